@@ -118,10 +118,13 @@ func NewRootCmd() *cobra.Command {
 	cmd.AddCommand(newVersionCmd())
 	cmd.AddCommand(newRunCmd())
 	cmd.AddCommand(newNewCmd())
+	cmd.AddCommand(newValidateCmd())
 	cmd.AddCommand(newEvalCmd())
 	cmd.AddCommand(newShareCmd())
 	cmd.AddCommand(newDebugCmd())
 	cmd.AddCommand(newAliasCmd())
+	cmd.AddCommand(newSessionCmd())
+	cmd.AddCommand(newUsageCmd())
 	cmd.AddCommand(newServeCmd())
 
 	// Define groups
@@ -32,6 +32,7 @@ import (
 
 type runExecFlags struct {
 	agentName         string
+	agentNameSet      bool // --agent was given on the command line
 	autoApprove       bool
 	attachmentPath    string
 	remoteAddress     string
@@ -135,6 +136,8 @@ func (f *runExecFlags) runRunCommand(cmd *cobra.Command, args []string) error {
 		telemetry.TrackCommand("run", args)
 	}
 
+	f.agentNameSet = cmd.Flags().Changed("agent")
+
 	ctx := cmd.Context()
 	out := cli.NewPrinter(cmd.OutOrStdout())
 
@@ -254,7 +257,12 @@ func (f *runExecFlags) runOrExec(ctx context.Context, out *cli.Printer, args []s
 		return err
 	}
 
-	rt, sess, err := f.createLocalRuntimeAndSession(ctx, loadResult)
+	teamRef, err := config.SourceRef(ctx, agentSource)
+	if err != nil {
+		slog.Debug("Failed to compute agent config reference", "source", agentSource.Name(), "error", err)
+	}
+
+	rt, sess, err := f.createLocalRuntimeAndSession(ctx, loadResult, teamRef)
 	if err != nil {
 		return err
 	}
@@ -348,7 +356,7 @@ func (f *runExecFlags) createRemoteRuntimeAndSession(ctx context.Context, origin
 	return remoteRt, sess, nil
 }
 
-func (f *runExecFlags) createLocalRuntimeAndSession(ctx context.Context, loadResult *teamloader.LoadResult) (runtime.Runtime, *session.Session, error) {
+func (f *runExecFlags) createLocalRuntimeAndSession(ctx context.Context, loadResult *teamloader.LoadResult, teamRef string) (runtime.Runtime, *session.Session, error) {
 	t := loadResult.Team
 
 	agent, err := t.Agent(f.agentName)
@@ -402,6 +410,15 @@ func (f *runExecFlags) createLocalRuntimeAndSession(ctx context.Context, loadRes
 		sess.ToolsApproved = f.autoApprove
 		sess.HideToolResults = f.hideToolResults
 
+		// Model overrides and commands of the session may not make sense with
+		// another configuration than the one that created it.
+		if sess.TeamRef != "" && teamRef != "" && sess.TeamRef != teamRef {
+			slog.Warn("Session was created with a different agent configuration", "session_id", resolvedID, "session_team_ref", sess.TeamRef, "team_ref", teamRef)
+		}
+		if teamRef != "" {
+			sess.TeamRef = teamRef
+		}
+
 		// Apply any stored model overrides from the session
 		if len(sess.AgentModelOverrides) > 0 {
 			if modelSwitcher, ok := localRt.(runtime.ModelSwitcher); ok {
@@ -413,10 +430,19 @@ func (f *runExecFlags) createLocalRuntimeAndSession(ctx context.Context, loadRes
 			}
 		}
 
-		slog.Debug("Loaded existing session", "session_id", resolvedID, "session_ref", f.sessionID, "agent", f.agentName)
+		// Continue with the agent the session was left with, e.g. after a
+		// handoff, unless another one was asked for.
+		if sess.CurrentAgent != "" && !f.agentNameSet {
+			if err := localRt.SetCurrentAgent(sess.CurrentAgent); err != nil {
+				slog.Warn("Failed to restore the current agent of the session", "session_id", resolvedID, "agent", sess.CurrentAgent, "error", err)
+			}
+		}
+
+		slog.Debug("Loaded existing session", "session_id", resolvedID, "session_ref", f.sessionID, "agent", localRt.CurrentAgentName())
 	} else {
 		wd, _ := os.Getwd()
-		sess = session.New(f.buildSessionOpts(agent.MaxIterations(), agent.ThinkingConfigured(), wd)...)
+		sessOpts := append(f.buildSessionOpts(agent.MaxIterations(), agent.ThinkingConfigured(), wd), session.WithTeamRef(teamRef))
+		sess = session.New(sessOpts...)
 		// Session is stored lazily on first UpdateSession call (when content is added)
 		// This avoids creating empty sessions in the database
 		slog.Debug("Using local runtime", "agent", f.agentName, "thinking", agent.ThinkingConfigured())
@@ -556,7 +582,12 @@ func (f *runExecFlags) createSessionSpawner(agentSource config.Source, sessStore
 		}
 
 		// Create a new session
-		newSess := session.New(f.buildSessionOpts(agent.MaxIterations(), agent.ThinkingConfigured(), workingDir)...)
+		teamRef, err := config.SourceRef(spawnCtx, agentSource)
+		if err != nil {
+			slog.Debug("Failed to compute agent config reference", "source", agentSource.Name(), "error", err)
+		}
+		sessOpts := append(f.buildSessionOpts(agent.MaxIterations(), agent.ThinkingConfigured(), workingDir), session.WithTeamRef(teamRef))
+		newSess := session.New(sessOpts...)
 
 		// Create cleanup function
 		cleanup := func() {
@@ -0,0 +1,186 @@
+package root
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/docker/cagent/pkg/app/transcript"
+	"github.com/docker/cagent/pkg/cli"
+	"github.com/docker/cagent/pkg/paths"
+	"github.com/docker/cagent/pkg/session"
+	"github.com/docker/cagent/pkg/telemetry"
+)
+
+func newSessionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "session",
+		Short: "Manage stored sessions",
+		Example: `  # Export a session as Markdown
+  cagent session export 0f9c2a1e-...
+
+  # Promote sub-sessions whose parent was deleted to root sessions
+  cagent session repair`,
+		GroupID: "advanced",
+	}
+
+	cmd.AddCommand(newSessionExportCmd())
+	cmd.AddCommand(newSessionRepairCmd())
+
+	return cmd
+}
+
+type sessionExportFlags struct {
+	sessionDB string
+	format    string
+}
+
+func newSessionExportCmd() *cobra.Command {
+	var flags sessionExportFlags
+
+	cmd := &cobra.Command{
+		Use:   "export <session-id>",
+		Short: "Export a session transcript",
+		Long: `Export the transcript of a stored session to stdout.
+
+Supported formats:
+
+  md    Markdown with headings, fenced tool calls and collapsible reasoning
+  text  Plain text transcript`,
+		Example: `  # Export a session as Markdown
+  cagent session export --format md 0f9c2a1e-... > session.md`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSessionExportCommand(cmd, args, &flags)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.sessionDB, "session-db", "s", filepath.Join(paths.GetHomeDir(), ".cagent", "session.db"), "Path to the session database")
+	cmd.Flags().StringVar(&flags.format, "format", "md", "Output format (md, text)")
+
+	return cmd
+}
+
+type sessionRepairFlags struct {
+	sessionDB string
+	delete    bool
+	dryRun    bool
+}
+
+func newSessionRepairCmd() *cobra.Command {
+	var flags sessionRepairFlags
+
+	cmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Repair orphaned sub-sessions",
+		Long: `Find sub-sessions whose parent session no longer exists and repair them.
+
+Orphaned sub-sessions never show up in session lists. By default they are
+promoted to root sessions; use --delete to delete them instead.`,
+		Example: `  # List orphaned sub-sessions without changing anything
+  cagent session repair --dry-run
+
+  # Delete orphaned sub-sessions
+  cagent session repair --delete`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runSessionRepairCommand(cmd, &flags)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.sessionDB, "session-db", "s", filepath.Join(paths.GetHomeDir(), ".cagent", "session.db"), "Path to the session database")
+	cmd.Flags().BoolVar(&flags.delete, "delete", false, "Delete orphaned sub-sessions instead of promoting them to root sessions")
+	cmd.Flags().BoolVar(&flags.dryRun, "dry-run", false, "Only list orphaned sub-sessions")
+
+	return cmd
+}
+
+func runSessionRepairCommand(cmd *cobra.Command, flags *sessionRepairFlags) error {
+	telemetry.TrackCommand("session", []string{"repair"})
+
+	ctx := cmd.Context()
+	out := cli.NewPrinter(cmd.OutOrStdout())
+
+	store, err := openSessionStore(flags.sessionDB)
+	if err != nil {
+		return err
+	}
+	defer closeSessionStore(store)
+
+	if flags.dryRun {
+		orphans, err := store.FindOrphanedSessions(ctx)
+		if err != nil {
+			return fmt.Errorf("finding orphaned sessions: %w", err)
+		}
+		for _, id := range orphans {
+			out.Println(id)
+		}
+		out.Printf("%d orphaned sub-session(s)\n", len(orphans))
+		return nil
+	}
+
+	repaired, err := store.RepairOrphans(ctx, !flags.delete)
+	if err != nil {
+		return fmt.Errorf("repairing orphaned sessions: %w", err)
+	}
+
+	if flags.delete {
+		out.Printf("Deleted %d orphaned sub-session(s)\n", repaired)
+	} else {
+		out.Printf("Promoted %d orphaned sub-session(s) to root sessions\n", repaired)
+	}
+	return nil
+}
+
+func openSessionStore(path string) (session.Store, error) {
+	sessionDB, err := expandTilde(path)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := session.NewSQLiteSessionStore(sessionDB)
+	if err != nil {
+		return nil, fmt.Errorf("opening session store: %w", err)
+	}
+	return store, nil
+}
+
+func closeSessionStore(store session.Store) {
+	if err := store.Close(); err != nil {
+		slog.Error("Failed to close session store", "error", err)
+	}
+}
+
+func runSessionExportCommand(cmd *cobra.Command, args []string, flags *sessionExportFlags) error {
+	telemetry.TrackCommand("session", append([]string{"export"}, args...))
+
+	ctx := cmd.Context()
+	out := cli.NewPrinter(cmd.OutOrStdout())
+
+	var render func(*session.Session) string
+	switch flags.format {
+	case "md", "markdown":
+		render = (*session.Session).ToMarkdown
+	case "text", "txt":
+		render = transcript.PlainText
+	default:
+		return fmt.Errorf("unsupported format %q (supported: md, text)", flags.format)
+	}
+
+	store, err := openSessionStore(flags.sessionDB)
+	if err != nil {
+		return err
+	}
+	defer closeSessionStore(store)
+
+	sess, err := store.GetSession(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("loading session %s: %w", args[0], err)
+	}
+
+	out.Println(strings.TrimRight(render(sess), "\n"))
+	return nil
+}
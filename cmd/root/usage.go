@@ -0,0 +1,98 @@
+package root
+
+import (
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/docker/cagent/pkg/paths"
+	"github.com/docker/cagent/pkg/telemetry"
+)
+
+func newUsageCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Report token and cost usage of stored sessions",
+		Example: `  # Export per-session usage as CSV
+  cagent usage export --format csv > usage.csv`,
+		GroupID: "advanced",
+	}
+
+	cmd.AddCommand(newUsageExportCmd())
+
+	return cmd
+}
+
+type usageExportFlags struct {
+	sessionDB string
+	format    string
+}
+
+func newUsageExportCmd() *cobra.Command {
+	var flags usageExportFlags
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export per-session usage",
+		Long: `Export the token usage and cost of every stored session to stdout, one row
+per session, newest first. The usage of sub-sessions is included in that of
+their root session.
+
+Supported formats:
+
+  csv   Comma-separated values with a header row`,
+		Example: `  # Export per-session usage as CSV
+  cagent usage export --format csv > usage.csv`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runUsageExportCommand(cmd, &flags)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.sessionDB, "session-db", "s", filepath.Join(paths.GetHomeDir(), ".cagent", "session.db"), "Path to the session database")
+	cmd.Flags().StringVar(&flags.format, "format", "csv", "Output format (csv)")
+
+	return cmd
+}
+
+func runUsageExportCommand(cmd *cobra.Command, flags *usageExportFlags) error {
+	telemetry.TrackCommand("usage", []string{"export"})
+
+	if flags.format != "csv" {
+		return fmt.Errorf("unsupported format %q (supported: csv)", flags.format)
+	}
+
+	ctx := cmd.Context()
+
+	store, err := openSessionStore(flags.sessionDB)
+	if err != nil {
+		return err
+	}
+	defer closeSessionStore(store)
+
+	rows, err := store.UsageRows(ctx)
+	if err != nil {
+		return fmt.Errorf("computing usage: %w", err)
+	}
+
+	w := csv.NewWriter(cmd.OutOrStdout())
+	_ = w.Write([]string{"session_id", "title", "created_at", "models", "input_tokens", "output_tokens", "cost"})
+	for _, row := range rows {
+		_ = w.Write([]string{
+			row.SessionID,
+			row.Title,
+			row.CreatedAt.Format(time.RFC3339),
+			strings.Join(row.Models, ";"),
+			strconv.FormatInt(row.InputTokens, 10),
+			strconv.FormatInt(row.OutputTokens, 10),
+			strconv.FormatFloat(row.Cost, 'f', 6, 64),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,71 @@
+package root
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/docker/cagent/pkg/cli"
+	"github.com/docker/cagent/pkg/config"
+	"github.com/docker/cagent/pkg/teamloader"
+	"github.com/docker/cagent/pkg/telemetry"
+)
+
+type validateFlags struct {
+	runConfig config.RuntimeConfig
+}
+
+func newValidateCmd() *cobra.Command {
+	var flags validateFlags
+
+	cmd := &cobra.Command{
+		Use:   "validate <agent-file>|<registry-ref>",
+		Short: "Check an agent configuration for problems without running it",
+		Long: `Load an agent configuration and report every problem found: sub-agents,
+handoffs and transfer targets that don't resolve, agents without a model and
+toolsets that can't be created. Toolsets are created but not started.`,
+		Example: `  cagent validate ./agent.yaml`,
+		GroupID: "core",
+		Args:    cobra.ExactArgs(1),
+		RunE:    flags.runValidateCommand,
+	}
+
+	addRuntimeConfigFlags(cmd, &flags.runConfig)
+
+	return cmd
+}
+
+func (f *validateFlags) runValidateCommand(cmd *cobra.Command, args []string) error {
+	telemetry.TrackCommand("validate", args)
+
+	ctx := cmd.Context()
+
+	agentSource, err := config.Resolve(args[0], f.runConfig.EnvProvider())
+	if err != nil {
+		return err
+	}
+
+	t, err := teamloader.Load(ctx, agentSource, &f.runConfig)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := t.StopToolSets(ctx); err != nil {
+			slog.Error("Failed to stop tool sets", "error", err)
+		}
+	}()
+
+	out := cli.NewPrinter(cmd.OutOrStdout())
+
+	errs := t.Validate(ctx)
+	if len(errs) == 0 {
+		out.Printf("%s is valid\n", args[0])
+		return nil
+	}
+
+	for _, err := range errs {
+		out.Println(" -", err)
+	}
+	return fmt.Errorf("%s has %d problem(s)", args[0], len(errs))
+}
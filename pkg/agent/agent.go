@@ -4,7 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"math/rand"
+	"os"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -16,16 +20,26 @@ import (
 
 // Agent represents an AI agent
 type Agent struct {
+	config
+	modelOverrides     atomic.Pointer[[]provider.Provider] // Optional model override(s) set at runtime (supports alloy)
+	warningsMu         sync.Mutex                          // Protects instructionFileErr and pendingWarnings
+	instructionFileErr string                              // Last error reading instructionFile, to warn only once
+	pendingWarnings    []string
+}
+
+// config holds the settings of an agent, which CloneWithModel copies as a
+// whole, as opposed to the state the agent updates while it runs.
+type config struct {
 	name                    string
 	description             string
 	welcomeMessage          string
 	instruction             string
+	instructionFile         string // Read on every call to Instruction when set
 	toolsets                []*tools.StartableToolSet
 	models                  []provider.Provider
-	fallbackModels          []provider.Provider                 // Fallback models to try if primary fails
-	fallbackRetries         int                                 // Number of retries per fallback model with exponential backoff
-	fallbackCooldown        time.Duration                       // Duration to stick with fallback after non-retryable error
-	modelOverrides          atomic.Pointer[[]provider.Provider] // Optional model override(s) set at runtime (supports alloy)
+	fallbackModels          []provider.Provider // Fallback models to try if primary fails
+	fallbackRetries         int                 // Number of retries per fallback model with exponential backoff
+	fallbackCooldown        time.Duration       // Duration to stick with fallback after non-retryable error
 	subAgents               []*Agent
 	handoffs                []*Agent
 	parents                 []*Agent
@@ -34,20 +48,36 @@ type Agent struct {
 	addDescriptionParameter bool
 	maxIterations           int
 	numHistoryItems         int
+	maxToolCallsPerTurn     int
+	transferKickoffMessage  string
+	allowedTransferTargets  []string // Agents this agent may transfer tasks to; empty means any sub-agent
+	stopSequences           []string // Sequences that make the model stop generating
 	addPromptFiles          []string
 	tools                   []tools.Tool
 	commands                types.Commands
-	pendingWarnings         []string
 	hooks                   *latest.HooksConfig
+	toolResultFormatter     ToolResultFormatter
 	thinkingConfigured      bool // true if thinking_budget was explicitly set in config
+	sanitizeToolOutput      bool // Strip ANSI escapes and control characters from tool results
+	promptCaching           bool // Mark the stable prefix of the prompt for providers that cache it
 }
 
+// ToolResultFormatter builds the content the model receives for the result
+// of a call to the named tool.
+type ToolResultFormatter func(toolName string, result *tools.ToolCallResult) string
+
+// defaultTransferKickoffMessage is the implicit user message used when a task
+// is transferred to an agent that doesn't configure its own.
+const defaultTransferKickoffMessage = "Please proceed."
+
 // New creates a new agent
 func New(name, prompt string, opts ...Opt) *Agent {
-	agent := &Agent{
-		name:        name,
-		instruction: prompt,
-	}
+	agent := &Agent{config: config{
+		name:               name,
+		instruction:        prompt,
+		sanitizeToolOutput: true,
+		promptCaching:      true,
+	}}
 
 	for _, opt := range opts {
 		opt(agent)
@@ -60,9 +90,31 @@ func (a *Agent) Name() string {
 	return a.name
 }
 
-// Instruction returns the agent's instructions
+// Instruction returns the agent's instructions. When the agent has an
+// instruction file, it's read on every call so that edits are picked up
+// without restarting. If it can't be read, a warning is recorded and the
+// inline instructions are returned instead.
 func (a *Agent) Instruction() string {
-	return a.instruction
+	if a.instructionFile == "" {
+		return a.instruction
+	}
+
+	content, err := os.ReadFile(a.instructionFile)
+
+	a.warningsMu.Lock()
+	defer a.warningsMu.Unlock()
+
+	if err != nil {
+		if msg := fmt.Sprintf("instruction file %s: %v", a.instructionFile, err); msg != a.instructionFileErr {
+			slog.Warn("Failed to read instruction file", "agent", a.Name(), "path", a.instructionFile, "error", err)
+			a.instructionFileErr = msg
+			a.pendingWarnings = append(a.pendingWarnings, msg)
+		}
+		return a.instruction
+	}
+
+	a.instructionFileErr = ""
+	return string(content)
 }
 
 func (a *Agent) AddDate() bool {
@@ -81,10 +133,65 @@ func (a *Agent) NumHistoryItems() int {
 	return a.numHistoryItems
 }
 
+// MaxToolCallsPerTurn returns the maximum number of tool calls executed per
+// model turn. Zero means unlimited.
+func (a *Agent) MaxToolCallsPerTurn() int {
+	return a.maxToolCallsPerTurn
+}
+
+// TransferKickoffMessage returns the implicit user message that starts a
+// session when a task is transferred to the agent.
+func (a *Agent) TransferKickoffMessage() string {
+	if a.transferKickoffMessage == "" {
+		return defaultTransferKickoffMessage
+	}
+	return a.transferKickoffMessage
+}
+
+// StopSequences returns the sequences that make the agent's model stop
+// generating.
+func (a *Agent) StopSequences() []string {
+	return a.stopSequences
+}
+
+// CanTransferTo reports whether the agent is allowed to transfer a task to
+// the named agent. Without an allow-list, any agent is allowed.
+func (a *Agent) CanTransferTo(name string) bool {
+	return len(a.allowedTransferTargets) == 0 || slices.Contains(a.allowedTransferTargets, name)
+}
+
+// AllowedTransferTargets returns the agents this agent may transfer tasks to,
+// empty when it may transfer to any of its sub-agents.
+func (a *Agent) AllowedTransferTargets() []string {
+	return a.allowedTransferTargets
+}
+
 func (a *Agent) AddPromptFiles() []string {
 	return a.addPromptFiles
 }
 
+// SanitizeToolOutput returns whether ANSI escapes and control characters are
+// stripped from the agent's tool results before they're added to the session.
+func (a *Agent) SanitizeToolOutput() bool {
+	return a.sanitizeToolOutput
+}
+
+// PromptCaching reports whether the stable prefix of the agent's prompt is
+// marked for prompt caching.
+func (a *Agent) PromptCaching() bool {
+	return a.promptCaching
+}
+
+// FormatToolResult returns the content the model receives for the result of
+// a call to the named tool: the tool's output, unless a ToolResultFormatter
+// was set.
+func (a *Agent) FormatToolResult(toolName string, result *tools.ToolCallResult) string {
+	if a.toolResultFormatter == nil {
+		return result.Output
+	}
+	return a.toolResultFormatter(toolName, result)
+}
+
 // ThinkingConfigured returns true if thinking_budget was explicitly set in the agent's config.
 // This is used to initialize session thinking state - thinking is only enabled by default
 // when the user explicitly configured it in their YAML.
@@ -133,6 +240,26 @@ func (a *Agent) Model() provider.Provider {
 	return a.models[rand.Intn(len(a.models))]
 }
 
+// CloneWithModel returns a copy of the agent that uses the given model
+// instead of its configured models and model override. The copy shares the
+// agent's toolsets, sub-agents and handoffs, but changing the copy doesn't
+// affect the original agent.
+func (a *Agent) CloneWithModel(model provider.Provider) *Agent {
+	c := &Agent{config: a.config}
+	c.models = []provider.Provider{model}
+	c.toolsets = slices.Clone(a.toolsets)
+	c.fallbackModels = slices.Clone(a.fallbackModels)
+	c.subAgents = slices.Clone(a.subAgents)
+	c.handoffs = slices.Clone(a.handoffs)
+	c.parents = slices.Clone(a.parents)
+	c.allowedTransferTargets = slices.Clone(a.allowedTransferTargets)
+	c.stopSequences = slices.Clone(a.stopSequences)
+	c.addPromptFiles = slices.Clone(a.addPromptFiles)
+	c.tools = slices.Clone(a.tools)
+	c.commands = maps.Clone(a.commands)
+	return c
+}
+
 // SetModelOverride sets runtime model override(s) for this agent.
 // The override(s) take precedence over the configured models.
 // For alloy models, multiple providers can be passed and one will be randomly selected.
@@ -252,11 +379,22 @@ func (a *Agent) addToolWarning(msg string) {
 	if msg == "" {
 		return
 	}
+	a.warningsMu.Lock()
+	defer a.warningsMu.Unlock()
 	a.pendingWarnings = append(a.pendingWarnings, msg)
 }
 
+// Warnings returns pending warnings without clearing them.
+func (a *Agent) Warnings() []string {
+	a.warningsMu.Lock()
+	defer a.warningsMu.Unlock()
+	return slices.Clone(a.pendingWarnings)
+}
+
 // DrainWarnings returns pending warnings and clears them.
 func (a *Agent) DrainWarnings() []string {
+	a.warningsMu.Lock()
+	defer a.warningsMu.Unlock()
 	if len(a.pendingWarnings) == 0 {
 		return nil
 	}
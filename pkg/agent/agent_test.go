@@ -3,6 +3,9 @@ package agent
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -139,6 +142,90 @@ func TestModelOverride(t *testing.T) {
 	assert.Equal(t, "openai/gpt-4o", model.ID())
 }
 
+func TestCloneWithModel(t *testing.T) {
+	t.Parallel()
+
+	baseModel := &mockProvider{id: "openai/gpt-4o"}
+	fastModel := &mockProvider{id: "openai/gpt-4o-mini"}
+	overrideModel := &mockProvider{id: "anthropic/claude-sonnet-4-0"}
+	toolSet := newStubToolSet(nil, []tools.Tool{{Name: "search"}}, nil)
+	sub := New("sub", "sub agent")
+
+	base := New("root", "instructions",
+		WithModel(baseModel),
+		WithToolSets(toolSet),
+		WithSubAgents(sub),
+		WithMaxIterations(7),
+		WithStopSequences("END"),
+		WithSanitizeToolOutput(false),
+		WithPromptCaching(false),
+		WithToolResultFormatter(func(toolName string, _ *tools.ToolCallResult) string { return "formatted " + toolName }),
+	)
+	base.SetModelOverride(overrideModel)
+
+	fast := base.CloneWithModel(fastModel)
+
+	assert.Equal(t, "root", fast.Name())
+	assert.Equal(t, "instructions", fast.Instruction())
+	assert.Equal(t, 7, fast.MaxIterations())
+	assert.Equal(t, "openai/gpt-4o-mini", fast.Model().ID())
+	assert.False(t, fast.HasModelOverride())
+	assert.Equal(t, []*Agent{sub}, fast.SubAgents())
+	assert.Equal(t, []string{"END"}, fast.StopSequences())
+	assert.False(t, fast.SanitizeToolOutput())
+	assert.False(t, fast.PromptCaching())
+	assert.Equal(t, "formatted search", fast.FormatToolResult("search", &tools.ToolCallResult{Output: "raw"}))
+
+	fastTools, err := fast.Tools(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "search", fastTools[0].Name)
+
+	// The original agent is left untouched.
+	assert.Equal(t, "anthropic/claude-sonnet-4-0", base.Model().ID())
+	assert.Equal(t, "openai/gpt-4o", base.ConfiguredModels()[0].ID())
+	WithSubAgents(New("other", "other agent"))(fast)
+	assert.Len(t, base.SubAgents(), 1)
+}
+
+func TestInstructionFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "instructions.md")
+	a := New("root", "inline instructions", WithInstructionFile(path))
+
+	// The file doesn't exist yet: warn once and fall back to the inline instructions.
+	assert.Equal(t, "inline instructions", a.Instruction())
+	assert.Equal(t, "inline instructions", a.Instruction())
+	warnings := a.DrainWarnings()
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "instructions.md")
+
+	require.NoError(t, os.WriteFile(path, []byte("You are a helpful assistant."), 0o644))
+	assert.Equal(t, "You are a helpful assistant.", a.Instruction())
+
+	require.NoError(t, os.WriteFile(path, []byte("You are a terse assistant."), 0o644))
+	assert.Equal(t, "You are a terse assistant.", a.Instruction())
+	assert.Equal(t, "You are a terse assistant.", a.CloneWithModel(&mockProvider{id: "openai/gpt-4o"}).Instruction())
+	assert.Empty(t, a.DrainWarnings())
+}
+
+func TestInstructionFile_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	a := New("root", "inline instructions", WithInstructionFile(filepath.Join(t.TempDir(), "missing.md")))
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			assert.Equal(t, "inline instructions", a.Instruction())
+			a.addToolWarning("toolset failed")
+			_ = a.Warnings()
+			_ = a.DrainWarnings()
+		})
+	}
+	wg.Wait()
+}
+
 func TestModelOverride_ConcurrentAccess(t *testing.T) {
 	t.Parallel()
 
@@ -17,6 +17,15 @@ func WithInstruction(instruction string) Opt {
 	}
 }
 
+// WithInstructionFile makes the agent read its instructions from the file at
+// path. The file is read when messages are built, not when the agent is
+// created, so editing it and starting a new session picks up the changes.
+func WithInstructionFile(path string) Opt {
+	return func(a *Agent) {
+		a.instructionFile = path
+	}
+}
+
 func WithToolSets(toolSet ...tools.ToolSet) Opt {
 	var startableToolSet []*tools.StartableToolSet
 	for _, ts := range toolSet {
@@ -133,6 +142,41 @@ func WithNumHistoryItems(numHistoryItems int) Opt {
 	}
 }
 
+// WithMaxToolCallsPerTurn limits how many tool calls are executed for a single
+// model response. Extra calls are rejected with an error result. Zero (the
+// default) means unlimited.
+func WithMaxToolCallsPerTurn(n int) Opt {
+	return func(a *Agent) {
+		a.maxToolCallsPerTurn = n
+	}
+}
+
+// WithTransferKickoffMessage sets the implicit user message that starts the
+// session when a task is transferred to the agent. It defaults to
+// "Please proceed.".
+func WithTransferKickoffMessage(msg string) Opt {
+	return func(a *Agent) {
+		a.transferKickoffMessage = msg
+	}
+}
+
+// WithAllowedTransferTargets restricts the agents this agent can transfer
+// tasks to. Without it, the agent can transfer to any of its sub-agents.
+func WithAllowedTransferTargets(names ...string) Opt {
+	return func(a *Agent) {
+		a.allowedTransferTargets = names
+	}
+}
+
+// WithStopSequences makes the agent's model stop generating as soon as it
+// emits one of the given sequences. Providers that don't support stop
+// sequences ignore them.
+func WithStopSequences(seqs ...string) Opt {
+	return func(a *Agent) {
+		a.stopSequences = seqs
+	}
+}
+
 func WithCommands(commands types.Commands) Opt {
 	return func(a *Agent) {
 		a.commands = commands
@@ -160,3 +204,32 @@ func WithThinkingConfigured(configured bool) Opt {
 		a.thinkingConfigured = configured
 	}
 }
+
+// WithSanitizeToolOutput sets whether ANSI escapes and control characters are
+// stripped from tool results before they're added to the session. It's on by
+// default: colored command output only wastes tokens and confuses models.
+func WithSanitizeToolOutput(sanitize bool) Opt {
+	return func(a *Agent) {
+		a.sanitizeToolOutput = sanitize
+	}
+}
+
+// WithToolResultFormatter sets how tool results are presented to the model,
+// for example wrapped in XML tags or as JSON, without changing the tools
+// themselves. The formatted content is still sanitized, see
+// WithSanitizeToolOutput.
+func WithToolResultFormatter(formatter ToolResultFormatter) Opt {
+	return func(a *Agent) {
+		a.toolResultFormatter = formatter
+	}
+}
+
+// WithPromptCaching sets whether the stable prefix of the prompt, the system
+// messages, is marked with chat.Message.CacheControl so that providers
+// supporting prompt caching, like Anthropic, can reuse it across requests.
+// It's on by default.
+func WithPromptCaching(enabled bool) Opt {
+	return func(a *Agent) {
+		a.promptCaching = enabled
+	}
+}
@@ -3,8 +3,10 @@ package app
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"os/exec"
 	"slices"
@@ -14,6 +16,7 @@ import (
 
 	tea "charm.land/bubbletea/v2"
 
+	"github.com/docker/cagent/pkg/agent"
 	"github.com/docker/cagent/pkg/app/export"
 	"github.com/docker/cagent/pkg/app/transcript"
 	"github.com/docker/cagent/pkg/chat"
@@ -37,6 +40,7 @@ type App struct {
 	events                 chan tea.Msg
 	throttleDuration       time.Duration
 	cancel                 context.CancelFunc
+	streamDone             chan struct{}           // Closed when the last stream started by startStream ends
 	currentAgentModel      string                  // Tracks the current agent's model ID from AgentInfoEvent
 	exitAfterFirstResponse bool                    // Exit TUI after first assistant response completes
 	titleGenerating        atomic.Bool             // True when title generation is in progress
@@ -177,9 +181,20 @@ func (a *App) SendFirstMessage() tea.Cmd {
 	return tea.Sequence(cmds...)
 }
 
-// CurrentAgentCommands returns the commands for the active agent
+// CurrentAgentCommands returns the commands for the active agent, merged with
+// the custom commands of the current session. Session commands win.
 func (a *App) CurrentAgentCommands(ctx context.Context) types.Commands {
-	return a.runtime.CurrentAgentInfo(ctx).Commands
+	commands := a.runtime.CurrentAgentInfo(ctx).Commands
+	if a.session == nil || len(a.session.Commands) == 0 {
+		return commands
+	}
+
+	merged := make(types.Commands, len(commands)+len(a.session.Commands))
+	maps.Copy(merged, commands)
+	for name, instruction := range a.session.Commands {
+		merged[name] = types.Command{Instruction: instruction}
+	}
+	return merged
 }
 
 // CurrentAgentSkills returns the available skills if skills are enabled for the current agent.
@@ -265,6 +280,11 @@ func (a *App) CurrentMCPPrompts(ctx context.Context) map[string]mcptools.PromptI
 	return a.runtime.CurrentMCPPrompts(ctx)
 }
 
+// CurrentAgentAuthStatus returns the OAuth state of the active agent's toolsets
+func (a *App) CurrentAgentAuthStatus(ctx context.Context) map[string]runtime.AuthStatus {
+	return a.runtime.CurrentAgentAuthStatus(ctx)
+}
+
 // ExecuteMCPPrompt executes an MCP prompt with provided arguments and returns the content
 func (a *App) ExecuteMCPPrompt(ctx context.Context, promptName string, arguments map[string]string) (string, error) {
 	return a.runtime.ExecuteMCPPrompt(ctx, promptName, arguments)
@@ -290,63 +310,145 @@ func (a *App) Run(ctx context.Context, cancel context.CancelFunc, message string
 		go a.generateTitle(ctx, []string{message})
 	}
 
-	go func() {
-		if len(attachments) > 0 {
-			// Build a single text string with the user's message and inlined text files.
-			// Keeping everything in one text block ensures the model sees file content
-			// together with the message, rather than as separate content blocks.
-			var textBuilder strings.Builder
-			textBuilder.WriteString(message)
-
-			// binaryParts holds non-text file parts (images, PDFs, etc.)
-			var binaryParts []chat.MessagePart
-
-			for _, att := range attachments {
-				switch {
-				case att.FilePath != "":
-					// File-reference attachment: read and classify from disk.
-					a.processFileAttachment(ctx, att, &textBuilder, &binaryParts)
-				case att.Content != "":
-					// Inline content attachment (e.g. pasted text).
-					a.processInlineAttachment(att, &textBuilder)
-				default:
-					slog.Debug("skipping attachment with no file path or content", "name", att.Name)
-				}
-			}
+	a.startStream(ctx, func() {
+		a.session.AddMessage(a.buildUserMessage(ctx, message, attachments))
+	})
+}
+
+// buildUserMessage builds a user message from the given text and attachments.
+func (a *App) buildUserMessage(ctx context.Context, message string, attachments []messages.Attachment) *session.Message {
+	if len(attachments) == 0 {
+		return session.UserMessage(message)
+	}
 
-			multiContent := []chat.MessagePart{
-				{Type: chat.MessagePartTypeText, Text: textBuilder.String()},
+	// Build a single text string with the user's message and inlined text files.
+	// Keeping everything in one text block ensures the model sees file content
+	// together with the message, rather than as separate content blocks.
+	var textBuilder strings.Builder
+	textBuilder.WriteString(message)
+
+	// binaryParts holds non-text file parts (images, PDFs, etc.)
+	var binaryParts []chat.MessagePart
+
+	// attached records the attachments that made it into the message so
+	// they're persisted with it.
+	var attached []session.Attachment
+
+	for _, att := range attachments {
+		switch {
+		case att.FilePath != "":
+			// File-reference attachment: read and classify from disk.
+			if stored, ok := a.processFileAttachment(ctx, att, &textBuilder, &binaryParts); ok {
+				attached = append(attached, stored)
 			}
-			multiContent = append(multiContent, binaryParts...)
+		case att.Content != "":
+			// Inline content attachment (e.g. pasted text).
+			a.processInlineAttachment(att, &textBuilder)
+			attached = append(attached, session.Attachment{Name: att.Name, MimeType: "text/plain", Content: att.Content})
+		default:
+			slog.Debug("skipping attachment with no file path or content", "name", att.Name)
+		}
+	}
 
-			a.session.AddMessage(session.UserMessage(message, multiContent...))
-		} else {
-			a.session.AddMessage(session.UserMessage(message))
+	multiContent := []chat.MessagePart{
+		{Type: chat.MessagePartTypeText, Text: textBuilder.String()},
+	}
+	multiContent = append(multiContent, binaryParts...)
+
+	msg := session.UserMessage(message, multiContent...)
+	msg.Attachments = attached
+	return msg
+}
+
+// startStream runs the current session in the background, after prepare if
+// it isn't nil, and forwards its events to the TUI.
+func (a *App) startStream(ctx context.Context, prepare func()) {
+	done := make(chan struct{})
+	a.streamDone = done
+	go func() {
+		defer close(done)
+		if prepare != nil {
+			prepare()
 		}
-		for event := range a.runtime.RunStream(ctx, a.session) {
-			// If context is cancelled, continue draining but don't forward events
-			// — except StreamStoppedEvent, which must always propagate so the
-			// supervisor can mark the session as no longer running.
-			if ctx.Err() != nil {
-				if _, ok := event.(*runtime.StreamStoppedEvent); ok {
-					a.sendEvent(context.Background(), event)
-				}
-				continue
-			}
+		a.runStream(ctx)
+	}()
+}
+
+// waitForStream waits for the last stream started by startStream to end.
+func (a *App) waitForStream(ctx context.Context) error {
+	if a.streamDone == nil {
+		return nil
+	}
+	select {
+	case <-a.streamDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-			// Clear titleGenerating flag when title is generated (from server for remote runtime)
-			if _, ok := event.(*runtime.SessionTitleEvent); ok {
-				a.titleGenerating.Store(false)
+// runStream runs the current session and forwards its events to the TUI.
+func (a *App) runStream(ctx context.Context) {
+	for event := range a.runtime.RunStream(ctx, a.session) {
+		// If context is cancelled, continue draining but don't forward events
+		// — except StreamStoppedEvent, which must always propagate so the
+		// supervisor can mark the session as no longer running.
+		if ctx.Err() != nil {
+			if _, ok := event.(*runtime.StreamStoppedEvent); ok {
+				a.sendEvent(context.Background(), event)
 			}
+			continue
+		}
 
-			a.sendEvent(ctx, event)
+		// Clear titleGenerating flag when title is generated (from server for remote runtime)
+		if _, ok := event.(*runtime.SessionTitleEvent); ok {
+			a.titleGenerating.Store(false)
 		}
-	}()
+
+		a.sendEvent(ctx, event)
+	}
+}
+
+// RewriteUserMessage replaces the user message at the given session position
+// and drops everything after it, both in the store and in the current session.
+// A canceled stream may still be appending to the session, so it waits for
+// the stream to end first. Call Rerun afterwards to get a new response to the
+// edited message.
+func (a *App) RewriteUserMessage(ctx context.Context, position int, message string, attachments []messages.Attachment) error {
+	store := a.SessionStore()
+	if store == nil {
+		return errors.New("no session store configured")
+	}
+
+	if err := a.waitForStream(ctx); err != nil {
+		return err
+	}
+
+	// The store sets the ID of the message, so that later updates find it.
+	item := session.NewMessageItem(a.buildUserMessage(ctx, message, attachments))
+	if err := store.RewriteItem(ctx, a.session.ID, position, item); err != nil {
+		return fmt.Errorf("rewriting message: %w", err)
+	}
+
+	// The in-memory store shares the session with the app, so these are no-ops there.
+	if err := a.session.ReplaceItem(position, item); err != nil {
+		return err
+	}
+	a.session.TruncateAfter(position)
+	return nil
+}
+
+// Rerun runs the current session again without adding a new user message.
+func (a *App) Rerun(ctx context.Context, cancel context.CancelFunc) {
+	a.cancel = cancel
+	a.startStream(ctx, nil)
 }
 
 // processFileAttachment reads a file from disk, classifies it, and either
 // appends its text content to textBuilder or adds a binary part to binaryParts.
-func (a *App) processFileAttachment(ctx context.Context, att messages.Attachment, textBuilder *strings.Builder, binaryParts *[]chat.MessagePart) {
+// It returns the attachment to persist with the message, and false when the
+// file was skipped.
+func (a *App) processFileAttachment(ctx context.Context, att messages.Attachment, textBuilder *strings.Builder, binaryParts *[]chat.MessagePart) (session.Attachment, bool) {
 	absPath := att.FilePath
 
 	fi, err := os.Stat(absPath)
@@ -362,20 +464,20 @@ func (a *App) processFileAttachment(ctx context.Context, att messages.Attachment
 		}
 		slog.Warn("skipping attachment", "path", absPath, "reason", reason)
 		a.sendEvent(ctx, runtime.Warning(fmt.Sprintf("Skipped attachment %s: %s", att.Name, reason), ""))
-		return
+		return session.Attachment{}, false
 	}
 
 	if !fi.Mode().IsRegular() {
 		slog.Warn("skipping attachment: not a regular file", "path", absPath, "mode", fi.Mode().String())
 		a.sendEvent(ctx, runtime.Warning(fmt.Sprintf("Skipped attachment %s: not a regular file", att.Name), ""))
-		return
+		return session.Attachment{}, false
 	}
 
 	const maxAttachmentSize = 100 * 1024 * 1024 // 100MB
 	if fi.Size() > maxAttachmentSize {
 		slog.Warn("skipping attachment: file too large", "path", absPath, "size", fi.Size(), "max", maxAttachmentSize)
 		a.sendEvent(ctx, runtime.Warning(fmt.Sprintf("Skipped attachment %s: file too large (max 100MB)", att.Name), ""))
-		return
+		return session.Attachment{}, false
 	}
 
 	mimeType := chat.DetectMimeType(absPath)
@@ -385,13 +487,13 @@ func (a *App) processFileAttachment(ctx context.Context, att messages.Attachment
 		if fi.Size() > chat.MaxInlineFileSize {
 			slog.Warn("skipping attachment: text file too large to inline", "path", absPath, "size", fi.Size(), "max", chat.MaxInlineFileSize)
 			a.sendEvent(ctx, runtime.Warning(fmt.Sprintf("Skipped attachment %s: text file too large to inline (max 5MB)", att.Name), ""))
-			return
+			return session.Attachment{}, false
 		}
 		content, err := chat.ReadFileForInline(absPath)
 		if err != nil {
 			slog.Warn("skipping attachment: failed to read file", "path", absPath, "error", err)
 			a.sendEvent(ctx, runtime.Warning(fmt.Sprintf("Skipped attachment %s: failed to read file", att.Name), ""))
-			return
+			return session.Attachment{}, false
 		}
 		textBuilder.WriteString("\n\n")
 		textBuilder.WriteString(content)
@@ -404,14 +506,14 @@ func (a *App) processFileAttachment(ctx context.Context, att messages.Attachment
 			if readErr != nil {
 				slog.Warn("skipping attachment: failed to read image", "path", absPath, "error", readErr)
 				a.sendEvent(ctx, runtime.Warning(fmt.Sprintf("Skipped attachment %s: failed to read image", att.Name), ""))
-				return
+				return session.Attachment{}, false
 			}
 			resized, resizeErr := chat.ResizeImage(imgData, mimeType)
 			if resizeErr != nil {
 				// Don't bypass security checks - reject the file if resize failed
 				slog.Warn("skipping attachment: image resize failed", "path", absPath, "error", resizeErr)
 				a.sendEvent(ctx, runtime.Warning(fmt.Sprintf("Skipped attachment %s: %s", att.Name, resizeErr), ""))
-				return
+				return session.Attachment{}, false
 			}
 			dataURL := fmt.Sprintf("data:%s;base64,%s", resized.MimeType, base64.StdEncoding.EncodeToString(resized.Data))
 			*binaryParts = append(*binaryParts, chat.MessagePart{
@@ -438,7 +540,10 @@ func (a *App) processFileAttachment(ctx context.Context, att messages.Attachment
 	default:
 		slog.Warn("skipping attachment: unsupported file type", "path", absPath, "mime_type", mimeType)
 		a.sendEvent(ctx, runtime.Warning(fmt.Sprintf("Skipped attachment %s: unsupported file type", att.Name), ""))
+		return session.Attachment{}, false
 	}
+
+	return session.Attachment{Name: att.Name, MimeType: mimeType, Path: absPath}, true
 }
 
 // sendEvent sends an event to the TUI, respecting context cancellation to
@@ -478,27 +583,9 @@ func (a *App) RunWithMessage(ctx context.Context, cancel context.CancelFunc, msg
 		go a.generateTitle(ctx, []string{userMessage})
 	}
 
-	go func() {
+	a.startStream(ctx, func() {
 		a.session.AddMessage(msg)
-		for event := range a.runtime.RunStream(ctx, a.session) {
-			// If context is cancelled, continue draining but don't forward events
-			// — except StreamStoppedEvent, which must always propagate so the
-			// supervisor can mark the session as no longer running.
-			if ctx.Err() != nil {
-				if _, ok := event.(*runtime.StreamStoppedEvent); ok {
-					a.sendEvent(context.Background(), event)
-				}
-				continue
-			}
-
-			// Clear titleGenerating flag when title is generated (from server for remote runtime)
-			if _, ok := event.(*runtime.SessionTitleEvent); ok {
-				a.titleGenerating.Store(false)
-			}
-
-			a.sendEvent(ctx, event)
-		}
-	}()
+	})
 }
 
 func (a *App) RunBangCommand(ctx context.Context, command string) {
@@ -559,6 +646,7 @@ func (a *App) NewSession() {
 			session.WithToolsApproved(a.session.ToolsApproved),
 			session.WithHideToolResults(a.session.HideToolResults),
 			session.WithWorkingDir(a.session.WorkingDir),
+			session.WithTeamRef(a.session.TeamRef),
 		)
 	}
 	a.session = session.New(opts...)
@@ -811,10 +899,31 @@ func (a *App) CompactSession(ctx context.Context, additionalPrompt string) {
 	}()
 }
 
+// CancelCompaction cancels the in-flight compaction of the session, if any,
+// and reports whether there was one.
+func (a *App) CancelCompaction() bool {
+	return a.runtime.CancelCompaction()
+}
+
 func (a *App) PlainTextTranscript() string {
 	return transcript.PlainText(a.session)
 }
 
+// PlainTextTranscriptWithSystem renders the session like PlainTextTranscript,
+// with the system messages and, when the runtime runs the agents locally,
+// the system prompt of the current agent.
+func (a *App) PlainTextTranscriptWithSystem() string {
+	opts := transcript.Options{
+		IncludeToolCalls:   true,
+		IncludeToolResults: true,
+		IncludeSystem:      true,
+	}
+	if local, ok := a.runtime.(interface{ CurrentAgent() *agent.Agent }); ok {
+		opts.Agent = local.CurrentAgent()
+	}
+	return transcript.PlainTextWithOptions(a.session, opts)
+}
+
 // SessionStore returns the session store for browsing/loading sessions.
 // Returns nil if no session store is configured.
 func (a *App) SessionStore() session.Store {
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/docker/cagent/pkg/config/types"
 	"github.com/docker/cagent/pkg/runtime"
 	"github.com/docker/cagent/pkg/session"
 	"github.com/docker/cagent/pkg/sessiontitle"
@@ -47,6 +48,7 @@ func (m *mockRuntime) ResumeElicitation(ctx context.Context, action tools.Elicit
 func (m *mockRuntime) SessionStore() session.Store { return nil }
 func (m *mockRuntime) Summarize(ctx context.Context, sess *session.Session, additionalPrompt string, events chan runtime.Event) {
 }
+func (m *mockRuntime) CancelCompaction() bool                    { return false }
 func (m *mockRuntime) PermissionsInfo() *runtime.PermissionsInfo { return nil }
 func (m *mockRuntime) CurrentAgentSkillsToolset() *builtin.SkillsToolset {
 	return nil
@@ -56,6 +58,10 @@ func (m *mockRuntime) CurrentMCPPrompts(context.Context) map[string]mcptools.Pro
 	return make(map[string]mcptools.PromptInfo)
 }
 
+func (m *mockRuntime) CurrentAgentAuthStatus(context.Context) map[string]runtime.AuthStatus {
+	return make(map[string]runtime.AuthStatus)
+}
+
 func (m *mockRuntime) ExecuteMCPPrompt(context.Context, string, map[string]string) (string, error) {
 	return "", nil
 }
@@ -319,3 +325,33 @@ func TestApp_RegenerateSessionTitle(t *testing.T) {
 		require.ErrorIs(t, err, ErrTitleGenerating)
 	})
 }
+
+type commandsRuntime struct {
+	mockRuntime
+	commands types.Commands
+}
+
+func (m *commandsRuntime) CurrentAgentInfo(context.Context) runtime.CurrentAgentInfo {
+	return runtime.CurrentAgentInfo{Commands: m.commands}
+}
+
+func TestApp_CurrentAgentCommands_MergesSessionCommands(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	rt := &commandsRuntime{commands: types.Commands{
+		"df":  {Instruction: "check disk space"},
+		"fix": {Description: "Fix lint", Instruction: "fix the lint issues"},
+	}}
+	sess := session.New()
+	sess.Commands = map[string]string{"fix": "fix the tests", "ls": "list files"}
+	app := New(ctx, rt, sess)
+
+	commands := app.CurrentAgentCommands(ctx)
+	assert.Equal(t, types.Commands{
+		"df":  {Instruction: "check disk space"},
+		"fix": {Instruction: "fix the tests"},
+		"ls":  {Instruction: "list files"},
+	}, commands)
+	assert.Len(t, rt.commands, 2, "agent commands must not be modified")
+}
@@ -5,39 +5,103 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/docker/cagent/pkg/agent"
 	"github.com/docker/cagent/pkg/chat"
 	"github.com/docker/cagent/pkg/session"
 )
 
+// Options controls what a plain text transcript contains.
+type Options struct {
+	// IncludeToolCalls includes the tool calls requested by assistant messages.
+	IncludeToolCalls bool
+	// IncludeToolResults includes the results of tool calls.
+	IncludeToolResults bool
+	// IncludeSystem includes system messages: the system prompt of Agent,
+	// when set, followed by the system messages stored in the session.
+	IncludeSystem bool
+	// Agent is the agent whose system prompt IncludeSystem adds.
+	Agent *agent.Agent
+}
+
+// PlainText renders the session as a plain text transcript including tool
+// calls and their results.
 func PlainText(sess *session.Session) string {
+	return PlainTextWithOptions(sess, Options{
+		IncludeToolCalls:   true,
+		IncludeToolResults: true,
+	})
+}
+
+// PlainTextWithOptions renders the session as a plain text transcript.
+// Assistant turns are labeled with the name of their agent and sub-sessions
+// are indented under their own heading.
+func PlainTextWithOptions(sess *session.Session, opts Options) string {
 	var builder strings.Builder
+	if opts.IncludeSystem && opts.Agent != nil {
+		for _, msg := range sess.SystemPrompt(opts.Agent) {
+			writeSystemMessage(&builder, msg.Content)
+		}
+	}
+	writeSession(&builder, sess, opts)
+	return strings.TrimSpace(builder.String())
+}
 
-	messages := sess.GetAllMessages()
-	for i := range messages {
-		msg := messages[i]
+func writeSession(builder *strings.Builder, sess *session.Session, opts Options) {
+	for _, item := range sess.Items() {
+		switch {
+		case item.IsMessage():
+			msg := *item.Message
+			if msg.Implicit {
+				continue
+			}
 
-		if msg.Implicit {
-			continue
+			switch msg.Message.Role {
+			case chat.MessageRoleSystem:
+				if opts.IncludeSystem {
+					writeSystemMessage(builder, msg.Message.Content)
+				}
+			case chat.MessageRoleUser:
+				writeUserMessage(builder, msg)
+			case chat.MessageRoleAssistant:
+				writeAssistantMessage(builder, msg, opts)
+			case chat.MessageRoleTool:
+				if opts.IncludeToolResults {
+					writeToolMessage(builder, msg)
+				}
+			}
+		case item.IsSubSession():
+			writeSubSession(builder, item.SubSession, opts)
 		}
+	}
+}
 
-		switch msg.Message.Role {
-		case chat.MessageRoleUser:
-			writeUserMessage(&builder, msg)
-		case chat.MessageRoleAssistant:
-			writeAssistantMessage(&builder, msg)
-		case chat.MessageRoleTool:
-			writeToolMessage(&builder, msg)
+func writeSubSession(builder *strings.Builder, sub *session.Session, opts Options) {
+	builder.WriteString("\n## Sub-session")
+	if sub.Title != "" {
+		fmt.Fprintf(builder, ": %s", sub.Title)
+	}
+	builder.WriteString("\n\n")
+
+	var subBuilder strings.Builder
+	writeSession(&subBuilder, sub, opts)
+	for line := range strings.SplitSeq(strings.TrimSpace(subBuilder.String()), "\n") {
+		if line != "" {
+			builder.WriteString("  ")
+			builder.WriteString(line)
 		}
+		builder.WriteString("\n")
 	}
+}
 
-	return strings.TrimSpace(builder.String())
+func writeSystemMessage(builder *strings.Builder, content string) {
+	fmt.Fprintf(builder, "\n## System\n\n%s\n", content)
 }
 
 func writeUserMessage(builder *strings.Builder, msg session.Message) {
 	fmt.Fprintf(builder, "\n## User\n\n%s\n", msg.Message.Content)
 }
 
-func writeAssistantMessage(builder *strings.Builder, msg session.Message) {
+func writeAssistantMessage(builder *strings.Builder, msg session.Message, opts Options) {
 	builder.WriteString("\n## Assistant")
 	if msg.AgentName != "" {
 		fmt.Fprintf(builder, " (%s)", msg.AgentName)
@@ -55,7 +119,7 @@ func writeAssistantMessage(builder *strings.Builder, msg session.Message) {
 		builder.WriteString("\n")
 	}
 
-	if len(msg.Message.ToolCalls) > 0 {
+	if opts.IncludeToolCalls && len(msg.Message.ToolCalls) > 0 {
 		builder.WriteString("\n### Tool Calls\n\n")
 		for _, toolCall := range msg.Message.ToolCalls {
 			fmt.Fprintf(builder, "- **%s**", toolCall.Function.Name)
@@ -3,8 +3,10 @@ package transcript
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"gotest.tools/v3/golden"
 
+	"github.com/docker/cagent/pkg/agent"
 	"github.com/docker/cagent/pkg/chat"
 	"github.com/docker/cagent/pkg/session"
 	"github.com/docker/cagent/pkg/tools"
@@ -75,3 +77,106 @@ func TestToolCalls(t *testing.T) {
 
 	golden.Assert(t, content, "tool_calls.golden")
 }
+
+func TestSubSession(t *testing.T) {
+	sess := session.New(
+		session.WithUserMessage("Find me a book"),
+	)
+	sess.AddMessage(&session.Message{
+		AgentName: "root",
+		Message: chat.Message{
+			Role:    chat.MessageRoleAssistant,
+			Content: "Asking the librarian",
+		},
+	})
+
+	sub := session.New(
+		session.WithTitle("Transferred task"),
+		session.WithImplicitUserMessage("Please proceed."),
+	)
+	sub.AddMessage(&session.Message{
+		AgentName: "librarian",
+		Message: chat.Message{
+			Role:    chat.MessageRoleAssistant,
+			Content: "Try Dune",
+		},
+	})
+	sess.AddSubSession(sub)
+
+	sess.AddMessage(&session.Message{
+		AgentName: "root",
+		Message: chat.Message{
+			Role:    chat.MessageRoleAssistant,
+			Content: "The librarian suggests Dune",
+		},
+	})
+
+	content := PlainText(sess)
+	golden.Assert(t, content, "sub_session.golden")
+}
+
+func TestWithoutTools(t *testing.T) {
+	sess := session.New(
+		session.WithUserMessage("Hello"),
+	)
+	sess.AddMessage(&session.Message{
+		AgentName: "root",
+		Message: chat.Message{
+			Role:    chat.MessageRoleAssistant,
+			Content: "Hello to you too",
+			ToolCalls: []tools.ToolCall{
+				{
+					Function: tools.FunctionCall{Name: "shell", Arguments: `{"cmd":"ls"}`},
+				},
+			},
+		},
+	})
+	sess.AddMessage(&session.Message{
+		Message: chat.Message{
+			Role:    chat.MessageRoleTool,
+			Content: ".\n..",
+		},
+	})
+
+	content := PlainTextWithOptions(sess, Options{})
+	golden.Assert(t, content, "assistant_message.golden")
+}
+
+func TestSystemMessages(t *testing.T) {
+	sess := session.New(
+		session.WithSystemMessage("Answer in French"),
+		session.WithUserMessage("Hello"),
+	)
+	sess.AddMessage(&session.Message{
+		AgentName: "root",
+		Message: chat.Message{
+			Role:    chat.MessageRoleAssistant,
+			Content: "Bonjour",
+		},
+	})
+
+	// System messages are left out by default.
+	assert.NotContains(t, PlainText(sess), "French")
+
+	content := PlainTextWithOptions(sess, Options{
+		IncludeSystem: true,
+		Agent:         agent.New("root", "You are a polite assistant"),
+	})
+	golden.Assert(t, content, "system_messages.golden")
+}
+
+func TestConcurrentStream(t *testing.T) {
+	sess := session.New(session.WithUserMessage("Hello"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			sess.AddMessage(session.UserMessage("Hello again"))
+		}
+	}()
+	for range 100 {
+		assert.Contains(t, PlainText(sess), "Hello")
+	}
+	<-done
+}
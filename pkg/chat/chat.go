@@ -78,6 +78,10 @@ type Message struct {
 	// IsError indicates the tool call failed (only for Role=tool messages).
 	IsError bool `json:"is_error,omitempty"`
 
+	// ToolCategory is the category of the tool that produced the result
+	// (only for Role=tool messages).
+	ToolCategory string `json:"tool_category,omitempty"`
+
 	CreatedAt string `json:"created_at,omitempty"`
 
 	// Usage tracks token usage for this message (only set for assistant messages)
@@ -89,6 +93,10 @@ type Message struct {
 	// Cost is the cost of this message in dollars (only set for assistant messages)
 	Cost float64 `json:"cost,omitempty"`
 
+	// FinishReason is why the model stopped generating this message (only set
+	// for assistant messages)
+	FinishReason FinishReason `json:"finish_reason,omitempty"`
+
 	// CacheControl indicates whether this message is a cached message (only used by anthropic)
 	CacheControl bool `json:"cache_control,omitempty"`
 }
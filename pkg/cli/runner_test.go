@@ -42,12 +42,17 @@ func (m *mockRuntime) ResumeElicitation(context.Context, tools.ElicitationAction
 }
 func (m *mockRuntime) SessionStore() session.Store                                             { return nil }
 func (m *mockRuntime) Summarize(context.Context, *session.Session, string, chan runtime.Event) {}
+func (m *mockRuntime) CancelCompaction() bool                                                  { return false }
 func (m *mockRuntime) PermissionsInfo() *runtime.PermissionsInfo                               { return nil }
 func (m *mockRuntime) CurrentAgentSkillsToolset() *builtin.SkillsToolset                       { return nil }
 func (m *mockRuntime) CurrentMCPPrompts(context.Context) map[string]mcptools.PromptInfo {
 	return nil
 }
 
+func (m *mockRuntime) CurrentAgentAuthStatus(context.Context) map[string]runtime.AuthStatus {
+	return nil
+}
+
 func (m *mockRuntime) ExecuteMCPPrompt(context.Context, string, map[string]string) (string, error) {
 	return "", nil
 }
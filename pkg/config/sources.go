@@ -30,6 +30,17 @@ type Source interface {
 
 type Sources map[string]Source
 
+// SourceRef identifies both a source and its current content, as
+// "<name>@sha256:<digest>". Two refs with the same name but different digests
+// mean that the configuration changed.
+func SourceRef(ctx context.Context, source Source) (string, error) {
+	data, err := source.Read(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s@sha256:%x", source.Name(), sha256.Sum256(data)), nil
+}
+
 // fileSource is used to load an agent configuration from a YAML file.
 type fileSource struct {
 	path string
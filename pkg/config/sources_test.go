@@ -474,3 +474,19 @@ func TestResolveSources_URLReference_WithEnvProvider(t *testing.T) {
 	require.True(t, ok)
 	assert.NotNil(t, urlSrc.envProvider)
 }
+
+func TestSourceRef(t *testing.T) {
+	t.Parallel()
+
+	ref, err := SourceRef(t.Context(), NewBytesSource("agent.yaml", []byte("version: 1")))
+	require.NoError(t, err)
+	assert.Equal(t, "agent.yaml@sha256:1a6ddd3533d91cae4b3742d4294fb07ee863a4d667fe598f01365bd68a18bcfd", ref)
+
+	same, err := SourceRef(t.Context(), NewBytesSource("agent.yaml", []byte("version: 1")))
+	require.NoError(t, err)
+	assert.Equal(t, ref, same)
+
+	changed, err := SourceRef(t.Context(), NewBytesSource("agent.yaml", []byte("version: 2")))
+	require.NoError(t, err)
+	assert.NotEqual(t, ref, changed)
+}
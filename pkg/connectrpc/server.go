@@ -493,6 +493,11 @@ func runtimeEventToProto(event runtime.Event) *cagentv1.Event {
 			},
 		}
 
+	case *runtime.ToolCallArgsDeltaEvent:
+		// Not part of the protocol: PartialToolCall already carries the
+		// accumulated arguments.
+		return nil
+
 	case *runtime.ToolCallEvent:
 		return &cagentv1.Event{
 			Event: &cagentv1.Event_ToolCall{
@@ -0,0 +1,123 @@
+package evaluation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/docker/cagent/pkg/session"
+)
+
+// Assertion is a check run against a session, for example a saved eval.
+type Assertion interface {
+	// Description tells what the assertion checks, e.g. "at most 3 tool calls".
+	Description() string
+	// Check returns why the session fails the assertion, or an empty string
+	// if it passes. An error means the check itself couldn't be run.
+	Check(sess *session.Session) (failure string, err error)
+}
+
+// Rubric is a named set of assertions a session is scored against.
+type Rubric struct {
+	Name       string
+	Assertions []Assertion
+}
+
+// AssertionResult is the outcome of a single assertion.
+type AssertionResult struct {
+	Assertion string `json:"assertion"`
+	Passed    bool   `json:"passed"`
+	Failure   string `json:"failure,omitempty"`
+}
+
+// ScoreResult is the outcome of scoring a session against a rubric.
+type ScoreResult struct {
+	Rubric  string            `json:"rubric"`
+	Passed  bool              `json:"passed"`
+	Score   float64           `json:"score"` // Ratio of passed assertions, 1 for an empty rubric
+	Results []AssertionResult `json:"results"`
+}
+
+// Score runs the assertions of the rubric against the session. The session
+// passes if every assertion does.
+func Score(sess *session.Session, rubric Rubric) (ScoreResult, error) {
+	if sess == nil {
+		return ScoreResult{}, errors.New("session is nil")
+	}
+
+	result := ScoreResult{
+		Rubric:  rubric.Name,
+		Passed:  true,
+		Score:   1,
+		Results: make([]AssertionResult, 0, len(rubric.Assertions)),
+	}
+
+	var passed int
+	for _, assertion := range rubric.Assertions {
+		failure, err := assertion.Check(sess)
+		if err != nil {
+			return ScoreResult{}, fmt.Errorf("checking %q: %w", assertion.Description(), err)
+		}
+		if failure == "" {
+			passed++
+		} else {
+			result.Passed = false
+		}
+		result.Results = append(result.Results, AssertionResult{
+			Assertion: assertion.Description(),
+			Passed:    failure == "",
+			Failure:   failure,
+		})
+	}
+	if len(rubric.Assertions) > 0 {
+		result.Score = float64(passed) / float64(len(rubric.Assertions))
+	}
+
+	return result, nil
+}
+
+type assertionFunc struct {
+	description string
+	check       func(*session.Session) (string, error)
+}
+
+func (a assertionFunc) Description() string { return a.description }
+
+func (a assertionFunc) Check(sess *session.Session) (string, error) { return a.check(sess) }
+
+// NewAssertion returns an Assertion running check.
+func NewAssertion(description string, check func(sess *session.Session) (failure string, err error)) Assertion {
+	return assertionFunc{description: description, check: check}
+}
+
+// FinalMessageContains asserts that the last assistant message contains text.
+func FinalMessageContains(text string) Assertion {
+	return NewAssertion(fmt.Sprintf("final message contains %q", text), func(sess *session.Session) (string, error) {
+		if strings.Contains(sess.GetLastAssistantMessageContent(), text) {
+			return "", nil
+		}
+		return fmt.Sprintf("final message doesn't contain %q", text), nil
+	})
+}
+
+// MaxToolCalls asserts that the session, sub-sessions included, made at most
+// n tool calls.
+func MaxToolCalls(n int) Assertion {
+	return NewAssertion(fmt.Sprintf("at most %d tool calls", n), func(sess *session.Session) (string, error) {
+		if count := len(extractToolCalls(sess.Messages)); count > n {
+			return fmt.Sprintf("%d tool calls", count), nil
+		}
+		return "", nil
+	})
+}
+
+// MaxCost asserts that the session, sub-sessions included, cost at most
+// maxUSD.
+func MaxCost(maxUSD float64) Assertion {
+	return NewAssertion(fmt.Sprintf("cost at most $%.4f", maxUSD), func(sess *session.Session) (string, error) {
+		if cost := sess.TotalCost(); cost > maxUSD {
+			return fmt.Sprintf("cost $%.4f", cost), nil
+		}
+		return "", nil
+	})
+}
@@ -0,0 +1,83 @@
+package evaluation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/session"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+func newRubricTestSession() *session.Session {
+	sess := session.New(session.WithUserMessage("What's in the README?"))
+	sess.AddMessage(&session.Message{
+		AgentName: "root",
+		Message: chat.Message{
+			Role:      chat.MessageRoleAssistant,
+			ToolCalls: []tools.ToolCall{{ID: "1", Function: tools.FunctionCall{Name: "read_file"}}, {ID: "2", Function: tools.FunctionCall{Name: "read_file"}}},
+			Cost:      0.02,
+		},
+	})
+	sess.AddMessage(&session.Message{
+		AgentName: "root",
+		Message:   chat.Message{Role: chat.MessageRoleAssistant, Content: "The README explains how to install cagent.", Cost: 0.01},
+	})
+	return sess
+}
+
+func TestScore(t *testing.T) {
+	sess := newRubricTestSession()
+
+	result, err := Score(sess, Rubric{
+		Name: "readme",
+		Assertions: []Assertion{
+			FinalMessageContains("install"),
+			FinalMessageContains("uninstall"),
+			MaxToolCalls(2),
+			MaxToolCalls(1),
+			MaxCost(0.05),
+			MaxCost(0.01),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "readme", result.Rubric)
+	assert.False(t, result.Passed)
+	assert.InDelta(t, 0.5, result.Score, 0.001)
+	assert.Equal(t, []AssertionResult{
+		{Assertion: `final message contains "install"`, Passed: true},
+		{Assertion: `final message contains "uninstall"`, Failure: `final message doesn't contain "uninstall"`},
+		{Assertion: "at most 2 tool calls", Passed: true},
+		{Assertion: "at most 1 tool calls", Failure: "2 tool calls"},
+		{Assertion: "cost at most $0.0500", Passed: true},
+		{Assertion: "cost at most $0.0100", Failure: "cost $0.0300"},
+	}, result.Results)
+}
+
+func TestScoreCustomAssertion(t *testing.T) {
+	sess := newRubricTestSession()
+
+	answered := NewAssertion("answered", func(sess *session.Session) (string, error) {
+		if sess.GetLastAssistantMessageContent() == "" {
+			return "no answer", nil
+		}
+		return "", nil
+	})
+	result, err := Score(sess, Rubric{Assertions: []Assertion{answered}})
+	require.NoError(t, err)
+	assert.True(t, result.Passed)
+	assert.InDelta(t, 1.0, result.Score, 0.001)
+
+	broken := NewAssertion("broken", func(*session.Session) (string, error) {
+		return "", errors.New("boom")
+	})
+	_, err = Score(sess, Rubric{Assertions: []Assertion{answered, broken}})
+	require.ErrorContains(t, err, `checking "broken": boom`)
+
+	_, err = Score(nil, Rubric{})
+	require.Error(t, err)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/anthropics/anthropic-sdk-go/shared"
 
 	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/model/provider/base"
 	"github.com/docker/cagent/pkg/tools"
 )
 
@@ -83,6 +84,9 @@ func (a *streamAdapter) Recv() (chat.MessageStreamResponse, error) {
 				return a.Recv()
 			}
 		}
+		if isContextLengthError(err) {
+			return chat.MessageStreamResponse{}, base.WrapContextExceeded(err)
+		}
 		if err != nil {
 			return chat.MessageStreamResponse{}, err
 		}
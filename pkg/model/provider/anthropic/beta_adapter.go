@@ -10,6 +10,7 @@ import (
 	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
 
 	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/model/provider/base"
 	"github.com/docker/cagent/pkg/tools"
 )
 
@@ -47,6 +48,9 @@ func (a *betaStreamAdapter) Recv() (chat.MessageStreamResponse, error) {
 				return a.Recv()
 			}
 		}
+		if isContextLengthError(err) {
+			return chat.MessageStreamResponse{}, base.WrapContextExceeded(err)
+		}
 		if err != nil {
 			return chat.MessageStreamResponse{}, err
 		}
@@ -70,12 +70,13 @@ func (c *Client) createBetaStream(
 	}
 
 	params := anthropic.BetaMessageNewParams{
-		Model:     anthropic.Model(c.ModelConfig.Model),
-		MaxTokens: maxTokens,
-		System:    sys,
-		Messages:  converted,
-		Tools:     allTools,
-		Betas:     betas,
+		Model:         anthropic.Model(c.ModelConfig.Model),
+		MaxTokens:     maxTokens,
+		System:        sys,
+		Messages:      converted,
+		Tools:         allTools,
+		Betas:         betas,
+		StopSequences: c.ModelOptions.StopSequences(),
 	}
 
 	// Apply structured output configuration
@@ -287,11 +287,12 @@ func (c *Client) CreateChatCompletionStream(
 	sys := extractSystemBlocks(messages)
 
 	params := anthropic.MessageNewParams{
-		Model:     anthropic.Model(c.ModelConfig.Model),
-		MaxTokens: maxTokens,
-		System:    sys,
-		Messages:  converted,
-		Tools:     allTools,
+		Model:         anthropic.Model(c.ModelConfig.Model),
+		MaxTokens:     maxTokens,
+		System:        sys,
+		Messages:      converted,
+		Tools:         allTools,
+		StopSequences: c.ModelOptions.StopSequences(),
 	}
 
 	// Apply thinking budget first, as it affects whether we can set temperature
@@ -0,0 +1,19 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrContextExceeded is returned (wrapped) by providers when a request is
+// rejected because the prompt does not fit in the model's context window.
+var ErrContextExceeded = errors.New("context window exceeded")
+
+// WrapContextExceeded wraps err so that errors.Is(err, ErrContextExceeded)
+// reports true while preserving the original provider error.
+func WrapContextExceeded(err error) error {
+	if err == nil || errors.Is(err, ErrContextExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrContextExceeded, err)
+}
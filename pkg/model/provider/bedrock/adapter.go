@@ -1,14 +1,17 @@
 package bedrock
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 
 	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/model/provider/base"
 	"github.com/docker/cagent/pkg/tools"
 )
 
@@ -37,6 +40,20 @@ func newStreamAdapter(stream *bedrockruntime.ConverseStreamEventStream, model st
 	}
 }
 
+// isContextLengthError checks if the error indicates the prompt exceeded the
+// model's context window. Bedrock reports this as a ValidationException
+// whose message varies by model family.
+func isContextLengthError(err error) bool {
+	validationErr, ok := errors.AsType[*types.ValidationException](err)
+	if !ok {
+		return false
+	}
+	msg := strings.ToLower(validationErr.ErrorMessage())
+	return strings.Contains(msg, "input is too long") ||
+		strings.Contains(msg, "too many input tokens") ||
+		strings.Contains(msg, "context window")
+}
+
 // Recv gets the next completion chunk
 func (a *streamAdapter) Recv() (chat.MessageStreamResponse, error) {
 	// If we have both finish reason and usage buffered, emit the final response
@@ -71,6 +88,9 @@ func (a *streamAdapter) Recv() (chat.MessageStreamResponse, error) {
 		// Check for errors
 		if err := a.stream.Err(); err != nil {
 			slog.Debug("Bedrock stream: error on channel close", "error", err)
+			if isContextLengthError(err) {
+				return chat.MessageStreamResponse{}, base.WrapContextExceeded(err)
+			}
 			return chat.MessageStreamResponse{}, err
 		}
 		// If we have a pending finish reason but never got metadata, emit it now
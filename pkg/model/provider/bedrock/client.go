@@ -219,6 +219,9 @@ func (c *Client) CreateChatCompletionStream(
 	output, err := c.bedrockClient.ConverseStream(ctx, input)
 	if err != nil {
 		slog.Error("Bedrock ConverseStream failed", "error", err)
+		if isContextLengthError(err) {
+			return nil, base.WrapContextExceeded(fmt.Errorf("bedrock converse stream failed: %w", err))
+		}
 		return nil, fmt.Errorf("bedrock converse stream failed: %w", err)
 	}
 
@@ -272,6 +275,8 @@ func (c *Client) buildInferenceConfig() *types.InferenceConfiguration {
 		slog.Debug("Bedrock extended thinking enabled, ignoring temperature/top_p settings")
 	}
 
+	cfg.StopSequences = c.ModelOptions.StopSequences()
+
 	return cfg
 }
 
@@ -3,10 +3,13 @@ package bedrock
 import (
 	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -1346,3 +1349,28 @@ func TestConvertMessages_ToolResultWithCaching(t *testing.T) {
 	_, isCachePoint = secondLastContent.(*types.ContentBlockMemberCachePoint)
 	assert.True(t, isCachePoint, "assistant tool call message should have cache point")
 }
+
+func TestIsContextLengthError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"not a validation exception", errors.New("input is too long"), false},
+		{"input too long", &types.ValidationException{Message: aws.String("Input is too long for requested model.")}, true},
+		{"too many input tokens", &types.ValidationException{Message: aws.String("too many input tokens")}, true},
+		{"wrapped", fmt.Errorf("bedrock converse stream failed: %w", &types.ValidationException{Message: aws.String("Input is too long for requested model.")}), true},
+		{"other validation error", &types.ValidationException{Message: aws.String("The provided model identifier is invalid.")}, false},
+		{"throttling", &types.ThrottlingException{Message: aws.String("Too many requests, input is too long")}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, isContextLengthError(tt.err))
+		})
+	}
+}
@@ -468,6 +468,10 @@ func (c *Client) CreateChatCompletionStream(ctx context.Context, messages []chat
 		slog.Debug("DMR request configured with max tokens", "max_tokens", *c.ModelConfig.MaxTokens)
 	}
 
+	if stop := c.ModelOptions.StopSequences(); len(stop) > 0 {
+		params.Stop.OfStringArray = stop
+	}
+
 	if len(requestTools) > 0 {
 		slog.Debug("Adding tools to DMR request", "tool_count", len(requestTools))
 		toolsParam := make([]openai.ChatCompletionToolUnionParam, len(requestTools))
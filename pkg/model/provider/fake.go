@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/model/provider/base"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+// FakeResponse is a scripted model response returned by a Fake provider.
+type FakeResponse struct {
+	Content   string           // Text streamed back to the caller
+	ToolCalls []tools.ToolCall // Tool calls requested by the model
+	Usage     *chat.Usage      // Usage reported with the last chunk, if any
+	Err       error            // Returned by CreateChatCompletionStream instead of a stream
+}
+
+// Fake is a Provider that replays scripted responses, one per call to
+// CreateChatCompletionStream, to test code that talks to a model without
+// network access.
+type Fake struct {
+	mu        sync.Mutex
+	responses []FakeResponse
+}
+
+// NewFake creates a Fake provider returning responses in order. Once they are
+// all consumed, CreateChatCompletionStream returns an error.
+func NewFake(responses []FakeResponse) *Fake {
+	return &Fake{responses: responses}
+}
+
+func (f *Fake) ID() string {
+	return "fake/fake"
+}
+
+func (f *Fake) CreateChatCompletionStream(context.Context, []chat.Message, []tools.Tool) (chat.MessageStream, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.responses) == 0 {
+		return nil, errors.New("fake provider: no more scripted responses")
+	}
+	response := f.responses[0]
+	f.responses = f.responses[1:]
+
+	if response.Err != nil {
+		return nil, response.Err
+	}
+	return newFakeStream(response), nil
+}
+
+func (f *Fake) BaseConfig() base.Config {
+	return base.Config{}
+}
+
+type fakeStream struct {
+	chunks []chat.MessageStreamResponse
+}
+
+func newFakeStream(response FakeResponse) *fakeStream {
+	var chunks []chat.MessageStreamResponse
+	if response.Content != "" {
+		chunks = append(chunks, chat.MessageStreamResponse{
+			Choices: []chat.MessageStreamChoice{{Delta: chat.MessageDelta{Content: response.Content}}},
+		})
+	}
+	if len(response.ToolCalls) > 0 {
+		chunks = append(chunks, chat.MessageStreamResponse{
+			Choices: []chat.MessageStreamChoice{{Delta: chat.MessageDelta{ToolCalls: response.ToolCalls}}},
+		})
+	}
+
+	finishReason := chat.FinishReasonStop
+	if len(response.ToolCalls) > 0 {
+		finishReason = chat.FinishReasonToolCalls
+	}
+	chunks = append(chunks, chat.MessageStreamResponse{
+		Choices: []chat.MessageStreamChoice{{FinishReason: finishReason}},
+		Usage:   response.Usage,
+	})
+
+	return &fakeStream{chunks: chunks}
+}
+
+func (s *fakeStream) Recv() (chat.MessageStreamResponse, error) {
+	if len(s.chunks) == 0 {
+		return chat.MessageStreamResponse{}, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *fakeStream) Close() {}
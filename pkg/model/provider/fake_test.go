@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+func TestFake(t *testing.T) {
+	t.Parallel()
+
+	toolCall := tools.ToolCall{ID: "call_1", Type: "function", Function: tools.FunctionCall{Name: "echo", Arguments: "{}"}}
+	fake := NewFake([]FakeResponse{
+		{ToolCalls: []tools.ToolCall{toolCall}},
+		{Content: "Done", Usage: &chat.Usage{InputTokens: 3, OutputTokens: 1}},
+		{Err: errors.New("boom")},
+	})
+
+	stream, err := fake.CreateChatCompletionStream(t.Context(), nil, nil)
+	require.NoError(t, err)
+	chunks := recvAll(t, stream)
+	require.Len(t, chunks, 2)
+	assert.Equal(t, []tools.ToolCall{toolCall}, chunks[0].Choices[0].Delta.ToolCalls)
+	assert.Equal(t, chat.FinishReasonToolCalls, chunks[1].Choices[0].FinishReason)
+
+	stream, err = fake.CreateChatCompletionStream(t.Context(), nil, nil)
+	require.NoError(t, err)
+	chunks = recvAll(t, stream)
+	require.Len(t, chunks, 2)
+	assert.Equal(t, "Done", chunks[0].Choices[0].Delta.Content)
+	assert.Equal(t, chat.FinishReasonStop, chunks[1].Choices[0].FinishReason)
+	assert.Equal(t, &chat.Usage{InputTokens: 3, OutputTokens: 1}, chunks[1].Usage)
+
+	_, err = fake.CreateChatCompletionStream(t.Context(), nil, nil)
+	require.EqualError(t, err, "boom")
+
+	_, err = fake.CreateChatCompletionStream(t.Context(), nil, nil)
+	require.Error(t, err)
+}
+
+func recvAll(t *testing.T, stream chat.MessageStream) []chat.MessageStreamResponse {
+	t.Helper()
+
+	var chunks []chat.MessageStreamResponse
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return chunks
+		}
+		require.NoError(t, err)
+		chunks = append(chunks, chunk)
+	}
+}
@@ -2,8 +2,10 @@ package gemini
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
+	"net/http"
 	"regexp"
 	"strings"
 
@@ -11,6 +13,7 @@ import (
 	"google.golang.org/genai"
 
 	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/model/provider/base"
 	"github.com/docker/cagent/pkg/tools"
 )
 
@@ -135,6 +138,19 @@ func NewStreamAdapter(iter func(func(*genai.GenerateContentResponse, error) bool
 	return adapter
 }
 
+// isContextLengthError checks if the error indicates the prompt exceeded the
+// model's input token limit. Gemini returns HTTP 400 INVALID_ARGUMENT with a
+// descriptive message, so we have to match on the message.
+func isContextLengthError(err error) bool {
+	apiErr, ok := errors.AsType[genai.APIError](err)
+	if !ok || apiErr.Code != http.StatusBadRequest {
+		return false
+	}
+	msg := strings.ToLower(apiErr.Message)
+	return strings.Contains(msg, "exceeds the maximum number of tokens") ||
+		strings.Contains(msg, "input token count")
+}
+
 // Recv gets the next Gemini content chunk
 func (g *StreamAdapter) Recv() (chat.MessageStreamResponse, error) {
 	res, ok := <-g.ch
@@ -143,6 +159,9 @@ func (g *StreamAdapter) Recv() (chat.MessageStreamResponse, error) {
 	}
 
 	if res.err != nil {
+		if isContextLengthError(res.err) {
+			return chat.MessageStreamResponse{}, base.WrapContextExceeded(res.err)
+		}
 		return chat.MessageStreamResponse{}, res.err
 	}
 
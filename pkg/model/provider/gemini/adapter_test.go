@@ -1,6 +1,9 @@
 package gemini
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -54,3 +57,24 @@ func TestStreamAdapter_FunctionCalls(t *testing.T) {
 		require.Empty(t, finalResp.Choices[0].Delta.ToolCalls)
 	})
 }
+
+func TestIsContextLengthError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"not an api error", errors.New("input token count exceeds the maximum"), false},
+		{"token limit", genai.APIError{Code: http.StatusBadRequest, Message: "The input token count (1200000) exceeds the maximum number of tokens allowed (1048576)."}, true},
+		{"wrapped token limit", fmt.Errorf("stream: %w", genai.APIError{Code: http.StatusBadRequest, Message: "The input token count (1200000) exceeds the maximum number of tokens allowed (1048576)."}), true},
+		{"unrelated 400", genai.APIError{Code: http.StatusBadRequest, Message: "Invalid JSON payload received."}, false},
+		{"non-400 with matching message", genai.APIError{Code: http.StatusInternalServerError, Message: "input token count exceeds the maximum number of tokens"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isContextLengthError(tt.err))
+		})
+	}
+}
@@ -338,6 +338,7 @@ func (c *Client) buildConfig() *genai.GenerateContentConfig {
 	if c.ModelConfig.PresencePenalty != nil {
 		config.PresencePenalty = new(float32(*c.ModelConfig.PresencePenalty))
 	}
+	config.StopSequences = c.ModelOptions.StopSequences()
 
 	// Apply thinking configuration for Gemini models.
 	// Per official docs: https://ai.google.dev/gemini-api/docs/thinking
@@ -5,12 +5,16 @@ This is a shared adapter for OpenAI-compatible streams.
 */
 
 import (
+	"errors"
 	"io"
+	"net/http"
+	"strings"
 
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/packages/ssestream"
 
 	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/model/provider/base"
 	"github.com/docker/cagent/pkg/tools"
 )
 
@@ -30,10 +34,34 @@ func NewStreamAdapter(stream *ssestream.Stream[openai.ChatCompletionChunk], trac
 	}
 }
 
+// IsContextLengthError checks if the error indicates the prompt did not fit
+// in the model's context window. OpenAI reports this with the
+// "context_length_exceeded" code; OpenAI-compatible servers often only
+// describe it in the message of a 400 response.
+func IsContextLengthError(err error) bool {
+	apiErr, ok := errors.AsType[*openai.Error](err)
+	if !ok {
+		return false
+	}
+	if apiErr.Code == "context_length_exceeded" {
+		return true
+	}
+	if apiErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	msg := strings.ToLower(apiErr.Message)
+	return strings.Contains(msg, "maximum context length") ||
+		strings.Contains(msg, "context window") ||
+		strings.Contains(msg, "context length")
+}
+
 // Recv gets the next completion chunk
 func (a *StreamAdapter) Recv() (chat.MessageStreamResponse, error) {
 	if !a.stream.Next() {
 		err := a.stream.Err()
+		if IsContextLengthError(err) {
+			return chat.MessageStreamResponse{}, base.WrapContextExceeded(err)
+		}
 		if err != nil {
 			return chat.MessageStreamResponse{}, err
 		}
@@ -0,0 +1,38 @@
+package oaistream
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsContextLengthError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"not an api error", errors.New("maximum context length exceeded"), false},
+		{"openai error code", &openai.Error{StatusCode: http.StatusBadRequest, Code: "context_length_exceeded"}, true},
+		{"wrapped openai error code", fmt.Errorf("stream: %w", &openai.Error{StatusCode: http.StatusBadRequest, Code: "context_length_exceeded"}), true},
+		{"compatible server message", &openai.Error{StatusCode: http.StatusBadRequest, Message: "This model's maximum context length is 8192 tokens"}, true},
+		{"context window message", &openai.Error{StatusCode: http.StatusBadRequest, Message: "Request exceeds the context window"}, true},
+		{"message on non-400", &openai.Error{StatusCode: http.StatusUnprocessableEntity, Message: "invalid context length setting"}, false},
+		{"unrelated 400", &openai.Error{StatusCode: http.StatusBadRequest, Code: "invalid_value", Message: "temperature must be <= 2"}, false},
+		{"rate limit", &openai.Error{StatusCode: http.StatusTooManyRequests, Code: "rate_limit_exceeded"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, IsContextLengthError(tt.err))
+		})
+	}
+}
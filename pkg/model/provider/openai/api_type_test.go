@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,6 +16,7 @@ import (
 	"github.com/docker/cagent/pkg/chat"
 	"github.com/docker/cagent/pkg/config/latest"
 	"github.com/docker/cagent/pkg/environment"
+	"github.com/docker/cagent/pkg/model/provider/options"
 )
 
 // mockEnvProvider is a simple env provider for testing
@@ -255,3 +258,150 @@ func TestCustomProvider_WithoutTokenKey(t *testing.T) {
 	// SDK sends "Bearer" with empty key - that's effectively no auth
 	assert.Equal(t, "Bearer", receivedAuth, "Should send empty bearer token when no token_key")
 }
+
+// TestExtraHeaders verifies that the headers set with options.WithExtraHeaders
+// are sent with both completion and models-listing requests
+func TestExtraHeaders(t *testing.T) {
+	t.Parallel()
+
+	var (
+		received = map[string]string{}
+		mu       sync.Mutex
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received[r.URL.Path] = r.Header.Get("X-Trace-Id")
+		mu.Unlock()
+		if r.URL.Path == "/models" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"object":"list","data":[]}`))
+			return
+		}
+		writeSSEResponse(w)
+	}))
+	defer server.Close()
+
+	cfg := &latest.ModelConfig{
+		Provider: "custom",
+		Model:    "test",
+		BaseURL:  server.URL,
+		ProviderOpts: map[string]any{
+			"api_type": "openai_chatcompletions",
+		},
+	}
+
+	client, err := NewClient(t.Context(), cfg, newMockEnvProvider(map[string]string{}), options.WithExtraHeaders(map[string]string{"X-Trace-Id": "trace-123"}))
+	require.NoError(t, err)
+
+	stream, err := client.CreateChatCompletionStream(t.Context(), []chat.Message{{Role: chat.MessageRoleUser, Content: "hi"}}, nil)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	// Drain stream
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+
+	oaiClient, err := client.clientFn(t.Context())
+	require.NoError(t, err)
+	_, err = oaiClient.Models.List(t.Context())
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]string{
+		"/chat/completions": "trace-123",
+		"/models":           "trace-123",
+	}, received)
+}
+
+func TestStopSequences(t *testing.T) {
+	t.Parallel()
+
+	var (
+		body map[string]any
+		mu   sync.Mutex
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Unlock()
+		writeSSEResponse(w)
+	}))
+	defer server.Close()
+
+	cfg := &latest.ModelConfig{
+		Provider: "custom",
+		Model:    "test",
+		BaseURL:  server.URL,
+		ProviderOpts: map[string]any{
+			"api_type": "openai_chatcompletions",
+		},
+	}
+
+	client, err := NewClient(t.Context(), cfg, newMockEnvProvider(map[string]string{}), options.WithStopSequences("<done>", "END"))
+	require.NoError(t, err)
+
+	stream, err := client.CreateChatCompletionStream(t.Context(), []chat.Message{{Role: chat.MessageRoleUser, Content: "hi"}}, nil)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []any{"<done>", "END"}, body["stop"])
+}
+
+func TestRateLimitIsSharedBetweenClients(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		writeSSEResponse(w)
+	}))
+	defer server.Close()
+
+	cfg := &latest.ModelConfig{
+		Provider: "custom",
+		Model:    "test",
+		BaseURL:  server.URL,
+		ProviderOpts: map[string]any{
+			"api_type": "openai_chatcompletions",
+		},
+	}
+
+	// One request every 1000 seconds: the second request can't be sent in time.
+	rateLimit := WithRateLimit(0.001, 1)
+	first, err := NewClient(t.Context(), cfg, newMockEnvProvider(map[string]string{}), rateLimit)
+	require.NoError(t, err)
+	second, err := NewClient(t.Context(), cfg, newMockEnvProvider(map[string]string{}), rateLimit)
+	require.NoError(t, err)
+
+	messages := []chat.Message{{Role: chat.MessageRoleUser, Content: "hi"}}
+
+	stream, err := first.CreateChatCompletionStream(t.Context(), messages, nil)
+	require.NoError(t, err)
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+	stream.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	_, err = second.CreateChatCompletionStream(ctx, messages, nil)
+	require.ErrorContains(t, err, "rate limit")
+
+	assert.Equal(t, int32(1), requests.Load())
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/openai/openai-go/v3/packages/param"
 	"github.com/openai/openai-go/v3/responses"
 	"github.com/openai/openai-go/v3/shared"
+	"golang.org/x/time/rate"
 
 	"github.com/docker/cagent/pkg/chat"
 	"github.com/docker/cagent/pkg/config/latest"
@@ -35,6 +36,16 @@ type Client struct {
 	clientFn func(context.Context) (*openai.Client, error)
 }
 
+// WithRateLimit throttles the requests of the clients created with the
+// returned option to rps requests per second, with bursts of up to burst
+// requests. All those clients, and their clones, share the same budget, so
+// that agents or tabs using the same provider don't run into its rate limits.
+// Requests over the budget wait for their turn, or until their context is
+// done.
+func WithRateLimit(rps float64, burst int) options.Opt {
+	return options.WithRateLimiter(rate.NewLimiter(rate.Limit(rps), burst))
+}
+
 // NewClient creates a new OpenAI client from the provided configuration
 func NewClient(ctx context.Context, cfg *latest.ModelConfig, env environment.Provider, opts ...options.Opt) (*Client, error) {
 	if cfg == nil {
@@ -87,6 +98,7 @@ func NewClient(ctx context.Context, cfg *latest.ModelConfig, env environment.Pro
 
 		httpClient := httpclient.NewHTTPClient()
 		clientOptions = append(clientOptions, option.WithHTTPClient(httpClient))
+		clientOptions = append(clientOptions, extraHeaderOptions(globalOptions.ExtraHeaders())...)
 
 		client := openai.NewClient(clientOptions...)
 		clientFn = func(context.Context) (*openai.Client, error) {
@@ -125,12 +137,15 @@ func NewClient(ctx context.Context, cfg *latest.ModelConfig, env environment.Pro
 				httpOptions = append(httpOptions, httpclient.WithHeader("X-Cagent-GeneratingTitle", "1"))
 			}
 
-			client := openai.NewClient(
+			clientOptions := []option.RequestOption{
 				option.WithAPIKey(authToken),
 				option.WithBaseURL(baseURL),
 				option.WithHTTPClient(httpclient.NewHTTPClient(httpOptions...)),
 				option.WithMiddleware(oaistream.ErrorBodyMiddleware()),
-			)
+			}
+			clientOptions = append(clientOptions, extraHeaderOptions(globalOptions.ExtraHeaders())...)
+
+			client := openai.NewClient(clientOptions...)
 
 			return &client, nil
 		}
@@ -166,6 +181,12 @@ func (c *Client) CreateChatCompletionStream(
 		"message_count", len(messages),
 		"tool_count", len(requestTools))
 
+	if limiter := c.ModelOptions.RateLimiter(); limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("waiting for rate limit: %w", err)
+		}
+	}
+
 	// Check api_type from ProviderOpts to determine which schema to use.
 	// This allows custom providers to explicitly choose the API schema.
 	apiType := getAPIType(&c.ModelConfig)
@@ -260,6 +281,10 @@ func (c *Client) CreateChatCompletionStream(
 		slog.Debug("OpenAI request using thinking_budget", "reasoning_effort", effort)
 	}
 
+	if stop := c.ModelOptions.StopSequences(); len(stop) > 0 {
+		params.Stop.OfStringArray = stop
+	}
+
 	// Apply structured output configuration
 	if structuredOutput := c.ModelOptions.StructuredOutput(); structuredOutput != nil {
 		slog.Debug("OpenAI request using structured output", "name", structuredOutput.Name, "strict", structuredOutput.Strict)
@@ -936,3 +961,14 @@ type jsonSchema map[string]any
 func (j jsonSchema) MarshalJSON() ([]byte, error) {
 	return json.Marshal(map[string]any(j))
 }
+
+// extraHeaderOptions turns the headers configured with
+// options.WithExtraHeaders into client options, so that they are sent with
+// every request the client makes.
+func extraHeaderOptions(headers map[string]string) []option.RequestOption {
+	var opts []option.RequestOption
+	for name, value := range headers {
+		opts = append(opts, option.WithHeader(name, value))
+	}
+	return opts
+}
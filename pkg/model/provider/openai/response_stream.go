@@ -9,6 +9,8 @@ import (
 	"github.com/openai/openai-go/v3/responses"
 
 	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/model/provider/base"
+	"github.com/docker/cagent/pkg/model/provider/oaistream"
 	"github.com/docker/cagent/pkg/tools"
 )
 
@@ -33,6 +35,9 @@ func newResponseStreamAdapter(stream *ssestream.Stream[responses.ResponseStreamE
 func (a *ResponseStreamAdapter) Recv() (chat.MessageStreamResponse, error) {
 	if !a.stream.Next() {
 		if err := a.stream.Err(); err != nil {
+			if oaistream.IsContextLengthError(err) {
+				return chat.MessageStreamResponse{}, base.WrapContextExceeded(err)
+			}
 			return chat.MessageStreamResponse{}, err
 		}
 		return chat.MessageStreamResponse{}, io.EOF
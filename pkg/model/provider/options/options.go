@@ -1,6 +1,11 @@
 package options
 
 import (
+	"maps"
+	"time"
+
+	"golang.org/x/time/rate"
+
 	"github.com/docker/cagent/pkg/config/latest"
 )
 
@@ -11,6 +16,10 @@ type ModelOptions struct {
 	maxTokens        int64
 	providers        map[string]latest.ProviderConfig
 	thinking         *bool
+	requestTimeout   time.Duration
+	extraHeaders     map[string]string
+	stopSequences    []string
+	rateLimiter      *rate.Limiter
 }
 
 func (c *ModelOptions) Gateway() string {
@@ -37,6 +46,29 @@ func (c *ModelOptions) Thinking() *bool {
 	return c.thinking
 }
 
+// RequestTimeout returns how long a streamed response may stay idle, with no
+// chunk received, before it is abandoned. Zero means no idle timeout.
+func (c *ModelOptions) RequestTimeout() time.Duration {
+	return c.requestTimeout
+}
+
+// ExtraHeaders returns the headers added to every request sent to the
+// provider.
+func (c *ModelOptions) ExtraHeaders() map[string]string {
+	return c.extraHeaders
+}
+
+// StopSequences returns the sequences that make the model stop generating.
+func (c *ModelOptions) StopSequences() []string {
+	return c.stopSequences
+}
+
+// RateLimiter returns the limiter requests wait on before being sent, or nil
+// if requests aren't throttled.
+func (c *ModelOptions) RateLimiter() *rate.Limiter {
+	return c.rateLimiter
+}
+
 type Opt func(*ModelOptions)
 
 func WithGateway(gateway string) Opt {
@@ -75,6 +107,44 @@ func WithThinking(enabled bool) Opt {
 	}
 }
 
+// WithRequestTimeout sets how long a streamed response may go without
+// receiving a chunk, including the first one, before it is canceled. Unlike a
+// context deadline it doesn't bound the total duration of the response.
+func WithRequestTimeout(d time.Duration) Opt {
+	return func(cfg *ModelOptions) {
+		cfg.requestTimeout = d
+	}
+}
+
+// WithExtraHeaders adds headers to every request sent to the provider, for
+// example to authenticate with or trace through a proxy. Headers set by several
+// calls are merged, the last value winning.
+func WithExtraHeaders(headers map[string]string) Opt {
+	return func(cfg *ModelOptions) {
+		if cfg.extraHeaders == nil {
+			cfg.extraHeaders = make(map[string]string, len(headers))
+		}
+		maps.Copy(cfg.extraHeaders, headers)
+	}
+}
+
+// WithStopSequences makes the model stop generating when it emits one of the
+// given sequences. Providers that don't support stop sequences ignore them.
+func WithStopSequences(seqs ...string) Opt {
+	return func(cfg *ModelOptions) {
+		cfg.stopSequences = seqs
+	}
+}
+
+// WithRateLimiter throttles the requests sent to the provider: each one waits
+// for the limiter before being sent. Clients created with the same limiter
+// share its budget.
+func WithRateLimiter(limiter *rate.Limiter) Opt {
+	return func(cfg *ModelOptions) {
+		cfg.rateLimiter = limiter
+	}
+}
+
 // FromModelOptions converts a concrete ModelOptions value into a slice of
 // Opt configuration functions. Later Opts override earlier ones when applied.
 func FromModelOptions(m ModelOptions) []Opt {
@@ -97,5 +167,17 @@ func FromModelOptions(m ModelOptions) []Opt {
 	if m.thinking != nil {
 		out = append(out, WithThinking(*m.thinking))
 	}
+	if m.requestTimeout != 0 {
+		out = append(out, WithRequestTimeout(m.requestTimeout))
+	}
+	if len(m.extraHeaders) > 0 {
+		out = append(out, WithExtraHeaders(m.extraHeaders))
+	}
+	if len(m.stopSequences) > 0 {
+		out = append(out, WithStopSequences(m.stopSequences...))
+	}
+	if m.rateLimiter != nil {
+		out = append(out, WithRateLimiter(m.rateLimiter))
+	}
 	return out
 }
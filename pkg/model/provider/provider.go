@@ -130,6 +130,10 @@ var Aliases = map[string]Alias{
 	},
 }
 
+// ErrContextExceeded is returned (wrapped) by providers when the request
+// does not fit in the model's context window. Use errors.Is to detect it.
+var ErrContextExceeded = base.ErrContextExceeded
+
 // Provider defines the interface for model providers
 type Provider interface {
 	// ID returns the model provider ID
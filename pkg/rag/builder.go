@@ -19,6 +19,9 @@ type ManagersBuildConfig struct {
 	ModelsGateway string
 	Env           environment.Provider
 	Models        map[string]latest.ModelConfig // Model configurations from config
+	// EmbeddingModel, when set, replaces the embedding model of every
+	// embedding strategy.
+	EmbeddingModel provider.EmbeddingProvider
 }
 
 // NewManagers constructs all RAG managers defined in the config.
@@ -48,6 +51,8 @@ func NewManagers(
 			Env:           buildCfg.Env,
 			ModelsGateway: buildCfg.ModelsGateway,
 			RespectVCS:    ragCfg.GetRespectVCS(),
+
+			EmbeddingModel: buildCfg.EmbeddingModel,
 		}
 
 		strategyConfigs, strategyEvents, err := buildStrategyConfigs(ctx, ragCfg, strategyBuildCtx, ragName)
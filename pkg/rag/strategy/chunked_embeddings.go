@@ -18,7 +18,7 @@ func NewChunkedEmbeddingsFromConfig(ctx context.Context, cfg latest.RAGStrategyC
 
 	// Extract required parameters
 	modelName := GetParam(cfg.Params, "embedding_model", "")
-	if modelName == "" {
+	if modelName == "" && buildCtx.EmbeddingModel == nil {
 		return nil, fmt.Errorf("'embedding_model' parameter required for %s strategy", strategyName)
 	}
 
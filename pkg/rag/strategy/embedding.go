@@ -22,7 +22,16 @@ type EmbeddingConfig struct {
 
 // CreateEmbeddingProvider creates an embedding model provider from configuration.
 // Supports "auto" for auto-detection, inline "provider/model" format, or named model references.
+// The embedding model of the build context, if any, takes precedence.
 func CreateEmbeddingProvider(ctx context.Context, modelName string, buildCtx BuildContext) (*EmbeddingConfig, error) {
+	if buildCtx.EmbeddingModel != nil {
+		return &EmbeddingConfig{
+			Provider:    buildCtx.EmbeddingModel,
+			ModelID:     buildCtx.EmbeddingModel.ID(),
+			ModelsStore: newPricingStore(),
+		}, nil
+	}
+
 	var embedModel provider.Provider
 	var modelCfg latest.ModelConfig
 	var err error
@@ -55,18 +64,22 @@ func CreateEmbeddingProvider(ctx context.Context, modelName string, buildCtx Bui
 		modelID = modelCfg.Provider + "/" + modelCfg.Model
 	}
 
-	// Create models.dev store for pricing
+	return &EmbeddingConfig{
+		Provider:    embedModel,
+		ModelID:     modelID,
+		ModelsStore: newPricingStore(),
+	}, nil
+}
+
+// newPricingStore creates the models.dev store used for RAG pricing, or
+// returns nil, disabling cost tracking, if it can't be created.
+func newPricingStore() *modelsdev.Store {
 	modelsStore, err := modelsdev.NewStore()
 	if err != nil {
 		slog.Debug("Failed to create models.dev store for RAG pricing; cost tracking disabled",
 			"error", err)
 	}
-
-	return &EmbeddingConfig{
-		Provider:    embedModel,
-		ModelID:     modelID,
-		ModelsStore: modelsStore,
-	}, nil
+	return modelsStore
 }
 
 // createAutoEmbeddingModel creates an auto-detected embedding model.
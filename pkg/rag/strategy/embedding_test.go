@@ -0,0 +1,55 @@
+package strategy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/config/latest"
+	"github.com/docker/cagent/pkg/model/provider/base"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+type fakeEmbeddingModel struct{}
+
+func (fakeEmbeddingModel) ID() string { return "local/embedder" }
+
+func (fakeEmbeddingModel) CreateChatCompletionStream(context.Context, []chat.Message, []tools.Tool) (chat.MessageStream, error) {
+	return nil, nil
+}
+
+func (fakeEmbeddingModel) BaseConfig() base.Config { return base.Config{} }
+
+func (fakeEmbeddingModel) CreateEmbedding(context.Context, string) (*base.EmbeddingResult, error) {
+	return &base.EmbeddingResult{Embedding: []float64{1, 0}}, nil
+}
+
+func TestCreateEmbeddingProviderUsesBuildContextModel(t *testing.T) {
+	model := fakeEmbeddingModel{}
+
+	cfg, err := CreateEmbeddingProvider(t.Context(), "not/configured", BuildContext{EmbeddingModel: model})
+	require.NoError(t, err)
+	assert.Equal(t, model, cfg.Provider)
+	assert.Equal(t, "local/embedder", cfg.ModelID)
+}
+
+func TestChunkedEmbeddingsWithoutEmbeddingModelParam(t *testing.T) {
+	strategyCfg := latest.RAGStrategyConfig{
+		Type:   "chunked-embeddings",
+		Params: map[string]any{"vector_dimensions": 2},
+	}
+
+	_, err := NewChunkedEmbeddingsFromConfig(t.Context(), strategyCfg, BuildContext{RAGName: "docs", ParentDir: t.TempDir()}, nil)
+	require.ErrorContains(t, err, "'embedding_model' parameter required")
+
+	built, err := NewChunkedEmbeddingsFromConfig(t.Context(), strategyCfg, BuildContext{
+		RAGName:        "docs",
+		ParentDir:      t.TempDir(),
+		EmbeddingModel: fakeEmbeddingModel{},
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = built.Strategy.Close() })
+}
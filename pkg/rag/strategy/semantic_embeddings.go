@@ -59,7 +59,7 @@ func NewSemanticEmbeddingsFromConfig(ctx context.Context, cfg latest.RAGStrategy
 
 	// Extract required embedding model parameter
 	embeddingModelName := GetParam(cfg.Params, "embedding_model", "")
-	if embeddingModelName == "" {
+	if embeddingModelName == "" && buildCtx.EmbeddingModel == nil {
 		return nil, fmt.Errorf("'embedding_model' parameter required for %s strategy", strategyName)
 	}
 
@@ -6,6 +6,7 @@ import (
 
 	"github.com/docker/cagent/pkg/config/latest"
 	"github.com/docker/cagent/pkg/environment"
+	"github.com/docker/cagent/pkg/model/provider"
 	"github.com/docker/cagent/pkg/rag/types"
 )
 
@@ -18,6 +19,9 @@ type BuildContext struct {
 	Env           environment.Provider
 	ModelsGateway string
 	RespectVCS    bool // Whether to respect VCS ignore files (e.g., .gitignore) when collecting files
+	// EmbeddingModel, when set, is used by the embedding strategies instead
+	// of their embedding_model parameter.
+	EmbeddingModel provider.EmbeddingProvider
 }
 
 // BuildStrategy builds a strategy from config
@@ -51,6 +51,7 @@ func (m *mockRuntime) ResumeElicitation(context.Context, tools.ElicitationAction
 func (m *mockRuntime) SessionStore() session.Store { return nil }
 func (m *mockRuntime) Summarize(context.Context, *session.Session, string, chan Event) {
 }
+func (m *mockRuntime) CancelCompaction() bool            { return false }
 func (m *mockRuntime) PermissionsInfo() *PermissionsInfo { return nil }
 func (m *mockRuntime) CurrentAgentSkillsToolset() *builtin.SkillsToolset {
 	return nil
@@ -60,6 +61,10 @@ func (m *mockRuntime) CurrentMCPPrompts(context.Context) map[string]mcptools.Pro
 	return make(map[string]mcptools.PromptInfo)
 }
 
+func (m *mockRuntime) CurrentAgentAuthStatus(context.Context) map[string]AuthStatus {
+	return make(map[string]AuthStatus)
+}
+
 func (m *mockRuntime) ExecuteMCPPrompt(context.Context, string, map[string]string) (string, error) {
 	return "", nil
 }
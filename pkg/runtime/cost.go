@@ -0,0 +1,32 @@
+package runtime
+
+import (
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/modelsdev"
+)
+
+// usageCost computes the cost of a model response from its token usage and
+// the model's models.dev pricing, which is expressed per million tokens.
+// It returns zero when either the usage or the pricing is unknown.
+func usageCost(m *modelsdev.Model, usage *chat.Usage) float64 {
+	if usage == nil || m == nil || m.Cost == nil {
+		return 0
+	}
+
+	return (float64(usage.InputTokens)*m.Cost.Input +
+		float64(usage.OutputTokens)*m.Cost.Output +
+		float64(usage.CachedInputTokens)*m.Cost.CacheRead +
+		float64(usage.CacheWriteTokens)*m.Cost.CacheWrite) / 1e6
+}
+
+// cacheSavings computes how much cheaper a model response was thanks to
+// prompt caching: the difference between the input and cache read prices of
+// the cached input tokens. Cache writes, usually more expensive than input
+// tokens, aren't deducted.
+func cacheSavings(m *modelsdev.Model, usage *chat.Usage) float64 {
+	if usage == nil || m == nil || m.Cost == nil {
+		return 0
+	}
+
+	return float64(usage.CachedInputTokens) * (m.Cost.Input - m.Cost.CacheRead) / 1e6
+}
@@ -12,20 +12,92 @@ import (
 
 type Event interface {
 	GetAgentName() string
-}
+	// Category tells what kind of event this is, so consumers can pick out
+	// the events they care about without switching on every type.
+	Category() EventCategory
+	// GetSeq returns the sequence number of the event in its session's
+	// stream, or 0 if it wasn't sequenced. See LocalRuntime.ResumeStream.
+	GetSeq() uint64
+}
+
+// EventCategory groups events by purpose.
+type EventCategory string
+
+const (
+	// CategoryContent is for conversation content: user messages, streamed
+	// assistant output and reasoning, finalized messages and shell output.
+	CategoryContent EventCategory = "content"
+	// CategoryTool is for tool call activity: partial and complete calls,
+	// confirmations, responses and tool calls blocked by hooks or limits.
+	CategoryTool EventCategory = "tool"
+	// CategorySystem is for everything else: stream lifecycle, errors,
+	// warnings, token usage, session metadata and startup information.
+	CategorySystem EventCategory = "system"
+)
 
 // AgentContext carries optional agent attribution and timestamp for an event.
 type AgentContext struct {
 	AgentName string    `json:"agent_name,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
+	// SubSessionID is set on events forwarded from a sub-session (e.g. a
+	// transfer_task) to the parent's stream. It is the ID of the sub-session
+	// that produced the event.
+	SubSessionID string `json:"sub_session_id,omitempty"`
+	// Depth is the sub-session nesting level of the event: 0 for events of
+	// the session being run, 1 for its sub-sessions, and so on.
+	Depth int `json:"depth,omitempty"`
+	// Seq is the position of the event in its session's stream. Sequence
+	// numbers increase monotonically across the runs of a session.
+	Seq uint64 `json:"seq,omitempty"`
 }
 
 // GetAgentName returns the agent name for events embedding AgentContext.
 func (a AgentContext) GetAgentName() string { return a.AgentName }
 
+// GetSubSessionID returns the ID of the sub-session that produced the event,
+// or an empty string for events of the session being run.
+func (a AgentContext) GetSubSessionID() string { return a.SubSessionID }
+
+// GetDepth returns the sub-session nesting level of the event.
+func (a AgentContext) GetDepth() int { return a.Depth }
+
+// GetSeq returns the sequence number of the event.
+func (a AgentContext) GetSeq() uint64 { return a.Seq }
+
+func (a *AgentContext) setSeq(seq uint64) { a.Seq = seq }
+
+// forwardedFrom tags an event forwarded from a sub-session to its parent.
+// The innermost sub-session ID is kept; the depth grows at each level.
+func (a *AgentContext) forwardedFrom(subSessionID string) {
+	if a.SubSessionID == "" {
+		a.SubSessionID = subSessionID
+	}
+	a.Depth++
+}
+
+// Category returns CategorySystem. Content and tool events override it.
+func (a AgentContext) Category() EventCategory { return CategorySystem }
+
+func (*UserMessageEvent) Category() EventCategory          { return CategoryContent }
+func (*AgentChoiceEvent) Category() EventCategory          { return CategoryContent }
+func (*AgentChoiceReasoningEvent) Category() EventCategory { return CategoryContent }
+func (*MessageAddedEvent) Category() EventCategory         { return CategoryContent }
+func (*ShellOutputEvent) Category() EventCategory          { return CategoryContent }
+func (*SubAgentResultEvent) Category() EventCategory       { return CategoryContent }
+
+func (*PartialToolCallEvent) Category() EventCategory       { return CategoryTool }
+func (*ToolCallArgsDeltaEvent) Category() EventCategory     { return CategoryTool }
+func (*ToolCallEvent) Category() EventCategory              { return CategoryTool }
+func (*ToolCallConfirmationEvent) Category() EventCategory  { return CategoryTool }
+func (*ToolApprovalRequestedEvent) Category() EventCategory { return CategoryTool }
+func (*ToolCallResponseEvent) Category() EventCategory      { return CategoryTool }
+func (*ToolCallLimitReachedEvent) Category() EventCategory  { return CategoryTool }
+func (*UnknownToolCallEvent) Category() EventCategory       { return CategoryTool }
+func (*HookBlockedEvent) Category() EventCategory           { return CategoryTool }
+
 // newAgentContext creates a new AgentContext with the current timestamp.
 func newAgentContext(agentName string) AgentContext {
-	return AgentContext{AgentName: agentName, Timestamp: time.Now()}
+	return AgentContext{AgentName: agentName, Timestamp: session.Now()}
 }
 
 // UserMessageEvent is sent when a user message is received
@@ -70,6 +142,28 @@ func PartialToolCall(toolCall tools.ToolCall, toolDefinition tools.Tool, agentNa
 	}
 }
 
+// ToolCallArgsDeltaEvent is sent for every fragment of a tool call's
+// arguments as the model streams them. Index is the position of the tool
+// call in the model response. Concatenating the deltas of a tool call gives
+// its complete JSON arguments.
+type ToolCallArgsDeltaEvent struct {
+	Type       string `json:"type"`
+	Index      int    `json:"index"`
+	ToolCallID string `json:"tool_call_id"`
+	Delta      string `json:"delta"`
+	AgentContext
+}
+
+func ToolCallArgsDelta(index int, toolCallID, delta, agentName string) Event {
+	return &ToolCallArgsDeltaEvent{
+		Type:         "tool_call_args_delta",
+		Index:        index,
+		ToolCallID:   toolCallID,
+		Delta:        delta,
+		AgentContext: newAgentContext(agentName),
+	}
+}
+
 // ToolCallEvent is sent when a tool call is received
 type ToolCallEvent struct {
 	Type           string         `json:"type"`
@@ -103,6 +197,29 @@ func ToolCallConfirmation(toolCall tools.ToolCall, toolDefinition tools.Tool, ag
 	}
 }
 
+// ToolApprovalRequestedEvent is sent right before the runtime waits for the
+// user to approve or reject a tool call, with what a confirmation dialog needs
+// to show.
+type ToolApprovalRequestedEvent struct {
+	Type        string `json:"type"`
+	CallID      string `json:"call_id"`
+	ToolName    string `json:"tool_name"`
+	Arguments   string `json:"arguments"`
+	Destructive bool   `json:"destructive"`
+	AgentContext
+}
+
+func ToolApprovalRequested(callID, toolName, argsJSON string, destructive bool, agentName string) Event {
+	return &ToolApprovalRequestedEvent{
+		Type:         "tool_approval_requested",
+		CallID:       callID,
+		ToolName:     toolName,
+		Arguments:    argsJSON,
+		Destructive:  destructive,
+		AgentContext: newAgentContext(agentName),
+	}
+}
+
 type ToolCallResponseEvent struct {
 	Type           string                `json:"type"`
 	ToolCall       tools.ToolCall        `json:"tool_call"`
@@ -206,6 +323,99 @@ func Warning(message, agentName string) Event {
 	}
 }
 
+// ToolCallLimitReachedEvent is emitted when the model requests more tool calls
+// in a single turn than the agent allows. The extra calls are not executed.
+type ToolCallLimitReachedEvent struct {
+	Type      string `json:"type"`
+	Limit     int    `json:"limit"`
+	Requested int    `json:"requested"`
+	AgentContext
+}
+
+func ToolCallLimitReached(limit, requested int, agentName string) Event {
+	return &ToolCallLimitReachedEvent{
+		Type:         "tool_call_limit_reached",
+		Limit:        limit,
+		Requested:    requested,
+		AgentContext: newAgentContext(agentName),
+	}
+}
+
+// UnknownToolCallEvent is emitted when the model calls a tool that isn't in
+// the agent's tool set. The call is answered with an error listing
+// AvailableTools, or aborts the run in strict mode.
+type UnknownToolCallEvent struct {
+	Type           string         `json:"type"`
+	ToolCall       tools.ToolCall `json:"tool_call"`
+	AvailableTools []string       `json:"available_tools"`
+	AgentContext
+}
+
+func UnknownToolCall(toolCall tools.ToolCall, availableTools []string, agentName string) Event {
+	return &UnknownToolCallEvent{
+		Type:           "unknown_tool_call",
+		ToolCall:       toolCall,
+		AvailableTools: availableTools,
+		AgentContext:   newAgentContext(agentName),
+	}
+}
+
+// ResponseFinishedEvent is emitted once the model finished streaming a
+// response. FinishReason tells a response that was cut short by the token
+// limit ("length") from one that ended naturally ("stop") or with tool calls
+// ("tool_calls"). It is empty if the provider didn't report a reason.
+type ResponseFinishedEvent struct {
+	Type         string            `json:"type"`
+	FinishReason chat.FinishReason `json:"finish_reason,omitempty"`
+	AgentContext
+}
+
+func ResponseFinished(finishReason chat.FinishReason, agentName string) Event {
+	return &ResponseFinishedEvent{
+		Type:         "response_finished",
+		FinishReason: finishReason,
+		AgentContext: newAgentContext(agentName),
+	}
+}
+
+// ContinuationStartedEvent is emitted when the runtime asks the model to
+// continue a response that was cut off by the output token limit, see
+// WithAutoContinueOnLength. The continuation's content follows the truncated
+// content.
+type ContinuationStartedEvent struct {
+	Type             string `json:"type"`
+	Continuation     int    `json:"continuation"`      // 1 for the first continuation of a response
+	MaxContinuations int    `json:"max_continuations"` // Continuations allowed in a row
+	AgentContext
+}
+
+func ContinuationStarted(continuation, maxContinuations int, agentName string) Event {
+	return &ContinuationStartedEvent{
+		Type:             "continuation_started",
+		Continuation:     continuation,
+		MaxContinuations: maxContinuations,
+		AgentContext:     newAgentContext(agentName),
+	}
+}
+
+// CostBudgetExceededEvent is emitted when a run stops because the cost of the
+// session went over the budget set with WithCostBudget.
+type CostBudgetExceededEvent struct {
+	Type   string  `json:"type"`
+	Cost   float64 `json:"cost"`
+	Budget float64 `json:"budget"`
+	AgentContext
+}
+
+func CostBudgetExceeded(cost, budget float64, agentName string) Event {
+	return &CostBudgetExceededEvent{
+		Type:         "cost_budget_exceeded",
+		Cost:         cost,
+		Budget:       budget,
+		AgentContext: newAgentContext(agentName),
+	}
+}
+
 // ModelFallbackEvent is emitted when the runtime switches to a fallback model
 // after the previous model in the chain fails. This can happen due to:
 // - Retryable errors (5xx, timeouts) after exhausting retries
@@ -254,8 +464,9 @@ type Usage struct {
 type MessageUsage struct {
 	chat.Usage
 	chat.RateLimit
-	Cost  float64
-	Model string
+	Cost         float64
+	CacheSavings float64 // Cost saved by reading input tokens from the prompt cache
+	Model        string
 }
 
 // NewTokenUsageEvent creates a TokenUsageEvent with the given usage data.
@@ -311,6 +522,24 @@ func SessionSummary(sessionID, summary, agentName string) Event {
 	}
 }
 
+// SummaryDeltaEvent carries a chunk of the session summary while it is being
+// generated. The complete summary follows in a SessionSummaryEvent.
+type SummaryDeltaEvent struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	Delta     string `json:"delta"`
+	AgentContext
+}
+
+func SummaryDelta(sessionID, delta, agentName string) Event {
+	return &SummaryDeltaEvent{
+		Type:         "summary_delta",
+		SessionID:    sessionID,
+		Delta:        delta,
+		AgentContext: newAgentContext(agentName),
+	}
+}
+
 type SessionCompactionEvent struct {
 	Type      string `json:"type"`
 	SessionID string `json:"session_id"`
@@ -327,6 +556,31 @@ func SessionCompaction(sessionID, status, agentName string) Event {
 	}
 }
 
+// SessionCompactedEvent is sent once a summary has replaced part of the
+// session history. FirstItem and LastItem are the indexes of the first and
+// last session items that were summarized.
+type SessionCompactedEvent struct {
+	Type               string `json:"type"`
+	SessionID          string `json:"session_id"`
+	MessagesSummarized int    `json:"messages_summarized"`
+	SummaryLength      int    `json:"summary_length"`
+	FirstItem          int    `json:"first_item"`
+	LastItem           int    `json:"last_item"`
+	AgentContext
+}
+
+func SessionCompacted(sessionID string, messagesSummarized, summaryLength, firstItem, lastItem int, agentName string) Event {
+	return &SessionCompactedEvent{
+		Type:               "session_compacted",
+		SessionID:          sessionID,
+		MessagesSummarized: messagesSummarized,
+		SummaryLength:      summaryLength,
+		FirstItem:          firstItem,
+		LastItem:           lastItem,
+		AgentContext:       newAgentContext(agentName),
+	}
+}
+
 type StreamStoppedEvent struct {
 	Type      string `json:"type"`
 	SessionID string `json:"session_id,omitempty"`
@@ -613,3 +867,19 @@ func SubSessionCompleted(parentSessionID string, subSession any, agentName strin
 		AgentContext:    newAgentContext(agentName),
 	}
 }
+
+// SubAgentResultEvent carries the final answer of a sub-agent. It replaces the
+// events of the sub-session with SubSessionEventModeFinalOnly.
+type SubAgentResultEvent struct {
+	Type   string `json:"type"`
+	Output string `json:"output"`
+	AgentContext
+}
+
+func SubAgentResult(agentName, output string) Event {
+	return &SubAgentResultEvent{
+		Type:         "sub_agent_result",
+		Output:       output,
+		AgentContext: newAgentContext(agentName),
+	}
+}
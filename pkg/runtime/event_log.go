@@ -0,0 +1,219 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/docker/cagent/pkg/session"
+)
+
+// eventLogSize is the number of recent events kept per session for
+// ResumeStream.
+const eventLogSize = 1024
+
+// eventLogRetention is how long the events of a session are kept after its
+// stream ends, for consumers that reconnect late.
+const eventLogRetention = 5 * time.Minute
+
+// eventLog numbers the events of a session's stream and keeps the most recent
+// ones in a ring buffer so that a consumer that got disconnected can catch up.
+type eventLog struct {
+	mu          sync.Mutex
+	ring        [eventLogSize]Event
+	seq         uint64 // Sequence number of the last event
+	live        bool   // A run of the session is streaming
+	runs        uint64 // Number of runs started, to tell whether a new one started
+	subscribers []*eventSubscriber
+}
+
+type eventSubscriber struct {
+	events chan Event
+	done   chan struct{} // Closed along with events
+}
+
+func (s *eventSubscriber) close() {
+	close(s.events)
+	close(s.done)
+}
+
+func (l *eventLog) start() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.live = true
+	l.runs++
+}
+
+// append assigns the next sequence number to event, stores it and hands it to
+// the subscribers. A subscriber whose buffer is full is disconnected: it has
+// to resume again from the last event it got.
+func (l *eventLog) append(event Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	if e, ok := event.(interface{ setSeq(uint64) }); ok {
+		e.setSeq(l.seq)
+	}
+	l.ring[l.seq%eventLogSize] = event
+
+	subscribers := l.subscribers[:0]
+	for _, sub := range l.subscribers {
+		select {
+		case sub.events <- event:
+			subscribers = append(subscribers, sub)
+		default:
+			slog.Warn("Resumed stream consumer is too slow, disconnecting it", "seq", l.seq)
+			sub.close()
+		}
+	}
+	l.subscribers = subscribers
+}
+
+// finish closes the subscribers once the run is over. It returns the number
+// of runs started so far, see idleSince.
+func (l *eventLog) finish() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.live = false
+	for _, sub := range l.subscribers {
+		sub.close()
+	}
+	l.subscribers = nil
+	return l.runs
+}
+
+// idleSince reports whether no run started since finish returned runs.
+func (l *eventLog) idleSince(runs uint64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.live && l.runs == runs
+}
+
+// subscribe returns a channel with the buffered events after afterSeq,
+// followed by the live events of the current run, if any.
+func (l *eventLog) subscribe(afterSeq uint64) *eventSubscriber {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	oldest := uint64(1)
+	if l.seq > eventLogSize {
+		oldest = l.seq - eventLogSize + 1
+	}
+
+	var replay []Event
+	if afterSeq+1 < oldest {
+		replay = append(replay, Warning(fmt.Sprintf("%d events were dropped from the stream", oldest-afterSeq-1), ""))
+	}
+	for seq := max(afterSeq+1, oldest); seq <= l.seq; seq++ {
+		replay = append(replay, l.ring[seq%eventLogSize])
+	}
+
+	sub := &eventSubscriber{
+		events: make(chan Event, len(replay)+defaultEventBufferSize),
+		done:   make(chan struct{}),
+	}
+	for _, event := range replay {
+		sub.events <- event
+	}
+
+	if l.live {
+		l.subscribers = append(l.subscribers, sub)
+	} else {
+		sub.close()
+	}
+	return sub
+}
+
+func (l *eventLog) unsubscribe(sub *eventSubscriber) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, s := range l.subscribers {
+		if s == sub {
+			l.subscribers = slices.Delete(l.subscribers, i, i+1)
+			sub.close()
+			return
+		}
+	}
+}
+
+// sequenceEvents numbers the events of a session's stream and records them in
+// the session's event log. Sub-session events are numbered when they are
+// forwarded to their parent's stream.
+func (r *LocalRuntime) sequenceEvents(sess *session.Session, in <-chan Event) <-chan Event {
+	if sess.IsSubSession() {
+		return in
+	}
+
+	// The log is started under eventLogsMux so that it can't be forgotten
+	// in between by forgetEventLog.
+	r.eventLogsMux.Lock()
+	log, ok := r.eventLogs[sess.ID]
+	if !ok {
+		log = &eventLog{}
+		r.eventLogs[sess.ID] = log
+	}
+	log.start()
+	r.eventLogsMux.Unlock()
+
+	out := make(chan Event, r.eventBufferSize)
+	go func() {
+		defer close(out)
+
+		for event := range in {
+			log.append(event)
+			out <- event
+		}
+
+		runs := log.finish()
+		time.AfterFunc(r.eventLogRetention, func() {
+			r.forgetEventLog(sess.ID, log, runs)
+		})
+	}()
+	return out
+}
+
+// forgetEventLog drops the event log of a session, unless another run of the
+// session started after the one that ended with runs.
+func (r *LocalRuntime) forgetEventLog(sessionID string, log *eventLog, runs uint64) {
+	r.eventLogsMux.Lock()
+	defer r.eventLogsMux.Unlock()
+
+	if r.eventLogs[sessionID] == log && log.idleSince(runs) {
+		delete(r.eventLogs, sessionID)
+	}
+}
+
+// ResumeStream returns the events of the session's stream that come after
+// the event numbered afterSeq, followed by the live events of the current run
+// if the session is running. Only the most recent events of a session are
+// kept, until a few minutes after its stream ends; when some of the requested
+// events are gone, a Warning event comes first. The channel is closed when the run ends, when ctx is done, or when
+// the consumer falls too far behind, in which case it can resume again from
+// the last event it got.
+func (r *LocalRuntime) ResumeStream(ctx context.Context, sess *session.Session, afterSeq uint64) <-chan Event {
+	r.eventLogsMux.Lock()
+	log, ok := r.eventLogs[sess.ID]
+	r.eventLogsMux.Unlock()
+
+	if !ok {
+		ch := make(chan Event)
+		close(ch)
+		return ch
+	}
+
+	sub := log.subscribe(afterSeq)
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.unsubscribe(sub)
+		case <-sub.done:
+		}
+	}()
+	return sub.events
+}
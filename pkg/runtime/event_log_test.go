@@ -0,0 +1,114 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/agent"
+	"github.com/docker/cagent/pkg/session"
+	"github.com/docker/cagent/pkg/team"
+)
+
+func drainEvents(ch <-chan Event) []Event {
+	var events []Event
+	for event := range ch {
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestResumeStream(t *testing.T) {
+	stream := newStreamBuilder().AddContent("Hello").AddStopWithUsage(3, 2).Build()
+	prov := &mockProvider{id: "test/mock-model", stream: stream}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Hi"))
+	events := drainEvents(rt.RunStream(t.Context(), sess))
+	require.NotEmpty(t, events)
+	for i, event := range events {
+		assert.Equal(t, uint64(i+1), event.GetSeq())
+	}
+
+	assert.Equal(t, events[3:], drainEvents(rt.ResumeStream(t.Context(), sess, 3)))
+	assert.Empty(t, drainEvents(rt.ResumeStream(t.Context(), sess, uint64(len(events)))))
+	assert.Empty(t, drainEvents(rt.ResumeStream(t.Context(), session.New(), 0)))
+}
+
+func TestResumeStreamForgetsEndedStreams(t *testing.T) {
+	prov := &mockProvider{id: "test/mock-model", stream: newStreamBuilder().AddContent("Hello").AddStopWithUsage(3, 2).Build()}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+	rt.eventLogRetention = 10 * time.Millisecond
+
+	sess := session.New(session.WithUserMessage("Hi"))
+	require.NotEmpty(t, drainEvents(rt.RunStream(t.Context(), sess)))
+	assert.NotEmpty(t, drainEvents(rt.ResumeStream(t.Context(), sess, 0)), "events are kept right after the stream ends")
+
+	assert.Eventually(t, func() bool {
+		rt.eventLogsMux.Lock()
+		defer rt.eventLogsMux.Unlock()
+		return len(rt.eventLogs) == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Empty(t, drainEvents(rt.ResumeStream(t.Context(), sess, 0)))
+}
+
+func TestForgetEventLogKeepsRestartedStreams(t *testing.T) {
+	rt := &LocalRuntime{eventLogs: map[string]*eventLog{}}
+	log := &eventLog{}
+	rt.eventLogs["id"] = log
+
+	log.start()
+	runs := log.finish()
+	log.start()
+
+	rt.forgetEventLog("id", log, runs)
+	assert.Contains(t, rt.eventLogs, "id")
+
+	rt.forgetEventLog("id", log, log.finish())
+	assert.NotContains(t, rt.eventLogs, "id")
+}
+
+func TestEventLogLiveSubscriber(t *testing.T) {
+	var log eventLog
+	log.start()
+	for range 3 {
+		log.append(Warning("before", "root"))
+	}
+
+	sub := log.subscribe(1)
+	log.append(Warning("after", "root"))
+	log.finish()
+
+	var seqs []uint64
+	for event := range sub.events {
+		seqs = append(seqs, event.GetSeq())
+	}
+	assert.Equal(t, []uint64{2, 3, 4}, seqs)
+}
+
+func TestEventLogReportsDroppedEvents(t *testing.T) {
+	var log eventLog
+	log.start()
+	for range eventLogSize + 5 {
+		log.append(Warning("event", "root"))
+	}
+	log.finish()
+
+	events := drainEvents(log.subscribe(0).events)
+	require.Len(t, events, eventLogSize+1)
+
+	warning, ok := events[0].(*WarningEvent)
+	require.True(t, ok)
+	assert.Contains(t, warning.Message, "5 events were dropped")
+	assert.Equal(t, uint64(6), events[1].GetSeq())
+}
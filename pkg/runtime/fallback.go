@@ -17,7 +17,6 @@ import (
 	"github.com/docker/cagent/pkg/agent"
 	"github.com/docker/cagent/pkg/chat"
 	"github.com/docker/cagent/pkg/model/provider"
-	"github.com/docker/cagent/pkg/model/provider/options"
 	"github.com/docker/cagent/pkg/modelsdev"
 	"github.com/docker/cagent/pkg/session"
 	"github.com/docker/cagent/pkg/tools"
@@ -144,6 +143,16 @@ func isRetryableModelError(err error) bool {
 		return false
 	}
 
+	// Retrying the same prompt won't make it fit in the context window
+	if errors.Is(err, provider.ErrContextExceeded) {
+		return false
+	}
+
+	// A stalled stream is worth another try
+	if errors.Is(err, ErrStreamIdleTimeout) {
+		return true
+	}
+
 	// First, try to extract HTTP status code from known SDK error types
 	if statusCode := extractHTTPStatusCode(err); statusCode != 0 {
 		retryable := isRetryableStatusCode(statusCode)
@@ -422,13 +431,13 @@ func (r *LocalRuntime) tryModelWithFallback(
 	m *modelsdev.Model,
 	events chan Event,
 ) (streamResult, provider.Provider, error) {
-	// Clone fallback models with the same thinking override as the primary model.
-	// The primary model was already cloned with options.WithThinking(sess.Thinking)
+	// Clone fallback models with the same overrides as the primary model.
+	// The primary model was already cloned with agentModelOptions(a, sess.Thinking)
 	// in the main runtime loop, so we apply the same to fallbacks for consistency.
 	rawFallbacks := a.FallbackModels()
 	fallbackModels := make([]provider.Provider, len(rawFallbacks))
 	for i, fb := range rawFallbacks {
-		fallbackModels[i] = provider.CloneWithOptions(ctx, fb, options.WithThinking(sess.Thinking))
+		fallbackModels[i] = provider.CloneWithOptions(ctx, fb, agentModelOptions(a, sess.Thinking)...)
 	}
 
 	fallbackRetries := getEffectiveRetries(a)
@@ -451,6 +460,9 @@ func (r *LocalRuntime) tryModelWithFallback(
 	}
 
 	var lastErr error
+	// Remember if any model rejected the prompt as too long, so that the caller
+	// can shrink the conversation even if a later model failed differently.
+	var contextExceededErr error
 	primaryFailedWithNonRetryable := false
 
 	for chainIdx := startIndex; chainIdx < len(modelChain); chainIdx++ {
@@ -501,9 +513,12 @@ func (r *LocalRuntime) tryModelWithFallback(
 				"in_cooldown", inCooldown,
 				"attempt", attempt+1)
 
-			stream, err := modelEntry.provider.CreateChatCompletionStream(ctx, messages, agentTools)
+			stream, cancelStream, err := createStream(ctx, modelEntry.provider, messages, agentTools)
 			if err != nil {
 				lastErr = err
+				if errors.Is(err, provider.ErrContextExceeded) {
+					contextExceededErr = err
+				}
 
 				// Context cancellation is never retryable
 				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
@@ -538,12 +553,16 @@ func (r *LocalRuntime) tryModelWithFallback(
 			// Stream created successfully, now handle it
 			slog.Debug("Processing stream", "agent", a.Name(), "model", modelEntry.provider.ID())
 			res, err := r.handleStream(ctx, stream, a, agentTools, sess, m, events)
+			cancelStream()
 			if err != nil {
 				lastErr = err
+				if errors.Is(err, provider.ErrContextExceeded) {
+					contextExceededErr = err
+				}
 
-				// Context cancellation stops everything
+				// Context cancellation stops everything, keeping the partial result
 				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-					return streamResult{}, nil, err
+					return res, modelEntry.provider, err
 				}
 
 				// Check if stream error is retryable
@@ -588,6 +607,9 @@ func (r *LocalRuntime) tryModelWithFallback(
 	}
 
 	// All models and retries exhausted
+	if contextExceededErr != nil {
+		return streamResult{}, nil, fmt.Errorf("all models failed: %w", contextExceededErr)
+	}
 	if lastErr != nil {
 		return streamResult{}, nil, fmt.Errorf("all models failed: %w", lastErr)
 	}
@@ -681,6 +681,40 @@ func TestFallback429SkipsToNextModel(t *testing.T) {
 	})
 }
 
+func TestFallbackReportsContextExceeded(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		// Primary rejects the prompt as too long, the fallback is rate limited.
+		primary := &countingProvider{
+			id:        "primary/small-context",
+			failCount: 100,
+			err:       base.WrapContextExceeded(errors.New("prompt is too long")),
+		}
+		fallback := &countingProvider{
+			id:        "fallback/rate-limited",
+			failCount: 100,
+			err:       errors.New("POST /v1/chat/completions: 429 Too Many Requests"),
+		}
+
+		root := agent.New("root", "test",
+			agent.WithModel(primary),
+			agent.WithFallbackModel(fallback),
+			agent.WithFallbackRetries(2),
+		)
+
+		tm := team.New(team.WithAgents(root))
+		rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+		require.NoError(t, err)
+
+		sess := session.New(session.WithUserMessage("test"))
+		events := make(chan Event, 10)
+
+		_, _, err = rt.tryModelWithFallback(t.Context(), root, primary, nil, nil, sess, nil, events)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, provider.ErrContextExceeded, "the caller must be able to recover even though the last model failed differently")
+		assert.Equal(t, 1, primary.callCount, "context exceeded is not retried on the same model")
+	})
+}
+
 func TestFallbackCooldownState(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
 		// Create a mock provider for the agent
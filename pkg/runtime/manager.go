@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/docker/cagent/pkg/session"
+)
+
+// Manager keeps track of the runs started through it, so that they can be
+// listed and canceled, for example when a server shuts down.
+type Manager struct {
+	mu   sync.Mutex
+	runs map[string]*activeRun
+}
+
+type activeRun struct {
+	cancel context.CancelFunc
+}
+
+// NewManager creates a Manager with no active runs.
+func NewManager() *Manager {
+	return &Manager{
+		runs: make(map[string]*activeRun),
+	}
+}
+
+// RunStream starts rt.RunStream for the session and registers the run until
+// it ends: the run is removed from the active runs before the returned channel
+// is closed. A session can only have one active run: if it's already running,
+// no run is started and the returned channel only carries an Error event.
+func (m *Manager) RunStream(ctx context.Context, rt Runtime, sess *session.Session) <-chan Event {
+	m.mu.Lock()
+	if _, running := m.runs[sess.ID]; running {
+		m.mu.Unlock()
+		out := make(chan Event, 1)
+		out <- Error(fmt.Sprintf("session %s is already running", sess.ID))
+		close(out)
+		return out
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	run := &activeRun{cancel: cancel}
+	m.runs[sess.ID] = run
+	m.mu.Unlock()
+
+	events := rt.RunStream(ctx, sess)
+
+	out := make(chan Event, defaultEventBufferSize)
+	go func() {
+		defer close(out)
+		defer cancel()
+		defer m.remove(sess.ID, run)
+
+		for event := range events {
+			out <- event
+		}
+	}()
+	return out
+}
+
+func (m *Manager) remove(sessionID string, run *activeRun) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.runs[sessionID] == run {
+		delete(m.runs, sessionID)
+	}
+}
+
+// ActiveRuns returns the IDs of the sessions being run, sorted.
+func (m *Manager) ActiveRuns() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, 0, len(m.runs))
+	for id := range m.runs {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Cancel cancels the run of the session, if any. The run is removed from
+// the active runs once its event channel is closed.
+func (m *Manager) Cancel(sessionID string) {
+	m.mu.Lock()
+	run, ok := m.runs[sessionID]
+	m.mu.Unlock()
+
+	if ok {
+		run.cancel()
+	}
+}
+
+// CancelAll cancels every active run.
+func (m *Manager) CancelAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, run := range m.runs {
+		run.cancel()
+	}
+}
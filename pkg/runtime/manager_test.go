@@ -0,0 +1,56 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/session"
+)
+
+// blockingRuntime streams a single event and then waits for its context to
+// be canceled.
+type blockingRuntime struct {
+	Runtime
+}
+
+func (blockingRuntime) RunStream(ctx context.Context, sess *session.Session) <-chan Event {
+	events := make(chan Event, 1)
+	events <- StreamStarted(sess.ID, "root")
+	go func() {
+		<-ctx.Done()
+		close(events)
+	}()
+	return events
+}
+
+func TestManager(t *testing.T) {
+	m := NewManager()
+	first := session.New()
+	second := session.New()
+
+	firstEvents := m.RunStream(t.Context(), blockingRuntime{}, first)
+	secondEvents := m.RunStream(t.Context(), blockingRuntime{}, second)
+	<-firstEvents
+	<-secondEvents
+
+	assert.ElementsMatch(t, []string{first.ID, second.ID}, m.ActiveRuns())
+
+	// A session that is already running isn't started again.
+	duplicate := drainEvents(m.RunStream(t.Context(), blockingRuntime{}, first))
+	require.Len(t, duplicate, 1)
+	assert.IsType(t, &ErrorEvent{}, duplicate[0])
+	assert.ElementsMatch(t, []string{first.ID, second.ID}, m.ActiveRuns())
+
+	m.Cancel(first.ID)
+	for range firstEvents {
+	}
+	assert.Equal(t, []string{second.ID}, m.ActiveRuns())
+
+	m.CancelAll()
+	for range secondEvents {
+	}
+	assert.Empty(t, m.ActiveRuns())
+}
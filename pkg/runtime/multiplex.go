@@ -0,0 +1,48 @@
+package runtime
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Multiplex fans the events of in out to n consumers. Every consumer gets
+// every event, in order, through a channel buffered like the one returned by
+// RunStream. A consumer that falls behind by more than the buffer doesn't
+// block the others: the events it can't take are dropped with a warning.
+// All returned channels are closed once in is closed.
+func Multiplex(in <-chan Event, n int) []<-chan Event {
+	outs := make([]chan Event, n)
+	result := make([]<-chan Event, n)
+	for i := range outs {
+		outs[i] = make(chan Event, defaultEventBufferSize)
+		result[i] = outs[i]
+	}
+
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+
+		dropped := make([]int, n)
+		for event := range in {
+			for i, out := range outs {
+				select {
+				case out <- event:
+					if dropped[i] > 0 {
+						slog.Warn("Event consumer caught up", "consumer", i, "dropped", dropped[i])
+						dropped[i] = 0
+					}
+				default:
+					if dropped[i] == 0 {
+						slog.Warn("Event consumer is too slow, dropping events", "consumer", i, "event", fmt.Sprintf("%T", event))
+					}
+					dropped[i]++
+				}
+			}
+		}
+	}()
+
+	return result
+}
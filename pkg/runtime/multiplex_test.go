@@ -0,0 +1,52 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiplex(t *testing.T) {
+	in := make(chan Event)
+	outs := Multiplex(in, 2)
+	require.Len(t, outs, 2)
+
+	go func() {
+		for range 3 {
+			in <- Warning("hello", "root")
+		}
+		close(in)
+	}()
+
+	for _, out := range outs {
+		var count int
+		for range out {
+			count++
+		}
+		assert.Equal(t, 3, count)
+	}
+}
+
+func TestMultiplexDropsEventsForSlowConsumer(t *testing.T) {
+	in := make(chan Event)
+	outs := Multiplex(in, 2)
+
+	// outs[0] takes every event as it comes while outs[1] isn't read until
+	// everything was sent, so it only keeps what fits in its buffer.
+	total := defaultEventBufferSize + 10
+	for range total {
+		in <- Warning("hello", "root")
+		<-outs[0]
+	}
+	close(in)
+
+	_, ok := <-outs[0]
+	assert.False(t, ok)
+
+	var slow int
+	for range outs[1] {
+		slow++
+	}
+	assert.Equal(t, defaultEventBufferSize, slow)
+}
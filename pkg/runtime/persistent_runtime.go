@@ -1,10 +1,14 @@
 package runtime
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/docker/cagent/pkg/chat"
 	"github.com/docker/cagent/pkg/session"
@@ -23,6 +27,16 @@ type streamingState struct {
 	reasoningContent strings.Builder
 	agentName        string
 	messageID        int64 // ID of the current streaming message (0 if none)
+	lastFlush        time.Time
+	dirty            bool // Content was received but not written yet
+}
+
+func (s *streamingState) reset() {
+	s.content.Reset()
+	s.reasoningContent.Reset()
+	s.agentName = ""
+	s.messageID = 0
+	s.dirty = false
 }
 
 // New creates a new runtime for an agent and its team.
@@ -42,14 +56,18 @@ func New(agents *team.Team, opts ...Opt) (Runtime, error) {
 // RunStream wraps the inner runtime's RunStream and intercepts events
 // to persist session changes to the store.
 func (r *PersistentRuntime) RunStream(ctx context.Context, sess *session.Session) <-chan Event {
+	return r.filterEvents(sess, r.runStream(ctx, r.inputSession(sess)))
+}
+
+func (r *PersistentRuntime) runStream(ctx context.Context, sess *session.Session) <-chan Event {
 	if !sess.IsSubSession() {
 		if err := r.sessionStore.UpdateSession(ctx, sess); err != nil {
 			slog.Warn("Failed to persist initial session", "session_id", sess.ID, "error", err)
 		}
 	}
 
-	innerEvents := r.LocalRuntime.RunStream(ctx, sess)
-	events := make(chan Event, 128)
+	innerEvents := r.LocalRuntime.runStream(ctx, sess)
+	events := make(chan Event, r.eventBufferSize)
 
 	go func() {
 		defer close(events)
@@ -60,6 +78,22 @@ func (r *PersistentRuntime) RunStream(ctx context.Context, sess *session.Session
 			r.handleEvent(ctx, sess, event, streaming)
 			events <- event
 		}
+
+		// Write debounced content even if the turn was cancelled.
+		r.flushStreamingContent(context.WithoutCancel(ctx), sess.ID, streaming)
+
+		if r.syncFlushOnComplete && !sess.IsSubSession() {
+			if err := r.syncSession(context.WithoutCancel(ctx), sess); err != nil {
+				slog.Error("Failed to persist session", "session_id", sess.ID, "error", err)
+				events <- Error(fmt.Sprintf("persisting session: %v", err))
+			}
+		}
+
+		// A session still pending in a lazy store was abandoned, or the run
+		// was canceled before it got a real message. The next run records it again.
+		if lazy, ok := r.sessionStore.(*session.LazyStore); ok {
+			lazy.Forget(sess.ID)
+		}
 	}()
 
 	return events
@@ -88,34 +122,41 @@ func (r *PersistentRuntime) handleEvent(ctx context.Context, sess *session.Sessi
 
 	case *UserMessageEvent:
 		// Reset streaming state when a user message is received
-		streaming.content.Reset()
-		streaming.reasoningContent.Reset()
-		streaming.agentName = ""
-		streaming.messageID = 0
+		r.flushStreamingContent(ctx, sess.ID, streaming)
+		streaming.reset()
 
-		if _, err := r.sessionStore.AddMessage(ctx, e.SessionID, session.UserMessage(e.Message, e.MultiContent...)); err != nil {
+		msg := session.UserMessage(e.Message, e.MultiContent...)
+		if e.SessionID == sess.ID {
+			if added := sess.MessageAt(e.SessionPosition); added != nil {
+				msg.Attachments = added.Attachments
+			}
+		}
+		if _, err := r.sessionStore.AddMessage(ctx, e.SessionID, msg); err != nil {
 			slog.Warn("Failed to persist user message", "session_id", e.SessionID, "error", err)
 		}
 
 	case *MessageAddedEvent:
-		// Finalize the streaming message with complete metadata
-		if streaming.messageID != 0 {
+		msg := r.transformForPersistence(e.Message)
+		switch {
+		case msg == nil:
+			// The persist transform dropped the message
+		case streaming.messageID != 0:
 			// Update the existing streaming message with final content
-			if err := r.sessionStore.UpdateMessage(ctx, streaming.messageID, e.Message); err != nil {
+			if err := r.sessionStore.UpdateMessage(ctx, streaming.messageID, msg); err != nil {
 				slog.Warn("Failed to finalize streaming message", "session_id", e.SessionID, "message_id", streaming.messageID, "error", err)
 			}
-		} else {
+		default:
 			// No streaming message exists, create a new one
-			if _, err := r.sessionStore.AddMessage(ctx, e.SessionID, e.Message); err != nil {
+			if _, err := r.sessionStore.AddMessage(ctx, e.SessionID, msg); err != nil {
 				slog.Warn("Failed to persist message", "session_id", e.SessionID, "error", err)
 			}
 		}
 
 		// Reset streaming state after message is finalized
-		streaming.content.Reset()
-		streaming.reasoningContent.Reset()
-		streaming.agentName = ""
-		streaming.messageID = 0
+		streaming.reset()
+
+	case *StreamStoppedEvent:
+		r.flushStreamingContent(ctx, sess.ID, streaming)
 
 	case *SubSessionCompletedEvent:
 		if subSess, ok := e.SubSession.(*session.Session); ok {
@@ -134,27 +175,68 @@ func (r *PersistentRuntime) handleEvent(ctx context.Context, sess *session.Sessi
 		// During task transfers, sub-session events flow through but should
 		// not overwrite the parent session's token counts.
 		if e.Usage != nil && e.SessionID == sess.ID {
-			if err := r.sessionStore.UpdateSessionTokens(ctx, sess.ID, e.Usage.InputTokens, e.Usage.OutputTokens, e.Usage.Cost); err != nil {
+			if err := r.sessionStore.UpdateSessionTokens(ctx, sess.ID, e.Usage.InputTokens, e.Usage.OutputTokens, sess.Cost, sess.LifetimeCost); err != nil {
 				slog.Warn("Failed to persist token usage", "session_id", sess.ID, "error", err)
 			}
 		}
 
+		// Token usage is reported once per turn, by the agent that ran it.
+		// Record it so that resuming the session continues with that agent.
+		if e.SessionID == sess.ID && sess.AgentName == "" && e.AgentName != "" && e.AgentName != sess.CurrentAgent {
+			sess.CurrentAgent = e.AgentName
+			if err := r.sessionStore.UpdateSession(ctx, sess); err != nil {
+				slog.Warn("Failed to persist current agent", "session_id", sess.ID, "agent", e.AgentName, "error", err)
+			}
+		}
+
 	case *SessionTitleEvent:
 		if err := r.sessionStore.UpdateSessionTitle(ctx, sess.ID, e.Title); err != nil {
 			slog.Warn("Failed to persist session title", "session_id", sess.ID, "error", err)
 		}
+
+	case *ErrorEvent:
+		if r.autoStarOnError && !sess.Starred {
+			sess.Starred = true
+			if err := r.sessionStore.SetSessionStarred(ctx, sess.ID, true); err != nil {
+				slog.Warn("Failed to star session after error", "session_id", sess.ID, "error", err)
+			}
+		}
 	}
 }
 
-// persistStreamingContent creates or updates the streaming assistant message
+// persistStreamingContent creates or updates the streaming assistant message.
+// With a persistence debounce, updates closer than the debounce interval to
+// the previous write are deferred until the next write or flush.
 func (r *PersistentRuntime) persistStreamingContent(ctx context.Context, sessionID string, streaming *streamingState) {
-	msg := &session.Message{
+	if streaming.messageID != 0 && time.Since(streaming.lastFlush) < r.persistenceDebounce {
+		streaming.dirty = true
+		return
+	}
+	r.writeStreamingContent(ctx, sessionID, streaming)
+}
+
+// flushStreamingContent writes streaming content deferred by the persistence
+// debounce, if any.
+func (r *PersistentRuntime) flushStreamingContent(ctx context.Context, sessionID string, streaming *streamingState) {
+	if streaming.dirty {
+		r.writeStreamingContent(ctx, sessionID, streaming)
+	}
+}
+
+func (r *PersistentRuntime) writeStreamingContent(ctx context.Context, sessionID string, streaming *streamingState) {
+	streaming.dirty = false
+	streaming.lastFlush = time.Now()
+
+	msg := r.transformForPersistence(&session.Message{
 		AgentName: streaming.agentName,
 		Message: chat.Message{
 			Role:             chat.MessageRoleAssistant,
 			Content:          streaming.content.String(),
 			ReasoningContent: streaming.reasoningContent.String(),
 		},
+	})
+	if msg == nil {
+		return
 	}
 
 	if streaming.messageID == 0 {
@@ -174,9 +256,100 @@ func (r *PersistentRuntime) persistStreamingContent(ctx context.Context, session
 	}
 }
 
+// transformForPersistence applies the persist transform, if any, to a copy of
+// an assistant message. It returns nil if the message must not be persisted.
+func (r *PersistentRuntime) transformForPersistence(msg *session.Message) *session.Message {
+	if r.persistTransform == nil || msg.Message.Role != chat.MessageRoleAssistant {
+		return msg
+	}
+	msgCopy := *msg
+	return r.persistTransform(&msgCopy)
+}
+
+// syncSession updates the stored session metadata and reconciles the stored
+// items with the items of the session: differing items are replaced, missing
+// ones are added and extra ones are removed.
+func (r *PersistentRuntime) syncSession(ctx context.Context, sess *session.Session) error {
+	if err := r.sessionStore.UpdateSession(ctx, sess); err != nil {
+		return fmt.Errorf("updating session: %w", err)
+	}
+
+	var want []session.Item
+	for _, item := range sess.Items() {
+		if item.Message != nil {
+			msg := r.transformForPersistence(item.Message)
+			if msg == nil {
+				continue
+			}
+			item.Message = msg
+		}
+		want = append(want, item)
+	}
+
+	stored, err := r.sessionStore.GetItemsByType(ctx, sess.ID)
+	if errors.Is(err, session.ErrNotFound) && len(want) == 0 {
+		// A lazily persisted session without messages isn't stored yet.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("loading stored items: %w", err)
+	}
+
+	for i, item := range want {
+		switch {
+		case i >= len(stored):
+			err = r.addStoredItem(ctx, sess.ID, item)
+		case !sameStoredItem(stored[i], item):
+			err = r.sessionStore.UpdateItem(ctx, sess.ID, i, item)
+		}
+		if err != nil {
+			return fmt.Errorf("writing item %d: %w", i, err)
+		}
+	}
+	if len(stored) > len(want) {
+		if err := r.sessionStore.DeleteItemsAfter(ctx, sess.ID, len(want)-1); err != nil {
+			return fmt.Errorf("removing extra items: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *PersistentRuntime) addStoredItem(ctx context.Context, sessionID string, item session.Item) error {
+	switch {
+	case item.Message != nil:
+		_, err := r.sessionStore.AddMessage(ctx, sessionID, item.Message)
+		return err
+	case item.SubSession != nil:
+		return r.sessionStore.AddSubSession(ctx, sessionID, item.SubSession)
+	default:
+		return r.sessionStore.AddSummary(ctx, sessionID, item.Summary)
+	}
+}
+
+// sameStoredItem reports whether a stored item holds the same content as an
+// item of the live session.
+func sameStoredItem(stored, item session.Item) bool {
+	if stored.Type() != item.Type() {
+		return false
+	}
+	switch {
+	case item.Message != nil:
+		// Compare what is stored, nested content included.
+		a, errA := json.Marshal(stored.Message)
+		b, errB := json.Marshal(item.Message)
+		return errA == nil && errB == nil && bytes.Equal(a, b)
+	case item.SubSession != nil:
+		return stored.SubSession.ID == item.SubSession.ID
+	default:
+		return stored.Summary == item.Summary
+	}
+}
+
 // Run wraps the inner runtime's Run method
 func (r *PersistentRuntime) Run(ctx context.Context, sess *session.Session) ([]session.Message, error) {
-	eventsChan := r.RunStream(ctx, sess)
+	sess = r.inputSession(sess)
+	eventsChan := r.runStream(ctx, sess)
 
 	for event := range eventsChan {
 		if errEvent, ok := event.(*ErrorEvent); ok {
@@ -0,0 +1,367 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/agent"
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/session"
+	"github.com/docker/cagent/pkg/team"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+// countingStore counts the writes of message updates.
+type countingStore struct {
+	session.Store
+	updates atomic.Int32
+}
+
+func (s *countingStore) UpdateMessage(ctx context.Context, messageID int64, msg *session.Message) error {
+	s.updates.Add(1)
+	return s.Store.UpdateMessage(ctx, messageID, msg)
+}
+
+func TestPersistenceDebounce(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		debounce time.Duration
+		updates  int32
+	}{
+		// One update per chunk after the first, plus the final message.
+		{name: "disabled", debounce: 0, updates: 5},
+		// Only the final message is written after the first chunk.
+		{name: "enabled", debounce: time.Hour, updates: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := newStreamBuilder().
+				AddContent("one ").
+				AddContent("two ").
+				AddContent("three ").
+				AddContent("four ").
+				AddContent("five").
+				AddStopWithUsage(10, 5).
+				Build()
+
+			prov := &mockProvider{id: "test/mock-model", stream: stream}
+			root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+			tm := team.New(team.WithAgents(root))
+
+			store := &countingStore{Store: session.NewInMemorySessionStore()}
+			rt, err := New(tm,
+				WithSessionCompaction(false),
+				WithModelStore(mockModelStore{}),
+				WithSessionStore(store),
+				WithPersistenceDebounce(tt.debounce),
+			)
+			require.NoError(t, err)
+
+			sess := session.New(session.WithUserMessage("Count to five"))
+			for range rt.RunStream(t.Context(), sess) {
+			}
+
+			assert.Equal(t, tt.updates, store.updates.Load())
+
+			stored, err := store.GetSession(t.Context(), sess.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "one two three four five", stored.GetLastAssistantMessageContent())
+		})
+	}
+}
+
+func TestPersistTransform(t *testing.T) {
+	stream := newStreamBuilder().
+		AddReasoning("thinking hard").
+		AddContent("answer").
+		AddStopWithUsage(10, 5).
+		Build()
+
+	prov := &mockProvider{id: "test/mock-model", stream: stream}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root))
+
+	store := session.NewInMemorySessionStore()
+	rt, err := New(tm,
+		WithSessionCompaction(false),
+		WithModelStore(mockModelStore{}),
+		WithSessionStore(store),
+		WithPersistTransform(func(msg *session.Message) *session.Message {
+			msg.Message.ReasoningContent = ""
+			return msg
+		}),
+	)
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Question"))
+	for range rt.RunStream(t.Context(), sess) {
+	}
+
+	// The live session keeps the reasoning.
+	live := sess.GetAllMessages()
+	assert.Equal(t, "thinking hard", live[len(live)-1].Message.ReasoningContent)
+
+	stored, err := store.GetSession(t.Context(), sess.ID)
+	require.NoError(t, err)
+	var assistant []session.Message
+	for _, msg := range stored.GetAllMessages() {
+		if msg.Message.Role == chat.MessageRoleAssistant {
+			assistant = append(assistant, msg)
+		}
+	}
+	require.Len(t, assistant, 1)
+	assert.Equal(t, "answer", assistant[0].Message.Content)
+	assert.Empty(t, assistant[0].Message.ReasoningContent)
+}
+
+func TestPersistTransformSkipsMessage(t *testing.T) {
+	stream := newStreamBuilder().
+		AddContent("answer").
+		AddStopWithUsage(10, 5).
+		Build()
+
+	prov := &mockProvider{id: "test/mock-model", stream: stream}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root))
+
+	store := session.NewInMemorySessionStore()
+	rt, err := New(tm,
+		WithSessionCompaction(false),
+		WithModelStore(mockModelStore{}),
+		WithSessionStore(store),
+		WithPersistTransform(func(*session.Message) *session.Message { return nil }),
+	)
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Question"))
+	for range rt.RunStream(t.Context(), sess) {
+	}
+
+	assert.Equal(t, "answer", sess.GetLastAssistantMessageContent())
+
+	stored, err := store.GetSession(t.Context(), sess.ID)
+	require.NoError(t, err)
+	assert.Empty(t, stored.GetLastAssistantMessageContent())
+}
+
+func TestAutoStarOnError(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("enabled=%t", enabled), func(t *testing.T) {
+			prov := &mockProviderWithError{id: "test/error-model"}
+			root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+			tm := team.New(team.WithAgents(root))
+
+			store := session.NewInMemorySessionStore()
+			rt, err := New(tm,
+				WithSessionCompaction(false),
+				WithModelStore(mockModelStore{}),
+				WithSessionStore(store),
+				WithAutoStarOnError(enabled),
+			)
+			require.NoError(t, err)
+
+			sess := session.New(session.WithUserMessage("Hi"))
+			for range rt.RunStream(t.Context(), sess) {
+			}
+
+			stored, err := store.GetSession(t.Context(), sess.ID)
+			require.NoError(t, err)
+			assert.Equal(t, enabled, stored.Starred)
+		})
+	}
+}
+
+// flakyStore fails the first writes of assistant messages, and every session
+// metadata update when failUpdates is set.
+type flakyStore struct {
+	session.Store
+	assistantFailures atomic.Int32
+	failUpdates       bool
+}
+
+func (s *flakyStore) AddMessage(ctx context.Context, sessionID string, msg *session.Message) (int64, error) {
+	if msg.Message.Role == chat.MessageRoleAssistant && s.assistantFailures.Add(-1) >= 0 {
+		return 0, errors.New("database is locked")
+	}
+	return s.Store.AddMessage(ctx, sessionID, msg)
+}
+
+func (s *flakyStore) UpdateSession(ctx context.Context, sess *session.Session) error {
+	if s.failUpdates {
+		return errors.New("disk full")
+	}
+	return s.Store.UpdateSession(ctx, sess)
+}
+
+func TestSyncFlushOnComplete(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("enabled=%t", enabled), func(t *testing.T) {
+			stream := newStreamBuilder().
+				AddContent("answer").
+				AddStopWithUsage(10, 5).
+				Build()
+
+			prov := &mockProvider{id: "test/mock-model", stream: stream}
+			root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+
+			store := &flakyStore{Store: session.NewInMemorySessionStore()}
+			// Both the streaming write and the final write of the answer fail.
+			store.assistantFailures.Store(2)
+			rt, err := New(team.New(team.WithAgents(root)),
+				WithSessionCompaction(false),
+				WithModelStore(mockModelStore{}),
+				WithSessionStore(store),
+				WithSyncFlushOnComplete(enabled),
+			)
+			require.NoError(t, err)
+
+			sess := session.New(session.WithUserMessage("Question"))
+			_, err = rt.Run(t.Context(), sess)
+			require.NoError(t, err)
+
+			stored, err := store.GetSession(t.Context(), sess.ID)
+			require.NoError(t, err)
+			if enabled {
+				assert.Equal(t, "answer", stored.GetLastAssistantMessageContent())
+				assert.Len(t, stored.Messages, len(sess.Messages))
+			} else {
+				assert.Empty(t, stored.GetLastAssistantMessageContent())
+			}
+		})
+	}
+}
+
+func TestSyncSessionUpdatesItemsInPlace(t *testing.T) {
+	ctx := t.Context()
+	store, err := session.NewSQLiteSessionStore(filepath.Join(t.TempDir(), "sync.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	root := agent.New("root", "You are a test agent", agent.WithModel(&mockProvider{}))
+	rt, err := New(team.New(team.WithAgents(root)), WithModelStore(mockModelStore{}), WithSessionStore(store))
+	require.NoError(t, err)
+	pr := rt.(*PersistentRuntime)
+
+	call := &session.Message{AgentName: "root", Message: chat.Message{
+		Role:      chat.MessageRoleAssistant,
+		ToolCalls: []tools.ToolCall{{ID: "call_1", Function: tools.FunctionCall{Name: "shell", Arguments: `{"cmd":"ls"}`}}},
+	}}
+	sub := session.New(session.WithUserMessage("sub task"))
+	sess := session.New(session.WithUserMessage("Question"))
+	sess.AddMessage(call)
+	sess.AddSubSession(sub)
+	require.NoError(t, store.AddSession(ctx, sess))
+
+	stored, err := store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+	id := stored.Messages[1].Message.ID
+	require.NotZero(t, id)
+
+	// Only the nested arguments change: the row is still rewritten, in place.
+	call.Message.ToolCalls[0].Function.Arguments = `{"cmd":"ls -la"}`
+	require.NoError(t, pr.syncSession(ctx, sess))
+
+	stored, err = store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, stored.Messages, 3)
+	assert.Equal(t, id, stored.Messages[1].Message.ID)
+	assert.JSONEq(t, `{"cmd":"ls -la"}`, stored.Messages[1].Message.Message.ToolCalls[0].Function.Arguments)
+	assert.Equal(t, sub.ID, stored.Messages[2].SubSession.ID)
+
+	// The row ID is still valid for streaming updates.
+	call.Message.Content = "done"
+	require.NoError(t, store.UpdateMessage(ctx, id, call))
+}
+
+func TestSyncFlushOnCompleteReportsFailure(t *testing.T) {
+	stream := newStreamBuilder().
+		AddContent("answer").
+		AddStopWithUsage(10, 5).
+		Build()
+
+	prov := &mockProvider{id: "test/mock-model", stream: stream}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+
+	store := &flakyStore{Store: session.NewInMemorySessionStore(), failUpdates: true}
+	rt, err := New(team.New(team.WithAgents(root)),
+		WithSessionCompaction(false),
+		WithModelStore(mockModelStore{}),
+		WithSessionStore(store),
+		WithSyncFlushOnComplete(true),
+	)
+	require.NoError(t, err)
+
+	_, err = rt.Run(t.Context(), session.New(session.WithUserMessage("Question")))
+	require.ErrorContains(t, err, "persisting session: updating session: disk full")
+}
+
+func TestCurrentAgentIsPersisted(t *testing.T) {
+	stream := newStreamBuilder().
+		AddContent("reviewed").
+		AddStopWithUsage(10, 5).
+		Build()
+
+	prov := &mockProvider{id: "test/mock-model", stream: stream}
+	reviewer := agent.New("reviewer", "You review code", agent.WithModel(prov))
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov), agent.WithHandoffs(reviewer))
+
+	store := session.NewInMemorySessionStore()
+	rt, err := New(team.New(team.WithAgents(root, reviewer)),
+		WithSessionCompaction(false),
+		WithModelStore(mockModelStore{}),
+		WithSessionStore(store),
+	)
+	require.NoError(t, err)
+
+	// As if the root agent had handed off the conversation.
+	require.NoError(t, rt.SetCurrentAgent("reviewer"))
+
+	sess := session.New(session.WithUserMessage("Review this"))
+	_, err = rt.Run(t.Context(), sess)
+	require.NoError(t, err)
+
+	stored, err := store.GetSession(t.Context(), sess.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "reviewer", stored.CurrentAgent)
+}
+
+func TestUserMessageAttachmentsArePersisted(t *testing.T) {
+	stream := newStreamBuilder().
+		AddContent("looks good").
+		AddStopWithUsage(10, 5).
+		Build()
+
+	prov := &mockProvider{id: "test/mock-model", stream: stream}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+
+	store, err := session.NewSQLiteSessionStore(filepath.Join(t.TempDir(), "session.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	rt, err := New(team.New(team.WithAgents(root)),
+		WithSessionCompaction(false),
+		WithModelStore(mockModelStore{}),
+		WithSessionStore(store),
+	)
+	require.NoError(t, err)
+
+	attachments := []session.Attachment{{Name: "main.go", MimeType: "text/x-go", Path: "/src/main.go"}}
+	msg := session.UserMessage("Review this")
+	msg.Attachments = attachments
+	sess := session.New()
+	sess.AddMessage(msg)
+	_, err = rt.Run(t.Context(), sess)
+	require.NoError(t, err)
+
+	stored, err := store.GetSession(t.Context(), sess.ID)
+	require.NoError(t, err)
+	require.NotEmpty(t, stored.Messages)
+	assert.Equal(t, attachments, stored.Messages[0].Message.Attachments)
+}
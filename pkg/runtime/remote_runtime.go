@@ -230,6 +230,11 @@ func (r *RemoteRuntime) Summarize(_ context.Context, sess *session.Session, _ st
 	events <- SessionSummary(sess.ID, "Summary generation not yet implemented for remote runtime", r.currentAgent)
 }
 
+// CancelCompaction is a no-op: the remote runtime doesn't compact sessions.
+func (r *RemoteRuntime) CancelCompaction() bool {
+	return false
+}
+
 func (r *RemoteRuntime) convertSessionMessages(sess *session.Session) []api.Message {
 	sessionMessages := sess.GetAllMessages()
 	messages := make([]api.Message, 0, len(sessionMessages))
@@ -453,6 +458,11 @@ func (r *RemoteRuntime) CurrentMCPPrompts(context.Context) map[string]mcp.Prompt
 	return make(map[string]mcp.PromptInfo)
 }
 
+// CurrentAgentAuthStatus is not supported on remote runtimes.
+func (r *RemoteRuntime) CurrentAgentAuthStatus(context.Context) map[string]AuthStatus {
+	return make(map[string]AuthStatus)
+}
+
 // ExecuteMCPPrompt is not supported on remote runtimes.
 func (r *RemoteRuntime) ExecuteMCPPrompt(context.Context, string, map[string]string) (string, error) {
 	return "", fmt.Errorf("MCP prompts are not supported by remote runtimes")
@@ -9,6 +9,7 @@ import (
 	"io"
 	"log/slog"
 	"maps"
+	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
@@ -31,6 +32,7 @@ import (
 	"github.com/docker/cagent/pkg/permissions"
 	"github.com/docker/cagent/pkg/rag"
 	ragtypes "github.com/docker/cagent/pkg/rag/types"
+	"github.com/docker/cagent/pkg/sanitize"
 	"github.com/docker/cagent/pkg/session"
 	"github.com/docker/cagent/pkg/sessiontitle"
 	"github.com/docker/cagent/pkg/team"
@@ -131,6 +133,9 @@ type Runtime interface {
 
 	// Summarize generates a summary for the session
 	Summarize(ctx context.Context, sess *session.Session, additionalPrompt string, events chan Event)
+	// CancelCompaction cancels the in-flight summary of Summarize, if any, and
+	// reports whether there was one. The session is left un-compacted.
+	CancelCompaction() bool
 
 	// PermissionsInfo returns the team-level permission patterns (allow/ask/deny).
 	// Returns nil if no permissions are configured.
@@ -143,6 +148,10 @@ type Runtime interface {
 	// Returns an empty map if no MCP prompts are available.
 	CurrentMCPPrompts(ctx context.Context) map[string]mcptools.PromptInfo
 
+	// CurrentAgentAuthStatus returns the OAuth state of the current agent's
+	// toolsets that support OAuth, keyed by toolset description.
+	CurrentAgentAuthStatus(ctx context.Context) map[string]AuthStatus
+
 	// ExecuteMCPPrompt executes a named MCP prompt with the given arguments.
 	ExecuteMCPPrompt(ctx context.Context, promptName string, arguments map[string]string) (string, error)
 
@@ -164,6 +173,14 @@ type PermissionsInfo struct {
 	Deny  []string
 }
 
+// AuthStatus describes the OAuth state of a toolset.
+type AuthStatus struct {
+	// NeedsAuth is true when the toolset's server requires an OAuth login.
+	NeedsAuth bool
+	// Authenticated is true when a valid token is available.
+	Authenticated bool
+}
+
 type CurrentAgentInfo struct {
 	Name        string
 	Description string
@@ -204,12 +221,38 @@ type LocalRuntime struct {
 	elicitationRequestCh        chan ElicitationResult // Channel for receiving elicitation responses
 	elicitationEventsChannel    chan Event             // Current events channel for sending elicitation requests
 	elicitationEventsChannelMux sync.RWMutex           // Protects elicitationEventsChannel
+	cancelCompaction            context.CancelFunc     // Cancels the in-flight compaction, if any
+	cancelCompactionMux         sync.Mutex             // Protects cancelCompaction
 	ragInitialized              atomic.Bool
+	ragDisabled                 bool // Skip RAG initialization entirely
 	sessionCompactor            *sessionCompactor
 	sessionStore                session.Store
 	workingDir                  string   // Working directory for hooks execution
 	env                         []string // Environment variables for hooks execution
 	modelSwitcherCfg            *ModelSwitcherConfig
+	eventBufferSize             int           // Capacity of the channel returned by RunStream
+	lazyPersistence             bool          // Only persist sessions once they have a real message
+	costCalculation             bool          // Compute message costs from models.dev pricing
+	persistenceDebounce         time.Duration // Minimum interval between writes of a streaming message
+	persistTransform            func(*session.Message) *session.Message
+	hierarchicalSummary         bool // Summarize long histories in chunks
+	summaryIncludeSystem        bool // Give the summary model the system prompt of the conversation
+	usageReporter               func(ctx context.Context, agentName string, usage chat.Usage, cost float64)
+	toolGate                    func(sess *session.Session, a *agent.Agent) []string
+	retainReasoningOnly         bool                 // Keep assistant messages that only carry reasoning
+	autoStarOnError             bool                 // Star sessions that hit an error
+	costBudget                  float64              // Maximum session cost in USD, zero for no budget
+	autoApproveReadOnly         bool                 // Run read-only tools without asking for approval
+	immutableInputSession       bool                 // Run on a copy of the session passed to Run and RunStream
+	syncFlushOnComplete         bool                 // Reconcile the stored session with the live one when a run ends
+	autoContinueOnLength        int                  // Maximum number of continuations of a response cut off by the token limit
+	eventFilter                 func(Event) bool     // Events of RunStream are dropped unless it returns true
+	strictToolCalls             bool                 // Abort runs when the model calls an unknown tool
+	subSessionEventMode         SubSessionEventMode  // Events of sub-sessions forwarded to the parent's stream
+	defaultTools                bool                 // Expose and handle the runtime-managed tools, such as transfer_task
+	eventLogs                   map[string]*eventLog // Recent events per session, for ResumeStream
+	eventLogsMux                sync.Mutex
+	eventLogRetention           time.Duration // How long event logs are kept after their stream ends
 
 	// fallbackCooldowns tracks per-agent cooldown state for sticky fallback behavior
 	fallbackCooldowns    map[string]*fallbackCooldownState
@@ -230,11 +273,23 @@ type streamResult struct {
 	ThinkingSignature string // Used with Anthropic's extended thinking feature
 	ThoughtSignature  []byte
 	Stopped           bool
-	ActualModel       string      // The actual model used (may differ from configured model with routing)
-	Usage             *chat.Usage // Token usage for this stream
+	FinishReason      chat.FinishReason // Why the model stopped, as reported by the provider
+	ActualModel       string            // The actual model used (may differ from configured model with routing)
+	Usage             *chat.Usage       // Token usage for this stream
 	RateLimit         *chat.RateLimit
 }
 
+// defaultEventBufferSize is the default capacity of the channel returned by RunStream.
+const defaultEventBufferSize = 128
+
+// continuationPrompt is the implicit user message asking the model to
+// continue a response that was cut off by the output token limit.
+const continuationPrompt = "Your previous response was cut off. Continue exactly where it stopped, without repeating anything."
+
+// compactionThreshold is the fraction of the model's context window above
+// which a session is compacted before the next turn.
+const compactionThreshold = 0.9
+
 type Opt func(*LocalRuntime)
 
 func WithCurrentAgent(agentName string) Opt {
@@ -288,6 +343,243 @@ func WithEnv(env []string) Opt {
 	}
 }
 
+// WithEventBufferSize sets the capacity of the event channel returned by RunStream.
+// A bigger buffer lets the runtime run ahead of a slow consumer; a smaller one
+// saves memory. n must be positive; the default is 128.
+func WithEventBufferSize(n int) Opt {
+	return func(r *LocalRuntime) {
+		r.eventBufferSize = n
+	}
+}
+
+// WithLazyPersistence defers writing a session to the store until it contains
+// at least one non-implicit message, so sessions that are opened and abandoned
+// never show up in the store.
+func WithLazyPersistence(lazy bool) Opt {
+	return func(r *LocalRuntime) {
+		r.lazyPersistence = lazy
+	}
+}
+
+// WithCostCalculation controls whether the cost of each model response is
+// computed from its token usage and the model's models.dev pricing. It is
+// enabled by default; when disabled, messages and sessions report no cost.
+func WithCostCalculation(enabled bool) Opt {
+	return func(r *LocalRuntime) {
+		r.costCalculation = enabled
+	}
+}
+
+// WithPersistenceDebounce limits how often the assistant message being
+// streamed is written to the session store: it is flushed at most once every
+// d, and always once the turn ends. Zero (the default) writes every chunk.
+func WithPersistenceDebounce(d time.Duration) Opt {
+	return func(r *LocalRuntime) {
+		r.persistenceDebounce = d
+	}
+}
+
+// WithPersistTransform sets a function applied to assistant messages right
+// before they are written to the session store. It receives a copy of the
+// message, so changes only affect what is persisted, not the live session.
+// Returning nil skips persisting the message.
+func WithPersistTransform(transform func(*session.Message) *session.Message) Opt {
+	return func(r *LocalRuntime) {
+		r.persistTransform = transform
+	}
+}
+
+// WithHierarchicalSummary makes session compaction summarize histories that
+// don't fit in half of the summary model's context in chunks, then combine
+// the partial summaries into the final one.
+func WithHierarchicalSummary(enabled bool) Opt {
+	return func(r *LocalRuntime) {
+		r.hierarchicalSummary = enabled
+	}
+}
+
+// WithSummaryIncludeSystem makes session compaction give the summary model
+// the system prompt of the agent whose conversation is summarized, so that
+// the summary accounts for it.
+func WithSummaryIncludeSystem(enabled bool) Opt {
+	return func(r *LocalRuntime) {
+		r.summaryIncludeSystem = enabled
+	}
+}
+
+// WithUsageReporter sets a function called with the token usage and cost of
+// every model response, as soon as they are known. It runs synchronously in
+// the runtime loop, so it should return quickly.
+func WithUsageReporter(reporter func(ctx context.Context, agentName string, usage chat.Usage, cost float64)) Opt {
+	return func(r *LocalRuntime) {
+		r.usageReporter = reporter
+	}
+}
+
+// WithRetainReasoningOnlyMessages controls whether assistant responses that
+// carry reasoning but neither content nor tool calls are added to the
+// session. They are dropped by default. Retained messages are never sent
+// back to the model, see [session.Message.IsReasoningOnly].
+func WithRetainReasoningOnlyMessages(enabled bool) Opt {
+	return func(r *LocalRuntime) {
+		r.retainReasoningOnly = enabled
+	}
+}
+
+// WithAutoStarOnError stars sessions in the session store as soon as their
+// run produces an error, so that they are easy to find for triage.
+func WithAutoStarOnError(enabled bool) Opt {
+	return func(r *LocalRuntime) {
+		r.autoStarOnError = enabled
+	}
+}
+
+// WithRAG controls whether the team's RAG sources are initialized and
+// indexed. It is enabled by default; when disabled, StartBackgroundRAGInit
+// and InitializeRAG do nothing and no indexing events are emitted.
+func WithRAG(enabled bool) Opt {
+	return func(r *LocalRuntime) {
+		r.ragDisabled = !enabled
+	}
+}
+
+// WithCostBudget stops a run once the cost of the session exceeds maxUSD.
+// The run ends with a CostBudgetExceeded event and an assistant message
+// explaining why it stopped. Zero, the default, means no budget.
+func WithCostBudget(maxUSD float64) Opt {
+	return func(r *LocalRuntime) {
+		r.costBudget = maxUSD
+	}
+}
+
+// WithAutoApproveReadOnly controls whether tools annotated as read-only run
+// without asking the user for approval when no permission rule matches them.
+// It is enabled by default; when disabled, every tool not approved by --yolo
+// or a permission rule needs the user's confirmation.
+func WithAutoApproveReadOnly(enabled bool) Opt {
+	return func(r *LocalRuntime) {
+		r.autoApproveReadOnly = enabled
+	}
+}
+
+// WithImmutableInputSession makes Run and RunStream operate on a deep copy of
+// the session they are given, leaving the caller's session untouched. Run
+// returns the messages of the copy. This suits servers that load a session
+// per request and don't want it changed behind their back.
+func WithImmutableInputSession(enabled bool) Opt {
+	return func(r *LocalRuntime) {
+		r.immutableInputSession = enabled
+	}
+}
+
+// WithSyncFlushOnComplete makes the persistent runtime write the session to
+// the store once more when a run ends, before its event channel is closed and
+// Run returns: the session metadata is updated and the stored items are made
+// to match the session's, fixing writes that failed or were skipped during
+// the run. A failure is reported with an ErrorEvent, making Run return an
+// error. This suits one-shot runs, like exec mode, that must not exit before
+// the session is saved.
+func WithSyncFlushOnComplete(enabled bool) Opt {
+	return func(r *LocalRuntime) {
+		r.syncFlushOnComplete = enabled
+	}
+}
+
+// WithToolGate restricts the tools offered to the model on each turn based on
+// the state of the conversation, e.g. to only expose a "deploy" tool once a
+// "test" tool succeeded. The gate returns the names of the tools the agent
+// may use; a nil result exposes all of them. Calls to tools that were
+// filtered out are handled like calls to unknown tools.
+func WithToolGate(gate func(sess *session.Session, a *agent.Agent) []string) Opt {
+	return func(r *LocalRuntime) {
+		r.toolGate = gate
+	}
+}
+
+// WithAutoContinueOnLength makes the runtime ask the model to continue, up to
+// maxContinuations times in a row, when a response is cut off by the output
+// token limit. The continuation is requested with an implicit user message
+// and streamed right after the truncated content, so that the parts read as
+// one response. A ContinuationStartedEvent is emitted for each continuation.
+// Responses with tool calls aren't continued.
+func WithAutoContinueOnLength(maxContinuations int) Opt {
+	return func(r *LocalRuntime) {
+		r.autoContinueOnLength = maxContinuations
+	}
+}
+
+// WithEventFilter drops the events of RunStream for which keep returns false,
+// e.g. token usage events for scripts that only want errors and the final
+// message. It only applies to the channel returned by RunStream: the runtime
+// itself, session persistence and Run still see every event. Events a run
+// waits on, like tool call confirmations, shouldn't be dropped.
+func WithEventFilter(keep func(Event) bool) Opt {
+	return func(r *LocalRuntime) {
+		r.eventFilter = keep
+	}
+}
+
+// WithStrictToolCalls makes a run fail when the model calls a tool that isn't
+// in the agent's tool set. By default, such calls are answered with an error
+// listing the available tools, so that the model can recover. In strict mode,
+// none of the calls of that turn is executed: they're all answered with an
+// error, to keep the session valid, and the run ends with an ErrorEvent.
+func WithStrictToolCalls(strict bool) Opt {
+	return func(r *LocalRuntime) {
+		r.strictToolCalls = strict
+	}
+}
+
+// SubSessionEventMode selects the events of a sub-session, such as a
+// transferred task, that are forwarded to the parent session's stream.
+type SubSessionEventMode string
+
+const (
+	// SubSessionEventModeFull forwards every event of the sub-session.
+	SubSessionEventModeFull SubSessionEventMode = "full"
+	// SubSessionEventModeFinalOnly forwards a single SubAgentResultEvent with
+	// the final answer of the sub-agent. Events waiting for the user, such as
+	// tool call confirmations and elicitations, and errors are still
+	// forwarded.
+	SubSessionEventModeFinalOnly SubSessionEventMode = "final_only"
+)
+
+// WithSubSessionEventMode selects the events of sub-sessions forwarded to
+// the parent session's stream. The default is SubSessionEventModeFull.
+func WithSubSessionEventMode(mode SubSessionEventMode) Opt {
+	return func(r *LocalRuntime) {
+		r.subSessionEventMode = mode
+	}
+}
+
+// forwardedInFinalOnlyMode reports whether an event of a sub-session is
+// forwarded to the parent's stream with SubSessionEventModeFinalOnly: only
+// errors and the events the user has to answer are.
+func forwardedInFinalOnlyMode(event Event) bool {
+	switch event.(type) {
+	case *ErrorEvent,
+		*ToolCallConfirmationEvent,
+		*ToolApprovalRequestedEvent,
+		*ElicitationRequestEvent,
+		*AuthorizationEvent,
+		*MaxIterationsReachedEvent:
+		return true
+	default:
+		return false
+	}
+}
+
+// WithDefaultTools sets whether the runtime-managed tools are available:
+// transfer_task, handoff, change_model, revert_model and the background agent
+// tools. They're on by default. Single-agent embeddings can turn them off so
+// that they're neither handled nor shown to the model, even when a toolset
+// provides them.
+func WithDefaultTools(enabled bool) Opt {
+	return func(r *LocalRuntime) {
+		r.defaultTools = enabled
+	}
+}
+
 // NewLocalRuntime creates a new LocalRuntime without the persistence wrapper.
 // This is useful for testing or when persistence is handled externally.
 func NewLocalRuntime(agents *team.Team, opts ...Opt) (*LocalRuntime, error) {
@@ -306,6 +598,12 @@ func NewLocalRuntime(agents *team.Team, opts ...Opt) (*LocalRuntime, error) {
 		managedOAuth:         true,
 		sessionStore:         session.NewInMemorySessionStore(),
 		fallbackCooldowns:    make(map[string]*fallbackCooldownState),
+		eventLogs:            make(map[string]*eventLog),
+		eventLogRetention:    eventLogRetention,
+		eventBufferSize:      defaultEventBufferSize,
+		costCalculation:      true,
+		autoApproveReadOnly:  true,
+		defaultTools:         true,
 	}
 	r.bgAgents = agenttool.NewHandler(r)
 
@@ -313,6 +611,14 @@ func NewLocalRuntime(agents *team.Team, opts ...Opt) (*LocalRuntime, error) {
 		opt(r)
 	}
 
+	if r.eventBufferSize <= 0 {
+		return nil, fmt.Errorf("event buffer size must be positive, got %d", r.eventBufferSize)
+	}
+
+	if r.lazyPersistence {
+		r.sessionStore = session.NewLazyStore(r.sessionStore)
+	}
+
 	if r.modelsStore == nil {
 		modelsStore, err := modelsdev.NewStore()
 		if err != nil {
@@ -334,6 +640,9 @@ func NewLocalRuntime(agents *team.Team, opts ...Opt) (*LocalRuntime, error) {
 	}
 
 	r.sessionCompactor = newSessionCompactor(model, r.sessionStore)
+	r.sessionCompactor.hierarchical = r.hierarchicalSummary
+	r.sessionCompactor.includeSystem = r.summaryIncludeSystem
+	r.sessionCompactor.modelsStore = r.modelsStore
 
 	slog.Debug("Creating new runtime", "agent", r.currentAgent, "available_agents", agents.Size())
 
@@ -343,7 +652,7 @@ func NewLocalRuntime(agents *team.Team, opts ...Opt) (*LocalRuntime, error) {
 // StartBackgroundRAGInit initializes RAG in background and forwards events
 // Should be called early (e.g., by App) to start indexing before RunStream
 func (r *LocalRuntime) StartBackgroundRAGInit(ctx context.Context, sendEvent func(Event)) {
-	if r.ragInitialized.Swap(true) {
+	if r.ragDisabled || r.ragInitialized.Swap(true) {
 		return
 	}
 
@@ -417,6 +726,10 @@ func (r *LocalRuntime) forwardRAGEvents(ctx context.Context, ragManagers map[str
 // InitializeRAG is called within RunStream as a fallback when background init wasn't used
 // (e.g., for exec command or API mode where there's no App)
 func (r *LocalRuntime) InitializeRAG(ctx context.Context, events chan Event) {
+	if r.ragDisabled {
+		return
+	}
+
 	// If already initialized via StartBackgroundRAGInit, skip entirely
 	// Event forwarding was already set up there
 	if r.ragInitialized.Swap(true) {
@@ -549,6 +862,31 @@ func (r *LocalRuntime) discoverMCPPrompts(ctx context.Context, toolset *mcptools
 	return prompts
 }
 
+// CurrentAgentAuthStatus returns the OAuth state of every toolset of the
+// current agent that can report one, keyed by toolset description.
+func (r *LocalRuntime) CurrentAgentAuthStatus(context.Context) map[string]AuthStatus {
+	statuses := make(map[string]AuthStatus)
+
+	currentAgent := r.CurrentAgent()
+	if currentAgent == nil {
+		return statuses
+	}
+
+	for _, toolset := range currentAgent.ToolSets() {
+		reporter, ok := tools.As[tools.OAuthStatusReporter](toolset)
+		if !ok {
+			continue
+		}
+		needsAuth, authenticated := reporter.OAuthStatus()
+		statuses[tools.DescribeToolSet(toolset)] = AuthStatus{
+			NeedsAuth:     needsAuth,
+			Authenticated: authenticated,
+		}
+	}
+
+	return statuses
+}
+
 // CurrentAgent returns the current agent
 func (r *LocalRuntime) CurrentAgent() *agent.Agent {
 	// We validated already that the agent exists
@@ -671,6 +1009,16 @@ func getAgentModelID(a *agent.Agent) string {
 	return ""
 }
 
+// agentModelOptions returns the options the agent's models are cloned with for
+// a run: the session's thinking setting and the agent's stop sequences.
+func agentModelOptions(a *agent.Agent, thinking bool) []options.Opt {
+	opts := []options.Opt{options.WithThinking(thinking)}
+	if stop := a.StopSequences(); len(stop) > 0 {
+		opts = append(opts, options.WithStopSequences(stop...))
+	}
+	return opts
+}
+
 // getEffectiveModelID returns the currently active model ID for an agent, accounting
 // for any active fallback cooldown. During a cooldown period, this returns the fallback
 // model ID instead of the configured primary model, so the UI reflects the actual model in use.
@@ -919,10 +1267,27 @@ func (r *LocalRuntime) emitToolsProgressively(ctx context.Context, a *agent.Agen
 	send(ToolsetInfo(totalTools, false, r.CurrentAgentName()))
 }
 
+// defaultToolNames are the names of the runtime-managed tools registered by
+// registerDefaultTools.
+var defaultToolNames = []string{
+	builtin.ToolNameTransferTask,
+	builtin.ToolNameHandoff,
+	builtin.ToolNameChangeModel,
+	builtin.ToolNameRevertModel,
+	agenttool.ToolNameRunBackgroundAgent,
+	agenttool.ToolNameListBackgroundAgents,
+	agenttool.ToolNameViewBackgroundAgent,
+	agenttool.ToolNameStopBackgroundAgent,
+}
+
 // registerDefaultTools registers the runtime-managed tool handlers.
 // The tool definitions themselves come from the agent's toolsets; this only
 // maps tool names to the runtime handler functions that implement them.
+// Nothing is registered when the default tools are disabled.
 func (r *LocalRuntime) registerDefaultTools() {
+	if !r.defaultTools {
+		return
+	}
 	r.toolMap[builtin.ToolNameTransferTask] = r.handleTaskTransfer
 	r.toolMap[builtin.ToolNameHandoff] = r.handleHandoff
 	r.toolMap[builtin.ToolNameChangeModel] = r.handleChangeModel
@@ -969,8 +1334,42 @@ func (r *LocalRuntime) finalizeEventChannel(ctx context.Context, sess *session.S
 
 // RunStream starts the agent's interaction loop and returns a channel of events
 func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-chan Event {
+	return r.filterEvents(sess, r.runStream(ctx, r.inputSession(sess)))
+}
+
+// filterEvents applies the event filter to the events of a run. Sub-session
+// events are filtered once forwarded to their parent's stream.
+func (r *LocalRuntime) filterEvents(sess *session.Session, in <-chan Event) <-chan Event {
+	if r.eventFilter == nil || sess.IsSubSession() {
+		return in
+	}
+
+	out := make(chan Event, r.eventBufferSize)
+	go func() {
+		defer close(out)
+
+		for event := range in {
+			if r.eventFilter(event) {
+				out <- event
+			}
+		}
+	}()
+	return out
+}
+
+// inputSession returns the session a run operates on: sess itself or, with
+// WithImmutableInputSession, a copy of it. Sub-sessions are created by the
+// runtime and always run in place.
+func (r *LocalRuntime) inputSession(sess *session.Session) *session.Session {
+	if !r.immutableInputSession || sess.IsSubSession() {
+		return sess
+	}
+	return sess.Clone()
+}
+
+func (r *LocalRuntime) runStream(ctx context.Context, sess *session.Session) <-chan Event {
 	slog.Debug("Starting runtime stream", "agent", r.CurrentAgentName(), "session_id", sess.ID)
-	events := make(chan Event, 128)
+	events := make(chan Event, r.eventBufferSize)
 
 	go func() {
 		telemetry.RecordSessionStart(ctx, r.CurrentAgentName(), sess.ID)
@@ -1014,7 +1413,7 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 		r.emitAgentWarnings(a, events)
 		r.configureToolsetHandlers(a, events)
 
-		agentTools, err := r.getTools(ctx, a, sessionSpan, events)
+		agentTools, err := r.getTools(ctx, sess, a, sessionSpan, events)
 		if err != nil {
 			events <- Error(fmt.Sprintf("failed to get tools: %v", err))
 			return
@@ -1023,7 +1422,7 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 		events <- ToolsetInfo(len(agentTools), false, r.CurrentAgentName())
 
 		messages := sess.GetMessages(a)
-		if sess.SendUserMessage {
+		if sess.ShouldEchoLastUserMessage() {
 			lastMsg := messages[len(messages)-1]
 			events <- UserMessage(lastMsg.Content, sess.ID, lastMsg.MultiContent, len(sess.Messages)-1)
 		}
@@ -1035,6 +1434,7 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 		r.registerDefaultTools()
 
 		iteration := 0
+		continuations := 0 // Consecutive continuations of truncated responses
 		// Use a runtime copy of maxIterations so we don't modify the session's persistent config
 		runtimeMaxIterations := sess.MaxIterations
 
@@ -1045,7 +1445,7 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 			r.emitAgentWarnings(a, events)
 			r.configureToolsetHandlers(a, events)
 
-			agentTools, err := r.getTools(ctx, a, sessionSpan, events)
+			agentTools, err := r.getTools(ctx, sess, a, sessionSpan, events)
 			if err != nil {
 				events <- Error(fmt.Sprintf("failed to get tools: %v", err))
 				return
@@ -1082,7 +1482,7 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 								"Execution stopped after reaching the configured max_iterations limit (%d).",
 								runtimeMaxIterations,
 							),
-							CreatedAt: time.Now().Format(time.RFC3339),
+							CreatedAt: session.Now().Format(session.TimestampFormat),
 						}
 
 						addAgentMessage(sess, a, &assistantMessage, events)
@@ -1120,13 +1520,14 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 			// When thinking is enabled: clone with thinking=true to ensure defaults are applied
 			// (this handles models with no thinking config, explicitly disabled thinking, or
 			// models that already have thinking configured).
+			// The agent's stop sequences are applied along the way.
 			if !sess.Thinking {
-				model = provider.CloneWithOptions(ctx, model, options.WithThinking(false))
+				model = provider.CloneWithOptions(ctx, model, agentModelOptions(a, false)...)
 				slog.Debug("Cloned provider with thinking disabled", "agent", a.Name(), "model", model.ID())
 			} else {
 				// Always clone with thinking=true when session has thinking enabled.
 				// applyOverrides will apply provider defaults if ThinkingBudget is nil or disabled.
-				model = provider.CloneWithOptions(ctx, model, options.WithThinking(true))
+				model = provider.CloneWithOptions(ctx, model, agentModelOptions(a, true)...)
 				slog.Debug("Cloned provider with thinking enabled", "agent", a.Name(), "model", model.ID())
 			}
 
@@ -1143,29 +1544,28 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 				contextLimit = int64(m.Limit.Context)
 			}
 
-			if m != nil && r.sessionCompaction {
-				contextLength := sess.InputTokens + sess.OutputTokens
-				if contextLength > int64(float64(contextLimit)*0.9) {
-					r.Summarize(ctx, sess, "", events)
-				}
+			if r.sessionCompaction && needsCompaction(sess, m) {
+				r.Summarize(ctx, sess, "", events)
 			}
 
-			messages := sess.GetMessages(a)
+			messages := modelMessages(sess, a, m)
 			slog.Debug("Retrieved messages for processing", "agent", a.Name(), "message_count", len(messages))
 
-			// Strip image content from messages if the model doesn't support image input.
-			// This prevents API errors when conversation history contains images (e.g. from
-			// tool results or user attachments) but the current model is text-only.
-			if m != nil && len(m.Modalities.Input) > 0 && !slices.Contains(m.Modalities.Input, "image") {
-				messages = stripImageContent(messages)
-			}
-
 			// Try primary model with fallback chain if configured
 			res, usedModel, err := r.tryModelWithFallback(streamCtx, a, model, messages, agentTools, sess, m, events)
+
+			// The provider told us the prompt doesn't fit, even after any proactive compaction.
+			if errors.Is(err, provider.ErrContextExceeded) {
+				if retryMessages, ok := r.recoverFromContextExceeded(ctx, sess, a, m, messages, events); ok {
+					res, usedModel, err = r.tryModelWithFallback(streamCtx, a, model, retryMessages, agentTools, sess, m, events)
+				}
+			}
+
 			if err != nil {
 				// Treat context cancellation as a graceful stop
 				if errors.Is(err, context.Canceled) {
 					slog.Debug("Model stream canceled by context", "agent", a.Name(), "session_id", sess.ID)
+					addInterruptedMessage(sess, a, res, events)
 					streamSpan.End()
 					return
 				}
@@ -1190,12 +1590,15 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 				attribute.Bool("stopped", res.Stopped),
 			)
 			streamSpan.End()
-			slog.Debug("Stream processed", "agent", a.Name(), "tool_calls", len(res.Calls), "content_length", len(res.Content), "stopped", res.Stopped)
+			slog.Debug("Stream processed", "agent", a.Name(), "tool_calls", len(res.Calls), "content_length", len(res.Content), "stopped", res.Stopped, "finish_reason", res.FinishReason)
+			events <- ResponseFinished(res.FinishReason, a.Name())
 
 			// Add assistant message to conversation history, but skip empty assistant messages
 			// Providers reject assistant messages that have neither content nor tool calls.
+			// Reasoning-only messages can be retained; they are filtered out of model requests.
 			var msgUsage *MessageUsage
-			if strings.TrimSpace(res.Content) != "" || len(res.Calls) > 0 {
+			hasContent := strings.TrimSpace(res.Content) != "" || len(res.Calls) > 0
+			if hasContent || (r.retainReasoningOnly && strings.TrimSpace(res.ReasoningContent) != "") {
 				// Build tool definitions for the tool calls
 				var toolDefs []tools.Tool
 				if len(res.Calls) > 0 {
@@ -1211,14 +1614,14 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 				}
 
 				// Calculate per-message cost if usage and pricing info available
-				var messageCost float64
-				if res.Usage != nil && m != nil && m.Cost != nil {
-					messageCost = (float64(res.Usage.InputTokens)*m.Cost.Input +
-						float64(res.Usage.OutputTokens)*m.Cost.Output +
-						float64(res.Usage.CachedInputTokens)*m.Cost.CacheRead +
-						float64(res.Usage.CacheWriteTokens)*m.Cost.CacheWrite) / 1e6
+				var messageCost, messageCacheSavings float64
+				if r.costCalculation {
+					messageCost = usageCost(m, res.Usage)
+					messageCacheSavings = cacheSavings(m, res.Usage)
 				}
 
+				sess.AddCost(messageCost)
+
 				// Determine the model name to store
 				messageModel := cmp.Or(res.ActualModel, modelID)
 
@@ -1230,18 +1633,20 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 					ThoughtSignature:  res.ThoughtSignature,
 					ToolCalls:         res.Calls,
 					ToolDefinitions:   toolDefs,
-					CreatedAt:         time.Now().Format(time.RFC3339),
+					CreatedAt:         session.Now().Format(session.TimestampFormat),
 					Usage:             res.Usage,
 					Model:             messageModel,
 					Cost:              messageCost,
+					FinishReason:      res.FinishReason,
 				}
 
 				// Build per-message usage for the event
 				if res.Usage != nil {
 					msgUsage = &MessageUsage{
-						Usage: *res.Usage,
-						Cost:  messageCost,
-						Model: messageModel,
+						Usage:        *res.Usage,
+						Cost:         messageCost,
+						CacheSavings: messageCacheSavings,
+						Model:        messageModel,
 					}
 					if res.RateLimit != nil {
 						msgUsage.RateLimit = *res.RateLimit
@@ -1258,7 +1663,40 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 			usage.LastMessage = msgUsage
 			events <- NewTokenUsageEvent(sess.ID, r.CurrentAgentName(), usage)
 
-			r.processToolCalls(ctx, sess, res.Calls, agentTools, events)
+			if r.usageReporter != nil && msgUsage != nil {
+				r.usageReporter(ctx, a.Name(), msgUsage.Usage, msgUsage.Cost)
+			}
+
+			if err := r.processToolCalls(ctx, sess, res.Calls, agentTools, events); err != nil {
+				events <- Error(err.Error())
+				return
+			}
+
+			// The budget is checked once the tool calls are answered so that
+			// the session can be continued later.
+			if r.costBudget > 0 && sess.TotalCost() > r.costBudget {
+				slog.Warn("Session cost budget exceeded", "agent", a.Name(), "session_id", sess.ID, "cost", sess.TotalCost(), "budget", r.costBudget)
+				events <- CostBudgetExceeded(sess.TotalCost(), r.costBudget, a.Name())
+				content := fmt.Sprintf("I stopped because this session cost $%.4f, which exceeds the budget of $%.4f.", sess.TotalCost(), r.costBudget)
+				events <- AgentChoice(a.Name(), content)
+				addAgentMessage(sess, a, &chat.Message{
+					Role:      chat.MessageRoleAssistant,
+					Content:   content,
+					CreatedAt: session.Now().Format(session.TimestampFormat),
+				}, events)
+				break
+			}
+
+			if res.FinishReason == chat.FinishReasonLength && len(res.Calls) == 0 && strings.TrimSpace(res.Content) != "" && continuations < r.autoContinueOnLength {
+				continuations++
+				slog.Debug("Response cut off by the token limit, continuing", "agent", a.Name(), "continuation", continuations, "max", r.autoContinueOnLength)
+				events <- ContinuationStarted(continuations, r.autoContinueOnLength, a.Name())
+				continueMsg := session.ImplicitUserMessage(continuationPrompt)
+				sess.AddMessage(continueMsg)
+				events <- MessageAdded(sess.ID, continueMsg, a.Name())
+				continue
+			}
+			continuations = 0
 
 			if res.Stopped {
 				slog.Debug("Conversation stopped", "agent", a.Name())
@@ -1267,11 +1705,12 @@ func (r *LocalRuntime) RunStream(ctx context.Context, sess *session.Session) <-c
 		}
 	}()
 
-	return events
+	return r.sequenceEvents(sess, events)
 }
 
-// getTools executes tool retrieval with automatic OAuth handling
-func (r *LocalRuntime) getTools(ctx context.Context, a *agent.Agent, sessionSpan trace.Span, events chan Event) ([]tools.Tool, error) {
+// getTools executes tool retrieval with automatic OAuth handling and applies
+// the tool gate, if any.
+func (r *LocalRuntime) getTools(ctx context.Context, sess *session.Session, a *agent.Agent, sessionSpan trace.Span, events chan Event) ([]tools.Tool, error) {
 	shouldEmitMCPInit := len(a.ToolSets()) > 0
 	if shouldEmitMCPInit {
 		events <- MCPInitStarted(a.Name())
@@ -1292,6 +1731,22 @@ func (r *LocalRuntime) getTools(ctx context.Context, a *agent.Agent, sessionSpan
 	}
 
 	slog.Debug("Retrieved agent tools", "agent", a.Name(), "tool_count", len(agentTools))
+
+	if !r.defaultTools {
+		agentTools = slices.DeleteFunc(agentTools, func(tool tools.Tool) bool {
+			return slices.Contains(defaultToolNames, tool.Name)
+		})
+	}
+
+	if r.toolGate != nil {
+		if allowed := r.toolGate(sess, a); allowed != nil {
+			agentTools = slices.DeleteFunc(agentTools, func(tool tools.Tool) bool {
+				return !slices.Contains(allowed, tool.Name)
+			})
+			slog.Debug("Applied tool gate", "agent", a.Name(), "tool_count", len(agentTools))
+		}
+	}
+
 	return agentTools, nil
 }
 
@@ -1399,7 +1854,8 @@ func (r *LocalRuntime) ResumeElicitation(ctx context.Context, action tools.Elici
 
 // Run starts the agent's interaction loop
 func (r *LocalRuntime) Run(ctx context.Context, sess *session.Session) ([]session.Message, error) {
-	eventsChan := r.RunStream(ctx, sess)
+	sess = r.inputSession(sess)
+	eventsChan := r.runStream(ctx, sess)
 
 	for event := range eventsChan {
 		if errEvent, ok := event.(*ErrorEvent); ok {
@@ -1421,6 +1877,7 @@ func (r *LocalRuntime) handleStream(ctx context.Context, stream chat.MessageStre
 	var actualModel string
 	var messageUsage *chat.Usage
 	var messageRateLimit *chat.RateLimit
+	var finishReason chat.FinishReason
 
 	toolCallIndex := make(map[string]int)   // toolCallID -> index in toolCalls slice
 	emittedPartial := make(map[string]bool) // toolCallID -> whether we've emitted a partial event
@@ -1454,7 +1911,12 @@ func (r *LocalRuntime) handleStream(ctx context.Context, stream chat.MessageStre
 			break
 		}
 		if err != nil {
-			return streamResult{Stopped: true}, fmt.Errorf("error receiving from stream: %w", err)
+			// Keep what was streamed so far, to record it if the run was canceled.
+			return streamResult{
+				Content:          fullContent.String(),
+				ReasoningContent: fullReasoningContent.String(),
+				Stopped:          true,
+			}, fmt.Errorf("error receiving from stream: %w", err)
 		}
 
 		if response.Usage != nil {
@@ -1473,6 +1935,10 @@ func (r *LocalRuntime) handleStream(ctx context.Context, stream chat.MessageStre
 		}
 		choice := response.Choices[0]
 
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+
 		if len(choice.Delta.ThoughtSignature) > 0 {
 			thoughtSignature = choice.Delta.ThoughtSignature
 		}
@@ -1491,6 +1957,7 @@ func (r *LocalRuntime) handleStream(ctx context.Context, stream chat.MessageStre
 				ThinkingSignature: thinkingSignature,
 				ThoughtSignature:  thoughtSignature,
 				Stopped:           true,
+				FinishReason:      finishReason,
 				ActualModel:       actualModel,
 				Usage:             messageUsage,
 				RateLimit:         messageRateLimit,
@@ -1525,6 +1992,7 @@ func (r *LocalRuntime) handleStream(ctx context.Context, stream chat.MessageStre
 				}
 				if delta.Function.Arguments != "" {
 					tc.Function.Arguments += delta.Function.Arguments
+					events <- ToolCallArgsDelta(idx, tc.ID, delta.Function.Arguments, a.Name())
 				}
 
 				// Emit PartialToolCall once we have a name, and on subsequent argument deltas
@@ -1566,14 +2034,16 @@ func (r *LocalRuntime) handleStream(ctx context.Context, stream chat.MessageStre
 		ThinkingSignature: thinkingSignature,
 		ThoughtSignature:  thoughtSignature,
 		Stopped:           stoppedDueToNoOutput,
+		FinishReason:      finishReason,
 		ActualModel:       actualModel,
 		Usage:             messageUsage,
 		RateLimit:         messageRateLimit,
 	}, nil
 }
 
-// processToolCalls handles the execution of tool calls for an agent
-func (r *LocalRuntime) processToolCalls(ctx context.Context, sess *session.Session, calls []tools.ToolCall, agentTools []tools.Tool, events chan Event) {
+// processToolCalls handles the execution of tool calls for an agent. It only
+// returns an error, in strict mode, if the model called an unknown tool.
+func (r *LocalRuntime) processToolCalls(ctx context.Context, sess *session.Session, calls []tools.ToolCall, agentTools []tools.Tool, events chan Event) error {
 	a := r.CurrentAgent()
 	slog.Debug("Processing tool calls", "agent", a.Name(), "call_count", len(calls))
 
@@ -1582,8 +2052,41 @@ func (r *LocalRuntime) processToolCalls(ctx context.Context, sess *session.Sessi
 	for _, t := range agentTools {
 		agentToolMap[t.Name] = t
 	}
+	availableTools := slices.Sorted(maps.Keys(agentToolMap))
+
+	if r.strictToolCalls {
+		var unknown []string
+		for _, toolCall := range calls {
+			if _, available := agentToolMap[toolCall.Function.Name]; !available {
+				events <- UnknownToolCall(toolCall, availableTools, a.Name())
+				unknown = append(unknown, toolCall.Function.Name)
+			}
+		}
+		if len(unknown) > 0 {
+			err := fmt.Errorf("model called unknown tools: %s", strings.Join(unknown, ", "))
+			slog.Warn("Aborting run on unknown tool calls", "agent", a.Name(), "tools", unknown, "session_id", sess.ID)
+			for _, toolCall := range calls {
+				r.addToolErrorResponse(ctx, sess, toolCall, tools.Tool{Name: toolCall.Function.Name}, events, a, "Tool call not executed: the run was aborted because the model called unknown tools.")
+			}
+			return err
+		}
+	}
+
+	// Calls beyond the agent's per-turn limit are rejected with an error
+	// response so the model sees them as failed and can retry with fewer.
+	limit := a.MaxToolCallsPerTurn()
+	if limit > 0 && len(calls) > limit {
+		slog.Warn("Too many tool calls in one turn", "agent", a.Name(), "limit", limit, "requested", len(calls), "session_id", sess.ID)
+		events <- ToolCallLimitReached(limit, len(calls), a.Name())
+	}
+
+	for i, toolCall := range calls {
+		if limit > 0 && i >= limit {
+			errTool := tools.Tool{Name: toolCall.Function.Name}
+			r.addToolErrorResponse(ctx, sess, toolCall, errTool, events, a, fmt.Sprintf("Tool call not executed: at most %d tool calls are allowed per turn. Make fewer tool calls at once.", limit))
+			continue
+		}
 
-	for _, toolCall := range calls {
 		callCtx, callSpan := r.startSpan(ctx, "runtime.tool.call", trace.WithAttributes(
 			attribute.String("tool.name", toolCall.Function.Name),
 			attribute.String("tool.type", string(toolCall.Type)),
@@ -1601,8 +2104,9 @@ func (r *LocalRuntime) processToolCalls(ctx context.Context, sess *session.Sessi
 		tool, available := agentToolMap[toolCall.Function.Name]
 		if !available {
 			slog.Warn("Tool call for unavailable tool", "agent", a.Name(), "tool", toolCall.Function.Name, "session_id", sess.ID)
+			events <- UnknownToolCall(toolCall, availableTools, a.Name())
 			errTool := tools.Tool{Name: toolCall.Function.Name}
-			r.addToolErrorResponse(ctx, sess, toolCall, errTool, events, a, fmt.Sprintf("Tool '%s' is not available. You can only use the tools provided to you.", toolCall.Function.Name))
+			r.addToolErrorResponse(ctx, sess, toolCall, errTool, events, a, unknownToolMessage(toolCall.Function.Name, availableTools))
 			callSpan.SetStatus(codes.Error, "tool not available")
 			callSpan.End()
 			continue
@@ -1622,12 +2126,23 @@ func (r *LocalRuntime) processToolCalls(ctx context.Context, sess *session.Sessi
 		if canceled {
 			callSpan.SetStatus(codes.Ok, "tool call canceled by user")
 			callSpan.End()
-			return
+			return nil
 		}
 
 		callSpan.SetStatus(codes.Ok, "tool call processed")
 		callSpan.End()
 	}
+	return nil
+}
+
+// unknownToolMessage is the error response to a call to an unknown tool. It
+// lists the available tools so that the model can pick one of them instead.
+func unknownToolMessage(name string, availableTools []string) string {
+	available := "none"
+	if len(availableTools) > 0 {
+		available = strings.Join(availableTools, ", ")
+	}
+	return fmt.Sprintf("unknown tool: %s, available tools: %s", name, available)
 }
 
 // executeWithApproval handles the tool approval flow and executes the tool.
@@ -1638,7 +2153,7 @@ func (r *LocalRuntime) processToolCalls(ctx context.Context, sess *session.Sessi
 //  1. sess.ToolsApproved (--yolo flag) - auto-approve everything, takes precedence
 //  2. Session-level permissions (if configured) - pattern-based Allow/Ask/Deny rules
 //  3. Team-level permissions config - checked second
-//  4. Read-only hint - auto-approve
+//  4. Read-only hint - auto-approve, unless disabled with WithAutoApproveReadOnly
 //  5. Default: ask for user confirmation
 func (r *LocalRuntime) executeWithApproval(
 	ctx context.Context,
@@ -1689,7 +2204,7 @@ func (r *LocalRuntime) executeWithApproval(
 	}
 
 	// No permission rule matched. Auto-approve if the tool is read-only.
-	if tool.Annotations.ReadOnlyHint {
+	if r.autoApproveReadOnly && tool.Annotations.ReadOnlyHint {
 		runTool()
 		return false
 	}
@@ -1740,6 +2255,8 @@ func (r *LocalRuntime) askUserForConfirmation(
 	toolName := toolCall.Function.Name
 	slog.Debug("Tools not approved, waiting for resume", "tool", toolName, "session_id", sess.ID)
 	events <- ToolCallConfirmation(toolCall, tool, a.Name())
+	destructive := tool.Annotations.DestructiveHint != nil && *tool.Annotations.DestructiveHint
+	events <- ToolApprovalRequested(toolCall.ID, toolName, toolCall.Function.Arguments, destructive, a.Name())
 
 	r.executeOnUserInputHooks(ctx, sess.ID, "tool confirmation")
 
@@ -1827,18 +2344,23 @@ func (r *LocalRuntime) executeToolWithHandler(
 
 	events <- ToolCallResponse(toolCall, tool, res, res.Output, a.Name())
 
+	content := a.FormatToolResult(toolCall.Function.Name, res)
+	if a.SanitizeToolOutput() {
+		content = sanitize.Text(content)
+	}
+
 	// Ensure tool response content is not empty for API compatibility
-	content := res.Output
 	if strings.TrimSpace(content) == "" {
 		content = "(no output)"
 	}
 
 	toolResponseMsg := chat.Message{
-		Role:       chat.MessageRoleTool,
-		Content:    content,
-		ToolCallID: toolCall.ID,
-		IsError:    res.IsError,
-		CreatedAt:  time.Now().Format(time.RFC3339),
+		Role:         chat.MessageRoleTool,
+		Content:      content,
+		ToolCallID:   toolCall.ID,
+		IsError:      res.IsError,
+		ToolCategory: tool.Category,
+		CreatedAt:    session.Now().Format(session.TimestampFormat),
 	}
 
 	// If the tool result contains images, attach them as MultiContent
@@ -1861,7 +2383,10 @@ func (r *LocalRuntime) executeToolWithHandler(
 		toolResponseMsg.MultiContent = multiContent
 	}
 
-	addAgentMessage(sess, a, &toolResponseMsg, events)
+	agentMsg := session.NewAgentMessage(a, &toolResponseMsg)
+	agentMsg.RawOutput = res.RawOutput
+	sess.AddMessage(agentMsg)
+	events <- MessageAdded(sess.ID, agentMsg, a.Name())
 }
 
 // runTool executes agent tools from toolsets (MCP, filesystem, etc.).
@@ -1951,6 +2476,26 @@ func (r *LocalRuntime) runAgentTool(ctx context.Context, handler ToolHandlerFunc
 		})
 }
 
+// interruptedMarker is appended to the content of an assistant message whose
+// stream was canceled.
+const interruptedMarker = "[interrupted]"
+
+// addInterruptedMessage records the content streamed before a run was
+// canceled, marked as interrupted. Partial tool calls are dropped since they
+// won't be answered.
+func addInterruptedMessage(sess *session.Session, a *agent.Agent, res streamResult, events chan Event) {
+	if strings.TrimSpace(res.Content) == "" {
+		return
+	}
+
+	addAgentMessage(sess, a, &chat.Message{
+		Role:             chat.MessageRoleAssistant,
+		Content:          res.Content + "\n\n" + interruptedMarker,
+		ReasoningContent: res.ReasoningContent,
+		CreatedAt:        session.Now().Format(session.TimestampFormat),
+	}, events)
+}
+
 func addAgentMessage(sess *session.Session, a *agent.Agent, msg *chat.Message, events chan Event) {
 	agentMsg := session.NewAgentMessage(a, msg)
 	sess.AddMessage(agentMsg)
@@ -1963,11 +2508,12 @@ func (r *LocalRuntime) addToolErrorResponse(_ context.Context, sess *session.Ses
 	events <- ToolCallResponse(toolCall, tool, tools.ResultError(errorMsg), errorMsg, a.Name())
 
 	toolResponseMsg := chat.Message{
-		Role:       chat.MessageRoleTool,
-		Content:    errorMsg,
-		ToolCallID: toolCall.ID,
-		IsError:    true,
-		CreatedAt:  time.Now().Format(time.RFC3339),
+		Role:         chat.MessageRoleTool,
+		Content:      errorMsg,
+		ToolCallID:   toolCall.ID,
+		IsError:      true,
+		ToolCategory: tool.Category,
+		CreatedAt:    session.Now().Format(session.TimestampFormat),
 	}
 	addAgentMessage(sess, a, &toolResponseMsg, events)
 }
@@ -2019,7 +2565,7 @@ func (r *LocalRuntime) RunAgent(ctx context.Context, params agenttool.RunParams)
 	// supports per-session permission scoping rather than a single shared ToolsApproved flag.
 	s := session.New(
 		session.WithSystemMessage(systemMsg),
-		session.WithImplicitUserMessage("Please proceed."),
+		session.WithImplicitUserMessage(child.TransferKickoffMessage()),
 		session.WithMaxIterations(child.MaxIterations()),
 		session.WithTitle("Background agent task"),
 		session.WithToolsApproved(true),
@@ -2064,6 +2610,7 @@ func (r *LocalRuntime) handleTaskTransfer(ctx context.Context, sess *session.Ses
 		Agent          string `json:"agent"`
 		Task           string `json:"task"`
 		ExpectedOutput string `json:"expected_output"`
+		WorkingDir     string `json:"working_dir"`
 	}
 
 	if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
@@ -2088,6 +2635,10 @@ func (r *LocalRuntime) handleTaskTransfer(ctx context.Context, sess *session.Ses
 		return tools.ResultError(errorMsg), nil
 	}
 
+	if !a.CanTransferTo(params.Agent) {
+		return tools.ResultError(fmt.Sprintf("Agent %s is not allowed to transfer tasks to %s.", a.Name(), params.Agent)), nil
+	}
+
 	// Span for task transfer (optional)
 	ctx, span := r.startSpan(ctx, "runtime.task_transfer", trace.WithAttributes(
 		attribute.String("from.agent", a.Name()),
@@ -2136,23 +2687,40 @@ func (r *LocalRuntime) handleTaskTransfer(ctx context.Context, sess *session.Ses
 
 	s := session.New(
 		session.WithSystemMessage(memberAgentTask),
-		session.WithImplicitUserMessage("Please proceed."),
+		session.WithImplicitUserMessage(child.TransferKickoffMessage()),
 		session.WithMaxIterations(child.MaxIterations()),
 		session.WithTitle("Transferred task"),
 		session.WithToolsApproved(sess.ToolsApproved),
 		session.WithThinking(sess.Thinking),
 		session.WithSendUserMessage(false),
 		session.WithParentID(sess.ID),
+		session.WithWorkingDir(sess.WorkingDir),
 	)
 
-	return r.runSubSession(ctx, sess, s, span, evts, a.Name())
+	// The member works in the parent's directory unless it's given its own,
+	// in which case its tools (the shell in particular) run there.
+	if params.WorkingDir != "" {
+		s.WorkingDir = params.WorkingDir
+		if !filepath.IsAbs(s.WorkingDir) {
+			s.WorkingDir = filepath.Join(cmp.Or(sess.WorkingDir, r.workingDir), s.WorkingDir)
+		}
+		ctx = tools.WithWorkingDir(ctx, s.WorkingDir)
+	}
+
+	return r.runSubSession(ctx, sess, s, span, evts, a.Name(), child.Name())
 }
 
 // runSubSession runs a child session within the parent, forwarding events and
 // propagating state (tool approvals, thinking) back to the parent when done.
-func (r *LocalRuntime) runSubSession(ctx context.Context, parent, child *session.Session, span trace.Span, evts chan Event, agentName string) (*tools.ToolCallResult, error) {
+func (r *LocalRuntime) runSubSession(ctx context.Context, parent, child *session.Session, span trace.Span, evts chan Event, agentName, childAgentName string) (*tools.ToolCallResult, error) {
+	finalOnly := r.subSessionEventMode == SubSessionEventModeFinalOnly
 	for event := range r.RunStream(ctx, child) {
-		evts <- event
+		if fe, ok := event.(interface{ forwardedFrom(string) }); ok {
+			fe.forwardedFrom(child.ID)
+		}
+		if !finalOnly || forwardedInFinalOnlyMode(event) {
+			evts <- event
+		}
 		if errEvent, ok := event.(*ErrorEvent); ok {
 			span.RecordError(fmt.Errorf("%s", errEvent.Error))
 			span.SetStatus(codes.Error, "sub-session error")
@@ -2164,6 +2732,9 @@ func (r *LocalRuntime) runSubSession(ctx context.Context, parent, child *session
 	parent.Thinking = child.Thinking
 
 	parent.AddSubSession(child)
+	if finalOnly {
+		evts <- SubAgentResult(childAgentName, child.GetLastAssistantMessageContent())
+	}
 	evts <- SubSessionCompleted(parent.ID, child, agentName)
 
 	span.SetStatus(codes.Ok, "sub-session completed")
@@ -2286,11 +2857,32 @@ func (r *LocalRuntime) setModelAndEmitInfo(ctx context.Context, modelRef string,
 	return tools.ResultSuccess(fmt.Sprintf("Model changed to %s", modelRef)), nil
 }
 
+// GenerateShortSummary returns a one-line summary of what changed during the
+// session, suitable as a commit message subject. It uses the same model as
+// Summarize but doesn't add a summary to the session.
+func (r *LocalRuntime) GenerateShortSummary(ctx context.Context, sess *session.Session) (string, error) {
+	return r.sessionCompactor.ShortSummary(ctx, sess)
+}
+
 // Summarize generates a summary for the session based on the conversation history.
 // The additionalPrompt parameter allows users to provide additional instructions
 // for the summarization (e.g., "focus on code changes" or "include action items").
+//
+// The summary can be cancelled with CancelCompaction, in which case the session
+// is left as is and a run that triggered the compaction goes on with the full
+// history.
 func (r *LocalRuntime) Summarize(ctx context.Context, sess *session.Session, additionalPrompt string, events chan Event) {
-	r.sessionCompactor.Compact(ctx, sess, additionalPrompt, events, r.CurrentAgentName())
+	compactionCtx, cancel := context.WithCancel(ctx)
+	r.cancelCompactionMux.Lock()
+	r.cancelCompaction = cancel
+	r.cancelCompactionMux.Unlock()
+
+	r.sessionCompactor.Compact(compactionCtx, sess, additionalPrompt, events, r.CurrentAgent())
+
+	r.cancelCompactionMux.Lock()
+	r.cancelCompaction = nil
+	r.cancelCompactionMux.Unlock()
+	cancel()
 
 	// Emit a TokenUsageEvent so the sidebar immediately reflects the
 	// compaction: tokens drop to the summary size, context % drops, and
@@ -2304,6 +2896,18 @@ func (r *LocalRuntime) Summarize(ctx context.Context, sess *session.Session, add
 	events <- NewTokenUsageEvent(sess.ID, r.CurrentAgentName(), SessionUsage(sess, contextLimit))
 }
 
+// CancelCompaction cancels the in-flight summary of Summarize, if any.
+func (r *LocalRuntime) CancelCompaction() bool {
+	r.cancelCompactionMux.Lock()
+	defer r.cancelCompactionMux.Unlock()
+
+	if r.cancelCompaction == nil {
+		return false
+	}
+	r.cancelCompaction()
+	return true
+}
+
 // setElicitationEventsChannel sets the current events channel for elicitation requests
 func (r *LocalRuntime) setElicitationEventsChannel(events chan Event) {
 	r.elicitationEventsChannelMux.Lock()
@@ -2354,6 +2958,131 @@ func (r *LocalRuntime) elicitationHandler(ctx context.Context, req *mcp.ElicitPa
 	}
 }
 
+// PreviewMessages returns the messages that the next turn of the session
+// would send to the model, system prompts and implicit messages included,
+// without calling the model.
+func (r *LocalRuntime) PreviewMessages(ctx context.Context, sess *session.Session) ([]chat.Message, error) {
+	a, err := r.sessionAgent(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := r.modelsStore.GetModel(ctx, a.Model().ID())
+	if err != nil {
+		slog.Debug("Failed to get model definition", "error", err)
+	}
+
+	return modelMessages(sess, a, m), nil
+}
+
+// WillCompact reports whether the next turn of the session will start by
+// compacting it, because its token count is over the compaction threshold
+// of the model in use.
+func (r *LocalRuntime) WillCompact(ctx context.Context, sess *session.Session) (bool, error) {
+	if !r.sessionCompaction {
+		return false, nil
+	}
+
+	a, err := r.sessionAgent(sess)
+	if err != nil {
+		return false, err
+	}
+
+	m, err := r.modelsStore.GetModel(ctx, a.Model().ID())
+	if err != nil {
+		return false, fmt.Errorf("getting model definition: %w", err)
+	}
+
+	return needsCompaction(sess, m), nil
+}
+
+// sessionAgent returns the agent the session runs with: the session's own
+// agent if it has one, the current agent otherwise.
+func (r *LocalRuntime) sessionAgent(sess *session.Session) (*agent.Agent, error) {
+	if sess.AgentName != "" {
+		return r.team.Agent(sess.AgentName)
+	}
+	return r.CurrentAgent(), nil
+}
+
+// needsCompaction reports whether the session uses more than
+// compactionThreshold of the model's context window.
+func needsCompaction(sess *session.Session, m *modelsdev.Model) bool {
+	if m == nil {
+		return false
+	}
+	contextLength := sess.InputTokens + sess.OutputTokens
+	return contextLength > int64(float64(m.Limit.Context)*compactionThreshold)
+}
+
+// modelMessages builds the messages sent to the model for the given agent.
+func modelMessages(sess *session.Session, a *agent.Agent, m *modelsdev.Model) []chat.Message {
+	messages := sess.GetMessages(a)
+
+	// Strip image content from messages if the model doesn't support image input.
+	// This prevents API errors when conversation history contains images (e.g. from
+	// tool results or user attachments) but the current model is text-only.
+	if m != nil && len(m.Modalities.Input) > 0 && !slices.Contains(m.Modalities.Input, "image") {
+		messages = stripImageContent(messages)
+	}
+
+	return messages
+}
+
+// recoverFromContextExceeded shrinks the conversation after a provider rejected
+// it for not fitting in the context window, and returns the messages to retry with.
+//
+// When session compaction is enabled the session itself is compacted, so every
+// following request in this and later turns benefits from it. Otherwise (e.g. the
+// runtime generating a summary) only this request's messages are truncated.
+func (r *LocalRuntime) recoverFromContextExceeded(ctx context.Context, sess *session.Session, a *agent.Agent, m *modelsdev.Model, messages []chat.Message, events chan Event) ([]chat.Message, bool) {
+	if r.sessionCompaction {
+		slog.Warn("Context window exceeded, compacting session", "agent", a.Name(), "session_id", sess.ID)
+		events <- Warning("The conversation no longer fits in the model's context window. Compacting the session and retrying.", a.Name())
+
+		itemCount := len(sess.Messages)
+		r.Summarize(ctx, sess, "", events)
+		if len(sess.Messages) == itemCount {
+			// No summary was produced, retrying would fail the same way.
+			return nil, false
+		}
+		return modelMessages(sess, a, m), true
+	}
+
+	truncated := truncateForContextRecovery(messages)
+	if len(truncated) == len(messages) {
+		return nil, false
+	}
+
+	slog.Warn("Context window exceeded, retrying with truncated conversation",
+		"agent", a.Name(), "messages", len(messages), "kept", len(truncated))
+	events <- Warning("The conversation no longer fits in the model's context window. Older messages were left out of this request.", a.Name())
+	return truncated, true
+}
+
+// truncateForContextRecovery drops the oldest half of the conversation while
+// keeping the leading system messages. The kept window always starts on a
+// user message so that tool results are never separated from their calls.
+// If no such cut point exists, messages is returned unchanged.
+func truncateForContextRecovery(messages []chat.Message) []chat.Message {
+	systemEnd := 0
+	for systemEnd < len(messages) && messages[systemEnd].Role == chat.MessageRoleSystem {
+		systemEnd++
+	}
+
+	conversation := messages[systemEnd:]
+	for i := len(conversation) / 2; i < len(conversation); i++ {
+		if i == 0 || conversation[i].Role != chat.MessageRoleUser {
+			continue
+		}
+		truncated := make([]chat.Message, 0, systemEnd+len(conversation)-i)
+		truncated = append(truncated, messages[:systemEnd]...)
+		return append(truncated, conversation[i:]...)
+	}
+
+	return messages
+}
+
 // stripImageContent returns a copy of messages with all image-related content
 // removed. This is used when the target model doesn't support image input to
 // prevent API errors. Text content is preserved; image parts in MultiContent
@@ -74,3 +74,31 @@ func TestResponseAPIMultipleToolCalls(t *testing.T) {
 	}
 	require.ElementsMatch(t, []string{"search", "calculate"}, toolCalls, "Expected both tool calls")
 }
+
+// TestToolCallArgsDeltaEvents verifies that argument fragments are surfaced
+// as they stream in, tagged with the index of their tool call
+func TestToolCallArgsDeltaEvents(t *testing.T) {
+	stream := newStreamBuilder().
+		AddToolCallName("call_1", "search").
+		AddToolCallName("call_2", "calculate").
+		AddToolCallArguments("call_1", `{"query":`).
+		AddToolCallArguments("call_2", `{"expression": "2+2"}`).
+		AddToolCallArguments("call_1", ` "test"}`).
+		AddStopWithUsage(20, 30).
+		Build()
+
+	sess := session.New(session.WithUserMessage("Search and calculate"))
+
+	events := runSession(t, sess, stream)
+
+	args := map[int]string{}
+	for _, ev := range events {
+		if delta, ok := ev.(*ToolCallArgsDeltaEvent); ok {
+			args[delta.Index] += delta.Delta
+		}
+	}
+	require.Equal(t, map[int]string{
+		0: `{"query": "test"}`,
+		1: `{"expression": "2+2"}`,
+	}, args)
+}
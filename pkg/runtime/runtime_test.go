@@ -2,9 +2,11 @@ package runtime
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"path/filepath"
 	"reflect"
 	"sync"
 	"testing"
@@ -17,7 +19,9 @@ import (
 	"github.com/docker/cagent/pkg/agent"
 	"github.com/docker/cagent/pkg/chat"
 	"github.com/docker/cagent/pkg/config/latest"
+	"github.com/docker/cagent/pkg/model/provider"
 	"github.com/docker/cagent/pkg/model/provider/base"
+	"github.com/docker/cagent/pkg/model/provider/options"
 	"github.com/docker/cagent/pkg/modelsdev"
 	"github.com/docker/cagent/pkg/permissions"
 	"github.com/docker/cagent/pkg/rag"
@@ -27,6 +31,7 @@ import (
 	"github.com/docker/cagent/pkg/session"
 	"github.com/docker/cagent/pkg/team"
 	"github.com/docker/cagent/pkg/tools"
+	"github.com/docker/cagent/pkg/tools/builtin"
 )
 
 type stubToolSet struct {
@@ -212,13 +217,19 @@ func hasEventType(t *testing.T, events []Event, target Event) bool {
 	return false
 }
 
-// assertEventsEqual compares two event slices, ignoring timestamps.
-// Timestamps are inherently non-deterministic in tests.
+// assertEventsEqual compares two event slices, ignoring timestamps and
+// sequence numbers. Timestamps are inherently non-deterministic in tests.
 func assertEventsEqual(t *testing.T, expected, actual []Event) {
 	t.Helper()
 
 	require.Len(t, actual, len(expected), "event count mismatch")
 
+	for i := range actual {
+		if e, ok := actual[i].(interface{ setSeq(uint64) }); ok {
+			e.setSeq(0)
+		}
+	}
+
 	for i := range expected {
 		expectedType := reflect.TypeOf(expected[i])
 		actualType := reflect.TypeOf(actual[i])
@@ -270,11 +281,12 @@ func TestSimple(t *testing.T) {
 
 	// Extract the actual message from MessageAddedEvent to use in comparison
 	// (it contains dynamic fields like CreatedAt that we can't predict)
-	require.Len(t, events, 10)
-	msgAdded := events[7].(*MessageAddedEvent)
+	require.Len(t, events, 11)
+	msgAdded := events[8].(*MessageAddedEvent)
 	require.NotNil(t, msgAdded.Message)
 	require.Equal(t, "Hello", msgAdded.Message.Message.Content)
 	require.Equal(t, chat.MessageRoleAssistant, msgAdded.Message.Message.Role)
+	require.Equal(t, chat.FinishReasonStop, msgAdded.Message.Message.FinishReason)
 
 	expectedEvents := []Event{
 		AgentInfo("root", "test/mock-model", "", ""),
@@ -284,6 +296,7 @@ func TestSimple(t *testing.T) {
 		StreamStarted(sess.ID, "root"),
 		ToolsetInfo(0, false, "root"),
 		AgentChoice("root", "Hello"),
+		ResponseFinished(chat.FinishReasonStop, "root"),
 		MessageAdded(sess.ID, msgAdded.Message, "root"),
 		NewTokenUsageEvent(sess.ID, "root", &Usage{InputTokens: 3, OutputTokens: 2, ContextLength: 5, LastMessage: &MessageUsage{
 			Usage: chat.Usage{InputTokens: 3, OutputTokens: 2},
@@ -311,8 +324,8 @@ func TestMultipleContentChunks(t *testing.T) {
 
 	// Extract the actual message from MessageAddedEvent to use in comparison
 	// (it contains dynamic fields like CreatedAt that we can't predict)
-	require.Len(t, events, 14)
-	msgAdded := events[11].(*MessageAddedEvent)
+	require.Len(t, events, 15)
+	msgAdded := events[12].(*MessageAddedEvent)
 	require.NotNil(t, msgAdded.Message)
 
 	expectedEvents := []Event{
@@ -327,6 +340,7 @@ func TestMultipleContentChunks(t *testing.T) {
 		AgentChoice("root", "how "),
 		AgentChoice("root", "are "),
 		AgentChoice("root", "you?"),
+		ResponseFinished(chat.FinishReasonStop, "root"),
 		MessageAdded(sess.ID, msgAdded.Message, "root"),
 		NewTokenUsageEvent(sess.ID, "root", &Usage{InputTokens: 8, OutputTokens: 12, ContextLength: 20, LastMessage: &MessageUsage{
 			Usage: chat.Usage{InputTokens: 8, OutputTokens: 12},
@@ -352,8 +366,8 @@ func TestWithReasoning(t *testing.T) {
 
 	// Extract the actual message from MessageAddedEvent to use in comparison
 	// (it contains dynamic fields like CreatedAt that we can't predict)
-	require.Len(t, events, 12)
-	msgAdded := events[9].(*MessageAddedEvent)
+	require.Len(t, events, 13)
+	msgAdded := events[10].(*MessageAddedEvent)
 	require.NotNil(t, msgAdded.Message)
 
 	expectedEvents := []Event{
@@ -366,6 +380,7 @@ func TestWithReasoning(t *testing.T) {
 		AgentChoiceReasoning("root", "Let me think about this..."),
 		AgentChoiceReasoning("root", " I should respond politely."),
 		AgentChoice("root", "Hello, how can I help you?"),
+		ResponseFinished(chat.FinishReasonStop, "root"),
 		MessageAdded(sess.ID, msgAdded.Message, "root"),
 		NewTokenUsageEvent(sess.ID, "root", &Usage{InputTokens: 10, OutputTokens: 15, ContextLength: 25, LastMessage: &MessageUsage{
 			Usage: chat.Usage{InputTokens: 10, OutputTokens: 15},
@@ -392,8 +407,8 @@ func TestMixedContentAndReasoning(t *testing.T) {
 
 	// Extract the actual message from MessageAddedEvent to use in comparison
 	// (it contains dynamic fields like CreatedAt that we can't predict)
-	require.Len(t, events, 13)
-	msgAdded := events[10].(*MessageAddedEvent)
+	require.Len(t, events, 14)
+	msgAdded := events[11].(*MessageAddedEvent)
 	require.NotNil(t, msgAdded.Message)
 
 	expectedEvents := []Event{
@@ -407,6 +422,7 @@ func TestMixedContentAndReasoning(t *testing.T) {
 		AgentChoice("root", "Hello!"),
 		AgentChoiceReasoning("root", " I should be friendly"),
 		AgentChoice("root", " How can I help you today?"),
+		ResponseFinished(chat.FinishReasonStop, "root"),
 		MessageAdded(sess.ID, msgAdded.Message, "root"),
 		NewTokenUsageEvent(sess.ID, "root", &Usage{InputTokens: 15, OutputTokens: 20, ContextLength: 35, LastMessage: &MessageUsage{
 			Usage: chat.Usage{InputTokens: 15, OutputTokens: 20},
@@ -468,6 +484,141 @@ func TestErrorEvent(t *testing.T) {
 	require.Contains(t, errorEvent.Error, "simulated error")
 }
 
+// contextExceededProvider serves the queued streams in order, rejecting the
+// request as too long for every nil entry. It records the messages it received.
+type contextExceededProvider struct {
+	id       string
+	mu       sync.Mutex
+	streams  []chat.MessageStream
+	received [][]chat.Message
+}
+
+func (p *contextExceededProvider) ID() string { return p.id }
+
+func (p *contextExceededProvider) CreateChatCompletionStream(_ context.Context, messages []chat.Message, _ []tools.Tool) (chat.MessageStream, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.received = append(p.received, messages)
+	if len(p.streams) == 0 {
+		return &mockStream{}, nil
+	}
+	s := p.streams[0]
+	p.streams = p.streams[1:]
+	if s == nil {
+		return nil, base.WrapContextExceeded(errors.New("prompt is too long"))
+	}
+	return s, nil
+}
+
+func (p *contextExceededProvider) BaseConfig() base.Config { return base.Config{} }
+
+func (p *contextExceededProvider) MaxTokens() int { return 0 }
+
+func newLongSession(root *agent.Agent) *session.Session {
+	sess := session.New(session.WithUserMessage("first"))
+	sess.AddMessage(session.NewAgentMessage(root, &chat.Message{Role: chat.MessageRoleAssistant, Content: "one"}))
+	sess.AddMessage(session.UserMessage("second"))
+	sess.AddMessage(session.NewAgentMessage(root, &chat.Message{Role: chat.MessageRoleAssistant, Content: "two"}))
+	sess.AddMessage(session.UserMessage("third"))
+	sess.Title = "Unit Test"
+	return sess
+}
+
+func TestContextExceededRetriesWithTruncatedConversation(t *testing.T) {
+	stream := newStreamBuilder().
+		AddContent("Done").
+		AddStopWithUsage(3, 2).
+		Build()
+	prov := &contextExceededProvider{id: "test/mock-model", streams: []chat.MessageStream{nil, stream}}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := newLongSession(root)
+
+	var events []Event
+	for ev := range rt.RunStream(t.Context(), sess) {
+		events = append(events, ev)
+	}
+
+	require.True(t, hasEventType(t, events, &WarningEvent{}), "expected a warning about truncation")
+	require.False(t, hasEventType(t, events, &ErrorEvent{}), "expected recovery without error")
+	require.Len(t, prov.received, 2)
+	require.Less(t, len(prov.received[1]), len(prov.received[0]))
+	last := prov.received[1][len(prov.received[1])-1]
+	assert.Equal(t, "third", last.Content)
+}
+
+func TestContextExceededCompactsSession(t *testing.T) {
+	summaryStream := newStreamBuilder().
+		AddContent("summary").
+		AddStopWithUsage(1, 1).
+		Build()
+	stream := newStreamBuilder().
+		AddContent("Done").
+		AddStopWithUsage(3, 2).
+		Build()
+	prov := &contextExceededProvider{id: "test/mock-model", streams: []chat.MessageStream{nil, summaryStream, stream}}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(true), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := newLongSession(root)
+
+	var events []Event
+	for ev := range rt.RunStream(t.Context(), sess) {
+		events = append(events, ev)
+	}
+
+	require.True(t, hasEventType(t, events, &SessionSummaryEvent{}), "expected the session to be compacted")
+	require.False(t, hasEventType(t, events, &ErrorEvent{}), "expected recovery without error")
+
+	// The compaction is stored on the session so later requests stay small too.
+	var summaries int
+	for _, item := range sess.Messages {
+		if item.Summary != "" {
+			summaries++
+		}
+	}
+	assert.Equal(t, 1, summaries)
+
+	require.Len(t, prov.received, 3)
+	retried := prov.received[2]
+	var sawSummary bool
+	for _, msg := range retried {
+		assert.NotEqual(t, "first", msg.Content)
+		if msg.Content == "Session Summary: summary" {
+			sawSummary = true
+		}
+	}
+	assert.True(t, sawSummary, "expected the retry to be built from the compacted session")
+}
+
+func TestTruncateForContextRecovery(t *testing.T) {
+	messages := []chat.Message{
+		{Role: chat.MessageRoleSystem, Content: "sys"},
+		{Role: chat.MessageRoleUser, Content: "u1"},
+		{Role: chat.MessageRoleAssistant, Content: "a1"},
+		{Role: chat.MessageRoleTool, Content: "t1"},
+		{Role: chat.MessageRoleUser, Content: "u2"},
+		{Role: chat.MessageRoleAssistant, Content: "a2"},
+	}
+
+	truncated := truncateForContextRecovery(messages)
+	require.Len(t, truncated, 3)
+	assert.Equal(t, "sys", truncated[0].Content)
+	assert.Equal(t, "u2", truncated[1].Content)
+	assert.Equal(t, "a2", truncated[2].Content)
+
+	// Nothing to drop when there is a single user turn
+	single := messages[:3]
+	assert.Equal(t, single, truncateForContextRecovery(single))
+}
+
 func TestContextCancellation(t *testing.T) {
 	stream := newStreamBuilder().
 		AddContent("This should not complete").
@@ -602,6 +753,42 @@ func TestStartBackgroundRAGInit_StopsForwardingAfterContextCancel(t *testing.T)
 	}
 }
 
+func TestWithRAGDisabled(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	strategyEvents := make(chan ragtypes.Event, 10)
+	mgr, err := rag.New(ctx, "test-rag", rag.Config{
+		StrategyConfigs: []strategy.Config{{Name: "stub", Strategy: &stubRAGStrategy{}}},
+	}, strategyEvents)
+	require.NoError(t, err)
+	defer func() {
+		_ = mgr.Close()
+	}()
+
+	prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root), team.WithRAGManagers(map[string]*rag.Manager{"default": mgr}))
+
+	rt, err := NewLocalRuntime(tm, WithModelStore(mockModelStore{}), WithRAG(false))
+	require.NoError(t, err)
+
+	eventsCh := make(chan Event, 10)
+	rt.StartBackgroundRAGInit(ctx, func(ev Event) {
+		eventsCh <- ev
+	})
+	rt.InitializeRAG(ctx, eventsCh)
+
+	strategyEvents <- ragtypes.Event{Type: ragtypes.EventTypeIndexingComplete, StrategyName: "stub"}
+
+	select {
+	case ev := <-eventsCh:
+		t.Fatalf("expected no RAG events with RAG disabled, got %T", ev)
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.False(t, rt.ragInitialized.Load())
+}
+
 func TestToolCallVariations(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -734,6 +921,32 @@ func TestCompaction(t *testing.T) {
 	}
 
 	require.NotEqual(t, -1, compactionStartIdx, "expected a SessionCompaction start event")
+
+	var compacted *SessionCompactedEvent
+	for _, ev := range seen {
+		if e, ok := ev.(*SessionCompactedEvent); ok {
+			compacted = e
+		}
+	}
+	require.NotNil(t, compacted, "expected a SessionCompacted event")
+	assert.Equal(t, sess.ID, compacted.SessionID)
+	assert.Equal(t, 3, compacted.MessagesSummarized)
+	assert.Equal(t, len("summary"), compacted.SummaryLength)
+	assert.Equal(t, 0, compacted.FirstItem)
+	assert.Equal(t, 2, compacted.LastItem)
+
+	// The summary streams before it is committed.
+	var streamed string
+	for _, ev := range seen {
+		switch e := ev.(type) {
+		case *SummaryDeltaEvent:
+			assert.Equal(t, sess.ID, e.SessionID)
+			streamed += e.Delta
+		case *SessionSummaryEvent:
+			assert.Equal(t, e.Summary, streamed)
+		}
+	}
+	assert.Equal(t, "summary", streamed)
 }
 
 func TestSessionWithoutUserMessage(t *testing.T) {
@@ -814,7 +1027,7 @@ func TestGetTools_WarningHandling(t *testing.T) {
 			sessionSpan := trace.SpanFromContext(t.Context())
 
 			// First call
-			tools1, err := rt.getTools(t.Context(), root, sessionSpan, events)
+			tools1, err := rt.getTools(t.Context(), nil, root, sessionSpan, events)
 			require.NoError(t, err)
 			require.Len(t, tools1, tt.wantToolCount)
 
@@ -825,6 +1038,64 @@ func TestGetTools_WarningHandling(t *testing.T) {
 	}
 }
 
+func TestToolGate(t *testing.T) {
+	agentTools := []tools.Tool{{Name: "test"}, {Name: "deploy"}}
+	root := agent.New("root", "test", agent.WithTools(agentTools...), agent.WithModel(&mockProvider{}))
+
+	// Only allow deploying once the tests passed.
+	gate := func(sess *session.Session, _ *agent.Agent) []string {
+		for _, item := range sess.Messages {
+			if item.IsMessage() && item.Message.Message.Role == chat.MessageRoleTool && item.Message.Message.Content == "PASS" {
+				return nil
+			}
+		}
+		return []string{"test"}
+	}
+	rt, err := NewLocalRuntime(team.New(team.WithAgents(root)), WithModelStore(mockModelStore{}), WithToolGate(gate))
+	require.NoError(t, err)
+
+	events := make(chan Event, 10)
+	sessionSpan := trace.SpanFromContext(t.Context())
+	sess := session.New(session.WithUserMessage("deploy"))
+
+	got, err := rt.getTools(t.Context(), sess, root, sessionSpan, events)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "test", got[0].Name)
+
+	sess.AddMessage(session.NewAgentMessage(root, &chat.Message{Role: chat.MessageRoleTool, ToolCallID: "call_1", Content: "PASS"}))
+
+	got, err = rt.getTools(t.Context(), sess, root, sessionSpan, events)
+	require.NoError(t, err)
+	assert.Len(t, got, 2)
+}
+
+func TestWithDefaultToolsDisabled(t *testing.T) {
+	agentTools := []tools.Tool{{Name: "read_file"}, {Name: builtin.ToolNameTransferTask}, {Name: builtin.ToolNameHandoff}}
+	root := agent.New("root", "test", agent.WithTools(agentTools...), agent.WithModel(&mockProvider{}))
+
+	rt, err := NewLocalRuntime(team.New(team.WithAgents(root)), WithModelStore(mockModelStore{}), WithDefaultTools(false))
+	require.NoError(t, err)
+	rt.registerDefaultTools()
+	assert.Empty(t, rt.toolMap)
+
+	events := make(chan Event, 10)
+	got, err := rt.getTools(t.Context(), session.New(), root, trace.SpanFromContext(t.Context()), events)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "read_file", got[0].Name)
+
+	// The default tools are on by default.
+	rt, err = NewLocalRuntime(team.New(team.WithAgents(root)), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+	rt.registerDefaultTools()
+	assert.Contains(t, rt.toolMap, builtin.ToolNameTransferTask)
+
+	got, err = rt.getTools(t.Context(), session.New(), root, trace.SpanFromContext(t.Context()), events)
+	require.NoError(t, err)
+	assert.Len(t, got, 3)
+}
+
 func TestNewRuntime_NoAgentsError(t *testing.T) {
 	tm := team.New()
 
@@ -842,6 +1113,26 @@ func TestNewRuntime_InvalidCurrentAgentError(t *testing.T) {
 	require.Contains(t, err.Error(), "agent not found: other (available agents: root)")
 }
 
+func TestNewRuntime_EventBufferSize(t *testing.T) {
+	prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+	assert.Equal(t, defaultEventBufferSize, rt.eventBufferSize)
+
+	rt, err = NewLocalRuntime(tm, WithModelStore(mockModelStore{}), WithEventBufferSize(8))
+	require.NoError(t, err)
+	events := rt.RunStream(t.Context(), session.New())
+	assert.Equal(t, 8, cap(events))
+	for range events {
+	}
+
+	_, err = NewLocalRuntime(tm, WithModelStore(mockModelStore{}), WithEventBufferSize(0))
+	require.ErrorContains(t, err, "event buffer size must be positive")
+}
+
 func TestSummarize_EmptySession(t *testing.T) {
 	prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
 	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
@@ -889,11 +1180,21 @@ func TestProcessToolCalls_UnknownTool_ReturnsErrorResponse(t *testing.T) {
 		Function: tools.FunctionCall{Name: "non_existent_tool", Arguments: "{}"},
 	}}
 
+	agentTools := []tools.Tool{{Name: "write_file"}, {Name: "read_file"}}
+
 	events := make(chan Event, 10)
-	rt.processToolCalls(t.Context(), sess, calls, nil, events)
+	require.NoError(t, rt.processToolCalls(t.Context(), sess, calls, agentTools, events))
 	close(events)
-	for range events {
+
+	var unknownEvent *UnknownToolCallEvent
+	for ev := range events {
+		if e, ok := ev.(*UnknownToolCallEvent); ok {
+			unknownEvent = e
+		}
 	}
+	require.NotNil(t, unknownEvent, "expected an UnknownToolCallEvent")
+	assert.Equal(t, "non_existent_tool", unknownEvent.ToolCall.Function.Name)
+	assert.Equal(t, []string{"read_file", "write_file"}, unknownEvent.AvailableTools)
 
 	// The model must receive an error tool response so it can self-correct.
 	var toolContent string
@@ -903,7 +1204,127 @@ func TestProcessToolCalls_UnknownTool_ReturnsErrorResponse(t *testing.T) {
 		}
 	}
 	require.NotEmpty(t, toolContent, "expected an error tool response for unknown tools")
-	assert.Contains(t, toolContent, "not available")
+	assert.Equal(t, "unknown tool: non_existent_tool, available tools: read_file, write_file", toolContent)
+}
+
+func TestProcessToolCalls_UnknownTool_StrictMode(t *testing.T) {
+	root := agent.New("root", "You are a test agent", agent.WithModel(&mockProvider{}))
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}), WithStrictToolCalls(true))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Start"), session.WithToolsApproved(true))
+
+	var executed int
+	agentTools := []tools.Tool{{
+		Name:       "echo",
+		Parameters: map[string]any{},
+		Handler: func(ctx context.Context, tc tools.ToolCall) (*tools.ToolCallResult, error) {
+			executed++
+			return tools.ResultSuccess("ok"), nil
+		},
+	}}
+	calls := []tools.ToolCall{
+		{ID: "call_0", Type: "function", Function: tools.FunctionCall{Name: "echo", Arguments: "{}"}},
+		{ID: "call_1", Type: "function", Function: tools.FunctionCall{Name: "non_existent_tool", Arguments: "{}"}},
+	}
+
+	events := make(chan Event, 10)
+	err = rt.processToolCalls(t.Context(), sess, calls, agentTools, events)
+	close(events)
+	require.ErrorContains(t, err, "non_existent_tool")
+
+	var unknownEvents int
+	for ev := range events {
+		if _, ok := ev.(*UnknownToolCallEvent); ok {
+			unknownEvents++
+		}
+	}
+	assert.Equal(t, 1, unknownEvents)
+	assert.Zero(t, executed, "no call is executed once an unknown tool is called")
+
+	// Every call is still answered, so that the session stays valid.
+	answered := map[string]bool{}
+	for _, it := range sess.Messages {
+		if it.IsMessage() && it.Message.Message.Role == chat.MessageRoleTool {
+			answered[it.Message.Message.ToolCallID] = true
+		}
+	}
+	assert.Equal(t, map[string]bool{"call_0": true, "call_1": true}, answered)
+}
+
+func TestProcessToolCalls_MaxToolCallsPerTurn(t *testing.T) {
+	root := agent.New("root", "You are a test agent", agent.WithModel(&mockProvider{}), agent.WithMaxToolCallsPerTurn(2))
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Start"), session.WithToolsApproved(true))
+
+	var executed int
+	agentTools := []tools.Tool{{
+		Name:       "echo",
+		Parameters: map[string]any{},
+		Handler: func(ctx context.Context, tc tools.ToolCall) (*tools.ToolCallResult, error) {
+			executed++
+			return tools.ResultSuccess("ok"), nil
+		},
+	}}
+
+	var calls []tools.ToolCall
+	for i := range 3 {
+		calls = append(calls, tools.ToolCall{
+			ID:       fmt.Sprintf("call_%d", i),
+			Type:     "function",
+			Function: tools.FunctionCall{Name: "echo", Arguments: "{}"},
+		})
+	}
+
+	events := make(chan Event, 20)
+	rt.processToolCalls(t.Context(), sess, calls, agentTools, events)
+	close(events)
+
+	var limitEvent *ToolCallLimitReachedEvent
+	for ev := range events {
+		if e, ok := ev.(*ToolCallLimitReachedEvent); ok {
+			limitEvent = e
+		}
+	}
+	require.NotNil(t, limitEvent, "expected a ToolCallLimitReachedEvent")
+	assert.Equal(t, 2, limitEvent.Limit)
+	assert.Equal(t, 3, limitEvent.Requested)
+	assert.Equal(t, 2, executed)
+
+	var rejected string
+	for _, it := range sess.Messages {
+		if it.IsMessage() && it.Message.Message.ToolCallID == "call_2" {
+			rejected = it.Message.Message.Content
+		}
+	}
+	assert.Contains(t, rejected, "at most 2 tool calls")
+}
+
+func TestEventCategory(t *testing.T) {
+	tests := []struct {
+		event    Event
+		category EventCategory
+	}{
+		{AgentChoice("root", "hello"), CategoryContent},
+		{AgentChoiceReasoning("root", "hmm"), CategoryContent},
+		{ToolCall(tools.ToolCall{}, tools.Tool{}, "root"), CategoryTool},
+		{ToolCallLimitReached(1, 2, "root"), CategoryTool},
+		{UnknownToolCall(tools.ToolCall{}, nil, "root"), CategoryTool},
+		{SubAgentResult("librarian", "Dune"), CategoryContent},
+		{Error("boom"), CategorySystem},
+		{Warning("careful", "root"), CategorySystem},
+		{StreamStarted("s1", "root"), CategorySystem},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.category, tt.event.Category(), "%T", tt.event)
+	}
 }
 
 func TestEmitStartupInfo(t *testing.T) {
@@ -1498,39 +1919,336 @@ func TestToolRejectionWithoutReason(t *testing.T) {
 	require.NotContains(t, toolResponse.Response, "Reason:")
 }
 
-func TestTransferTaskRejectsNonSubAgent(t *testing.T) {
-	// root has librarian as sub-agent but NOT planner.
-	// planner exists in the team. transfer_task to planner should be rejected.
-	prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
-
-	librarian := agent.New("librarian", "Library agent", agent.WithModel(prov))
-	root := agent.New("root", "Root agent", agent.WithModel(prov))
-	planner := agent.New("planner", "Planner agent", agent.WithModel(prov))
-
-	agent.WithSubAgents(librarian)(root)
+func TestToolApprovalRequestedEvent(t *testing.T) {
+	destructive := true
+	agentTools := []tools.Tool{{
+		Name:        "shell",
+		Parameters:  map[string]any{},
+		Annotations: tools.ToolAnnotations{DestructiveHint: &destructive},
+		Handler: func(_ context.Context, _ tools.ToolCall) (*tools.ToolCallResult, error) {
+			return tools.ResultSuccess("ok"), nil
+		},
+	}}
 
-	tm := team.New(team.WithAgents(root, planner, librarian))
+	prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
+	root := agent.New("root", "You are a test agent",
+		agent.WithModel(prov),
+		agent.WithToolSets(newStubToolSet(nil, agentTools, nil)),
+	)
+	tm := team.New(team.WithAgents(root))
 
 	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
 	require.NoError(t, err)
 
 	sess := session.New(session.WithUserMessage("Test"))
-	evts := make(chan Event, 128)
+	calls := []tools.ToolCall{{
+		ID:       "call_1",
+		Type:     "function",
+		Function: tools.FunctionCall{Name: "shell", Arguments: `{"cmd":"rm -rf build"}`},
+	}}
 
-	toolCall := tools.ToolCall{
-		ID:   "call_1",
-		Type: "function",
-		Function: tools.FunctionCall{
-			Name:      "transfer_task",
-			Arguments: `{"agent":"planner","task":"do something","expected_output":""}`,
-		},
+	events := make(chan Event, 10)
+	go func() {
+		rt.processToolCalls(t.Context(), sess, calls, agentTools, events)
+		close(events)
+	}()
+
+	var requested *ToolApprovalRequestedEvent
+	for ev := range events {
+		if e, ok := ev.(*ToolApprovalRequestedEvent); ok {
+			requested = e
+			rt.resumeChan <- ResumeApprove()
+		}
 	}
 
-	result, err := rt.handleTaskTransfer(t.Context(), sess, toolCall, evts)
-	require.NoError(t, err)
-	require.NotNil(t, result)
-	assert.True(t, result.IsError, "transfer to non-sub-agent should return an error result")
-	assert.Contains(t, result.Output, "cannot transfer task to planner")
+	require.NotNil(t, requested)
+	assert.Equal(t, "call_1", requested.CallID)
+	assert.Equal(t, "shell", requested.ToolName)
+	assert.JSONEq(t, `{"cmd":"rm -rf build"}`, requested.Arguments)
+	assert.True(t, requested.Destructive)
+	assert.Equal(t, "root", requested.AgentName)
+}
+
+func TestAutoApproveReadOnly(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			var ran bool
+			agentTools := []tools.Tool{{
+				Name:        "read_file",
+				Parameters:  map[string]any{},
+				Annotations: tools.ToolAnnotations{ReadOnlyHint: true},
+				Handler: func(_ context.Context, _ tools.ToolCall) (*tools.ToolCallResult, error) {
+					ran = true
+					return tools.ResultSuccess("ok"), nil
+				},
+			}}
+
+			prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
+			root := agent.New("root", "You are a test agent",
+				agent.WithModel(prov),
+				agent.WithToolSets(newStubToolSet(nil, agentTools, nil)),
+			)
+			tm := team.New(team.WithAgents(root))
+
+			rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}), WithAutoApproveReadOnly(enabled))
+			require.NoError(t, err)
+
+			sess := session.New(session.WithUserMessage("Test"))
+			calls := []tools.ToolCall{{
+				ID:       "call_1",
+				Type:     "function",
+				Function: tools.FunctionCall{Name: "read_file", Arguments: "{}"},
+			}}
+
+			events := make(chan Event, 10)
+			go func() {
+				rt.processToolCalls(t.Context(), sess, calls, agentTools, events)
+				close(events)
+			}()
+
+			var asked bool
+			for ev := range events {
+				if _, ok := ev.(*ToolCallConfirmationEvent); ok {
+					asked = true
+					rt.resumeChan <- ResumeReject("")
+				}
+			}
+
+			assert.Equal(t, !enabled, asked)
+			assert.Equal(t, enabled, ran)
+		})
+	}
+}
+
+func TestToolRawOutputIsKeptOnToolMessage(t *testing.T) {
+	agentTools := []tools.Tool{{
+		Name:        "read_file",
+		Parameters:  map[string]any{},
+		Annotations: tools.ToolAnnotations{ReadOnlyHint: true},
+		Handler: func(_ context.Context, _ tools.ToolCall) (*tools.ToolCallResult, error) {
+			return &tools.ToolCallResult{Output: "line 1\n[truncated]", RawOutput: "line 1\nline 2\nline 3"}, nil
+		},
+	}}
+
+	prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
+	root := agent.New("root", "You are a test agent",
+		agent.WithModel(prov),
+		agent.WithToolSets(newStubToolSet(nil, agentTools, nil)),
+	)
+	rt, err := NewLocalRuntime(team.New(team.WithAgents(root)), WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Test"))
+	calls := []tools.ToolCall{{ID: "call_1", Type: "function", Function: tools.FunctionCall{Name: "read_file", Arguments: "{}"}}}
+
+	events := make(chan Event, 10)
+	rt.processToolCalls(t.Context(), sess, calls, agentTools, events)
+	close(events)
+
+	last := sess.Messages[len(sess.Messages)-1].Message
+	require.NotNil(t, last)
+	assert.Equal(t, chat.MessageRoleTool, last.Message.Role)
+	assert.Equal(t, "line 1\n[truncated]", last.Message.Content)
+	assert.Equal(t, "line 1\nline 2\nline 3", last.RawOutput)
+}
+
+func TestSanitizeToolOutput(t *testing.T) {
+	agentTools := []tools.Tool{{
+		Name:        "shell",
+		Parameters:  map[string]any{},
+		Annotations: tools.ToolAnnotations{ReadOnlyHint: true},
+		Handler: func(_ context.Context, _ tools.ToolCall) (*tools.ToolCallResult, error) {
+			return &tools.ToolCallResult{Output: "\x1b[32mok\x1b[0m\r\ndone\x07"}, nil
+		},
+	}}
+
+	for _, tt := range []struct {
+		name     string
+		opts     []agent.Opt
+		expected string
+	}{
+		{name: "default", expected: "ok\ndone"},
+		{name: "disabled", opts: []agent.Opt{agent.WithSanitizeToolOutput(false)}, expected: "\x1b[32mok\x1b[0m\r\ndone\x07"},
+		{name: "formatted", opts: []agent.Opt{agent.WithToolResultFormatter(func(toolName string, result *tools.ToolCallResult) string {
+			return "<" + toolName + ">" + result.Output + "</" + toolName + ">"
+		})}, expected: "<shell>ok\ndone</shell>"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
+			root := agent.New("root", "You are a test agent", append([]agent.Opt{
+				agent.WithModel(prov),
+				agent.WithToolSets(newStubToolSet(nil, agentTools, nil)),
+			}, tt.opts...)...)
+			rt, err := NewLocalRuntime(team.New(team.WithAgents(root)), WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+			require.NoError(t, err)
+
+			sess := session.New(session.WithUserMessage("Test"))
+			calls := []tools.ToolCall{{ID: "call_1", Type: "function", Function: tools.FunctionCall{Name: "shell", Arguments: "{}"}}}
+
+			events := make(chan Event, 10)
+			rt.processToolCalls(t.Context(), sess, calls, agentTools, events)
+			close(events)
+
+			last := sess.Messages[len(sess.Messages)-1].Message
+			require.NotNil(t, last)
+			assert.Equal(t, tt.expected, last.Message.Content)
+		})
+	}
+}
+
+func TestAutoContinueOnLength(t *testing.T) {
+	truncated := func(content string) chat.MessageStream {
+		return &mockStream{responses: []chat.MessageStreamResponse{
+			{Choices: []chat.MessageStreamChoice{{Delta: chat.MessageDelta{Content: content}}}},
+			{Choices: []chat.MessageStreamChoice{{FinishReason: chat.FinishReasonLength}}},
+		}}
+	}
+
+	for _, tt := range []struct {
+		name             string
+		maxContinuations int
+		expected         []string
+	}{
+		{name: "disabled", expected: []string{"Once upon"}},
+		{name: "until done", maxContinuations: 3, expected: []string{"Once upon", " a time", " the end."}},
+		{name: "limited", maxContinuations: 1, expected: []string{"Once upon", " a time"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &queueProvider{id: "test/mock-model", streams: []chat.MessageStream{
+				truncated("Once upon"),
+				truncated(" a time"),
+				newStreamBuilder().AddContent(" the end.").AddStopWithUsage(1, 1).Build(),
+			}}
+			root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+			rt, err := NewLocalRuntime(team.New(team.WithAgents(root)),
+				WithSessionCompaction(false),
+				WithModelStore(mockModelStore{}),
+				WithAutoContinueOnLength(tt.maxContinuations),
+			)
+			require.NoError(t, err)
+
+			sess := session.New(session.WithUserMessage("Tell me a story"))
+			var continuations int
+			for event := range rt.RunStream(t.Context(), sess) {
+				if _, ok := event.(*ContinuationStartedEvent); ok {
+					continuations++
+				}
+			}
+			assert.Equal(t, len(tt.expected)-1, continuations)
+
+			var contents []string
+			for _, msg := range sess.GetAllMessages() {
+				switch {
+				case msg.Message.Role == chat.MessageRoleAssistant:
+					contents = append(contents, msg.Message.Content)
+				case msg.Implicit:
+					assert.Equal(t, continuationPrompt, msg.Message.Content)
+				}
+			}
+			assert.Equal(t, tt.expected, contents)
+		})
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	stream := newStreamBuilder().
+		AddContent("Hello").
+		AddStopWithUsage(3, 2).
+		Build()
+
+	prov := &mockProvider{id: "test/mock-model", stream: stream}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	rt, err := NewLocalRuntime(team.New(team.WithAgents(root)),
+		WithSessionCompaction(false),
+		WithModelStore(mockModelStore{}),
+		WithEventFilter(func(event Event) bool {
+			_, isUsage := event.(*TokenUsageEvent)
+			return !isUsage
+		}),
+	)
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Hi"))
+	var events []Event
+	for event := range rt.RunStream(t.Context(), sess) {
+		events = append(events, event)
+	}
+
+	var choices, usages int
+	for _, event := range events {
+		switch event.(type) {
+		case *AgentChoiceEvent:
+			choices++
+		case *TokenUsageEvent:
+			usages++
+		}
+	}
+	assert.Equal(t, 1, choices)
+	assert.Zero(t, usages)
+	assert.Equal(t, "Hello", sess.GetLastAssistantMessageContent())
+}
+
+func TestImmutableInputSession(t *testing.T) {
+	stream := newStreamBuilder().
+		AddContent("Hello").
+		AddStopWithUsage(3, 2).
+		Build()
+
+	prov := &mockProvider{id: "test/mock-model", stream: stream}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	rt, err := NewLocalRuntime(team.New(team.WithAgents(root)),
+		WithSessionCompaction(false),
+		WithModelStore(mockModelStore{}),
+		WithImmutableInputSession(true),
+	)
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Hi"), session.WithTitle("Unit Test"))
+
+	messages, err := rt.Run(t.Context(), sess)
+	require.NoError(t, err)
+
+	require.Len(t, messages, 2)
+	assert.Equal(t, "Hello", messages[1].Message.Content)
+
+	assert.Len(t, sess.Messages, 1)
+	assert.Zero(t, sess.InputTokens)
+	assert.Zero(t, sess.OutputTokens)
+}
+
+func TestTransferTaskRejectsNonSubAgent(t *testing.T) {
+	// root has librarian as sub-agent but NOT planner.
+	// planner exists in the team. transfer_task to planner should be rejected.
+	prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
+
+	librarian := agent.New("librarian", "Library agent", agent.WithModel(prov))
+	root := agent.New("root", "Root agent", agent.WithModel(prov))
+	planner := agent.New("planner", "Planner agent", agent.WithModel(prov))
+
+	agent.WithSubAgents(librarian)(root)
+
+	tm := team.New(team.WithAgents(root, planner, librarian))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Test"))
+	evts := make(chan Event, 128)
+
+	toolCall := tools.ToolCall{
+		ID:   "call_1",
+		Type: "function",
+		Function: tools.FunctionCall{
+			Name:      "transfer_task",
+			Arguments: `{"agent":"planner","task":"do something","expected_output":""}`,
+		},
+	}
+
+	result, err := rt.handleTaskTransfer(t.Context(), sess, toolCall, evts)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.True(t, result.IsError, "transfer to non-sub-agent should return an error result")
+	assert.Contains(t, result.Output, "cannot transfer task to planner")
 	assert.Contains(t, result.Output, "librarian")
 	assert.Equal(t, "root", rt.currentAgent, "current agent should remain root")
 }
@@ -1570,6 +2288,444 @@ func TestTransferTaskAllowsSubAgent(t *testing.T) {
 	assert.False(t, result.IsError, "transfer to valid sub-agent should succeed")
 }
 
+func TestTransferTaskWorkingDir(t *testing.T) {
+	tests := []struct {
+		name       string
+		workingDir string
+		expected   string
+	}{
+		{name: "defaults to parent", workingDir: "", expected: "/project"},
+		{name: "relative to parent", workingDir: "docs", expected: "/project/docs"},
+		{name: "absolute", workingDir: "/elsewhere", expected: "/elsewhere"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &mockProvider{id: "test/mock-model", stream: newStreamBuilder().AddContent("done").AddStopWithUsage(10, 5).Build()}
+			librarian := agent.New("librarian", "Library agent", agent.WithModel(prov))
+			root := agent.New("root", "Root agent", agent.WithModel(prov))
+			agent.WithSubAgents(librarian)(root)
+
+			rt, err := NewLocalRuntime(team.New(team.WithAgents(root, librarian)), WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+			require.NoError(t, err)
+
+			sess := session.New(session.WithUserMessage("Test"), session.WithToolsApproved(true), session.WithWorkingDir("/project"))
+			evts := make(chan Event, 128)
+
+			args, err := json.Marshal(map[string]string{"agent": "librarian", "task": "find a book", "expected_output": "", "working_dir": tt.workingDir})
+			require.NoError(t, err)
+			toolCall := tools.ToolCall{ID: "call_1", Type: "function", Function: tools.FunctionCall{Name: "transfer_task", Arguments: string(args)}}
+
+			_, err = rt.handleTaskTransfer(t.Context(), sess, toolCall, evts)
+			require.NoError(t, err)
+			close(evts)
+
+			var child *session.Session
+			for ev := range evts {
+				if completed, ok := ev.(*SubSessionCompletedEvent); ok {
+					child = completed.SubSession.(*session.Session)
+				}
+			}
+			require.NotNil(t, child)
+			assert.Equal(t, filepath.FromSlash(tt.expected), child.WorkingDir)
+		})
+	}
+}
+
+func TestTransferTaskTagsForwardedEvents(t *testing.T) {
+	prov := &mockProvider{id: "test/mock-model", stream: newStreamBuilder().AddContent("done").AddStopWithUsage(10, 5).Build()}
+
+	librarian := agent.New("librarian", "Library agent", agent.WithModel(prov))
+	root := agent.New("root", "Root agent", agent.WithModel(prov))
+	agent.WithSubAgents(librarian)(root)
+
+	tm := team.New(team.WithAgents(root, librarian))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Test"), session.WithToolsApproved(true))
+	evts := make(chan Event, 128)
+
+	toolCall := tools.ToolCall{
+		ID:   "call_1",
+		Type: "function",
+		Function: tools.FunctionCall{
+			Name:      "transfer_task",
+			Arguments: `{"agent":"librarian","task":"find a book","expected_output":"book title"}`,
+		},
+	}
+
+	_, err = rt.handleTaskTransfer(t.Context(), sess, toolCall, evts)
+	require.NoError(t, err)
+	close(evts)
+
+	var received []Event
+	var subSessionID string
+	for ev := range evts {
+		received = append(received, ev)
+		if completed, ok := ev.(*SubSessionCompletedEvent); ok {
+			// Emitted by the parent itself, so it is not tagged.
+			assert.Empty(t, completed.GetSubSessionID())
+			subSessionID = completed.SubSession.(*session.Session).ID
+		}
+	}
+	require.NotEmpty(t, subSessionID)
+
+	var forwarded int
+	for _, ev := range received {
+		if choice, ok := ev.(*AgentChoiceEvent); ok {
+			forwarded++
+			assert.Equal(t, subSessionID, choice.GetSubSessionID())
+			assert.Equal(t, 1, choice.GetDepth())
+		}
+	}
+	assert.Positive(t, forwarded)
+}
+
+func TestTransferTaskFinalOnlyEvents(t *testing.T) {
+	prov := &mockProvider{id: "test/mock-model", stream: newStreamBuilder().AddContent("Dune").AddStopWithUsage(10, 5).Build()}
+
+	librarian := agent.New("librarian", "Library agent", agent.WithModel(prov))
+	root := agent.New("root", "Root agent", agent.WithModel(prov))
+	agent.WithSubAgents(librarian)(root)
+
+	rt, err := NewLocalRuntime(team.New(team.WithAgents(root, librarian)),
+		WithSessionCompaction(false),
+		WithModelStore(mockModelStore{}),
+		WithSubSessionEventMode(SubSessionEventModeFinalOnly),
+	)
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Test"), session.WithToolsApproved(true))
+	evts := make(chan Event, 128)
+
+	toolCall := tools.ToolCall{
+		ID:   "call_1",
+		Type: "function",
+		Function: tools.FunctionCall{
+			Name:      "transfer_task",
+			Arguments: `{"agent":"librarian","task":"find a book","expected_output":"book title"}`,
+		},
+	}
+
+	result, err := rt.handleTaskTransfer(t.Context(), sess, toolCall, evts)
+	require.NoError(t, err)
+	assert.Equal(t, "Dune", result.Output)
+	close(evts)
+
+	var results []*SubAgentResultEvent
+	for ev := range evts {
+		// Nothing of the sub-session is forwarded.
+		if ctx, ok := ev.(interface{ GetSubSessionID() string }); ok {
+			assert.Empty(t, ctx.GetSubSessionID(), "unexpected forwarded %T", ev)
+		}
+		if r, ok := ev.(*SubAgentResultEvent); ok {
+			results = append(results, r)
+		}
+	}
+	require.Len(t, results, 1)
+	assert.Equal(t, "librarian", results[0].AgentName)
+	assert.Equal(t, "Dune", results[0].Output)
+}
+
+type mockModelStoreWithPricing struct {
+	ModelStore
+}
+
+func (m mockModelStoreWithPricing) GetModel(_ context.Context, _ string) (*modelsdev.Model, error) {
+	return &modelsdev.Model{Cost: &modelsdev.Cost{Input: 3, Output: 15}}, nil
+}
+
+func TestCostCalculation(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		enabled  bool
+		expected float64
+	}{
+		{name: "enabled", enabled: true, expected: (1000*3 + 500*15) / 1e6},
+		{name: "disabled", enabled: false, expected: 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &mockProvider{id: "test/mock-model", stream: newStreamBuilder().AddContent("Hello").AddStopWithUsage(1000, 500).Build()}
+			root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+			tm := team.New(team.WithAgents(root))
+
+			rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStoreWithPricing{}), WithCostCalculation(tt.enabled))
+			require.NoError(t, err)
+
+			sess := session.New(session.WithUserMessage("Hi"))
+			for range rt.RunStream(t.Context(), sess) {
+			}
+
+			msgs := sess.GetAllMessages()
+			last := msgs[len(msgs)-1]
+			assert.InDelta(t, tt.expected, last.Message.Cost, 1e-9)
+			assert.InDelta(t, tt.expected, sess.Cost, 1e-9)
+		})
+	}
+}
+
+func TestCacheSavings(t *testing.T) {
+	m := &modelsdev.Model{Cost: &modelsdev.Cost{Input: 3, Output: 15, CacheRead: 0.3, CacheWrite: 3.75}}
+	usage := &chat.Usage{InputTokens: 100, OutputTokens: 50, CachedInputTokens: 10000, CacheWriteTokens: 2000}
+
+	assert.InDelta(t, 10000*(3-0.3)/1e6, cacheSavings(m, usage), 1e-9)
+	assert.Zero(t, cacheSavings(m, &chat.Usage{InputTokens: 100}))
+	assert.Zero(t, cacheSavings(&modelsdev.Model{}, usage))
+	assert.Zero(t, cacheSavings(m, nil))
+}
+
+func TestUsageReporter(t *testing.T) {
+	prov := &mockProvider{id: "test/mock-model", stream: newStreamBuilder().AddContent("Hello").AddStopWithUsage(1000, 500).Build()}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root))
+
+	type report struct {
+		agentName string
+		usage     chat.Usage
+		cost      float64
+	}
+	var reports []report
+	rt, err := NewLocalRuntime(tm,
+		WithSessionCompaction(false),
+		WithModelStore(mockModelStoreWithPricing{}),
+		WithUsageReporter(func(_ context.Context, agentName string, usage chat.Usage, cost float64) {
+			reports = append(reports, report{agentName, usage, cost})
+		}),
+	)
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Hi"))
+	for range rt.RunStream(t.Context(), sess) {
+	}
+
+	require.Len(t, reports, 1)
+	assert.Equal(t, "root", reports[0].agentName)
+	assert.Equal(t, int64(1000), reports[0].usage.InputTokens)
+	assert.Equal(t, int64(500), reports[0].usage.OutputTokens)
+	assert.InDelta(t, (1000*3+500*15)/1e6, reports[0].cost, 1e-9)
+}
+
+func TestRetainReasoningOnlyMessages(t *testing.T) {
+	for _, retain := range []bool{false, true} {
+		t.Run(fmt.Sprintf("retain=%t", retain), func(t *testing.T) {
+			stream := newStreamBuilder().AddReasoning("Let me think.").AddContent("  \n").AddStopWithUsage(10, 5).Build()
+			prov := &mockProvider{id: "test/mock-model", stream: stream}
+			root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+			tm := team.New(team.WithAgents(root))
+
+			rt, err := NewLocalRuntime(tm,
+				WithSessionCompaction(false),
+				WithModelStore(mockModelStore{}),
+				WithRetainReasoningOnlyMessages(retain),
+			)
+			require.NoError(t, err)
+
+			sess := session.New(session.WithUserMessage("Hi"))
+			for range rt.RunStream(t.Context(), sess) {
+			}
+
+			var assistant []*session.Message
+			for _, item := range sess.Messages {
+				if item.IsMessage() && item.Message.Message.Role == chat.MessageRoleAssistant {
+					assistant = append(assistant, item.Message)
+				}
+			}
+
+			if !retain {
+				assert.Empty(t, assistant)
+				return
+			}
+			require.Len(t, assistant, 1)
+			assert.True(t, assistant[0].IsReasoningOnly())
+			assert.Equal(t, "Let me think.", assistant[0].Message.ReasoningContent)
+
+			for _, msg := range sess.GetMessages(root) {
+				assert.NotEqual(t, chat.MessageRoleAssistant, msg.Role)
+			}
+		})
+	}
+}
+
+func TestPreviewMessages(t *testing.T) {
+	prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	other := agent.New("other", "You are another agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root, other))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Hello"))
+	messages, err := rt.PreviewMessages(t.Context(), sess)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, messages)
+	assert.Equal(t, chat.MessageRoleSystem, messages[0].Role)
+	assert.Contains(t, messages[0].Content, "You are a test agent")
+	assert.Equal(t, "Hello", messages[len(messages)-1].Content)
+	assert.Len(t, sess.GetAllMessages(), 1, "previewing must not change the session")
+
+	sess.AgentName = "other"
+	messages, err = rt.PreviewMessages(t.Context(), sess)
+	require.NoError(t, err)
+	assert.Contains(t, messages[0].Content, "You are another agent")
+
+	sess.AgentName = "missing"
+	_, err = rt.PreviewMessages(t.Context(), sess)
+	require.Error(t, err)
+}
+
+func TestWillCompact(t *testing.T) {
+	prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithModelStore(mockModelStoreWithLimit{limit: 1000}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Hello"))
+	sess.InputTokens = 800
+	sess.OutputTokens = 100
+
+	willCompact, err := rt.WillCompact(t.Context(), sess)
+	require.NoError(t, err)
+	assert.False(t, willCompact)
+
+	sess.OutputTokens = 101
+	willCompact, err = rt.WillCompact(t.Context(), sess)
+	require.NoError(t, err)
+	assert.True(t, willCompact)
+
+	rt, err = NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStoreWithLimit{limit: 1000}))
+	require.NoError(t, err)
+	willCompact, err = rt.WillCompact(t.Context(), sess)
+	require.NoError(t, err)
+	assert.False(t, willCompact)
+}
+
+func TestTransferTaskUsesKickoffMessage(t *testing.T) {
+	prov := &mockProvider{id: "test/mock-model", stream: newStreamBuilder().AddContent("fertig").AddStopWithUsage(10, 5).Build()}
+
+	librarian := agent.New("librarian", "Library agent", agent.WithModel(prov), agent.WithTransferKickoffMessage("Bitte fahre fort."))
+	root := agent.New("root", "Root agent", agent.WithModel(prov))
+	agent.WithSubAgents(librarian)(root)
+
+	tm := team.New(team.WithAgents(root, librarian))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Test"), session.WithToolsApproved(true))
+	evts := make(chan Event, 128)
+
+	toolCall := tools.ToolCall{
+		ID:   "call_1",
+		Type: "function",
+		Function: tools.FunctionCall{
+			Name:      "transfer_task",
+			Arguments: `{"agent":"librarian","task":"find a book"}`,
+		},
+	}
+
+	_, err = rt.handleTaskTransfer(t.Context(), sess, toolCall, evts)
+	require.NoError(t, err)
+	close(evts)
+
+	var sub *session.Session
+	for ev := range evts {
+		if completed, ok := ev.(*SubSessionCompletedEvent); ok {
+			sub = completed.SubSession.(*session.Session)
+		}
+	}
+	require.NotNil(t, sub)
+
+	var kickoff string
+	for _, item := range sub.Messages {
+		if item.IsMessage() && item.Message.Message.Role == chat.MessageRoleUser {
+			kickoff = item.Message.Message.Content
+			break
+		}
+	}
+	assert.Equal(t, "Bitte fahre fort.", kickoff)
+	assert.Equal(t, "Please proceed.", root.TransferKickoffMessage())
+}
+
+func TestTransferTaskAllowedTargets(t *testing.T) {
+	prov := &mockProvider{id: "test/mock-model", stream: newStreamBuilder().AddContent("done").AddStopWithUsage(10, 5).Build()}
+
+	librarian := agent.New("librarian", "Library agent", agent.WithModel(prov))
+	helper := agent.New("helper", "Internal helper", agent.WithModel(prov))
+	root := agent.New("root", "Root agent", agent.WithModel(prov), agent.WithAllowedTransferTargets("librarian"))
+	agent.WithSubAgents(librarian, helper)(root)
+
+	tm := team.New(team.WithAgents(root, librarian, helper))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	transfer := func(target string) *tools.ToolCallResult {
+		sess := session.New(session.WithUserMessage("Test"), session.WithToolsApproved(true))
+		evts := make(chan Event, 128)
+		result, err := rt.handleTaskTransfer(t.Context(), sess, tools.ToolCall{
+			ID:   "call_1",
+			Type: "function",
+			Function: tools.FunctionCall{
+				Name:      "transfer_task",
+				Arguments: `{"agent":"` + target + `","task":"do something"}`,
+			},
+		}, evts)
+		require.NoError(t, err)
+		return result
+	}
+
+	denied := transfer("helper")
+	assert.True(t, denied.IsError)
+	assert.Contains(t, denied.Output, "not allowed")
+
+	allowed := transfer("librarian")
+	assert.False(t, allowed.IsError)
+	assert.Equal(t, "root", rt.CurrentAgentName())
+}
+
+func TestToolResultRecordsErrorAndCategory(t *testing.T) {
+	agentTools := []tools.Tool{{
+		Name:       "failing_tool",
+		Category:   "filesystem",
+		Parameters: map[string]any{},
+		Handler: func(_ context.Context, _ tools.ToolCall) (*tools.ToolCallResult, error) {
+			return tools.ResultError("no such file"), nil
+		},
+	}}
+
+	prov := &mockProvider{id: "test/mock-model", stream: &mockStream{}}
+	root := agent.New("root", "You are a test agent",
+		agent.WithModel(prov),
+		agent.WithToolSets(newStubToolSet(nil, agentTools, nil)),
+	)
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Test"), session.WithToolsApproved(true))
+	calls := []tools.ToolCall{{
+		ID:       "call_1",
+		Type:     "function",
+		Function: tools.FunctionCall{Name: "failing_tool", Arguments: "{}"},
+	}}
+
+	events := make(chan Event, 10)
+	rt.processToolCalls(t.Context(), sess, calls, agentTools, events)
+	close(events)
+
+	last := sess.Messages[len(sess.Messages)-1].Message.Message
+	assert.Equal(t, chat.MessageRoleTool, last.Role)
+	assert.True(t, last.IsError)
+	assert.Equal(t, "filesystem", last.ToolCategory)
+}
+
 func TestYoloMode_OverridesPermissionsDeny(t *testing.T) {
 	// Test that --yolo flag takes precedence over deny permissions
 	permChecker := permissions.NewChecker(&latest.PermissionsConfig{
@@ -1823,3 +2979,179 @@ func TestStripImageContent(t *testing.T) {
 		})
 	}
 }
+
+func TestRunStreamWithFakeProvider(t *testing.T) {
+	var executed bool
+	agentTools := []tools.Tool{{
+		Name:       "echo",
+		Parameters: map[string]any{},
+		Handler: func(context.Context, tools.ToolCall) (*tools.ToolCallResult, error) {
+			executed = true
+			return tools.ResultSuccess("echoed"), nil
+		},
+	}}
+
+	fake := provider.NewFake([]provider.FakeResponse{
+		{ToolCalls: []tools.ToolCall{{ID: "call_1", Type: "function", Function: tools.FunctionCall{Name: "echo", Arguments: "{}"}}}},
+		{Content: "All done"},
+	})
+	root := agent.New("root", "You are a test agent",
+		agent.WithModel(fake),
+		agent.WithToolSets(newStubToolSet(nil, agentTools, nil)),
+	)
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Hi"), session.WithToolsApproved(true))
+	for range rt.RunStream(t.Context(), sess) {
+	}
+
+	assert.True(t, executed)
+	assert.Equal(t, "All done", sess.GetLastAssistantMessageContent())
+}
+
+func TestCostBudget(t *testing.T) {
+	toolCall := tools.ToolCall{ID: "call_1", Type: "function", Function: tools.FunctionCall{Name: "echo", Arguments: "{}"}}
+	agentTools := []tools.Tool{{
+		Name:       "echo",
+		Parameters: map[string]any{},
+		Handler: func(context.Context, tools.ToolCall) (*tools.ToolCallResult, error) {
+			return tools.ResultSuccess("echoed"), nil
+		},
+	}}
+
+	// Each response costs (1000*3 + 0*15) / 1e6 = $0.003.
+	usage := &chat.Usage{InputTokens: 1000}
+	fake := provider.NewFake([]provider.FakeResponse{
+		{ToolCalls: []tools.ToolCall{toolCall}, Usage: usage},
+		{ToolCalls: []tools.ToolCall{toolCall}, Usage: usage},
+		{Content: "Never reached", Usage: usage},
+	})
+	root := agent.New("root", "You are a test agent",
+		agent.WithModel(fake),
+		agent.WithToolSets(newStubToolSet(nil, agentTools, nil)),
+	)
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStoreWithPricing{}), WithCostBudget(0.005))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Hi"), session.WithToolsApproved(true))
+	var exceeded *CostBudgetExceededEvent
+	for event := range rt.RunStream(t.Context(), sess) {
+		if e, ok := event.(*CostBudgetExceededEvent); ok {
+			exceeded = e
+		}
+	}
+
+	require.NotNil(t, exceeded)
+	assert.InDelta(t, 0.006, exceeded.Cost, 1e-9)
+	assert.InDelta(t, 0.005, exceeded.Budget, 1e-9)
+	assert.Contains(t, sess.GetLastAssistantMessageContent(), "exceeds the budget")
+}
+
+func TestGenerateShortSummary(t *testing.T) {
+	fake := provider.NewFake([]provider.FakeResponse{
+		{Content: "Add a login form\n\nIt validates the email address."},
+	})
+	root := agent.New("root", "You are a test agent", agent.WithModel(fake))
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Add a login form"))
+	summary, err := rt.GenerateShortSummary(t.Context(), sess)
+	require.NoError(t, err)
+	assert.Equal(t, "Add a login form", summary)
+	assert.Len(t, sess.Messages, 1)
+
+	_, err = rt.GenerateShortSummary(t.Context(), session.New())
+	require.Error(t, err)
+}
+
+// cancelingStream streams some content, then cancels the run as a user
+// interrupting it would.
+type cancelingStream struct {
+	cancel context.CancelFunc
+	sent   bool
+}
+
+func (s *cancelingStream) Recv() (chat.MessageStreamResponse, error) {
+	if !s.sent {
+		s.sent = true
+		return chat.MessageStreamResponse{Choices: []chat.MessageStreamChoice{{Delta: chat.MessageDelta{Content: "Partial answer"}}}}, nil
+	}
+	s.cancel()
+	return chat.MessageStreamResponse{}, context.Canceled
+}
+
+func (s *cancelingStream) Close() {}
+
+func TestCanceledRunKeepsPartialContent(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	prov := &mockProvider{id: "test/mock-model", stream: &cancelingStream{cancel: cancel}}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	tm := team.New(team.WithAgents(root))
+
+	rt, err := NewLocalRuntime(tm, WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Hi"))
+	for range rt.RunStream(ctx, sess) {
+	}
+
+	assert.Equal(t, "Partial answer\n\n[interrupted]", sess.GetLastAssistantMessageContent())
+}
+
+func TestAgentModelOptions(t *testing.T) {
+	apply := func(opts []options.Opt) *options.ModelOptions {
+		var m options.ModelOptions
+		for _, opt := range opts {
+			opt(&m)
+		}
+		return &m
+	}
+
+	m := apply(agentModelOptions(agent.New("root", ""), true))
+	require.NotNil(t, m.Thinking())
+	assert.True(t, *m.Thinking())
+	assert.Empty(t, m.StopSequences())
+
+	m = apply(agentModelOptions(agent.New("root", "", agent.WithStopSequences("<done>")), false))
+	require.NotNil(t, m.Thinking())
+	assert.False(t, *m.Thinking())
+	assert.Equal(t, []string{"<done>"}, m.StopSequences())
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestTimestampsFollowSessionClock(t *testing.T) {
+	frozen := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+	defer session.SetClock(fixedClock(frozen))()
+
+	prov := &mockProvider{id: "test/mock-model", stream: newStreamBuilder().AddContent("Hello").AddStopWithUsage(10, 5).Build()}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	rt, err := NewLocalRuntime(team.New(team.WithAgents(root)), WithSessionCompaction(false), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	sess := session.New(session.WithUserMessage("Hi"))
+	var choices int
+	for ev := range rt.RunStream(t.Context(), sess) {
+		if choice, ok := ev.(*AgentChoiceEvent); ok {
+			choices++
+			assert.Equal(t, frozen, choice.Timestamp)
+		}
+	}
+	assert.Positive(t, choices)
+
+	for _, msg := range sess.GetAllMessages() {
+		assert.Equal(t, frozen.Format(session.TimestampFormat), msg.Message.CreatedAt)
+	}
+}
@@ -1,10 +1,14 @@
 package runtime
 
 import (
+	"cmp"
 	"context"
 	_ "embed"
+	"errors"
+	"fmt"
 	"log/slog"
-	"time"
+	"slices"
+	"strings"
 
 	"github.com/docker/cagent/pkg/agent"
 	"github.com/docker/cagent/pkg/chat"
@@ -20,9 +24,29 @@ var compactionSystemPrompt string
 //go:embed prompts/compaction-user.txt
 var compactionUserPrompt string
 
+//go:embed prompts/short-summary-system.txt
+var shortSummarySystemPrompt string
+
+//go:embed prompts/short-summary-user.txt
+var shortSummaryUserPrompt string
+
+// defaultSummaryChunkTokens is the size of the history chunks summarized
+// separately by hierarchical summarization when the context limit of the
+// summary model is unknown.
+const defaultSummaryChunkTokens = 32_000
+
 type sessionCompactor struct {
 	model        provider.Provider
 	sessionStore session.Store
+
+	// hierarchical enables map-reduce summarization of histories that don't
+	// fit in half of the summary model's context.
+	hierarchical bool
+	modelsStore  ModelStore
+
+	// includeSystem adds the system prompt of the summarized conversation to
+	// the messages the summary model gets.
+	includeSystem bool
 }
 
 func newSessionCompactor(model provider.Provider, sessionStore session.Store) *sessionCompactor {
@@ -32,12 +56,15 @@ func newSessionCompactor(model provider.Provider, sessionStore session.Store) *s
 	}
 }
 
-func (c *sessionCompactor) Compact(ctx context.Context, sess *session.Session, additionalPrompt string, events chan Event, agentName string) {
+func (c *sessionCompactor) Compact(ctx context.Context, sess *session.Session, additionalPrompt string, events chan Event, a *agent.Agent) {
 	slog.Debug("Generating summary for session", "session_id", sess.ID)
 
+	agentName := a.Name()
+
 	events <- SessionCompaction(sess.ID, "started", agentName)
+	status := "completed"
 	defer func() {
-		events <- SessionCompaction(sess.ID, "completed", agentName)
+		events <- SessionCompaction(sess.ID, status, agentName)
 	}()
 
 	summaryModel := provider.CloneWithOptions(ctx, c.model, options.WithStructuredOutput(nil))
@@ -50,38 +77,56 @@ func (c *sessionCompactor) Compact(ctx context.Context, sess *session.Session, a
 		return
 	}
 
-	summarySession := session.New()
-	summarySession.Title = "Generating summary..."
-	for _, msg := range messages {
-		// Copy messages without their cost — the summary session should
-		// only track the cost of generating the summary itself, not the
-		// original conversation costs (which are already accounted for
-		// in the parent session).
-		cloned := msg
-		cloned.Cost = 0
-		summarySession.AddMessage(&session.Message{Message: cloned})
+	if c.includeSystem {
+		messages = withConversationSystemPrompt(messages, sess.SystemPrompt(a))
 	}
 
 	prompt := compactionUserPrompt
 	if additionalPrompt != "" {
 		prompt += "\n\nAdditional instructions from user: " + additionalPrompt
 	}
-	summarySession.AddMessage(&session.Message{
-		Message: chat.Message{
-			Role:      chat.MessageRoleUser,
-			Content:   prompt,
-			CreatedAt: time.Now().Format(time.RFC3339),
-		},
-	})
 
-	summaryRuntime, err := New(newTeam, WithSessionCompaction(false))
-	if err != nil {
-		slog.Error("Failed to create summary generator runtime", "error", err)
-		events <- Error(err.Error())
-		return
+	// Summarize each chunk of a long history on its own, then summarize the
+	// partial summaries.
+	var compactionCost float64
+	if c.hierarchical {
+		if chunks := chunkConversation(messages, c.chunkTokens(ctx)); len(chunks) > 1 {
+			slog.Debug("Summarizing session in chunks", "session_id", sess.ID, "chunks", len(chunks))
+
+			var partials []chat.Message
+			for i, chunk := range chunks {
+				summarySession, err := generateSummary(ctx, newTeam, chunk, prompt, nil)
+				if ctx.Err() != nil {
+					slog.Debug("Session compaction cancelled", "session_id", sess.ID)
+					status = "cancelled"
+					return
+				}
+				if err != nil {
+					slog.Error("Failed to generate partial session summary", "chunk", i, "error", err)
+					events <- Error(err.Error())
+					return
+				}
+				compactionCost += summarySession.TotalCost()
+				partials = append(partials, chat.Message{
+					Role:      chat.MessageRoleUser,
+					Content:   fmt.Sprintf("Summary of part %d of %d of the conversation:\n\n%s", i+1, len(chunks), summarySession.GetLastAssistantMessageContent()),
+					CreatedAt: session.Now().Format(session.TimestampFormat),
+				})
+			}
+
+			messages = append(systemMessages(messages), partials...)
+			prompt = "Combine the summaries of the parts of the conversation above into a single summary.\n\n" + prompt
+		}
 	}
 
-	_, err = summaryRuntime.Run(ctx, summarySession)
+	summarySession, err := generateSummary(ctx, newTeam, messages, prompt, func(delta string) {
+		events <- SummaryDelta(sess.ID, delta, agentName)
+	})
+	if ctx.Err() != nil {
+		slog.Debug("Session compaction cancelled", "session_id", sess.ID)
+		status = "cancelled"
+		return
+	}
 	if err != nil {
 		slog.Error("Failed to generate session summary", "error", err)
 		events <- Error(err.Error())
@@ -93,23 +138,187 @@ func (c *sessionCompactor) Compact(ctx context.Context, sess *session.Session, a
 		return
 	}
 
-	compactionCost := summarySession.TotalCost()
+	compactionCost += summarySession.TotalCost()
+
+	// The summary covers every item since the previous summary.
+	firstItem, lastItem := 0, len(sess.Messages)-1
+	for i := lastItem; i >= 0; i-- {
+		if sess.Messages[i].Summary != "" {
+			firstItem = i + 1
+			break
+		}
+	}
+	var messagesSummarized int
+	for _, item := range sess.Messages[firstItem:] {
+		if item.IsMessage() {
+			messagesSummarized++
+		}
+	}
 
 	// Store the compaction cost on the summary item so that TotalCost()
 	// can discover it when walking the session tree.
 	sess.Messages = append(sess.Messages, session.Item{Summary: summary, Cost: compactionCost})
 
-	// Update the parent session's token counts to reflect the compacted
-	// context. The summary model's output tokens approximate the new
-	// context size (system prompt + summary). The old counts reflected
-	// the pre-compaction context and are no longer meaningful.
+	// Reset the parent session's usage to reflect the compacted context.
+	// The summary model's output tokens approximate the new context size
+	// (system prompt + summary). The old counts reflected the
+	// pre-compaction context and are no longer meaningful.
+	sess.AddCost(compactionCost)
+	sess.ResetUsage()
 	sess.InputTokens = summarySession.OutputTokens
-	sess.OutputTokens = 0
 
 	_ = c.sessionStore.UpdateSession(ctx, sess)
 
 	slog.Debug("Generated session summary", "session_id", sess.ID, "summary_length", len(summary), "compaction_cost", compactionCost)
 	events <- SessionSummary(sess.ID, summary, agentName)
+	events <- SessionCompacted(sess.ID, messagesSummarized, len(summary), firstItem, lastItem, agentName)
+}
+
+// ShortSummary returns a one-line, commit-style summary of the session. Unlike
+// Compact, it leaves the session untouched.
+func (c *sessionCompactor) ShortSummary(ctx context.Context, sess *session.Session) (string, error) {
+	summaryModel := provider.CloneWithOptions(ctx, c.model, options.WithStructuredOutput(nil))
+	root := agent.New("root", shortSummarySystemPrompt, agent.WithModel(summaryModel))
+
+	messages := sess.GetMessages(root)
+	if !hasConversationMessages(messages) {
+		return "", errors.New("session is empty")
+	}
+
+	summarySession, err := generateSummary(ctx, team.New(team.WithAgents(root)), messages, shortSummaryUserPrompt, nil)
+	if err != nil {
+		return "", err
+	}
+
+	summary, _, _ := strings.Cut(strings.TrimSpace(summarySession.GetLastAssistantMessageContent()), "\n")
+	return strings.TrimSpace(summary), nil
+}
+
+// generateSummary runs the summary agent over messages followed by prompt and
+// returns the session it ran in. If onDelta isn't nil, it's called with every
+// chunk of the summary as it streams in.
+func generateSummary(ctx context.Context, summaryTeam *team.Team, messages []chat.Message, prompt string, onDelta func(string)) (*session.Session, error) {
+	summarySession := session.New()
+	summarySession.Title = "Generating summary..."
+	for _, msg := range messages {
+		// Copy messages without their cost — the summary session should
+		// only track the cost of generating the summary itself, not the
+		// original conversation costs (which are already accounted for
+		// in the parent session).
+		cloned := msg
+		cloned.Cost = 0
+		summarySession.AddMessage(&session.Message{Message: cloned})
+	}
+
+	summarySession.AddMessage(&session.Message{
+		Message: chat.Message{
+			Role:      chat.MessageRoleUser,
+			Content:   prompt,
+			CreatedAt: session.Now().Format(session.TimestampFormat),
+		},
+	})
+
+	summaryRuntime, err := New(summaryTeam, WithSessionCompaction(false))
+	if err != nil {
+		return nil, fmt.Errorf("creating summary generator runtime: %w", err)
+	}
+
+	for event := range summaryRuntime.RunStream(ctx, summarySession) {
+		switch e := event.(type) {
+		case *ErrorEvent:
+			err = cmp.Or(err, errors.New(e.Error))
+		case *AgentChoiceEvent:
+			if onDelta != nil {
+				onDelta(e.Content)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return summarySession, nil
+}
+
+// chunkTokens returns the estimated size of the history chunks summarized
+// separately: half of the summary model's context.
+func (c *sessionCompactor) chunkTokens(ctx context.Context) int {
+	if c.modelsStore != nil {
+		if m, err := c.modelsStore.GetModel(ctx, c.model.ID()); err == nil && m != nil && m.Limit.Context > 0 {
+			return m.Limit.Context / 2
+		}
+	}
+	return defaultSummaryChunkTokens
+}
+
+// chunkConversation splits the conversation messages into chunks of about
+// maxTokens estimated tokens, each prefixed with the system messages. Chunks
+// only start at user messages so tool calls stay next to their results; a
+// single turn bigger than maxTokens gets a chunk of its own.
+func chunkConversation(messages []chat.Message, maxTokens int) [][]chat.Message {
+	system := systemMessages(messages)
+
+	var chunks [][]chat.Message
+	var current []chat.Message
+	var currentTokens int
+	for _, msg := range messages {
+		if msg.Role == chat.MessageRoleSystem {
+			continue
+		}
+
+		tokens := len(msg.Content) / 4
+		if msg.Role == chat.MessageRoleUser && len(current) > 0 && currentTokens+tokens > maxTokens {
+			chunks = append(chunks, append(slices.Clone(system), current...))
+			current, currentTokens = nil, 0
+		}
+		current = append(current, msg)
+		currentTokens += tokens
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, append(slices.Clone(system), current...))
+	}
+
+	return chunks
+}
+
+func systemMessages(messages []chat.Message) []chat.Message {
+	var system []chat.Message
+	for _, msg := range messages {
+		if msg.Role == chat.MessageRoleSystem {
+			system = append(system, msg)
+		}
+	}
+	return system
+}
+
+// withConversationSystemPrompt inserts the system prompt of the summarized
+// conversation after the summary agent's own system messages. It's quoted in
+// a user message so that the summary model doesn't follow it.
+func withConversationSystemPrompt(messages, systemPrompt []chat.Message) []chat.Message {
+	if len(systemPrompt) == 0 {
+		return messages
+	}
+
+	var quoted strings.Builder
+	quoted.WriteString("The conversation below was held with these system instructions:")
+	for _, msg := range systemPrompt {
+		quoted.WriteString("\n\n")
+		quoted.WriteString(msg.Content)
+	}
+
+	system := systemMessages(messages)
+	result := slices.Clone(system)
+	result = append(result, chat.Message{
+		Role:      chat.MessageRoleUser,
+		Content:   quoted.String(),
+		CreatedAt: session.Now().Format(session.TimestampFormat),
+	})
+	for _, msg := range messages {
+		if msg.Role != chat.MessageRoleSystem {
+			result = append(result, msg)
+		}
+	}
+	return result
 }
 
 func hasConversationMessages(messages []chat.Message) bool {
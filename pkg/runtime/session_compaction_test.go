@@ -0,0 +1,178 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/agent"
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/session"
+	"github.com/docker/cagent/pkg/team"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+// recordingProvider records the messages of every request.
+type recordingProvider struct {
+	queueProvider
+	mu       sync.Mutex
+	requests [][]chat.Message
+}
+
+func (p *recordingProvider) CreateChatCompletionStream(ctx context.Context, messages []chat.Message, agentTools []tools.Tool) (chat.MessageStream, error) {
+	p.mu.Lock()
+	p.requests = append(p.requests, messages)
+	p.mu.Unlock()
+	return p.queueProvider.CreateChatCompletionStream(ctx, messages, agentTools)
+}
+
+func TestChunkConversation(t *testing.T) {
+	system := chat.Message{Role: chat.MessageRoleSystem, Content: "system"}
+	user := func(content string) chat.Message { return chat.Message{Role: chat.MessageRoleUser, Content: content} }
+	assistant := func(content string) chat.Message {
+		return chat.Message{Role: chat.MessageRoleAssistant, Content: content}
+	}
+	tool := func(content string) chat.Message { return chat.Message{Role: chat.MessageRoleTool, Content: content} }
+
+	long := strings.Repeat("x", 40) // 10 tokens
+
+	messages := []chat.Message{
+		system,
+		user(long), assistant("calling"), tool(long), assistant("done"),
+		user(long), assistant("ok"),
+		user("short"),
+	}
+
+	chunks := chunkConversation(messages, 15)
+	require.Len(t, chunks, 2)
+
+	// Tool results stay with their turn even if the turn is too big.
+	assert.Equal(t, []chat.Message{system, user(long), assistant("calling"), tool(long), assistant("done")}, chunks[0])
+	assert.Equal(t, []chat.Message{system, user(long), assistant("ok"), user("short")}, chunks[1])
+
+	assert.Len(t, chunkConversation(messages, 1000), 1)
+}
+
+func TestHierarchicalSummary(t *testing.T) {
+	prov := &recordingProvider{queueProvider: queueProvider{id: "test/mock-model", streams: []chat.MessageStream{
+		newStreamBuilder().AddContent("first part").AddStopWithUsage(1, 1).Build(),
+		newStreamBuilder().AddContent("second part").AddStopWithUsage(1, 1).Build(),
+		newStreamBuilder().AddContent("combined").AddStopWithUsage(1, 1).Build(),
+	}}}
+
+	compactor := newSessionCompactor(prov, session.NewInMemorySessionStore())
+	compactor.hierarchical = true
+	compactor.modelsStore = mockModelStoreWithLimit{limit: 20} // 10-token chunks
+
+	long := strings.Repeat("x", 40)
+	sess := session.New()
+	for range 2 {
+		sess.AddMessage(session.UserMessage(long))
+		sess.AddMessage(&session.Message{Message: chat.Message{Role: chat.MessageRoleAssistant, Content: "answer"}})
+	}
+
+	events := make(chan Event, 16)
+	compactor.Compact(t.Context(), sess, "", events, agent.New("root", ""))
+
+	require.Len(t, prov.requests, 3)
+	final := prov.requests[2]
+	var transcript strings.Builder
+	for _, msg := range final {
+		transcript.WriteString(msg.Content)
+	}
+	assert.Contains(t, transcript.String(), "Summary of part 1 of 2 of the conversation:\n\nfirst part")
+	assert.Contains(t, transcript.String(), "Summary of part 2 of 2 of the conversation:\n\nsecond part")
+	assert.NotContains(t, transcript.String(), long)
+
+	last := sess.Messages[len(sess.Messages)-1]
+	assert.Equal(t, "combined", last.Summary)
+}
+
+func TestSummaryIncludeSystem(t *testing.T) {
+	for name, includeSystem := range map[string]bool{"excluded": false, "included": true} {
+		t.Run(name, func(t *testing.T) {
+			prov := &recordingProvider{queueProvider: queueProvider{id: "test/mock-model", streams: []chat.MessageStream{
+				newStreamBuilder().AddContent("summary").AddStopWithUsage(1, 1).Build(),
+			}}}
+
+			compactor := newSessionCompactor(prov, session.NewInMemorySessionStore())
+			compactor.includeSystem = includeSystem
+
+			sess := session.New(session.WithUserMessage("Hello"))
+			sess.AddMessage(&session.Message{Message: chat.Message{Role: chat.MessageRoleAssistant, Content: "Bonjour"}})
+
+			events := make(chan Event, 16)
+			compactor.Compact(t.Context(), sess, "", events, agent.New("root", "Always answer in French"))
+
+			require.Len(t, prov.requests, 1)
+			request := prov.requests[0]
+			var quoted []chat.Message
+			for _, msg := range request {
+				if strings.Contains(msg.Content, "Always answer in French") {
+					quoted = append(quoted, msg)
+				}
+			}
+			if !includeSystem {
+				assert.Empty(t, quoted)
+				return
+			}
+			require.Len(t, quoted, 1)
+			assert.Equal(t, chat.MessageRoleUser, quoted[0].Role)
+			assert.Equal(t, chat.MessageRoleSystem, request[0].Role)
+		})
+	}
+}
+
+// blockingProvider blocks requests until they're cancelled.
+type blockingProvider struct {
+	queueProvider
+	started chan struct{}
+}
+
+func (p *blockingProvider) CreateChatCompletionStream(ctx context.Context, _ []chat.Message, _ []tools.Tool) (chat.MessageStream, error) {
+	close(p.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCancelCompaction(t *testing.T) {
+	prov := &blockingProvider{queueProvider: queueProvider{id: "test/mock-model"}, started: make(chan struct{})}
+	root := agent.New("root", "You are a test agent", agent.WithModel(prov))
+	rt, err := NewLocalRuntime(team.New(team.WithAgents(root)), WithModelStore(mockModelStore{}))
+	require.NoError(t, err)
+
+	assert.False(t, rt.CancelCompaction(), "nothing to cancel")
+
+	sess := session.New(session.WithUserMessage("Hello"))
+	sess.AddMessage(&session.Message{Message: chat.Message{Role: chat.MessageRoleAssistant, Content: "Hi"}})
+	itemCount := len(sess.Messages)
+
+	events := make(chan Event, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rt.Summarize(t.Context(), sess, "", events)
+	}()
+
+	<-prov.started
+	assert.True(t, rt.CancelCompaction())
+	<-done
+	close(events)
+
+	var statuses []string
+	for event := range events {
+		switch e := event.(type) {
+		case *SessionCompactionEvent:
+			statuses = append(statuses, e.Status)
+		case *ErrorEvent:
+			t.Errorf("unexpected error event: %s", e.Error)
+		}
+	}
+	assert.Equal(t, []string{"started", "cancelled"}, statuses)
+	assert.Len(t, sess.Messages, itemCount, "the session isn't compacted")
+	assert.False(t, rt.CancelCompaction())
+}
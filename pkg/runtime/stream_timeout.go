@@ -0,0 +1,98 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/model/provider"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+// ErrStreamIdleTimeout is returned when a model stream doesn't deliver any
+// chunk within the model's request timeout (see options.WithRequestTimeout).
+var ErrStreamIdleTimeout = errors.New("stream idle timeout")
+
+type recvResult struct {
+	response chat.MessageStreamResponse
+	err      error
+}
+
+// idleTimeoutStream wraps a MessageStream and fails Recv when no chunk
+// arrives within timeout. On timeout it cancels the stream's context so the
+// underlying connection is torn down.
+type idleTimeoutStream struct {
+	chat.MessageStream
+
+	timeout time.Duration
+	cancel  context.CancelFunc
+	pending chan recvResult
+}
+
+func newIdleTimeoutStream(stream chat.MessageStream, timeout time.Duration, cancel context.CancelFunc) chat.MessageStream {
+	return &idleTimeoutStream{
+		MessageStream: stream,
+		timeout:       timeout,
+		cancel:        cancel,
+	}
+}
+
+func (s *idleTimeoutStream) Recv() (chat.MessageStreamResponse, error) {
+	// Recv blocks, so it runs in its own goroutine. A result that arrives
+	// after a timeout is dropped: the stream is canceled by then.
+	if s.pending == nil {
+		s.pending = make(chan recvResult, 1)
+		go func(ch chan<- recvResult) {
+			response, err := s.MessageStream.Recv()
+			ch <- recvResult{response: response, err: err}
+		}(s.pending)
+	}
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-s.pending:
+		s.pending = nil
+		return res.response, res.err
+	case <-timer.C:
+		s.cancel()
+		return chat.MessageStreamResponse{}, fmt.Errorf("%w: no data received from the model for %s", ErrStreamIdleTimeout, s.timeout)
+	}
+}
+
+func (s *idleTimeoutStream) Close() {
+	s.cancel()
+	s.MessageStream.Close()
+}
+
+// createStream starts a chat completion stream. When the model has a request
+// timeout, the stream is canceled if it stays idle for longer than that.
+// The returned cancel function must be called once the stream is consumed.
+func createStream(ctx context.Context, p provider.Provider, messages []chat.Message, agentTools []tools.Tool) (chat.MessageStream, context.CancelFunc, error) {
+	modelOptions := p.BaseConfig().ModelOptions
+	timeout := modelOptions.RequestTimeout()
+	if timeout <= 0 {
+		stream, err := p.CreateChatCompletionStream(ctx, messages, agentTools)
+		return stream, func() {}, err
+	}
+
+	// Some providers only return once the response headers arrived, so the
+	// timeout also applies to creating the stream.
+	streamCtx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(timeout, cancel)
+	stream, err := p.CreateChatCompletionStream(streamCtx, messages, agentTools)
+	if !timer.Stop() {
+		if err == nil {
+			stream.Close()
+		}
+		return nil, cancel, fmt.Errorf("%w: no response from the model within %s", ErrStreamIdleTimeout, timeout)
+	}
+	if err != nil {
+		cancel()
+		return nil, cancel, err
+	}
+	return newIdleTimeoutStream(stream, timeout, cancel), cancel, nil
+}
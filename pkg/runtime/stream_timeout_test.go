@@ -0,0 +1,80 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/model/provider/base"
+	"github.com/docker/cagent/pkg/model/provider/options"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+// stallingStream delivers its chunks, then blocks until its context is canceled.
+type stallingStream struct {
+	ctx    context.Context
+	chunks []chat.MessageStreamResponse
+}
+
+func (s *stallingStream) Recv() (chat.MessageStreamResponse, error) {
+	if len(s.chunks) > 0 {
+		chunk := s.chunks[0]
+		s.chunks = s.chunks[1:]
+		return chunk, nil
+	}
+	<-s.ctx.Done()
+	return chat.MessageStreamResponse{}, s.ctx.Err()
+}
+
+func (s *stallingStream) Close() {}
+
+type stallingProvider struct {
+	mockProvider
+	timeout time.Duration
+	chunks  []chat.MessageStreamResponse
+}
+
+func (p *stallingProvider) CreateChatCompletionStream(ctx context.Context, _ []chat.Message, _ []tools.Tool) (chat.MessageStream, error) {
+	return &stallingStream{ctx: ctx, chunks: p.chunks}, nil
+}
+
+func (p *stallingProvider) BaseConfig() base.Config {
+	var opts options.ModelOptions
+	options.WithRequestTimeout(p.timeout)(&opts)
+	return base.Config{ModelOptions: opts}
+}
+
+func TestCreateStream_IdleTimeout(t *testing.T) {
+	p := &stallingProvider{
+		timeout: 50 * time.Millisecond,
+		chunks:  []chat.MessageStreamResponse{{Model: "first"}},
+	}
+
+	stream, cancel, err := createStream(t.Context(), p, nil, nil)
+	require.NoError(t, err)
+	defer cancel()
+
+	// Chunks arriving in time are passed through.
+	chunk, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "first", chunk.Model)
+
+	// A stall fails fast instead of blocking forever.
+	_, err = stream.Recv()
+	require.ErrorIs(t, err, ErrStreamIdleTimeout)
+	assert.True(t, isRetryableModelError(err))
+}
+
+func TestCreateStream_NoTimeout(t *testing.T) {
+	stream, cancel, err := createStream(t.Context(), &mockProvider{stream: &mockStream{}}, nil, nil)
+	require.NoError(t, err)
+	defer cancel()
+
+	_, err = stream.Recv()
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,39 @@
+// Package sanitize cleans up text coming from terminals and external
+// processes so it can be displayed or sent to a model as plain text.
+package sanitize
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// StripANSI removes ANSI escape sequences (colors, cursor movements, OSC
+// hyperlinks...) from s.
+func StripANSI(s string) string {
+	return ansi.Strip(s)
+}
+
+// ControlChars normalizes line endings to \n and removes the control
+// characters other than newlines and tabs.
+func ControlChars(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case r == '\r':
+			return '\n'
+		case r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0):
+			return -1
+		default:
+			return r
+		}
+	}, s)
+}
+
+// Text strips ANSI escape sequences from s and normalizes its control
+// characters.
+func Text(s string) string {
+	return ControlChars(StripANSI(s))
+}
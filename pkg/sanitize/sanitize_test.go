@@ -0,0 +1,23 @@
+package sanitize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripANSI(t *testing.T) {
+	assert.Equal(t, "red text", StripANSI("\x1b[31mred\x1b[0m text"))
+	assert.Equal(t, "link", StripANSI("\x1b]8;;https://example.com\x07link\x1b]8;;\x07"))
+	assert.Equal(t, "plain", StripANSI("plain"))
+}
+
+func TestControlChars(t *testing.T) {
+	assert.Equal(t, "a\nb\nc", ControlChars("a\r\nb\rc"))
+	assert.Equal(t, "tab\tkept\n", ControlChars("tab\tkept\x00\x07\x08\n"))
+	assert.Equal(t, "héllo 👋", ControlChars("héllo 👋"))
+}
+
+func TestText(t *testing.T) {
+	assert.Equal(t, "ok\ndone", Text("\x1b[32mok\x1b[0m\r\ndone\x1b[K"))
+}
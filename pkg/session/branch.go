@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"maps"
 	"strings"
-	"time"
 
 	"github.com/docker/cagent/pkg/chat"
 	"github.com/docker/cagent/pkg/tools"
@@ -23,7 +22,7 @@ func BranchSession(parent *Session, branchAtPosition int) (*Session, error) {
 	branched := New()
 	copySessionMetadata(branched, parent, generateBranchTitle(parent.Title))
 
-	now := time.Now()
+	now := Now()
 	branched.BranchParentSessionID = parent.ID
 	branched.BranchParentPosition = &branchAtPosition
 	branched.BranchCreatedAt = &now
@@ -42,6 +41,55 @@ func BranchSession(parent *Session, branchAtPosition int) (*Session, error) {
 	return branched, nil
 }
 
+// Clone returns a deep copy of the session, keeping its identity: the ID,
+// message IDs, timestamps and totals are the same as the original's. Changes
+// to the copy, or to its sub-sessions, don't affect the original.
+func (s *Session) Clone() *Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cloned := &Session{
+		ID:                    s.ID,
+		CreatedAt:             s.CreatedAt,
+		InputTokens:           s.InputTokens,
+		OutputTokens:          s.OutputTokens,
+		Cost:                  s.Cost,
+		LifetimeCost:          s.LifetimeCost,
+		BranchParentSessionID: s.BranchParentSessionID,
+		AgentName:             s.AgentName,
+		ParentID:              s.ParentID,
+		MessageUsageHistory:   append([]MessageUsageRecord(nil), s.MessageUsageHistory...),
+	}
+	copySessionMetadata(cloned, s, s.Title)
+
+	if s.Evals != nil {
+		evals := *s.Evals
+		evals.Relevance = cloneStringSlice(s.Evals.Relevance)
+		cloned.Evals = &evals
+	}
+	if s.BranchParentPosition != nil {
+		position := *s.BranchParentPosition
+		cloned.BranchParentPosition = &position
+	}
+	if s.BranchCreatedAt != nil {
+		createdAt := *s.BranchCreatedAt
+		cloned.BranchCreatedAt = &createdAt
+	}
+
+	cloned.Messages = make([]Item, len(s.Messages))
+	for i, item := range s.Messages {
+		cloned.Messages[i] = Item{Summary: item.Summary, Cost: item.Cost}
+		if item.Message != nil {
+			cloned.Messages[i].Message = deepCopyMessage(item.Message)
+		}
+		if item.SubSession != nil {
+			cloned.Messages[i].SubSession = item.SubSession.Clone()
+		}
+	}
+
+	return cloned
+}
+
 func cloneSessionItem(item Item) (Item, error) {
 	switch {
 	case item.Message != nil:
@@ -96,6 +144,9 @@ func copySessionMetadata(dst, src *Session, title string) {
 	dst.Permissions = clonePermissionsConfig(src.Permissions)
 	dst.AgentModelOverrides = cloneStringMap(src.AgentModelOverrides)
 	dst.CustomModelsUsed = cloneStringSlice(src.CustomModelsUsed)
+	dst.Commands = cloneStringMap(src.Commands)
+	dst.TeamRef = src.TeamRef
+	dst.CurrentAgent = src.CurrentAgent
 }
 
 // generateBranchTitle creates a title for a branched session based on the parent title.
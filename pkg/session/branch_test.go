@@ -145,3 +145,36 @@ func TestBranchSession(t *testing.T) {
 		assert.Equal(t, "msg2", branched.Messages[1].Message.Message.Content)
 	})
 }
+
+func TestSessionClone(t *testing.T) {
+	sub := New(WithUserMessage("sub task"), WithParentID("parent"))
+	msg := UserMessage("hello")
+	msg.ID = 42
+
+	s := New(WithTitle("original"), WithToolsApproved(false))
+	s.AddMessage(msg)
+	s.AddSubSession(sub)
+	s.Messages = append(s.Messages, Item{Summary: "summary", Cost: 0.5})
+	s.Cost = 1.5
+	s.Commands = map[string]string{"fix": "Fix it"}
+
+	cloned := s.Clone()
+	assert.Equal(t, s.ID, cloned.ID)
+	assert.Equal(t, s.Title, cloned.Title)
+	assert.InDelta(t, 1.5, cloned.Cost, 0)
+	assert.Equal(t, int64(42), cloned.Messages[0].Message.ID)
+	assert.Equal(t, sub.ID, cloned.Messages[1].SubSession.ID)
+	assert.Equal(t, "summary", cloned.Messages[2].Summary)
+
+	cloned.ToolsApproved = true
+	cloned.Commands["fix"] = "Fix it differently"
+	cloned.Messages[0].Message.Message.Content = "changed"
+	cloned.Messages[1].SubSession.AddMessage(UserMessage("more"))
+	cloned.AddMessage(UserMessage("new"))
+
+	assert.False(t, s.ToolsApproved)
+	assert.Equal(t, "Fix it", s.Commands["fix"])
+	assert.Equal(t, "hello", s.Messages[0].Message.Message.Content)
+	assert.Len(t, s.Messages[1].SubSession.Messages, 1)
+	assert.Len(t, s.Messages, 3)
+}
@@ -0,0 +1,45 @@
+package session
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the time. The session and runtime packages read it for the
+// timestamps they record, so that tests and replays can control them.
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is the Clock reading the system time. It's the default.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// clockHolder wraps the current Clock so that it can be stored atomically.
+type clockHolder struct{ Clock }
+
+var clock atomic.Pointer[clockHolder]
+
+func init() {
+	clock.Store(&clockHolder{RealClock})
+}
+
+// SetClock replaces the Clock used for timestamps and returns a function
+// that restores the previous one. A nil clock restores RealClock.
+func SetClock(c Clock) (restore func()) {
+	if c == nil {
+		c = RealClock
+	}
+	previous := clock.Swap(&clockHolder{c})
+	return func() {
+		clock.Store(previous)
+	}
+}
+
+// Now returns the current time according to the Clock in use.
+func Now() time.Time {
+	return clock.Load().Now()
+}
@@ -0,0 +1,38 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/agent"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestSetClock(t *testing.T) {
+	frozen := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+	restore := SetClock(fixedClock(frozen))
+
+	sess := New(WithUserMessage("hello"))
+	assert.Equal(t, frozen, sess.CreatedAt)
+	assert.Equal(t, frozen.Format(TimestampFormat), sess.GetAllMessages()[0].Message.CreatedAt)
+
+	messages := sess.GetMessages(agent.New("root", "", agent.WithAddDate(true)))
+	require.NotEmpty(t, messages)
+	assert.Contains(t, messages[0].Content, "Today's date: 2025-03-14")
+
+	restore()
+	assert.NotEqual(t, frozen, Now())
+}
+
+func TestSetClockNilRestoresRealClock(t *testing.T) {
+	restore := SetClock(nil)
+	defer restore()
+
+	assert.WithinDuration(t, time.Now(), Now(), time.Minute)
+}
@@ -0,0 +1,125 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/cagent/pkg/chat"
+)
+
+// encryptedPrefix marks the values encrypted by a store opened with
+// WithEncryption, so that values written before encryption was turned on
+// can still be read.
+const encryptedPrefix = "enc:v1:"
+
+// ErrDecryption is returned when stored data can't be decrypted: the store
+// was opened with the wrong key, or without a key.
+var ErrDecryption = errors.New("cannot decrypt session data: wrong or missing encryption key")
+
+// SQLiteStoreOpt configures a SQLiteSessionStore.
+type SQLiteStoreOpt func(*SQLiteSessionStore)
+
+// WithEncryption encrypts the content of the stored messages with AES-GCM:
+// their text, reasoning, tool call arguments, tool results and attachments,
+// as well as the summaries. Metadata such
+// as titles, timestamps, models and usage stay in clear so they can still be
+// queried. The key must be 16, 24 or 32 bytes long. Reading data encrypted
+// with another key fails with ErrDecryption.
+//
+// The legacy messages column, kept for older versions of cagent, isn't
+// written by encrypted stores.
+func WithEncryption(key []byte) SQLiteStoreOpt {
+	return func(s *SQLiteSessionStore) {
+		s.encryptionKey = slices.Clone(key)
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt returns the encrypted form of a value, or the value itself when
+// the store isn't encrypted. Empty values are left empty.
+func (s *SQLiteSessionStore) encrypt(value string) string {
+	if s.aead == nil || value == "" {
+		return value
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	_, _ = rand.Read(nonce)
+	sealed := s.aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// decrypt reverses encrypt. Values that aren't encrypted are returned as is.
+func (s *SQLiteSessionStore) decrypt(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, nil
+	}
+	if s.aead == nil {
+		return "", ErrDecryption
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", ErrDecryption
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrDecryption
+	}
+	return string(plaintext), nil
+}
+
+// encryptMessage returns a copy of msg whose content is encrypted.
+func (s *SQLiteSessionStore) encryptMessage(msg chat.Message) chat.Message {
+	if s.aead == nil {
+		return msg
+	}
+
+	msg.Content = s.encrypt(msg.Content)
+	msg.ReasoningContent = s.encrypt(msg.ReasoningContent)
+	msg.MultiContent = slices.Clone(msg.MultiContent)
+	for i := range msg.MultiContent {
+		msg.MultiContent[i].Text = s.encrypt(msg.MultiContent[i].Text)
+	}
+	msg.ToolCalls = slices.Clone(msg.ToolCalls)
+	for i := range msg.ToolCalls {
+		msg.ToolCalls[i].Function.Arguments = s.encrypt(msg.ToolCalls[i].Function.Arguments)
+	}
+	return msg
+}
+
+// decryptMessage decrypts the content of msg in place.
+func (s *SQLiteSessionStore) decryptMessage(msg *chat.Message) error {
+	var err error
+	if msg.Content, err = s.decrypt(msg.Content); err != nil {
+		return err
+	}
+	if msg.ReasoningContent, err = s.decrypt(msg.ReasoningContent); err != nil {
+		return err
+	}
+	for i := range msg.MultiContent {
+		if msg.MultiContent[i].Text, err = s.decrypt(msg.MultiContent[i].Text); err != nil {
+			return err
+		}
+	}
+	for i := range msg.ToolCalls {
+		if msg.ToolCalls[i].Function.Arguments, err = s.decrypt(msg.ToolCalls[i].Function.Arguments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package session
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+func TestEncryption_SQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "encrypted.db")
+	key := bytes.Repeat([]byte{1}, 32)
+	ctx := t.Context()
+
+	store, err := NewSQLiteSessionStore(path, WithEncryption(key))
+	require.NoError(t, err)
+
+	sess := New(WithTitle("Quarterly numbers"), WithUserMessage("the secret is 42"))
+	sess.AddMessage(&Message{AgentName: "root", Message: chat.Message{
+		Role:             chat.MessageRoleAssistant,
+		ReasoningContent: "the user shared a secret",
+		ToolCalls: []tools.ToolCall{{
+			ID:       "call_1",
+			Function: tools.FunctionCall{Name: "write_file", Arguments: `{"content":"secret"}`},
+		}},
+		Model: "openai/gpt-4o",
+	}})
+	sess.AddMessage(&Message{
+		AgentName: "root",
+		Message:   chat.Message{Role: chat.MessageRoleTool, ToolCallID: "call_1", Content: "wrote the secret"},
+		RawOutput: "secret raw output",
+	})
+	sess.AddMessage(&Message{
+		AgentName:   "root",
+		Message:     chat.Message{Role: chat.MessageRoleUser, Content: "see attached"},
+		Attachments: []Attachment{{Name: "notes.txt", MimeType: "text/plain", Content: "secret notes"}},
+	})
+	sess.Messages = append(sess.Messages, Item{Summary: "the secret was shared"})
+	require.NoError(t, store.AddSession(ctx, sess))
+	_, err = store.AddMessage(ctx, sess.ID, UserMessage("another secret"))
+	require.NoError(t, err)
+	require.NoError(t, store.AddSummary(ctx, sess.ID, "another secret was shared"))
+	require.NoError(t, store.UpdateItem(ctx, sess.ID, 4, Item{Summary: "the secret was shared"}))
+
+	// Nothing sensitive is stored in clear, but metadata can still be queried.
+	db := store.(*SQLiteSessionStore).DB()
+	var leaks int
+	require.NoError(t, db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM session_items WHERE message_json LIKE '%secret%' OR raw_output LIKE '%secret%' OR summary_text LIKE '%secret%'`).Scan(&leaks))
+	assert.Zero(t, leaks)
+	require.NoError(t, db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM attachments WHERE content LIKE '%secret%'`).Scan(&leaks))
+	assert.Zero(t, leaks)
+	require.NoError(t, db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sessions WHERE messages LIKE '%secret%'`).Scan(&leaks))
+	assert.Zero(t, leaks)
+	var title, model string
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT title FROM sessions WHERE id = ?`, sess.ID).Scan(&title))
+	require.NoError(t, db.QueryRowContext(ctx,
+		`SELECT json_extract(message_json, '$.model') FROM session_items WHERE position = 1`).Scan(&model))
+	assert.Equal(t, "Quarterly numbers", title)
+	assert.Equal(t, "openai/gpt-4o", model)
+	require.NoError(t, store.Close())
+
+	store, err = NewSQLiteSessionStore(path, WithEncryption(key))
+	require.NoError(t, err)
+	retrieved, err := store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, retrieved.Messages, 7)
+	assert.Equal(t, "the secret is 42", retrieved.Messages[0].Message.Message.Content)
+	assert.Equal(t, "the user shared a secret", retrieved.Messages[1].Message.Message.ReasoningContent)
+	assert.JSONEq(t, `{"content":"secret"}`, retrieved.Messages[1].Message.Message.ToolCalls[0].Function.Arguments)
+	assert.Equal(t, "wrote the secret", retrieved.Messages[2].Message.Message.Content)
+	assert.Equal(t, "secret raw output", retrieved.Messages[2].Message.RawOutput)
+	assert.Equal(t, "secret notes", retrieved.Messages[3].Message.Attachments[0].Content)
+	assert.Equal(t, "the secret was shared", retrieved.Messages[4].Summary)
+	assert.Equal(t, "another secret", retrieved.Messages[5].Message.Message.Content)
+	assert.Equal(t, "another secret was shared", retrieved.Messages[6].Summary)
+	summaries, err := store.GetSummaries(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, summaries, 2)
+	assert.Equal(t, "the secret was shared", summaries[0].Text)
+	require.NoError(t, store.Close())
+
+	t.Run("wrong key", func(t *testing.T) {
+		store, err := NewSQLiteSessionStore(path, WithEncryption(bytes.Repeat([]byte{2}, 32)))
+		require.NoError(t, err)
+		defer store.Close()
+
+		_, err = store.GetSession(ctx, sess.ID)
+		require.ErrorIs(t, err, ErrDecryption)
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		store, err := NewSQLiteSessionStore(path)
+		require.NoError(t, err)
+		defer store.Close()
+
+		_, err = store.GetSession(ctx, sess.ID)
+		require.ErrorIs(t, err, ErrDecryption)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := NewSQLiteSessionStore(path, WithEncryption([]byte("short")))
+		require.Error(t, err)
+	})
+}
+
+func TestEncryption_ReadsMessagesWrittenInClear(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plain.db")
+	ctx := t.Context()
+
+	store, err := NewSQLiteSessionStore(path)
+	require.NoError(t, err)
+	sess := New(WithUserMessage("written in clear"))
+	require.NoError(t, store.AddSession(ctx, sess))
+	require.NoError(t, store.Close())
+
+	store, err = NewSQLiteSessionStore(path, WithEncryption(bytes.Repeat([]byte{1}, 16)))
+	require.NoError(t, err)
+	defer store.Close()
+
+	retrieved, err := store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "written in clear", retrieved.Messages[0].Message.Message.Content)
+}
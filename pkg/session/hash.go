@@ -0,0 +1,68 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+// hashedMessage is the part of a message that makes up the content of a
+// session. Costs, usage, models and timestamps are left out.
+type hashedMessage struct {
+	AgentName        string             `json:"agent_name,omitempty"`
+	Implicit         bool               `json:"implicit,omitempty"`
+	Role             chat.MessageRole   `json:"role"`
+	Content          string             `json:"content,omitempty"`
+	MultiContent     []chat.MessagePart `json:"multi_content,omitempty"`
+	ReasoningContent string             `json:"reasoning_content,omitempty"`
+	ToolCalls        []tools.ToolCall   `json:"tool_calls,omitempty"`
+	ToolCallID       string             `json:"tool_call_id,omitempty"`
+	IsError          bool               `json:"is_error,omitempty"`
+}
+
+type hashedItem struct {
+	Message    *hashedMessage `json:"message,omitempty"`
+	SubSession string         `json:"sub_session,omitempty"` // Content hash of the sub-session
+	Summary    string         `json:"summary,omitempty"`
+}
+
+// ContentHash returns a hex-encoded SHA-256 hash of the session's content:
+// its messages (roles, text, tool calls and results), sub-sessions and
+// summaries, in order. Volatile fields such as costs, token usage, models and
+// timestamps don't contribute, so two sessions that went through the same
+// conversation, a branch and its source for example, hash the same until they
+// diverge.
+func (s *Session) ContentHash() string {
+	s.mu.RLock()
+	items := make([]hashedItem, len(s.Messages))
+	for i, item := range s.Messages {
+		switch {
+		case item.IsMessage():
+			m := &item.Message.Message
+			items[i].Message = &hashedMessage{
+				AgentName:        item.Message.AgentName,
+				Implicit:         item.Message.Implicit,
+				Role:             m.Role,
+				Content:          m.Content,
+				MultiContent:     m.MultiContent,
+				ReasoningContent: m.ReasoningContent,
+				ToolCalls:        m.ToolCalls,
+				ToolCallID:       m.ToolCallID,
+				IsError:          m.IsError,
+			}
+		case item.IsSubSession():
+			items[i].SubSession = item.SubSession.ContentHash()
+		default:
+			items[i].Summary = item.Summary
+		}
+	}
+	s.mu.RUnlock()
+
+	// Marshaling plain structs, slices and strings can't fail.
+	data, _ := json.Marshal(items)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,72 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+func newHashTestSession() *Session {
+	sub := New(WithUserMessage("sub task"))
+	sub.AddMessage(&Message{AgentName: "helper", Message: chat.Message{Role: chat.MessageRoleAssistant, Content: "sub done"}})
+
+	s := New(WithUserMessage("hello"))
+	s.AddMessage(&Message{
+		AgentName: "root",
+		Message: chat.Message{
+			Role:      chat.MessageRoleAssistant,
+			ToolCalls: []tools.ToolCall{{ID: "call_1", Type: "function", Function: tools.FunctionCall{Name: "shell", Arguments: `{"cmd":"ls"}`}}},
+			Cost:      0.01,
+			Usage:     &chat.Usage{InputTokens: 10, OutputTokens: 5},
+			CreatedAt: "2025-01-01T00:00:00Z",
+		},
+	})
+	s.AddMessage(&Message{Message: chat.Message{Role: chat.MessageRoleTool, ToolCallID: "call_1", Content: "README.md"}})
+	s.AddSubSession(sub)
+	s.Messages = append(s.Messages, Item{Summary: "listed files"})
+	return s
+}
+
+func TestContentHash(t *testing.T) {
+	a := newHashTestSession()
+	b := newHashTestSession()
+
+	hash := a.ContentHash()
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, b.ContentHash(), "sessions with the same content hash the same")
+
+	// Volatile fields don't change the hash.
+	b.Messages[1].Message.Message.Cost = 1
+	b.Messages[1].Message.Message.Usage = &chat.Usage{InputTokens: 1000}
+	b.Messages[1].Message.Message.CreatedAt = "2026-01-01T00:00:00Z"
+	b.Messages[4].Cost = 0.5
+	assert.Equal(t, hash, b.ContentHash())
+
+	// Content does.
+	b.Messages[1].Message.Message.ToolCalls[0].Function.Arguments = `{"cmd":"ls -la"}`
+	assert.NotEqual(t, hash, b.ContentHash())
+
+	c := newHashTestSession()
+	c.Messages[3].SubSession.Messages[1].Message.Message.Content = "sub failed"
+	assert.NotEqual(t, hash, c.ContentHash())
+
+	d := newHashTestSession()
+	d.Messages[4].Summary = "listed other files"
+	assert.NotEqual(t, hash, d.ContentHash())
+}
+
+func TestContentHashOfBranch(t *testing.T) {
+	parent := newHashTestSession()
+	branched, err := BranchSession(parent, 3)
+	require.NoError(t, err)
+
+	prefix := &Session{Messages: parent.Messages[:3]}
+	assert.Equal(t, prefix.ContentHash(), branched.ContentHash())
+
+	branched.AddMessage(UserMessage("something else"))
+	assert.NotEqual(t, prefix.ContentHash(), branched.ContentHash())
+}
@@ -0,0 +1,110 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// LazyStore wraps a Store so that sessions are only written once they hold a
+// real conversation. UpdateSession on a session without any non-implicit
+// message is recorded in memory instead of being upserted, which keeps
+// abandoned "New Session" rows out of the underlying store. The pending
+// session is flushed the first time an item is added to it, or when it is
+// updated after a real message was added.
+type LazyStore struct {
+	Store
+
+	mu      sync.Mutex
+	pending map[string]*Session
+}
+
+// NewLazyStore returns a Store that defers persisting sessions until they
+// contain at least one non-implicit message.
+func NewLazyStore(store Store) *LazyStore {
+	return &LazyStore{
+		Store:   store,
+		pending: make(map[string]*Session),
+	}
+}
+
+// UpdateSession persists the session if it has a real message or was already
+// persisted, and otherwise keeps it pending.
+func (s *LazyStore) UpdateSession(ctx context.Context, session *Session) error {
+	if session.ID == "" {
+		return ErrEmptyID
+	}
+
+	if !session.HasVisibleMessages() {
+		if _, err := s.Store.GetSession(ctx, session.ID); errors.Is(err, ErrNotFound) {
+			s.mu.Lock()
+			s.pending[session.ID] = session
+			s.mu.Unlock()
+			return nil
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.pending, session.ID)
+	s.mu.Unlock()
+
+	return s.Store.UpdateSession(ctx, session)
+}
+
+// AddMessage flushes a pending session before adding the message.
+func (s *LazyStore) AddMessage(ctx context.Context, sessionID string, msg *Message) (int64, error) {
+	if err := s.flush(ctx, sessionID); err != nil {
+		return 0, err
+	}
+	return s.Store.AddMessage(ctx, sessionID, msg)
+}
+
+// AddSubSession flushes a pending parent session before adding the sub-session.
+func (s *LazyStore) AddSubSession(ctx context.Context, parentSessionID string, subSession *Session) error {
+	if err := s.flush(ctx, parentSessionID); err != nil {
+		return err
+	}
+	return s.Store.AddSubSession(ctx, parentSessionID, subSession)
+}
+
+// AddSummary flushes a pending session before adding the summary.
+func (s *LazyStore) AddSummary(ctx context.Context, sessionID, summary string) error {
+	if err := s.flush(ctx, sessionID); err != nil {
+		return err
+	}
+	return s.Store.AddSummary(ctx, sessionID, summary)
+}
+
+// DeleteSession forgets a pending session, or deletes a persisted one.
+func (s *LazyStore) DeleteSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	_, isPending := s.pending[id]
+	delete(s.pending, id)
+	s.mu.Unlock()
+
+	if isPending {
+		return nil
+	}
+	return s.Store.DeleteSession(ctx, id)
+}
+
+// Forget drops a session that is still pending, for example once the run
+// it was created for ends without a real message. Persisted sessions are
+// left untouched, and a later UpdateSession keeps the session pending again.
+func (s *LazyStore) Forget(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, sessionID)
+}
+
+func (s *LazyStore) flush(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	sess, isPending := s.pending[sessionID]
+	delete(s.pending, sessionID)
+	s.mu.Unlock()
+
+	if !isPending {
+		return nil
+	}
+	return s.Store.UpdateSession(ctx, sess)
+}
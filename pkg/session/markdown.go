@@ -0,0 +1,121 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/cagent/pkg/chat"
+)
+
+// ToMarkdown renders the session as a Markdown transcript. User, assistant
+// and tool turns get their own heading, tool calls and results are rendered
+// as fenced code blocks and reasoning is wrapped in a collapsible <details>
+// block. Sub-sessions are rendered as nested sections. Implicit messages are
+// skipped.
+func (s *Session) ToMarkdown() string {
+	var b strings.Builder
+
+	title := s.Title
+	if title == "" {
+		title = "Session " + s.ID
+	}
+	fmt.Fprintf(&b, "# %s\n", title)
+
+	s.writeMarkdownItems(&b, 2)
+
+	return strings.TrimSpace(b.String()) + "\n"
+}
+
+func (s *Session) writeMarkdownItems(b *strings.Builder, level int) {
+	s.mu.RLock()
+	items := make([]Item, len(s.Messages))
+	copy(items, s.Messages)
+	s.mu.RUnlock()
+
+	heading := strings.Repeat("#", level)
+	toolNames := make(map[string]string)
+
+	for _, item := range items {
+		switch {
+		case item.IsMessage():
+			msg := item.Message
+			if msg.Implicit {
+				continue
+			}
+			switch msg.Message.Role {
+			case chat.MessageRoleUser:
+				fmt.Fprintf(b, "\n%s User\n\n%s\n", heading, msg.Message.Content)
+			case chat.MessageRoleAssistant:
+				writeMarkdownAssistant(b, heading, msg, toolNames)
+			case chat.MessageRoleTool:
+				fmt.Fprintf(b, "\n%s Tool result", heading)
+				if name := toolNames[msg.Message.ToolCallID]; name != "" {
+					fmt.Fprintf(b, ": `%s`", name)
+				}
+				b.WriteString("\n\n")
+				writeCodeBlock(b, msg.Message.Content)
+			}
+		case item.SubSession != nil:
+			sub := item.SubSession
+			title := sub.Title
+			if title == "" {
+				title = sub.ID
+			}
+			fmt.Fprintf(b, "\n%s Sub-session: %s\n", heading, title)
+			sub.writeMarkdownItems(b, level+1)
+		case item.Summary != "":
+			fmt.Fprintf(b, "\n%s Summary\n\n%s\n", heading, item.Summary)
+		}
+	}
+}
+
+func writeMarkdownAssistant(b *strings.Builder, heading string, msg *Message, toolNames map[string]string) {
+	fmt.Fprintf(b, "\n%s Assistant", heading)
+	if msg.AgentName != "" {
+		fmt.Fprintf(b, " (%s)", msg.AgentName)
+	}
+	b.WriteString("\n\n")
+
+	if msg.Message.ReasoningContent != "" {
+		fmt.Fprintf(b, "<details>\n<summary>Reasoning</summary>\n\n%s\n\n</details>\n\n", msg.Message.ReasoningContent)
+	}
+
+	if msg.Message.Content != "" {
+		b.WriteString(msg.Message.Content)
+		b.WriteString("\n")
+	}
+
+	for _, toolCall := range msg.Message.ToolCalls {
+		toolNames[toolCall.ID] = toolCall.Function.Name
+		fmt.Fprintf(b, "\n**Tool call:** `%s`\n\n", toolCall.Function.Name)
+		writeCodeBlock(b, toolCall.Function.Arguments)
+	}
+}
+
+// writeCodeBlock writes content as a fenced code block, pretty-printing it
+// as JSON when it parses as such. The fence is made longer than any run of
+// backticks in the content so it can't be closed early.
+func writeCodeBlock(b *strings.Builder, content string) {
+	lang := ""
+	var v any
+	if err := json.Unmarshal([]byte(content), &v); err == nil {
+		if formatted, err := json.MarshalIndent(v, "", "  "); err == nil {
+			content = string(formatted)
+			lang = "json"
+		}
+	}
+
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+
+	fmt.Fprintf(b, "%s%s\n%s\n%s\n", fence, lang, strings.TrimRight(content, "\n"), fence)
+}
@@ -0,0 +1,55 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+func TestToMarkdown(t *testing.T) {
+	sess := New(WithTitle("Demo"), WithImplicitUserMessage("hidden"), WithUserMessage("List files"))
+	sess.AddMessage(&Message{
+		AgentName: "root",
+		Message: chat.Message{
+			Role:             chat.MessageRoleAssistant,
+			Content:          "Sure.",
+			ReasoningContent: "Use the shell.",
+			ToolCalls: []tools.ToolCall{{
+				ID:       "call_1",
+				Function: tools.FunctionCall{Name: "shell", Arguments: `{"cmd":"ls"}`},
+			}},
+		},
+	})
+	sess.AddMessage(&Message{
+		Message: chat.Message{
+			Role:       chat.MessageRoleTool,
+			ToolCallID: "call_1",
+			Content:    "a.txt\n```b```",
+		},
+	})
+
+	sub := New(WithTitle("Research"), WithUserMessage("Look it up"))
+	sub.ParentID = sess.ID
+	sess.AddSubSession(sub)
+
+	expected := "# Demo\n" +
+		"\n## User\n\nList files\n" +
+		"\n## Assistant (root)\n\n" +
+		"<details>\n<summary>Reasoning</summary>\n\nUse the shell.\n\n</details>\n\n" +
+		"Sure.\n" +
+		"\n**Tool call:** `shell`\n\n```json\n{\n  \"cmd\": \"ls\"\n}\n```\n" +
+		"\n## Tool result: `shell`\n\n````\na.txt\n```b```\n````\n" +
+		"\n## Sub-session: Research\n" +
+		"\n### User\n\nLook it up\n"
+
+	assert.Equal(t, expected, sess.ToMarkdown())
+}
+
+func TestToMarkdownUntitled(t *testing.T) {
+	sess := New(WithUserMessage("Hi"))
+
+	assert.Equal(t, "# Session "+sess.ID+"\n\n## User\n\nHi\n", sess.ToMarkdown())
+}
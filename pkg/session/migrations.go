@@ -42,6 +42,12 @@ func (m *MigrationManager) InitializeMigrations(ctx context.Context) error {
 		return fmt.Errorf("failed to create migrations table: %w", err)
 	}
 
+	// Refuse to touch a database migrated by a newer version: its schema may
+	// have columns this version doesn't write.
+	if err := m.checkSchemaVersion(ctx); err != nil {
+		return err
+	}
+
 	// Run all pending migrations
 	err = m.RunPendingMigrations(ctx)
 	if err != nil {
@@ -64,6 +70,29 @@ func (m *MigrationManager) createMigrationsTable(ctx context.Context) error {
 	return err
 }
 
+// checkSchemaVersion returns ErrSchemaTooNew when the database has migrations
+// applied that this version doesn't know about.
+func (m *MigrationManager) checkSchemaVersion(ctx context.Context) error {
+	var version int
+	if err := m.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM migrations").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	if supported := latestMigrationID(); version > supported {
+		return fmt.Errorf("%w: schema version %d, this version supports up to %d", ErrSchemaTooNew, version, supported)
+	}
+	return nil
+}
+
+// latestMigrationID returns the ID of the most recent known migration.
+func latestMigrationID() int {
+	var latest int
+	for _, migration := range getAllMigrations() {
+		latest = max(latest, migration.ID)
+	}
+	return latest
+}
+
 // RunPendingMigrations executes all migrations that haven't been applied yet
 func (m *MigrationManager) RunPendingMigrations(ctx context.Context) error {
 	migrations := getAllMigrations()
@@ -332,6 +361,62 @@ func getAllMigrations() []Migration {
 			Description: "Add index on session_items(session_id, item_type) to speed up session summary message counts",
 			UpSQL:       `CREATE INDEX IF NOT EXISTS idx_session_items_session_type ON session_items(session_id, item_type)`,
 		},
+		{
+			ID:          19,
+			Name:        "019_add_lifetime_cost_column",
+			Description: "Add lifetime_cost column to sessions table so cost can be reset after compaction",
+			UpSQL: `
+				ALTER TABLE sessions ADD COLUMN lifetime_cost REAL DEFAULT 0;
+				UPDATE sessions SET lifetime_cost = cost;
+			`,
+		},
+		{
+			ID:          20,
+			Name:        "020_add_commands_column",
+			Description: "Add commands column to sessions table for persisting custom session commands",
+			UpSQL:       `ALTER TABLE sessions ADD COLUMN commands TEXT DEFAULT '{}'`,
+		},
+		{
+			ID:          21,
+			Name:        "021_add_team_ref_column",
+			Description: "Add team_ref column to sessions table to record the agent configuration of a session",
+			UpSQL:       `ALTER TABLE sessions ADD COLUMN team_ref TEXT DEFAULT ''`,
+		},
+		{
+			ID:          22,
+			Name:        "022_add_raw_output_column",
+			Description: "Add raw_output column to session_items table to keep the full result of truncated tool calls",
+			UpSQL:       `ALTER TABLE session_items ADD COLUMN raw_output TEXT`,
+		},
+		{
+			ID:          23,
+			Name:        "023_add_current_agent_column",
+			Description: "Add current_agent column to sessions table to resume sessions with the agent they were left with",
+			UpSQL:       `ALTER TABLE sessions ADD COLUMN current_agent TEXT DEFAULT ''`,
+		},
+		{
+			ID:          24,
+			Name:        "024_add_attachments_table",
+			Description: "Create attachments table to keep the files attached to user messages",
+			UpSQL: `
+				CREATE TABLE IF NOT EXISTS attachments (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					item_id INTEGER NOT NULL,
+					position INTEGER NOT NULL,
+					name TEXT NOT NULL,
+					mime_type TEXT,
+					path TEXT,
+					content TEXT,
+					FOREIGN KEY (item_id) REFERENCES session_items(id) ON DELETE CASCADE
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_attachments_item ON attachments(item_id, position);
+			`,
+			DownSQL: `
+				DROP INDEX IF EXISTS idx_attachments_item;
+				DROP TABLE IF EXISTS attachments;
+			`,
+		},
 	}
 }
 
@@ -453,7 +538,7 @@ func migrateItem(ctx context.Context, db *sql.DB, sessionID string, position int
 				subSessionID, string(subMessagesJSON), item.SubSession.ToolsApproved,
 				item.SubSession.InputTokens, item.SubSession.OutputTokens, item.SubSession.Title,
 				item.SubSession.Cost, item.SubSession.SendUserMessage, item.SubSession.MaxIterations,
-				item.SubSession.WorkingDir, item.SubSession.CreatedAt.Format(time.RFC3339),
+				item.SubSession.WorkingDir, item.SubSession.CreatedAt.Format(TimestampFormat),
 				item.SubSession.Starred, "", "{}", "[]", item.SubSession.Thinking, sessionID)
 			if execErr != nil {
 				return fmt.Errorf("inserting sub-session: %w", execErr)
@@ -0,0 +1,139 @@
+package session
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// StoreEventType is the kind of change a StoreEvent reports.
+type StoreEventType string
+
+const (
+	StoreEventSessionAdded   StoreEventType = "session_added"
+	StoreEventSessionUpdated StoreEventType = "session_updated"
+	StoreEventSessionDeleted StoreEventType = "session_deleted"
+)
+
+// StoreEvent reports a change to a session of an ObservableStore.
+type StoreEvent struct {
+	Type      StoreEventType
+	SessionID string
+}
+
+// storeEventBufferSize is the capacity of a subscriber's channel.
+const storeEventBufferSize = 64
+
+// ObservableStore wraps a Store so that observers, a live session list for
+// example, can subscribe to changes instead of polling. An event is published
+// once the wrapped store has successfully applied a change: adding, updating
+// or deleting a session, or changing its items or metadata. Adding a
+// sub-session is reported as an update of its parent. UpdateMessage, which
+// only knows the message ID, and RepairOrphans aren't reported.
+type ObservableStore struct {
+	Store
+
+	mu          sync.Mutex
+	subscribers map[chan StoreEvent]struct{}
+}
+
+// NewObservableStore returns a Store that publishes its changes to the
+// subscribers registered with Subscribe.
+func NewObservableStore(store Store) *ObservableStore {
+	return &ObservableStore{
+		Store:       store,
+		subscribers: make(map[chan StoreEvent]struct{}),
+	}
+}
+
+// Subscribe returns a channel with the events published from now on and a
+// function that unsubscribes and closes the channel. A subscriber that falls
+// behind misses events rather than blocking the store, so the events are best
+// read as a hint to reload.
+func (s *ObservableStore) Subscribe() (<-chan StoreEvent, func()) {
+	ch := make(chan StoreEvent, storeEventBufferSize)
+
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subscribers, ch)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (s *ObservableStore) publish(eventType StoreEventType, sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- StoreEvent{Type: eventType, SessionID: sessionID}:
+		default:
+			slog.Warn("Session store subscriber is too slow, dropping event", "type", eventType, "session_id", sessionID)
+		}
+	}
+}
+
+// publishIfOK publishes an event if err is nil and returns err.
+func (s *ObservableStore) publishIfOK(err error, eventType StoreEventType, sessionID string) error {
+	if err == nil {
+		s.publish(eventType, sessionID)
+	}
+	return err
+}
+
+func (s *ObservableStore) AddSession(ctx context.Context, session *Session) error {
+	return s.publishIfOK(s.Store.AddSession(ctx, session), StoreEventSessionAdded, session.ID)
+}
+
+func (s *ObservableStore) UpdateSession(ctx context.Context, session *Session) error {
+	return s.publishIfOK(s.Store.UpdateSession(ctx, session), StoreEventSessionUpdated, session.ID)
+}
+
+func (s *ObservableStore) DeleteSession(ctx context.Context, id string) error {
+	return s.publishIfOK(s.Store.DeleteSession(ctx, id), StoreEventSessionDeleted, id)
+}
+
+func (s *ObservableStore) SetSessionStarred(ctx context.Context, id string, starred bool) error {
+	return s.publishIfOK(s.Store.SetSessionStarred(ctx, id, starred), StoreEventSessionUpdated, id)
+}
+
+func (s *ObservableStore) AddMessage(ctx context.Context, sessionID string, msg *Message) (int64, error) {
+	id, err := s.Store.AddMessage(ctx, sessionID, msg)
+	return id, s.publishIfOK(err, StoreEventSessionUpdated, sessionID)
+}
+
+func (s *ObservableStore) AddSubSession(ctx context.Context, parentSessionID string, subSession *Session) error {
+	return s.publishIfOK(s.Store.AddSubSession(ctx, parentSessionID, subSession), StoreEventSessionUpdated, parentSessionID)
+}
+
+func (s *ObservableStore) AddSummary(ctx context.Context, sessionID, summary string) error {
+	return s.publishIfOK(s.Store.AddSummary(ctx, sessionID, summary), StoreEventSessionUpdated, sessionID)
+}
+
+func (s *ObservableStore) UpdateItem(ctx context.Context, sessionID string, position int, item Item) error {
+	return s.publishIfOK(s.Store.UpdateItem(ctx, sessionID, position, item), StoreEventSessionUpdated, sessionID)
+}
+
+func (s *ObservableStore) UpdateItems(ctx context.Context, sessionID string, items map[int]Item) error {
+	return s.publishIfOK(s.Store.UpdateItems(ctx, sessionID, items), StoreEventSessionUpdated, sessionID)
+}
+
+func (s *ObservableStore) DeleteItemsAfter(ctx context.Context, sessionID string, position int) error {
+	return s.publishIfOK(s.Store.DeleteItemsAfter(ctx, sessionID, position), StoreEventSessionUpdated, sessionID)
+}
+
+func (s *ObservableStore) UpdateSessionTokens(ctx context.Context, sessionID string, inputTokens, outputTokens int64, cost, lifetimeCost float64) error {
+	return s.publishIfOK(s.Store.UpdateSessionTokens(ctx, sessionID, inputTokens, outputTokens, cost, lifetimeCost), StoreEventSessionUpdated, sessionID)
+}
+
+func (s *ObservableStore) UpdateSessionTitle(ctx context.Context, sessionID, title string) error {
+	return s.publishIfOK(s.Store.UpdateSessionTitle(ctx, sessionID, title), StoreEventSessionUpdated, sessionID)
+}
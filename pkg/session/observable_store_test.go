@@ -0,0 +1,58 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObservableStore(t *testing.T) {
+	store := NewObservableStore(NewInMemorySessionStore())
+	events, unsubscribe := store.Subscribe()
+
+	sess := New(WithTitle("first"))
+	require.NoError(t, store.AddSession(t.Context(), sess))
+	_, err := store.AddMessage(t.Context(), sess.ID, UserMessage("hello"))
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateSessionTitle(t.Context(), sess.ID, "renamed"))
+	require.NoError(t, store.DeleteSession(t.Context(), sess.ID))
+
+	// Failed changes aren't published.
+	require.Error(t, store.DeleteSession(t.Context(), ""))
+
+	unsubscribe()
+	unsubscribe()
+
+	var got []StoreEvent
+	for event := range events {
+		got = append(got, event)
+	}
+	assert.Equal(t, []StoreEvent{
+		{Type: StoreEventSessionAdded, SessionID: sess.ID},
+		{Type: StoreEventSessionUpdated, SessionID: sess.ID},
+		{Type: StoreEventSessionUpdated, SessionID: sess.ID},
+		{Type: StoreEventSessionDeleted, SessionID: sess.ID},
+	}, got)
+
+	// Nothing is published to a subscriber once it unsubscribed.
+	require.NoError(t, store.AddSession(t.Context(), New()))
+}
+
+func TestObservableStoreDropsEventsForSlowSubscriber(t *testing.T) {
+	store := NewObservableStore(NewInMemorySessionStore())
+	events, unsubscribe := store.Subscribe()
+
+	sess := New()
+	require.NoError(t, store.AddSession(t.Context(), sess))
+	for range storeEventBufferSize + 10 {
+		require.NoError(t, store.SetSessionStarred(t.Context(), sess.ID, true))
+	}
+	unsubscribe()
+
+	var count int
+	for range events {
+		count++
+	}
+	assert.Equal(t, storeEventBufferSize, count)
+}
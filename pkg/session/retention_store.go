@@ -0,0 +1,85 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// RetentionStore wraps a Store so that it keeps at most a given number of root
+// sessions. Once a new session is written, with AddSession or with the upsert
+// of UpdateSession, the oldest sessions beyond the limit are deleted. Starred
+// sessions are never deleted, nor is the session being written, so the store
+// can hold more sessions than the limit when enough of them are starred.
+type RetentionStore struct {
+	Store
+
+	maxSessions int
+
+	mu sync.Mutex // Serializes prunes
+}
+
+// NewRetentionStore returns a Store that keeps at most maxSessions root
+// sessions, deleting the oldest ones first. A maxSessions of zero or less
+// disables the retention.
+func NewRetentionStore(store Store, maxSessions int) *RetentionStore {
+	return &RetentionStore{
+		Store:       store,
+		maxSessions: maxSessions,
+	}
+}
+
+func (s *RetentionStore) AddSession(ctx context.Context, session *Session) error {
+	if err := s.Store.AddSession(ctx, session); err != nil {
+		return err
+	}
+
+	s.prune(ctx, session.ID)
+	return nil
+}
+
+// UpdateSession prunes the store as well, since its upsert can add a session.
+// Updates of a session that was already stored leave the store untouched as
+// long as it holds no more than maxSessions sessions.
+func (s *RetentionStore) UpdateSession(ctx context.Context, session *Session) error {
+	if err := s.Store.UpdateSession(ctx, session); err != nil {
+		return err
+	}
+
+	s.prune(ctx, session.ID)
+	return nil
+}
+
+// prune deletes the oldest non-starred root sessions, but keep, until at most
+// maxSessions remain. The session that was written is already stored, so
+// failing to prune is only logged.
+func (s *RetentionStore) prune(ctx context.Context, keep string) {
+	if s.maxSessions <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summaries, err := s.Store.GetSessionSummaries(ctx)
+	if err != nil {
+		slog.Warn("Failed to list sessions to prune", "error", err)
+		return
+	}
+
+	// Summaries are sorted newest first.
+	excess := len(summaries) - s.maxSessions
+	for i := len(summaries) - 1; i >= 0 && excess > 0; i-- {
+		summary := summaries[i]
+		if summary.Starred || summary.ID == keep {
+			continue
+		}
+		if err := s.Store.DeleteSession(ctx, summary.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			slog.Warn("Failed to prune session", "session_id", summary.ID, "error", err)
+			continue
+		}
+		slog.Debug("Pruned session", "session_id", summary.ID)
+		excess--
+	}
+}
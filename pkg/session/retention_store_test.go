@@ -0,0 +1,79 @@
+package session
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionStore(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "retention.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	for name, inner := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			store := NewRetentionStore(inner, 3)
+
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s1", CreatedAt: at(1)}))
+			require.NoError(t, store.SetSessionStarred(ctx, "s1", true))
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s2", CreatedAt: at(2)}))
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s3", CreatedAt: at(3)}))
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s4", CreatedAt: at(4)}))
+			assertSessionIDs(t, store, "s4", "s3", "s1")
+
+			// Updating a stored session doesn't delete anything.
+			require.NoError(t, store.UpdateSession(ctx, &Session{ID: "s3", Title: "renamed", CreatedAt: at(3)}))
+			assertSessionIDs(t, store, "s4", "s3", "s1")
+
+			// Sessions created with the upsert of UpdateSession count too.
+			require.NoError(t, store.UpdateSession(ctx, &Session{ID: "s5", CreatedAt: at(5)}))
+			assertSessionIDs(t, store, "s5", "s4", "s1")
+
+			// The session being written is kept, even if it's the oldest.
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s0", CreatedAt: at(0)}))
+			assertSessionIDs(t, store, "s5", "s1", "s0")
+
+			// Starred sessions are never deleted.
+			require.NoError(t, store.SetSessionStarred(ctx, "s5", true))
+			require.NoError(t, store.SetSessionStarred(ctx, "s0", true))
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s6", CreatedAt: at(6)}))
+			assertSessionIDs(t, store, "s6", "s5", "s1", "s0")
+		})
+	}
+}
+
+func TestRetentionStoreDisabled(t *testing.T) {
+	store := NewRetentionStore(NewInMemorySessionStore(), 0)
+	for _, id := range []string{"s1", "s2", "s3"} {
+		require.NoError(t, store.AddSession(t.Context(), &Session{ID: id, CreatedAt: time.Now()}))
+	}
+
+	summaries, err := store.GetSessionSummaries(t.Context())
+	require.NoError(t, err)
+	assert.Len(t, summaries, 3)
+}
+
+func assertSessionIDs(t *testing.T, store Store, expected ...string) {
+	t.Helper()
+
+	summaries, err := store.GetSessionSummaries(t.Context())
+	require.NoError(t, err)
+	var ids []string
+	for _, summary := range summaries {
+		ids = append(ids, summary.ID)
+	}
+	assert.Equal(t, expected, ids)
+}
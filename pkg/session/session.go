@@ -3,6 +3,7 @@ package session
 import (
 	"log/slog"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +23,13 @@ const (
 
 	// toolContentPlaceholder is the text used to replace truncated tool content
 	toolContentPlaceholder = "[content truncated]"
+
+	// TimestampFormat is the layout of the stored timestamps of sessions and
+	// messages: RFC 3339 with a fixed nanosecond precision, so that timestamps
+	// taken within the same second keep their order, also when compared as
+	// strings. time.RFC3339 parses it as well as older timestamps, which have
+	// no fractional seconds.
+	TimestampFormat = "2006-01-02T15:04:05.000000000Z07:00"
 )
 
 // Item represents either a message or a sub-session
@@ -50,6 +58,42 @@ func (si *Item) IsSubSession() bool {
 	return si.SubSession != nil
 }
 
+// Item types, as stored in the item_type column of the session_items table.
+const (
+	ItemTypeMessage    = "message"
+	ItemTypeSubSession = "subsession"
+	ItemTypeSummary    = "summary"
+)
+
+// Type returns the type of the item, or an empty string for an empty item.
+func (si *Item) Type() string {
+	switch {
+	case si.Message != nil:
+		return ItemTypeMessage
+	case si.SubSession != nil:
+		return ItemTypeSubSession
+	case si.Summary != "":
+		return ItemTypeSummary
+	default:
+		return ""
+	}
+}
+
+// filterItemsByType returns the items whose type is one of types.
+// All items are returned when no type is given.
+func filterItemsByType(items []Item, types []string) []Item {
+	if len(types) == 0 {
+		return items
+	}
+	var filtered []Item
+	for i := range items {
+		if slices.Contains(types, items[i].Type()) {
+			filtered = append(filtered, items[i])
+		}
+	}
+	return filtered
+}
+
 // Session represents the agent's state including conversation history and variables
 type Session struct {
 	// mu protects Messages from concurrent read/write access.
@@ -95,9 +139,13 @@ type Session struct {
 	// Starred indicates if this session has been starred by the user
 	Starred bool `json:"starred"`
 
+	// InputTokens, OutputTokens and Cost are reset by ResetUsage, e.g. after
+	// the session is compacted. LifetimeCost keeps the cost accrued over the
+	// whole life of the session.
 	InputTokens  int64   `json:"input_tokens"`
 	OutputTokens int64   `json:"output_tokens"`
 	Cost         float64 `json:"cost"`
+	LifetimeCost float64 `json:"lifetime_cost"`
 
 	// Permissions holds session-level permission overrides.
 	// When set, these are evaluated before team-level permissions.
@@ -112,6 +160,20 @@ type Session struct {
 	// These are shown in the model picker for easy re-selection.
 	CustomModelsUsed []string `json:"custom_models_used,omitempty"`
 
+	// Commands holds ad-hoc slash commands defined for this session, keyed by
+	// name, with the instruction sent to the agent as value. They are merged
+	// with, and take precedence over, the current agent's commands.
+	Commands map[string]string `json:"commands,omitempty"`
+
+	// TeamRef identifies the agent configuration the session was created
+	// with, see config.SourceRef. It lets a resumed session be matched with
+	// the configuration that produced it.
+	TeamRef string `json:"team_ref,omitempty"`
+
+	// CurrentAgent is the agent that was active when the session last ran,
+	// after any handoff. Resuming the session continues with this agent.
+	CurrentAgent string `json:"current_agent,omitempty"`
+
 	// BranchParentSessionID indicates this session was branched from another session.
 	BranchParentSessionID string `json:"branch_parent_session_id,omitempty"`
 
@@ -170,6 +232,37 @@ type Message struct {
 	// like when an agent transfers a task to another agent - new session is created with a default user message, but this shouldn't be shown to the user.
 	// Such messages should be marked as true
 	Implicit bool `json:"implicit,omitempty"`
+	// RawOutput is the full result of a tool call whose content was truncated
+	// or redacted before being sent to the model. It's kept for audit and
+	// never sent to the model.
+	RawOutput string `json:"raw_output,omitempty"`
+	// Attachments lists the files the user attached to the message, so that
+	// a resumed session can show them. They are already part of the message
+	// content sent to the model.
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file attached to a user message.
+type Attachment struct {
+	// Name is the label shown to the user (e.g. "paste-1", "main.go").
+	Name string `json:"name"`
+	// MimeType is the detected MIME type of the attachment.
+	MimeType string `json:"mime_type,omitempty"`
+	// Path is the absolute path of the attached file, empty for inline content.
+	Path string `json:"path,omitempty"`
+	// Content is the inline content of the attachment (e.g. pasted text),
+	// empty for attachments read from Path.
+	Content string `json:"content,omitempty"`
+}
+
+// IsReasoningOnly reports whether the message is an assistant message that
+// carries reasoning but neither content nor tool calls. Such messages are kept
+// for the record but never sent to a model, since providers reject them.
+func (m *Message) IsReasoningOnly() bool {
+	return m.Message.Role == chat.MessageRoleAssistant &&
+		strings.TrimSpace(m.Message.Content) == "" &&
+		len(m.Message.ToolCalls) == 0 &&
+		m.Message.ReasoningContent != ""
 }
 
 func ImplicitUserMessage(content string) *Message {
@@ -184,7 +277,7 @@ func UserMessage(content string, multiContent ...chat.MessagePart) *Message {
 			Role:         chat.MessageRoleUser,
 			Content:      content,
 			MultiContent: multiContent,
-			CreatedAt:    time.Now().Format(time.RFC3339),
+			CreatedAt:    Now().Format(TimestampFormat),
 		},
 	}
 }
@@ -201,7 +294,7 @@ func SystemMessage(content string) *Message {
 		Message: chat.Message{
 			Role:      chat.MessageRoleSystem,
 			Content:   content,
-			CreatedAt: time.Now().Format(time.RFC3339),
+			CreatedAt: Now().Format(TimestampFormat),
 		},
 	}
 }
@@ -289,6 +382,37 @@ func (s *Session) AddSubSession(subSession *Session) {
 	s.mu.Unlock()
 }
 
+// ReplaceItem replaces the item at the given position.
+func (s *Session) ReplaceItem(position int, item Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if position < 0 || position >= len(s.Messages) {
+		return ErrItemNotFound
+	}
+	s.Messages[position] = item
+	return nil
+}
+
+// MessageAt returns the message at the given position, or nil if there's no
+// message there.
+func (s *Session) MessageAt(position int) *Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if position < 0 || position >= len(s.Messages) {
+		return nil
+	}
+	return s.Messages[position].Message
+}
+
+// TruncateAfter removes all items after the given position.
+func (s *Session) TruncateAfter(position int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if position+1 < len(s.Messages) {
+		s.Messages = s.Messages[:max(position+1, 0)]
+	}
+}
+
 // Duration calculates the duration of the session from message timestamps.
 func (s *Session) Duration() time.Duration {
 	messages := s.GetAllMessages()
@@ -317,6 +441,22 @@ func (s *Session) AllowedDirectories() []string {
 	return []string{s.WorkingDir}
 }
 
+// Items returns a snapshot of the items of the session, taken under its lock.
+// Messages are deep copies; sub-sessions are shared.
+func (s *Session) Items() []Item {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]Item, len(s.Messages))
+	for i, item := range s.Messages {
+		if item.Message != nil {
+			item.Message = deepCopyMessage(item.Message)
+		}
+		items[i] = item
+	}
+	return items
+}
+
 // GetAllMessages extracts all messages from the session, including from sub-sessions
 func (s *Session) GetAllMessages() []Message {
 	s.mu.RLock()
@@ -429,6 +569,13 @@ func WithWorkingDir(workingDir string) Opt {
 	}
 }
 
+// WithTeamRef records the agent configuration the session is created with.
+func WithTeamRef(teamRef string) Opt {
+	return func(s *Session) {
+		s.TeamRef = teamRef
+	}
+}
+
 func WithTitle(title string) Opt {
 	return func(s *Session) {
 		s.Title = title
@@ -487,6 +634,28 @@ func (s *Session) IsSubSession() bool {
 	return s.ParentID != ""
 }
 
+// SummaryItem is a summary left by a compaction of a session, along with its
+// position in the session items.
+type SummaryItem struct {
+	Position int
+	Text     string
+}
+
+// Summaries returns the summaries of the session, one per compaction, in
+// order.
+func (s *Session) Summaries() []SummaryItem {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var summaries []SummaryItem
+	for i, item := range s.Messages {
+		if item.Type() == ItemTypeSummary {
+			summaries = append(summaries, SummaryItem{Position: i, Text: item.Summary})
+		}
+	}
+	return summaries
+}
+
 // MessageCount returns the number of items that contain a message.
 func (s *Session) MessageCount() int {
 	s.mu.RLock()
@@ -501,6 +670,54 @@ func (s *Session) MessageCount() int {
 	return n
 }
 
+// AddCost adds cost to both the resettable Cost and the LifetimeCost.
+func (s *Session) AddCost(cost float64) {
+	s.Cost += cost
+	s.LifetimeCost += cost
+}
+
+// ResetUsage resets the token counters and Cost, e.g. after compaction, so
+// they only reflect usage from that point on. LifetimeCost is kept.
+func (s *Session) ResetUsage() {
+	s.InputTokens = 0
+	s.OutputTokens = 0
+	s.Cost = 0
+}
+
+// HasVisibleMessages reports whether the session contains at least one
+// message that is not implicit.
+func (s *Session) HasVisibleMessages() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, item := range s.Messages {
+		if item.IsMessage() && !item.Message.Implicit {
+			return true
+		}
+	}
+	return false
+}
+
+// ShouldEchoLastUserMessage reports whether the last message of the session
+// should be echoed back to the user as a UserMessage event when a run starts.
+// That is only the case when SendUserMessage is set and the last message is
+// a user message that is not implicit, such as the kickoff message of a
+// transferred task.
+func (s *Session) ShouldEchoLastUserMessage() bool {
+	if !s.SendUserMessage {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.Messages) == 0 {
+		return false
+	}
+	last := s.Messages[len(s.Messages)-1]
+	return last.IsMessage() && last.Message.Message.Role == chat.MessageRoleUser && !last.Message.Implicit
+}
+
 // TotalCost computes the total cost of a session by walking all messages,
 // sub-sessions, and summary items. It does not use the session-level Cost
 // field, which exists only for backward-compatible persistence.
@@ -546,7 +763,7 @@ func New(opts ...Opt) *Session {
 
 	s := &Session{
 		ID:              sessionID,
-		CreatedAt:       time.Now(),
+		CreatedAt:       Now(),
 		SendUserMessage: true,
 		Thinking:        false,
 	}
@@ -656,7 +873,7 @@ func buildContextSpecificSystemMessages(a *agent.Agent, s *Session) []chat.Messa
 	if a.AddDate() {
 		messages = append(messages, chat.Message{
 			Role:    chat.MessageRoleSystem,
-			Content: "Today's date: " + time.Now().Format("2006-01-02"),
+			Content: "Today's date: " + Now().Format("2006-01-02"),
 		})
 	}
 
@@ -715,23 +932,32 @@ func buildSessionSummaryMessages(items []Item) ([]chat.Message, int) {
 		messages = append(messages, chat.Message{
 			Role:      chat.MessageRoleUser,
 			Content:   "Session Summary: " + items[lastSummaryIndex].Summary,
-			CreatedAt: time.Now().Format(time.RFC3339),
+			CreatedAt: Now().Format(TimestampFormat),
 		})
 	}
 
 	return messages, lastSummaryIndex
 }
 
+// SystemPrompt returns the system messages the agent starts its conversation
+// in the session with: its instructions and the context the session adds.
+func (s *Session) SystemPrompt(a *agent.Agent) []chat.Message {
+	return append(buildInvariantSystemMessages(a), buildContextSpecificSystemMessages(a, s)...)
+}
+
 func (s *Session) GetMessages(a *agent.Agent) []chat.Message {
 	slog.Debug("Getting messages for agent", "agent", a.Name(), "session_id", s.ID)
 
 	// Build invariant system messages (cacheable across sessions/users/projects)
 	invariantMessages := buildInvariantSystemMessages(a)
-	markLastMessageAsCacheControl(invariantMessages)
 
 	// Build context-specific system messages (vary per user/project/time)
 	contextMessages := buildContextSpecificSystemMessages(a, s)
-	markLastMessageAsCacheControl(contextMessages)
+
+	if a.PromptCaching() {
+		markLastMessageAsCacheControl(invariantMessages)
+		markLastMessageAsCacheControl(contextMessages)
+	}
 
 	// Take a snapshot of Messages under the lock, copying Message structs
 	// to avoid racing with UpdateMessage which may modify the pointed-to objects.
@@ -759,7 +985,7 @@ func (s *Session) GetMessages(a *agent.Agent) []chat.Message {
 	// Begin adding conversation messages
 	for i := startIndex; i < len(items); i++ {
 		item := items[i]
-		if item.IsMessage() {
+		if item.IsMessage() && !item.Message.IsReasoningOnly() {
 			messages = append(messages, item.Message.Message)
 		}
 	}
@@ -185,6 +185,21 @@ func TestGetMessages_CacheControl(t *testing.T) {
 	assert.True(t, messages[1].CacheControl)
 }
 
+func TestGetMessages_PromptCachingDisabled(t *testing.T) {
+	testAgent := agent.New("root", "instructions",
+		agent.WithToolSets(&builtin.TodoTool{}),
+		agent.WithAddDate(true),
+		agent.WithPromptCaching(false),
+	)
+
+	messages := New(WithUserMessage("hello")).GetMessages(testAgent)
+
+	require.NotEmpty(t, messages)
+	for _, msg := range messages {
+		assert.False(t, msg.CacheControl, "unexpected cache checkpoint on %q", msg.Content)
+	}
+}
+
 func TestGetMessages_CacheControlWithSummary(t *testing.T) {
 	// Create agent with invariant, context-specific, and session summary
 	testAgent := agent.New("root", "instructions",
@@ -332,3 +347,57 @@ func TestTransferTaskPromptExcludesParents(t *testing.T) {
 	assert.Contains(t, subAgentMsg, "librarian", "should list librarian as a valid sub-agent")
 	assert.NotContains(t, subAgentMsg, "planner", "should NOT list parent agent planner as a valid transfer target")
 }
+
+func TestShouldEchoLastUserMessage(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name     string
+		sess     *Session
+		expected bool
+	}{
+		{
+			name:     "explicit user message",
+			sess:     New(WithUserMessage("Hi")),
+			expected: true,
+		},
+		{
+			name:     "implicit user message",
+			sess:     New(WithImplicitUserMessage("Kickoff")),
+			expected: false,
+		},
+		{
+			name: "transferred task",
+			sess: New(
+				WithUserMessage("Original request"),
+				WithImplicitUserMessage("Please take over the task"),
+				WithSendUserMessage(false),
+			),
+			expected: false,
+		},
+		{
+			name:     "echo disabled",
+			sess:     New(WithUserMessage("Hi"), WithSendUserMessage(false)),
+			expected: false,
+		},
+		{
+			name: "last message is not from the user",
+			sess: func() *Session {
+				s := New(WithUserMessage("Hi"))
+				s.AddMessage(&Message{Message: chat.Message{Role: chat.MessageRoleAssistant, Content: "Hello"}})
+				return s
+			}(),
+			expected: false,
+		},
+		{
+			name:     "empty session",
+			sess:     New(),
+			expected: false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.expected, tt.sess.ShouldEchoLastUserMessage())
+		})
+	}
+}
@@ -1,13 +1,17 @@
 package session
 
 import (
+	"cmp"
 	"context"
+	"crypto/cipher"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -21,6 +25,12 @@ import (
 var (
 	ErrEmptyID  = errors.New("session ID cannot be empty")
 	ErrNotFound = errors.New("session not found")
+
+	ErrItemNotFound = errors.New("session item not found")
+
+	// ErrSchemaTooNew is returned when opening a session database that was
+	// migrated by a newer version of cagent.
+	ErrSchemaTooNew = errors.New("session database was created by a newer version of cagent")
 )
 
 // parseRelativeSessionRef checks if ref is a relative session reference (e.g., "-1", "-2")
@@ -71,17 +81,66 @@ type Summary struct {
 	CreatedAt             time.Time
 	Starred               bool
 	BranchParentSessionID string
+	WorkingDir            string
 	NumMessages           int
 }
 
+// NoWorkingDir is the key under which GetSessionsGroupedByWorkingDir groups
+// sessions that don't have a working directory.
+const NoWorkingDir = "(none)"
+
+// groupByWorkingDir buckets summaries by working directory, keeping their order.
+func groupByWorkingDir(summaries []Summary) map[string][]Summary {
+	groups := make(map[string][]Summary)
+	for _, summary := range summaries {
+		key := cmp.Or(summary.WorkingDir, NoWorkingDir)
+		groups[key] = append(groups[key], summary)
+	}
+	return groups
+}
+
+// ModelStat aggregates the usage of a model across all stored sessions.
+type ModelStat struct {
+	Model        string
+	Messages     int
+	InputTokens  int64
+	OutputTokens int64
+	Cost         float64
+}
+
+// UsageRow is the usage of a root session, its sub-sessions included.
+type UsageRow struct {
+	SessionID    string
+	Title        string
+	CreatedAt    time.Time
+	Models       []string // Models that generated the assistant messages, sorted
+	InputTokens  int64
+	OutputTokens int64
+	Cost         float64
+}
+
 // Store defines the interface for session storage
 type Store interface {
 	// === Core session operations ===
 	AddSession(ctx context.Context, session *Session) error
 	GetSession(ctx context.Context, id string) (*Session, error)
 	GetSessions(ctx context.Context) ([]*Session, error)
+	// GetSessionsByIDs loads the sessions with the given IDs in a single
+	// metadata query. IDs that don't exist are absent from the result.
+	GetSessionsByIDs(ctx context.Context, ids []string) (map[string]*Session, error)
 	GetSessionSummaries(ctx context.Context) ([]Summary, error)
+	// GetSessionsGroupedByWorkingDir returns the session summaries keyed by
+	// working directory, newest first. Sessions without a working directory
+	// are grouped under NoWorkingDir.
+	GetSessionsGroupedByWorkingDir(ctx context.Context) (map[string][]Summary, error)
 	DeleteSession(ctx context.Context, id string) error
+	// FindOrphanedSessions returns the IDs of sub-sessions whose parent
+	// session no longer exists.
+	FindOrphanedSessions(ctx context.Context) ([]string, error)
+	// RepairOrphans promotes orphaned sub-sessions to root sessions, or
+	// deletes them along with their own sub-sessions, and returns how many
+	// orphans were repaired.
+	RepairOrphans(ctx context.Context, promoteToRoot bool) (int, error)
 	UpdateSession(ctx context.Context, session *Session) error // Updates metadata only (not messages/items)
 	SetSessionStarred(ctx context.Context, id string, starred bool) error
 
@@ -102,10 +161,50 @@ type Store interface {
 	// AddSummary adds a summary item to a session at the next position
 	AddSummary(ctx context.Context, sessionID, summary string) error
 
+	// GetItemsByType returns the items of a session whose type is one of
+	// types (see ItemTypeMessage, ItemTypeSubSession and ItemTypeSummary),
+	// in order. All items are returned when no type is given.
+	GetItemsByType(ctx context.Context, sessionID string, types ...string) ([]Item, error)
+
+	// GetSummaries returns the summaries of a session, one per compaction,
+	// with their positions, in order.
+	GetSummaries(ctx context.Context, sessionID string) ([]SummaryItem, error)
+
+	// UpdateItem replaces the item at the given position of a session.
+	UpdateItem(ctx context.Context, sessionID string, position int, item Item) error
+
+	// UpdateItems replaces the items of a session at the positions they're
+	// keyed by, all at once: if one of the positions doesn't exist, no item
+	// is replaced.
+	UpdateItems(ctx context.Context, sessionID string, items map[int]Item) error
+
+	// DeleteItemsAfter removes all items after the given position of a session,
+	// along with the sub-sessions they reference.
+	DeleteItemsAfter(ctx context.Context, sessionID string, position int) error
+
+	// RewriteItem replaces the item at the given position of a session and
+	// removes all items after it, all at once: either both happen or none.
+	RewriteItem(ctx context.Context, sessionID string, position int, item Item) error
+
+	// ModelUsageStats aggregates assistant messages of all sessions, including
+	// sub-sessions, by the model that generated them. Stats are sorted by
+	// decreasing number of messages.
+	ModelUsageStats(ctx context.Context) ([]ModelStat, error)
+
+	// UsageRows sums up the usage and cost of the messages of each root
+	// session, including those of its sub-sessions, newest session first.
+	UsageRows(ctx context.Context) ([]UsageRow, error)
+
+	// FindSessionsUsingTool returns the IDs of the root sessions in which
+	// the named tool was called, directly or in one of their sub-sessions,
+	// newest session first. When argSubstring isn't empty, only the calls
+	// whose arguments contain it count.
+	FindSessionsUsingTool(ctx context.Context, toolName, argSubstring string) ([]string, error)
+
 	// === Granular metadata updates ===
 
 	// UpdateSessionTokens updates only token/cost fields
-	UpdateSessionTokens(ctx context.Context, sessionID string, inputTokens, outputTokens int64, cost float64) error
+	UpdateSessionTokens(ctx context.Context, sessionID string, inputTokens, outputTokens int64, cost, lifetimeCost float64) error
 
 	// UpdateSessionTitle updates only the title
 	UpdateSessionTitle(ctx context.Context, sessionID, title string) error
@@ -150,6 +249,25 @@ func (s *InMemorySessionStore) GetSessions(_ context.Context) ([]*Session, error
 		sessions = append(sessions, value)
 		return true
 	})
+	slices.SortFunc(sessions, func(a, b *Session) int {
+		return newestFirst(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+	return sessions, nil
+}
+
+// newestFirst orders sessions like the SQLite store does: newest first, and
+// by ID when they were created at the same time.
+func newestFirst(aCreatedAt time.Time, aID string, bCreatedAt time.Time, bID string) int {
+	return cmp.Or(bCreatedAt.Compare(aCreatedAt), cmp.Compare(aID, bID))
+}
+
+func (s *InMemorySessionStore) GetSessionsByIDs(_ context.Context, ids []string) (map[string]*Session, error) {
+	sessions := make(map[string]*Session, len(ids))
+	for _, id := range ids {
+		if session, exists := s.sessions.Load(id); exists {
+			sessions[id] = session
+		}
+	}
 	return sessions, nil
 }
 
@@ -165,16 +283,25 @@ func (s *InMemorySessionStore) GetSessionSummaries(_ context.Context) ([]Summary
 			CreatedAt:             value.CreatedAt,
 			Starred:               value.Starred,
 			BranchParentSessionID: value.BranchParentSessionID,
+			WorkingDir:            value.WorkingDir,
 			NumMessages:           value.MessageCount(),
 		})
 		return true
 	})
-	sort.Slice(summaries, func(i, j int) bool {
-		return summaries[i].CreatedAt.After(summaries[j].CreatedAt)
+	slices.SortFunc(summaries, func(a, b Summary) int {
+		return newestFirst(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
 	})
 	return summaries, nil
 }
 
+func (s *InMemorySessionStore) GetSessionsGroupedByWorkingDir(ctx context.Context) (map[string][]Summary, error) {
+	summaries, err := s.GetSessionSummaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return groupByWorkingDir(summaries), nil
+}
+
 func (s *InMemorySessionStore) DeleteSession(_ context.Context, id string) error {
 	if id == "" {
 		return ErrEmptyID
@@ -187,6 +314,53 @@ func (s *InMemorySessionStore) DeleteSession(_ context.Context, id string) error
 	return nil
 }
 
+func (s *InMemorySessionStore) FindOrphanedSessions(_ context.Context) ([]string, error) {
+	var orphans []string
+	s.sessions.Range(func(id string, value *Session) bool {
+		if value.ParentID != "" {
+			if _, exists := s.sessions.Load(value.ParentID); !exists {
+				orphans = append(orphans, id)
+			}
+		}
+		return true
+	})
+	slices.Sort(orphans)
+	return orphans, nil
+}
+
+func (s *InMemorySessionStore) RepairOrphans(ctx context.Context, promoteToRoot bool) (int, error) {
+	orphans, err := s.FindOrphanedSessions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range orphans {
+		if promoteToRoot {
+			if session, exists := s.sessions.Load(id); exists {
+				session.ParentID = ""
+			}
+		} else {
+			s.deleteWithSubSessions(id)
+		}
+	}
+	return len(orphans), nil
+}
+
+// deleteWithSubSessions deletes a session and, recursively, its sub-sessions.
+func (s *InMemorySessionStore) deleteWithSubSessions(id string) {
+	var children []string
+	s.sessions.Range(func(childID string, value *Session) bool {
+		if value.ParentID == id {
+			children = append(children, childID)
+		}
+		return true
+	})
+	for _, childID := range children {
+		s.deleteWithSubSessions(childID)
+	}
+	s.sessions.Delete(id)
+}
+
 // UpdateSession updates an existing session, or creates it if it doesn't exist (upsert).
 // This enables lazy session persistence - sessions are only stored when they have content.
 // Note: Like SQLite, this only stores metadata. Messages are stored separately via AddMessage.
@@ -213,9 +387,13 @@ func (s *InMemorySessionStore) UpdateSession(_ context.Context, session *Session
 		InputTokens:           session.InputTokens,
 		OutputTokens:          session.OutputTokens,
 		Cost:                  session.Cost,
+		LifetimeCost:          session.LifetimeCost,
 		Permissions:           session.Permissions,
 		AgentModelOverrides:   session.AgentModelOverrides,
 		CustomModelsUsed:      session.CustomModelsUsed,
+		Commands:              session.Commands,
+		TeamRef:               session.TeamRef,
+		CurrentAgent:          session.CurrentAgent,
 		BranchParentSessionID: session.BranchParentSessionID,
 		BranchParentPosition:  session.BranchParentPosition,
 		BranchCreatedAt:       session.BranchCreatedAt,
@@ -323,6 +501,230 @@ func (s *InMemorySessionStore) AddSummary(_ context.Context, sessionID, summary
 	return nil
 }
 
+// GetItemsByType returns the items of a session whose type is one of types.
+func (s *InMemorySessionStore) GetItemsByType(_ context.Context, sessionID string, types ...string) ([]Item, error) {
+	if sessionID == "" {
+		return nil, ErrEmptyID
+	}
+	session, exists := s.sessions.Load(sessionID)
+	if !exists {
+		return nil, ErrNotFound
+	}
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+	return slices.Clone(filterItemsByType(session.Messages, types)), nil
+}
+
+// GetSummaries returns the summaries of a session with their positions.
+func (s *InMemorySessionStore) GetSummaries(_ context.Context, sessionID string) ([]SummaryItem, error) {
+	if sessionID == "" {
+		return nil, ErrEmptyID
+	}
+	session, exists := s.sessions.Load(sessionID)
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return session.Summaries(), nil
+}
+
+// UpdateItem replaces the item at the given position of a session.
+func (s *InMemorySessionStore) UpdateItem(ctx context.Context, sessionID string, position int, item Item) error {
+	return s.UpdateItems(ctx, sessionID, map[int]Item{position: item})
+}
+
+// UpdateItems replaces the items at the given positions of a session, all at
+// once.
+func (s *InMemorySessionStore) UpdateItems(_ context.Context, sessionID string, items map[int]Item) error {
+	if sessionID == "" {
+		return ErrEmptyID
+	}
+	session, exists := s.sessions.Load(sessionID)
+	if !exists {
+		return ErrNotFound
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	for position := range items {
+		if position < 0 || position >= len(session.Messages) {
+			return ErrItemNotFound
+		}
+	}
+	for position, item := range items {
+		if item.Message != nil && item.Message.ID == 0 {
+			s.messageID++
+			item.Message.ID = s.messageID
+		}
+		session.Messages[position] = item
+	}
+	return nil
+}
+
+// RewriteItem replaces the item at the given position of a session and
+// removes all items after it. DeleteItemsAfter can't fail once the item is
+// replaced, so either both happen or none.
+func (s *InMemorySessionStore) RewriteItem(ctx context.Context, sessionID string, position int, item Item) error {
+	if err := s.UpdateItem(ctx, sessionID, position, item); err != nil {
+		return err
+	}
+	return s.DeleteItemsAfter(ctx, sessionID, position)
+}
+
+// DeleteItemsAfter removes all items after the given position of a session.
+func (s *InMemorySessionStore) DeleteItemsAfter(_ context.Context, sessionID string, position int) error {
+	if sessionID == "" {
+		return ErrEmptyID
+	}
+	session, exists := s.sessions.Load(sessionID)
+	if !exists {
+		return ErrNotFound
+	}
+	session.mu.RLock()
+	var removed []*Session
+	for i := position + 1; i < len(session.Messages); i++ {
+		if sub := session.Messages[i].SubSession; sub != nil {
+			removed = append(removed, sub)
+		}
+	}
+	session.mu.RUnlock()
+
+	session.TruncateAfter(position)
+	for _, sub := range removed {
+		s.sessions.Delete(sub.ID)
+	}
+	return nil
+}
+
+// ModelUsageStats aggregates assistant messages of all sessions by model.
+func (s *InMemorySessionStore) ModelUsageStats(_ context.Context) ([]ModelStat, error) {
+	byModel := map[string]*ModelStat{}
+	s.sessions.Range(func(_ string, session *Session) bool {
+		// Sub-sessions are stored on their own, so only look at direct messages.
+		session.mu.RLock()
+		defer session.mu.RUnlock()
+		for _, item := range session.Messages {
+			if item.Message == nil || item.Message.Message.Model == "" {
+				continue
+			}
+			msg := &item.Message.Message
+			stat, ok := byModel[msg.Model]
+			if !ok {
+				stat = &ModelStat{Model: msg.Model}
+				byModel[msg.Model] = stat
+			}
+			stat.Messages++
+			stat.Cost += msg.Cost
+			if msg.Usage != nil {
+				stat.InputTokens += msg.Usage.InputTokens
+				stat.OutputTokens += msg.Usage.OutputTokens
+			}
+		}
+		return true
+	})
+
+	stats := make([]ModelStat, 0, len(byModel))
+	for _, stat := range byModel {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Messages != stats[j].Messages {
+			return stats[i].Messages > stats[j].Messages
+		}
+		return stats[i].Model < stats[j].Model
+	})
+	return stats, nil
+}
+
+// UsageRows sums up the usage and cost of the messages of each root session.
+func (s *InMemorySessionStore) UsageRows(_ context.Context) ([]UsageRow, error) {
+	var rows []UsageRow
+	s.sessions.Range(func(_ string, session *Session) bool {
+		if session.ParentID != "" {
+			return true
+		}
+		row := UsageRow{
+			SessionID: session.ID,
+			Title:     session.Title,
+			CreatedAt: session.CreatedAt,
+		}
+		models := map[string]bool{}
+		addUsage(&row, models, session)
+		row.Models = slices.Sorted(maps.Keys(models))
+		rows = append(rows, row)
+		return true
+	})
+	slices.SortFunc(rows, func(a, b UsageRow) int {
+		return newestFirst(a.CreatedAt, a.SessionID, b.CreatedAt, b.SessionID)
+	})
+	return rows, nil
+}
+
+// FindSessionsUsingTool returns the root sessions in which the named tool
+// was called with arguments containing argSubstring.
+func (s *InMemorySessionStore) FindSessionsUsingTool(_ context.Context, toolName, argSubstring string) ([]string, error) {
+	var roots []*Session
+	s.sessions.Range(func(_ string, session *Session) bool {
+		if session.ParentID == "" && usesTool(session, toolName, argSubstring) {
+			roots = append(roots, session)
+		}
+		return true
+	})
+	slices.SortFunc(roots, func(a, b *Session) int {
+		return newestFirst(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+
+	ids := make([]string, len(roots))
+	for i, session := range roots {
+		ids[i] = session.ID
+	}
+	return ids, nil
+}
+
+// usesTool reports whether the named tool was called with arguments
+// containing argSubstring in session or in one of its sub-sessions.
+func usesTool(session *Session, toolName, argSubstring string) bool {
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+	for _, item := range session.Messages {
+		switch {
+		case item.IsMessage():
+			for _, call := range item.Message.Message.ToolCalls {
+				if call.Function.Name == toolName && strings.Contains(call.Function.Arguments, argSubstring) {
+					return true
+				}
+			}
+		case item.IsSubSession():
+			if usesTool(item.SubSession, toolName, argSubstring) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addUsage adds the usage and cost of the messages of session and of its
+// sub-sessions to row, and collects the models that generated them.
+func addUsage(row *UsageRow, models map[string]bool, session *Session) {
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+	for _, item := range session.Messages {
+		switch {
+		case item.IsMessage():
+			msg := &item.Message.Message
+			if msg.Model != "" {
+				models[msg.Model] = true
+			}
+			row.Cost += msg.Cost
+			if msg.Usage != nil {
+				row.InputTokens += msg.Usage.InputTokens
+				row.OutputTokens += msg.Usage.OutputTokens
+			}
+		case item.IsSubSession():
+			addUsage(row, models, item.SubSession)
+		}
+	}
+}
+
 // querier is an interface that abstracts *sql.DB and *sql.Tx for query operations.
 type querier interface {
 	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
@@ -332,7 +734,18 @@ type querier interface {
 
 // SQLiteSessionStore implements Store using SQLite
 type SQLiteSessionStore struct {
-	db *sql.DB
+	db            *sql.DB
+	encryptionKey []byte
+	aead          cipher.AEAD // Encrypts message content, nil when the store isn't encrypted
+}
+
+// DB returns the database the store reads and writes, for custom queries
+// such as analytics over the stored sessions. Use it at your own risk: the
+// schema is internal and changes with migrations, and writing through the
+// database bypasses the store's invariants, for example keeping the legacy
+// messages column in sync with session_items. Stick to read-only queries.
+func (s *SQLiteSessionStore) DB() *sql.DB {
+	return s.db
 }
 
 // syncMessagesColumn rebuilds the messages JSON column from session_items for backward compatibility.
@@ -348,6 +761,12 @@ func (s *SQLiteSessionStore) syncMessagesColumnTx(ctx context.Context, tx *sql.T
 
 // syncMessagesColumnWith rebuilds the messages JSON column using the provided querier.
 func (s *SQLiteSessionStore) syncMessagesColumnWith(ctx context.Context, q querier, sessionID string) error {
+	if s.aead != nil {
+		// Don't leak the encrypted content in clear.
+		_, err := q.ExecContext(ctx, "UPDATE sessions SET messages = NULL WHERE id = ?", sessionID)
+		return err
+	}
+
 	items, err := s.loadSessionItemsWith(ctx, q, sessionID)
 	if err != nil {
 		return fmt.Errorf("loading session items: %w", err)
@@ -363,7 +782,7 @@ func (s *SQLiteSessionStore) syncMessagesColumnWith(ctx context.Context, q queri
 }
 
 // UpdateSessionTokens updates only token/cost fields.
-func (s *InMemorySessionStore) UpdateSessionTokens(_ context.Context, sessionID string, inputTokens, outputTokens int64, cost float64) error {
+func (s *InMemorySessionStore) UpdateSessionTokens(_ context.Context, sessionID string, inputTokens, outputTokens int64, cost, lifetimeCost float64) error {
 	if sessionID == "" {
 		return ErrEmptyID
 	}
@@ -374,6 +793,7 @@ func (s *InMemorySessionStore) UpdateSessionTokens(_ context.Context, sessionID
 	session.InputTokens = inputTokens
 	session.OutputTokens = outputTokens
 	session.Cost = cost
+	session.LifetimeCost = lifetimeCost
 	return nil
 }
 
@@ -396,8 +816,12 @@ func (s *InMemorySessionStore) Close() error {
 }
 
 // NewSQLiteSessionStore creates a new SQLite session store
-func NewSQLiteSessionStore(path string) (Store, error) {
+func NewSQLiteSessionStore(path string, opts ...SQLiteStoreOpt) (Store, error) {
 	store, err := openAndMigrateSQLiteStore(path)
+	if errors.Is(err, ErrSchemaTooNew) {
+		// Don't reset a database that a newer version can still use.
+		return nil, err
+	}
 	if err != nil {
 		// If migrations failed, try to recover by backing up the database and starting fresh
 		slog.Warn("Failed to open session store, attempting recovery", "error", err)
@@ -418,6 +842,16 @@ func NewSQLiteSessionStore(path string) (Store, error) {
 		slog.Info("Successfully recovered session store with fresh database")
 	}
 
+	for _, opt := range opts {
+		opt(store)
+	}
+	if store.encryptionKey != nil {
+		if store.aead, err = newAEAD(store.encryptionKey); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+
 	return store, nil
 }
 
@@ -522,6 +956,11 @@ func (s *SQLiteSessionStore) AddSession(ctx context.Context, session *Session) e
 		customModelsUsedJSON = string(customBytes)
 	}
 
+	commandsJSON, err := marshalCommands(session.Commands)
+	if err != nil {
+		return err
+	}
+
 	// Use NULL for empty parent_id to avoid foreign key constraint issues
 	var parentID any
 	if session.ParentID != "" {
@@ -537,7 +976,7 @@ func (s *SQLiteSessionStore) AddSession(ctx context.Context, session *Session) e
 	}
 	var branchCreatedAt any
 	if session.BranchCreatedAt != nil {
-		branchCreatedAt = session.BranchCreatedAt.Format(time.RFC3339)
+		branchCreatedAt = session.BranchCreatedAt.Format(TimestampFormat)
 	}
 
 	// Use a transaction to insert session and its items
@@ -552,12 +991,13 @@ func (s *SQLiteSessionStore) AddSession(ctx context.Context, session *Session) e
 			id, tools_approved, input_tokens, output_tokens, title, cost, send_user_message,
 			max_iterations, working_dir, created_at, permissions, agent_model_overrides,
 			custom_models_used, thinking, parent_id, branch_parent_session_id,
-			branch_parent_position, branch_created_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			branch_parent_position, branch_created_at, lifetime_cost, commands, team_ref, current_agent
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		session.ID, session.ToolsApproved, session.InputTokens, session.OutputTokens, session.Title,
 		session.Cost, session.SendUserMessage, session.MaxIterations, session.WorkingDir,
-		session.CreatedAt.Format(time.RFC3339), permissionsJSON, agentModelOverridesJSON,
-		customModelsUsedJSON, session.Thinking, parentID, branchParentID, branchParentPosition, branchCreatedAt)
+		session.CreatedAt.Format(TimestampFormat), permissionsJSON, agentModelOverridesJSON,
+		customModelsUsedJSON, session.Thinking, parentID, branchParentID, branchParentPosition, branchCreatedAt,
+		session.LifetimeCost, commandsJSON, session.TeamRef, session.CurrentAgent)
 	if err != nil {
 		return err
 	}
@@ -572,6 +1012,18 @@ func (s *SQLiteSessionStore) AddSession(ctx context.Context, session *Session) e
 	return tx.Commit()
 }
 
+// marshalCommands marshals session commands, defaulting to an empty object.
+func marshalCommands(commands map[string]string) (string, error) {
+	if len(commands) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(commands)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
 // scanSession scans a single row into a Session struct
 // Note: Messages are loaded separately from session_items table
 func scanSession(scanner interface {
@@ -587,8 +1039,12 @@ func scanSession(scanner interface {
 	var branchParentPosition sql.NullInt64
 	var branchCreatedAt sql.NullString
 	var splitDiffView sql.NullBool // column kept for backward compat, value ignored
+	var lifetimeCost sql.NullFloat64
+	var commandsJSON sql.NullString
+	var teamRef sql.NullString
+	var currentAgent sql.NullString
 
-	err := scanner.Scan(&sessionID, &toolsApprovedStr, &inputTokensStr, &outputTokensStr, &titleStr, &costStr, &sendUserMessageStr, &maxIterationsStr, &workingDir, &createdAtStr, &starredStr, &permissionsJSON, &agentModelOverridesJSON, &customModelsUsedJSON, &thinkingStr, &parentID, &branchParentID, &branchParentPosition, &branchCreatedAt, &splitDiffView)
+	err := scanner.Scan(&sessionID, &toolsApprovedStr, &inputTokensStr, &outputTokensStr, &titleStr, &costStr, &sendUserMessageStr, &maxIterationsStr, &workingDir, &createdAtStr, &starredStr, &permissionsJSON, &agentModelOverridesJSON, &customModelsUsedJSON, &thinkingStr, &parentID, &branchParentID, &branchParentPosition, &branchCreatedAt, &splitDiffView, &lifetimeCost, &commandsJSON, &teamRef, &currentAgent)
 	if err != nil {
 		return nil, err
 	}
@@ -663,6 +1119,14 @@ func scanSession(scanner interface {
 		}
 	}
 
+	// Parse custom commands (may be NULL, empty or "{}")
+	var commands map[string]string
+	if commandsJSON.Valid && commandsJSON.String != "" && commandsJSON.String != "{}" {
+		if err := json.Unmarshal([]byte(commandsJSON.String), &commands); err != nil {
+			return nil, err
+		}
+	}
+
 	var branchParentPositionPtr *int
 	if branchParentPosition.Valid {
 		pos := int(branchParentPosition.Int64)
@@ -687,6 +1151,7 @@ func scanSession(scanner interface {
 		InputTokens:           inputTokens,
 		OutputTokens:          outputTokens,
 		Cost:                  cost,
+		LifetimeCost:          lifetimeCost.Float64,
 		SendUserMessage:       sendUserMessage,
 		MaxIterations:         maxIterations,
 		CreatedAt:             createdAt,
@@ -695,6 +1160,9 @@ func scanSession(scanner interface {
 		Permissions:           permissions,
 		AgentModelOverrides:   agentModelOverrides,
 		CustomModelsUsed:      customModelsUsed,
+		Commands:              commands,
+		TeamRef:               teamRef.String,
+		CurrentAgent:          currentAgent.String,
 		BranchParentSessionID: branchParentID.String,
 		BranchParentPosition:  branchParentPositionPtr,
 		BranchCreatedAt:       branchCreatedAtPtr,
@@ -709,7 +1177,7 @@ func (s *SQLiteSessionStore) GetSession(ctx context.Context, id string) (*Sessio
 	}
 
 	row := s.db.QueryRowContext(ctx,
-		"SELECT id, tools_approved, input_tokens, output_tokens, title, cost, send_user_message, max_iterations, working_dir, created_at, starred, permissions, agent_model_overrides, custom_models_used, thinking, parent_id, branch_parent_session_id, branch_parent_position, branch_created_at, split_diff_view FROM sessions WHERE id = ?", id)
+		"SELECT id, tools_approved, input_tokens, output_tokens, title, cost, send_user_message, max_iterations, working_dir, created_at, starred, permissions, agent_model_overrides, custom_models_used, thinking, parent_id, branch_parent_session_id, branch_parent_position, branch_created_at, split_diff_view, lifetime_cost, commands, team_ref, current_agent FROM sessions WHERE id = ?", id)
 
 	sess, err := scanSession(row)
 	if err != nil {
@@ -731,6 +1199,7 @@ func (s *SQLiteSessionStore) GetSession(ctx context.Context, id string) (*Sessio
 
 // sessionItemRow holds the raw data from a session_items row
 type sessionItemRow struct {
+	id           int64
 	position     int
 	itemType     string
 	agentName    sql.NullString
@@ -738,6 +1207,86 @@ type sessionItemRow struct {
 	implicit     bool
 	subsessionID sql.NullString
 	summaryText  sql.NullString
+	rawOutput    sql.NullString
+}
+
+// insertAttachments stores the attachments of the message item itemID, with
+// their content encrypted if the store is.
+func (s *SQLiteSessionStore) insertAttachments(ctx context.Context, q querier, itemID int64, attachments []Attachment) error {
+	for i, att := range attachments {
+		if _, err := q.ExecContext(ctx,
+			`INSERT INTO attachments (item_id, position, name, mime_type, path, content) VALUES (?, ?, ?, ?, ?, ?)`,
+			itemID, i, att.Name, att.MimeType, att.Path, s.encrypt(att.Content)); err != nil {
+			return fmt.Errorf("inserting attachment %q: %w", att.Name, err)
+		}
+	}
+	return nil
+}
+
+// loadAttachments returns the attachments of the messages of a session,
+// keyed by message item ID.
+func (s *SQLiteSessionStore) loadAttachments(ctx context.Context, q querier, sessionID string) (map[int64][]Attachment, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT item_id, name, mime_type, path, content FROM attachments
+		 WHERE item_id IN (SELECT id FROM session_items WHERE session_id = ?)
+		 ORDER BY item_id, position`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := map[int64][]Attachment{}
+	for rows.Next() {
+		var (
+			itemID                  int64
+			att                     Attachment
+			mimeType, path, content sql.NullString
+		)
+		if err := rows.Scan(&itemID, &att.Name, &mimeType, &path, &content); err != nil {
+			return nil, err
+		}
+		att.MimeType = mimeType.String
+		att.Path = path.String
+		if att.Content, err = s.decrypt(content.String); err != nil {
+			return nil, fmt.Errorf("decrypting attachment %q: %w", att.Name, err)
+		}
+		attachments[itemID] = append(attachments[itemID], att)
+	}
+	return attachments, rows.Err()
+}
+
+// messageJSONColumn returns the value of the message_json column of a
+// message, with its content encrypted if the store is.
+func (s *SQLiteSessionStore) messageJSONColumn(msg *Message) (string, error) {
+	msgJSON, err := json.Marshal(s.encryptMessage(msg.Message))
+	if err != nil {
+		return "", fmt.Errorf("marshaling message: %w", err)
+	}
+	return string(msgJSON), nil
+}
+
+// rawOutputColumn returns the value of the raw_output column of a message,
+// NULL when it has no raw output.
+func (s *SQLiteSessionStore) rawOutputColumn(msg *Message) any {
+	if msg.RawOutput == "" {
+		return nil
+	}
+	return s.encrypt(msg.RawOutput)
+}
+
+// warnDuplicatePositions logs a warning for every position shared by several
+// items of a session. rows must be sorted by position.
+func warnDuplicatePositions(sessionID string, rows []sessionItemRow) {
+	for i := 0; i < len(rows); {
+		j := i + 1
+		for j < len(rows) && rows[j].position == rows[i].position {
+			j++
+		}
+		if j-i > 1 {
+			slog.Warn("Duplicate session item position, ordering by insertion", "session_id", sessionID, "position", rows[i].position, "count", j-i)
+		}
+		i = j
+	}
 }
 
 // loadSessionItems loads all items for a session from the session_items table.
@@ -749,9 +1298,26 @@ func (s *SQLiteSessionStore) loadSessionItems(ctx context.Context, sessionID str
 
 // loadSessionItemsWith loads items using the provided querier (db or tx).
 func (s *SQLiteSessionStore) loadSessionItemsWith(ctx context.Context, q querier, sessionID string) ([]Item, error) {
-	rows, err := q.QueryContext(ctx,
-		`SELECT position, item_type, agent_name, message_json, implicit, subsession_id, summary_text
-		 FROM session_items WHERE session_id = ? ORDER BY position`, sessionID)
+	return s.loadSessionItemsByTypeWith(ctx, q, sessionID, nil)
+}
+
+// loadSessionItemsByTypeWith loads the items whose type is one of types,
+// or all items when types is empty, using the provided querier (db or tx).
+func (s *SQLiteSessionStore) loadSessionItemsByTypeWith(ctx context.Context, q querier, sessionID string, types []string) ([]Item, error) {
+	query := `SELECT id, position, item_type, agent_name, message_json, implicit, subsession_id, summary_text, raw_output
+		 FROM session_items WHERE session_id = ?`
+	args := []any{sessionID}
+	if len(types) > 0 {
+		query += " AND item_type IN (?" + strings.Repeat(", ?", len(types)-1) + ")"
+		for _, t := range types {
+			args = append(args, t)
+		}
+	}
+	// Order by row id as well so that items sharing a position (which should
+	// never happen, but did with buggy writers) load in insertion order.
+	query += " ORDER BY position, id"
+
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -761,7 +1327,7 @@ func (s *SQLiteSessionStore) loadSessionItemsWith(ctx context.Context, q querier
 	var rawRows []sessionItemRow
 	for rows.Next() {
 		var row sessionItemRow
-		if err := rows.Scan(&row.position, &row.itemType, &row.agentName, &row.messageJSON, &row.implicit, &row.subsessionID, &row.summaryText); err != nil {
+		if err := rows.Scan(&row.id, &row.position, &row.itemType, &row.agentName, &row.messageJSON, &row.implicit, &row.subsessionID, &row.summaryText, &row.rawOutput); err != nil {
 			rows.Close()
 			return nil, err
 		}
@@ -773,29 +1339,50 @@ func (s *SQLiteSessionStore) loadSessionItemsWith(ctx context.Context, q querier
 	}
 	rows.Close()
 
+	warnDuplicatePositions(sessionID, rawRows)
+
 	// If no session_items found, fall back to legacy messages column
 	if len(rawRows) == 0 {
-		return s.loadMessagesFromLegacyColumn(ctx, sessionID)
+		items, err := s.loadMessagesFromLegacyColumn(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		return filterItemsByType(items, types), nil
+	}
+
+	attachments, err := s.loadAttachments(ctx, q, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("loading attachments: %w", err)
 	}
 
 	// Now process the collected rows, making recursive calls as needed
 	var items []Item
 	for _, row := range rawRows {
 		switch row.itemType {
-		case "message":
+		case ItemTypeMessage:
 			var chatMsg chat.Message
 			if err := json.Unmarshal([]byte(row.messageJSON.String), &chatMsg); err != nil {
 				return nil, fmt.Errorf("unmarshaling message at position %d: %w", row.position, err)
 			}
+			if err := s.decryptMessage(&chatMsg); err != nil {
+				return nil, fmt.Errorf("decrypting message at position %d: %w", row.position, err)
+			}
+			rawOutput, err := s.decrypt(row.rawOutput.String)
+			if err != nil {
+				return nil, fmt.Errorf("decrypting raw output at position %d: %w", row.position, err)
+			}
 			items = append(items, Item{
 				Message: &Message{
-					AgentName: row.agentName.String,
-					Message:   chatMsg,
-					Implicit:  row.implicit,
+					ID:          row.id,
+					AgentName:   row.agentName.String,
+					Message:     chatMsg,
+					Implicit:    row.implicit,
+					RawOutput:   rawOutput,
+					Attachments: attachments[row.id],
 				},
 			})
 
-		case "subsession":
+		case ItemTypeSubSession:
 			// Skip if subsession_id is NULL (can happen if the sub-session was deleted
 			// and the foreign key set the reference to NULL)
 			if !row.subsessionID.Valid || row.subsessionID.String == "" {
@@ -814,46 +1401,104 @@ func (s *SQLiteSessionStore) loadSessionItemsWith(ctx context.Context, q querier
 			}
 			items = append(items, Item{SubSession: subSession})
 
-		case "summary":
-			items = append(items, Item{Summary: row.summaryText.String})
+		case ItemTypeSummary:
+			summary, err := s.decrypt(row.summaryText.String)
+			if err != nil {
+				return nil, fmt.Errorf("decrypting summary at position %d: %w", row.position, err)
+			}
+			items = append(items, Item{Summary: summary})
 		}
 	}
 
 	return items, nil
 }
 
-// loadSessionWith loads a session using the provided querier.
-func (s *SQLiteSessionStore) loadSessionWith(ctx context.Context, q querier, id string) (*Session, error) {
-	row := q.QueryRowContext(ctx,
-		"SELECT id, tools_approved, input_tokens, output_tokens, title, cost, send_user_message, max_iterations, working_dir, created_at, starred, permissions, agent_model_overrides, custom_models_used, thinking, parent_id, branch_parent_session_id, branch_parent_position, branch_created_at, split_diff_view FROM sessions WHERE id = ?", id)
+// GetItemsByType returns the items of a session whose type is one of types.
+// Filtering happens in SQL, so sub-sessions are only loaded when requested.
+func (s *SQLiteSessionStore) GetItemsByType(ctx context.Context, sessionID string, types ...string) ([]Item, error) {
+	if sessionID == "" {
+		return nil, ErrEmptyID
+	}
 
-	sess, err := scanSession(row)
-	if err != nil {
+	var exists int
+	if err := s.db.QueryRowContext(ctx, "SELECT 1 FROM sessions WHERE id = ?", sessionID).Scan(&exists); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
 
-	// Load messages
-	items, err := s.loadSessionItemsWith(ctx, q, id)
-	if err != nil {
-		return nil, fmt.Errorf("loading session items: %w", err)
-	}
-	sess.Messages = items
-
-	return sess, nil
+	return s.loadSessionItemsByTypeWith(ctx, s.db, sessionID, types)
 }
 
-// loadMessagesFromLegacyColumn loads messages from the legacy messages JSON column.
-// This is used for backward compatibility with sessions created by older cagent versions
-// that haven't been migrated to the session_items table yet.
-func (s *SQLiteSessionStore) loadMessagesFromLegacyColumn(ctx context.Context, sessionID string) ([]Item, error) {
-	var messagesJSON sql.NullString
-	err := s.db.QueryRowContext(ctx, "SELECT messages FROM sessions WHERE id = ?", sessionID).Scan(&messagesJSON)
-	if err != nil {
+// GetSummaries returns the summaries of a session with their positions.
+func (s *SQLiteSessionStore) GetSummaries(ctx context.Context, sessionID string) ([]SummaryItem, error) {
+	if sessionID == "" {
+		return nil, ErrEmptyID
+	}
+
+	var exists int
+	if err := s.db.QueryRowContext(ctx, "SELECT 1 FROM sessions WHERE id = ?", sessionID).Scan(&exists); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT position, summary_text FROM session_items WHERE session_id = ? AND item_type = ? ORDER BY position, id",
+		sessionID, ItemTypeSummary)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []SummaryItem
+	for rows.Next() {
+		var summary SummaryItem
+		if err := rows.Scan(&summary.Position, &summary.Text); err != nil {
+			return nil, err
+		}
+		if summary.Text, err = s.decrypt(summary.Text); err != nil {
+			return nil, fmt.Errorf("decrypting summary at position %d: %w", summary.Position, err)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+// loadSessionWith loads a session using the provided querier.
+func (s *SQLiteSessionStore) loadSessionWith(ctx context.Context, q querier, id string) (*Session, error) {
+	row := q.QueryRowContext(ctx,
+		"SELECT id, tools_approved, input_tokens, output_tokens, title, cost, send_user_message, max_iterations, working_dir, created_at, starred, permissions, agent_model_overrides, custom_models_used, thinking, parent_id, branch_parent_session_id, branch_parent_position, branch_created_at, split_diff_view, lifetime_cost, commands, team_ref, current_agent FROM sessions WHERE id = ?", id)
+
+	sess, err := scanSession(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	// Load messages
+	items, err := s.loadSessionItemsWith(ctx, q, id)
+	if err != nil {
+		return nil, fmt.Errorf("loading session items: %w", err)
+	}
+	sess.Messages = items
+
+	return sess, nil
+}
+
+// loadMessagesFromLegacyColumn loads messages from the legacy messages JSON column.
+// This is used for backward compatibility with sessions created by older cagent versions
+// that haven't been migrated to the session_items table yet.
+func (s *SQLiteSessionStore) loadMessagesFromLegacyColumn(ctx context.Context, sessionID string) ([]Item, error) {
+	var messagesJSON sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT messages FROM sessions WHERE id = ?", sessionID).Scan(&messagesJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
 		}
 		// Handle case where messages column doesn't exist (very old or corrupted database)
 		// This can happen if the database was created before the messages column was added
@@ -880,7 +1525,7 @@ func (s *SQLiteSessionStore) loadMessagesFromLegacyColumn(ctx context.Context, s
 // GetSessions retrieves all root sessions (excludes sub-sessions)
 func (s *SQLiteSessionStore) GetSessions(ctx context.Context) ([]*Session, error) {
 	rows, err := s.db.QueryContext(ctx,
-		"SELECT id, tools_approved, input_tokens, output_tokens, title, cost, send_user_message, max_iterations, working_dir, created_at, starred, permissions, agent_model_overrides, custom_models_used, thinking, parent_id, branch_parent_session_id, branch_parent_position, branch_created_at, split_diff_view FROM sessions WHERE parent_id IS NULL OR parent_id = '' ORDER BY created_at DESC")
+		"SELECT id, tools_approved, input_tokens, output_tokens, title, cost, send_user_message, max_iterations, working_dir, created_at, starred, permissions, agent_model_overrides, custom_models_used, thinking, parent_id, branch_parent_session_id, branch_parent_position, branch_created_at, split_diff_view, lifetime_cost, commands, team_ref, current_agent FROM sessions WHERE parent_id IS NULL OR parent_id = '' ORDER BY created_at DESC, id")
 	if err != nil {
 		return nil, err
 	}
@@ -911,15 +1556,60 @@ func (s *SQLiteSessionStore) GetSessions(ctx context.Context) ([]*Session, error
 	return sessions, nil
 }
 
+// GetSessionsByIDs retrieves the sessions with the given IDs, including
+// sub-sessions. Metadata is loaded with a single IN (...) query; IDs that
+// don't exist are absent from the returned map.
+func (s *SQLiteSessionStore) GetSessionsByIDs(ctx context.Context, ids []string) (map[string]*Session, error) {
+	sessions := make(map[string]*Session, len(ids))
+	if len(ids) == 0 {
+		return sessions, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, tools_approved, input_tokens, output_tokens, title, cost, send_user_message, max_iterations, working_dir, created_at, starred, permissions, agent_model_overrides, custom_models_used, thinking, parent_id, branch_parent_session_id, branch_parent_position, branch_created_at, split_diff_view, lifetime_cost, commands, team_ref, current_agent FROM sessions WHERE id IN (?"+strings.Repeat(", ?", len(ids)-1)+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Collect sessions first to close the rows before loading items
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions[session.ID] = session
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, session := range sessions {
+		items, err := s.loadSessionItems(ctx, session.ID)
+		if err != nil {
+			return nil, fmt.Errorf("loading items for session %s: %w", session.ID, err)
+		}
+		session.Messages = items
+	}
+
+	return sessions, nil
+}
+
 // GetSessionSummaries retrieves lightweight session metadata for listing (excludes sub-sessions).
 // This is much faster than GetSessions as it doesn't load message content.
 func (s *SQLiteSessionStore) GetSessionSummaries(ctx context.Context) ([]Summary, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT s.id, s.title, s.created_at, s.starred, s.branch_parent_session_id,
+		`SELECT s.id, s.title, s.created_at, s.starred, s.branch_parent_session_id, s.working_dir,
 		        (SELECT COUNT(*) FROM session_items si WHERE si.session_id = s.id AND si.item_type = 'message')
 		 FROM sessions s
 		 WHERE s.parent_id IS NULL OR s.parent_id = ''
-		 ORDER BY s.created_at DESC`)
+		 ORDER BY s.created_at DESC, s.id`)
 	if err != nil {
 		return nil, err
 	}
@@ -928,9 +1618,9 @@ func (s *SQLiteSessionStore) GetSessionSummaries(ctx context.Context) ([]Summary
 	var summaries []Summary
 	for rows.Next() {
 		var id, title, createdAtStr, starredStr string
-		var branchParentID sql.NullString
+		var branchParentID, workingDir sql.NullString
 		var numMessages int
-		if err := rows.Scan(&id, &title, &createdAtStr, &starredStr, &branchParentID, &numMessages); err != nil {
+		if err := rows.Scan(&id, &title, &createdAtStr, &starredStr, &branchParentID, &workingDir, &numMessages); err != nil {
 			return nil, err
 		}
 		createdAt, err := time.Parse(time.RFC3339, createdAtStr)
@@ -947,6 +1637,7 @@ func (s *SQLiteSessionStore) GetSessionSummaries(ctx context.Context) ([]Summary
 			CreatedAt:             createdAt,
 			Starred:               starred,
 			BranchParentSessionID: branchParentID.String,
+			WorkingDir:            workingDir.String,
 			NumMessages:           numMessages,
 		})
 	}
@@ -958,6 +1649,15 @@ func (s *SQLiteSessionStore) GetSessionSummaries(ctx context.Context) ([]Summary
 	return summaries, nil
 }
 
+// GetSessionsGroupedByWorkingDir returns the session summaries keyed by working directory
+func (s *SQLiteSessionStore) GetSessionsGroupedByWorkingDir(ctx context.Context) (map[string][]Summary, error) {
+	summaries, err := s.GetSessionSummaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return groupByWorkingDir(summaries), nil
+}
+
 // DeleteSession deletes a session by ID
 func (s *SQLiteSessionStore) DeleteSession(ctx context.Context, id string) error {
 	if id == "" {
@@ -981,6 +1681,65 @@ func (s *SQLiteSessionStore) DeleteSession(ctx context.Context, id string) error
 	return nil
 }
 
+// FindOrphanedSessions returns the IDs of sub-sessions whose parent session no longer exists.
+func (s *SQLiteSessionStore) FindOrphanedSessions(ctx context.Context) ([]string, error) {
+	return findOrphanedSessions(ctx, s.db)
+}
+
+func findOrphanedSessions(ctx context.Context, q querier) ([]string, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT id FROM sessions
+		 WHERE parent_id IS NOT NULL AND parent_id != ''
+		   AND parent_id NOT IN (SELECT id FROM sessions)
+		 ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orphans []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, id)
+	}
+
+	return orphans, rows.Err()
+}
+
+// RepairOrphans promotes orphaned sub-sessions to root sessions, or deletes them.
+// Deleting an orphan also deletes its items and sub-sessions through the
+// ON DELETE CASCADE constraints.
+func (s *SQLiteSessionStore) RepairOrphans(ctx context.Context, promoteToRoot bool) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	orphans, err := findOrphanedSessions(ctx, tx)
+	if err != nil {
+		return 0, fmt.Errorf("finding orphaned sessions: %w", err)
+	}
+
+	query := "DELETE FROM sessions WHERE id = ?"
+	if promoteToRoot {
+		query = "UPDATE sessions SET parent_id = NULL WHERE id = ?"
+	}
+	for _, id := range orphans {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return 0, fmt.Errorf("repairing orphaned session %s: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(orphans), nil
+}
+
 // UpdateSession updates an existing session's metadata, or creates it if it doesn't exist (upsert).
 // Only metadata is modified - use AddMessage, AddSubSession, AddSummary for items.
 // Messages are persisted separately via events to avoid duplication.
@@ -1018,6 +1777,11 @@ func (s *SQLiteSessionStore) UpdateSession(ctx context.Context, session *Session
 		customModelsUsedJSON = string(customBytes)
 	}
 
+	commandsJSON, err := marshalCommands(session.Commands)
+	if err != nil {
+		return err
+	}
+
 	// Use NULL for empty parent_id to avoid foreign key constraint issues
 	var parentID any
 	if session.ParentID != "" {
@@ -1033,7 +1797,7 @@ func (s *SQLiteSessionStore) UpdateSession(ctx context.Context, session *Session
 	}
 	var branchCreatedAt any
 	if session.BranchCreatedAt != nil {
-		branchCreatedAt = session.BranchCreatedAt.Format(time.RFC3339)
+		branchCreatedAt = session.BranchCreatedAt.Format(TimestampFormat)
 	}
 
 	// Use a transaction
@@ -1049,9 +1813,9 @@ func (s *SQLiteSessionStore) UpdateSession(ctx context.Context, session *Session
 			id, tools_approved, input_tokens, output_tokens, title, cost, send_user_message,
 			max_iterations, working_dir, created_at, starred, permissions, agent_model_overrides,
 			custom_models_used, thinking, parent_id, branch_parent_session_id,
-			branch_parent_position, branch_created_at
+			branch_parent_position, branch_created_at, lifetime_cost, commands, team_ref, current_agent
 		)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		 ON CONFLICT(id) DO UPDATE SET
 		   title = excluded.title,
 		   tools_approved = excluded.tools_approved,
@@ -1069,11 +1833,16 @@ func (s *SQLiteSessionStore) UpdateSession(ctx context.Context, session *Session
 		   parent_id = excluded.parent_id,
 		   branch_parent_session_id = excluded.branch_parent_session_id,
 		   branch_parent_position = excluded.branch_parent_position,
-		   branch_created_at = excluded.branch_created_at`,
+		   branch_created_at = excluded.branch_created_at,
+		   lifetime_cost = excluded.lifetime_cost,
+		   commands = excluded.commands,
+		   team_ref = excluded.team_ref,
+		   current_agent = excluded.current_agent`,
 		session.ID, session.ToolsApproved, session.InputTokens, session.OutputTokens,
 		session.Title, session.Cost, session.SendUserMessage, session.MaxIterations, session.WorkingDir,
-		session.CreatedAt.Format(time.RFC3339), session.Starred, permissionsJSON, agentModelOverridesJSON,
-		customModelsUsedJSON, session.Thinking, parentID, branchParentID, branchParentPosition, branchCreatedAt)
+		session.CreatedAt.Format(TimestampFormat), session.Starred, permissionsJSON, agentModelOverridesJSON,
+		customModelsUsedJSON, session.Thinking, parentID, branchParentID, branchParentPosition, branchCreatedAt,
+		session.LifetimeCost, commandsJSON, session.TeamRef, session.CurrentAgent)
 	if err != nil {
 		return err
 	}
@@ -1119,16 +1888,16 @@ func (s *SQLiteSessionStore) AddMessage(ctx context.Context, sessionID string, m
 		return 0, ErrEmptyID
 	}
 
-	msgJSON, err := json.Marshal(msg.Message)
+	msgJSON, err := s.messageJSONColumn(msg)
 	if err != nil {
-		return 0, fmt.Errorf("marshaling message: %w", err)
+		return 0, err
 	}
 
 	// Insert a new message at the next position
 	result, err := s.db.ExecContext(ctx,
-		`INSERT INTO session_items (session_id, position, item_type, agent_name, message_json, implicit)
-		 VALUES (?, (SELECT COALESCE(MAX(position), -1) + 1 FROM session_items WHERE session_id = ?), 'message', ?, ?, ?)`,
-		sessionID, sessionID, msg.AgentName, string(msgJSON), msg.Implicit)
+		`INSERT INTO session_items (session_id, position, item_type, agent_name, message_json, implicit, raw_output)
+		 VALUES (?, (SELECT COALESCE(MAX(position), -1) + 1 FROM session_items WHERE session_id = ?), 'message', ?, ?, ?, ?)`,
+		sessionID, sessionID, msg.AgentName, msgJSON, msg.Implicit, s.rawOutputColumn(msg))
 	if err != nil {
 		return 0, fmt.Errorf("inserting message: %w", err)
 	}
@@ -1138,6 +1907,10 @@ func (s *SQLiteSessionStore) AddMessage(ctx context.Context, sessionID string, m
 		return 0, fmt.Errorf("getting last insert id: %w", err)
 	}
 
+	if err := s.insertAttachments(ctx, s.db, id, msg.Attachments); err != nil {
+		return 0, err
+	}
+
 	// Update messages column for backward compatibility with older cagent versions
 	if err := s.syncMessagesColumn(ctx, sessionID); err != nil {
 		slog.Warn("[STORE] Failed to sync messages column", "session_id", sessionID, "error", err)
@@ -1149,14 +1922,14 @@ func (s *SQLiteSessionStore) AddMessage(ctx context.Context, sessionID string, m
 
 // UpdateMessage updates an existing message by its ID.
 func (s *SQLiteSessionStore) UpdateMessage(ctx context.Context, messageID int64, msg *Message) error {
-	msgJSON, err := json.Marshal(msg.Message)
+	msgJSON, err := s.messageJSONColumn(msg)
 	if err != nil {
-		return fmt.Errorf("marshaling message: %w", err)
+		return err
 	}
 
 	result, err := s.db.ExecContext(ctx,
-		`UPDATE session_items SET message_json = ?, implicit = ? WHERE id = ?`,
-		string(msgJSON), msg.Implicit, messageID)
+		`UPDATE session_items SET message_json = ?, implicit = ?, raw_output = ? WHERE id = ?`,
+		msgJSON, msg.Implicit, s.rawOutputColumn(msg), messageID)
 	if err != nil {
 		return fmt.Errorf("updating message: %w", err)
 	}
@@ -1170,6 +1943,13 @@ func (s *SQLiteSessionStore) UpdateMessage(ctx context.Context, messageID int64,
 		return ErrNotFound
 	}
 
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM attachments WHERE item_id = ?", messageID); err != nil {
+		return fmt.Errorf("deleting attachments: %w", err)
+	}
+	if err := s.insertAttachments(ctx, s.db, messageID, msg.Attachments); err != nil {
+		return err
+	}
+
 	// Get session ID for this message to sync the messages column
 	var sessionID string
 	err = s.db.QueryRowContext(ctx, "SELECT session_id FROM session_items WHERE id = ?", messageID).Scan(&sessionID)
@@ -1260,6 +2040,11 @@ func (s *SQLiteSessionStore) addSessionTx(ctx context.Context, tx *sql.Tx, sessi
 		customModelsUsedJSON = string(customBytes)
 	}
 
+	commandsJSON, err := marshalCommands(session.Commands)
+	if err != nil {
+		return err
+	}
+
 	// Use NULL for empty parent_id to avoid foreign key constraint issues
 	var parentID any
 	if session.ParentID != "" {
@@ -1275,22 +2060,23 @@ func (s *SQLiteSessionStore) addSessionTx(ctx context.Context, tx *sql.Tx, sessi
 	}
 	var branchCreatedAt any
 	if session.BranchCreatedAt != nil {
-		branchCreatedAt = session.BranchCreatedAt.Format(time.RFC3339)
+		branchCreatedAt = session.BranchCreatedAt.Format(TimestampFormat)
 	}
 
-	_, err := tx.ExecContext(ctx,
+	_, err = tx.ExecContext(ctx,
 		`INSERT INTO sessions (
 			id, tools_approved, input_tokens, output_tokens, title, cost, send_user_message,
 			max_iterations, working_dir, created_at, starred, permissions, agent_model_overrides,
 			custom_models_used, thinking, parent_id, branch_parent_session_id,
-			branch_parent_position, branch_created_at
+			branch_parent_position, branch_created_at, lifetime_cost, commands, team_ref, current_agent
 		)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		session.ID, session.ToolsApproved, session.InputTokens, session.OutputTokens,
 		session.Title, session.Cost, session.SendUserMessage, session.MaxIterations,
-		session.WorkingDir, session.CreatedAt.Format(time.RFC3339), session.Starred,
+		session.WorkingDir, session.CreatedAt.Format(TimestampFormat), session.Starred,
 		permissionsJSON, agentModelOverridesJSON, customModelsUsedJSON, session.Thinking,
-		parentID, branchParentID, branchParentPosition, branchCreatedAt)
+		parentID, branchParentID, branchParentPosition, branchCreatedAt, session.LifetimeCost,
+		commandsJSON, session.TeamRef, session.CurrentAgent)
 	return err
 }
 
@@ -1298,15 +2084,25 @@ func (s *SQLiteSessionStore) addSessionTx(ctx context.Context, tx *sql.Tx, sessi
 func (s *SQLiteSessionStore) addItemTx(ctx context.Context, tx *sql.Tx, sessionID string, position int, item Item) error {
 	switch {
 	case item.Message != nil:
-		msgJSON, err := json.Marshal(item.Message.Message)
+		msgJSON, err := s.messageJSONColumn(item.Message)
 		if err != nil {
-			return fmt.Errorf("marshaling message: %w", err)
+			return err
 		}
-		_, err = tx.ExecContext(ctx,
-			`INSERT INTO session_items (session_id, position, item_type, agent_name, message_json, implicit)
-			 VALUES (?, ?, 'message', ?, ?, ?)`,
-			sessionID, position, item.Message.AgentName, string(msgJSON), item.Message.Implicit)
-		return err
+		result, err := tx.ExecContext(ctx,
+			`INSERT INTO session_items (session_id, position, item_type, agent_name, message_json, implicit, raw_output)
+			 VALUES (?, ?, 'message', ?, ?, ?, ?)`,
+			sessionID, position, item.Message.AgentName, msgJSON, item.Message.Implicit, s.rawOutputColumn(item.Message))
+		if err != nil {
+			return err
+		}
+		if len(item.Message.Attachments) == 0 {
+			return nil
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		return s.insertAttachments(ctx, tx, id, item.Message.Attachments)
 
 	case item.SubSession != nil:
 		// Recursively add the sub-session
@@ -1333,7 +2129,7 @@ func (s *SQLiteSessionStore) addItemTx(ctx context.Context, tx *sql.Tx, sessionI
 		_, err := tx.ExecContext(ctx,
 			`INSERT INTO session_items (session_id, position, item_type, summary_text)
 			 VALUES (?, ?, 'summary', ?)`,
-			sessionID, position, item.Summary)
+			sessionID, position, s.encrypt(item.Summary))
 		return err
 
 	default:
@@ -1350,7 +2146,7 @@ func (s *SQLiteSessionStore) AddSummary(ctx context.Context, sessionID, summary
 	_, err := s.db.ExecContext(ctx,
 		`INSERT INTO session_items (session_id, position, item_type, summary_text)
 		 VALUES (?, (SELECT COALESCE(MAX(position), -1) + 1 FROM session_items WHERE session_id = ?), 'summary', ?)`,
-		sessionID, sessionID, summary)
+		sessionID, sessionID, s.encrypt(summary))
 	if err != nil {
 		return err
 	}
@@ -1363,14 +2159,326 @@ func (s *SQLiteSessionStore) AddSummary(ctx context.Context, sessionID, summary
 	return nil
 }
 
+// UpdateItem replaces the item at the given position of a session.
+func (s *SQLiteSessionStore) UpdateItem(ctx context.Context, sessionID string, position int, item Item) error {
+	return s.UpdateItems(ctx, sessionID, map[int]Item{position: item})
+}
+
+// UpdateItems replaces the items at the given positions of a session in a
+// single transaction. The rows are updated in place, so they keep their IDs,
+// which are copied to the replacing messages.
+func (s *SQLiteSessionStore) UpdateItems(ctx context.Context, sessionID string, items map[int]Item) error {
+	if sessionID == "" {
+		return ErrEmptyID
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, position := range slices.Sorted(maps.Keys(items)) {
+		if err := s.updateItemTx(ctx, tx, sessionID, position, items[position]); err != nil {
+			return err
+		}
+	}
+
+	if err := s.syncMessagesColumnTx(ctx, tx, sessionID); err != nil {
+		slog.Warn("[STORE] Failed to sync messages column", "session_id", sessionID, "error", err)
+	}
+
+	return tx.Commit()
+}
+
+// updateItemTx replaces the item at the given position of a session within a
+// transaction, updating its row in place. A sub-session that isn't stored yet
+// is inserted, and a sub-session that the item no longer references is
+// deleted.
+func (s *SQLiteSessionStore) updateItemTx(ctx context.Context, tx *sql.Tx, sessionID string, position int, item Item) error {
+	var id int64
+	var previousSubSession sql.NullString
+	err := tx.QueryRowContext(ctx,
+		"SELECT id, subsession_id FROM session_items WHERE session_id = ? AND position = ? ORDER BY id LIMIT 1",
+		sessionID, position).Scan(&id, &previousSubSession)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrItemNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("finding item: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM attachments WHERE item_id = ?", id); err != nil {
+		return fmt.Errorf("deleting attachments: %w", err)
+	}
+
+	var subSessionID string
+	switch {
+	case item.Message != nil:
+		msgJSON, err := s.messageJSONColumn(item.Message)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE session_items SET item_type = 'message', agent_name = ?, message_json = ?, implicit = ?, raw_output = ?, subsession_id = NULL, summary_text = NULL
+			 WHERE id = ?`,
+			item.Message.AgentName, msgJSON, item.Message.Implicit, s.rawOutputColumn(item.Message), id); err != nil {
+			return fmt.Errorf("updating item: %w", err)
+		}
+		if err := s.insertAttachments(ctx, tx, id, item.Message.Attachments); err != nil {
+			return err
+		}
+		item.Message.ID = id
+
+	case item.SubSession != nil:
+		subSession := item.SubSession
+		subSessionID = subSession.ID
+
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM sessions WHERE id = ?)", subSession.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			subSession.ParentID = sessionID
+			if err := s.addSessionTx(ctx, tx, subSession); err != nil {
+				return fmt.Errorf("inserting sub-session: %w", err)
+			}
+			for i, subItem := range subSession.Messages {
+				if err := s.addItemTx(ctx, tx, subSession.ID, i, subItem); err != nil {
+					return fmt.Errorf("inserting sub-session item %d: %w", i, err)
+				}
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE session_items SET item_type = 'subsession', agent_name = NULL, message_json = NULL, implicit = 0, raw_output = NULL, subsession_id = ?, summary_text = NULL
+			 WHERE id = ?`,
+			subSession.ID, id); err != nil {
+			return fmt.Errorf("updating item: %w", err)
+		}
+
+	default:
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE session_items SET item_type = 'summary', agent_name = NULL, message_json = NULL, implicit = 0, raw_output = NULL, subsession_id = NULL, summary_text = ?
+			 WHERE id = ?`,
+			s.encrypt(item.Summary), id); err != nil {
+			return fmt.Errorf("updating item: %w", err)
+		}
+	}
+
+	if previousSubSession.Valid && previousSubSession.String != subSessionID {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE id = ?", previousSubSession.String); err != nil {
+			return fmt.Errorf("deleting replaced sub-session: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteItemsAfter removes all items after the given position of a session.
+// Sub-sessions referenced by the removed items are deleted as well.
+func (s *SQLiteSessionStore) DeleteItemsAfter(ctx context.Context, sessionID string, position int) error {
+	if sessionID == "" {
+		return ErrEmptyID
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := deleteItemsAfterTx(ctx, tx, sessionID, position); err != nil {
+		return err
+	}
+
+	if err := s.syncMessagesColumnTx(ctx, tx, sessionID); err != nil {
+		slog.Warn("[STORE] Failed to sync messages column", "session_id", sessionID, "error", err)
+	}
+
+	return tx.Commit()
+}
+
+// RewriteItem replaces the item at the given position of a session and
+// removes all items after it, in a single transaction.
+func (s *SQLiteSessionStore) RewriteItem(ctx context.Context, sessionID string, position int, item Item) error {
+	if sessionID == "" {
+		return ErrEmptyID
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := s.updateItemTx(ctx, tx, sessionID, position, item); err != nil {
+		return err
+	}
+	if err := deleteItemsAfterTx(ctx, tx, sessionID, position); err != nil {
+		return err
+	}
+
+	if err := s.syncMessagesColumnTx(ctx, tx, sessionID); err != nil {
+		slog.Warn("[STORE] Failed to sync messages column", "session_id", sessionID, "error", err)
+	}
+
+	return tx.Commit()
+}
+
+// deleteItemsAfterTx removes all items after the given position of a session,
+// and the sub-sessions they reference, within a transaction.
+func deleteItemsAfterTx(ctx context.Context, tx *sql.Tx, sessionID string, position int) error {
+	_, err := tx.ExecContext(ctx,
+		`DELETE FROM sessions WHERE id IN (
+			SELECT subsession_id FROM session_items
+			WHERE session_id = ? AND position > ? AND subsession_id IS NOT NULL
+		)`, sessionID, position)
+	if err != nil {
+		return fmt.Errorf("deleting sub-sessions: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM session_items WHERE session_id = ? AND position > ?", sessionID, position)
+	if err != nil {
+		return fmt.Errorf("deleting items: %w", err)
+	}
+	return nil
+}
+
+// ModelUsageStats aggregates assistant messages of all sessions by model.
+// The model, usage and cost live in the message JSON, so they are read with json_extract.
+func (s *SQLiteSessionStore) ModelUsageStats(ctx context.Context) ([]ModelStat, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT json_extract(message_json, '$.model') AS model,
+			COUNT(*) AS messages,
+			COALESCE(SUM(json_extract(message_json, '$.usage.input_tokens')), 0),
+			COALESCE(SUM(json_extract(message_json, '$.usage.output_tokens')), 0),
+			COALESCE(SUM(json_extract(message_json, '$.cost')), 0)
+		 FROM session_items
+		 WHERE item_type = 'message' AND COALESCE(json_extract(message_json, '$.model'), '') != ''
+		 GROUP BY model
+		 ORDER BY messages DESC, model`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []ModelStat
+	for rows.Next() {
+		var stat ModelStat
+		if err := rows.Scan(&stat.Model, &stat.Messages, &stat.InputTokens, &stat.OutputTokens, &stat.Cost); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// UsageRows sums up the usage and cost of the messages of each root session.
+// Each sub-session is attributed to its root session through a recursive
+// query, and the usage is read from the message JSON with json_extract.
+func (s *SQLiteSessionStore) UsageRows(ctx context.Context) ([]UsageRow, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`WITH RECURSIVE tree(root_id, id) AS (
+			SELECT id, id FROM sessions WHERE parent_id IS NULL OR parent_id = ''
+			UNION ALL
+			SELECT tree.root_id, s.id FROM sessions s JOIN tree ON s.parent_id = tree.id
+		 ), usage AS (
+			SELECT tree.root_id,
+				GROUP_CONCAT(DISTINCT NULLIF(json_extract(si.message_json, '$.model'), '')) AS models,
+				SUM(json_extract(si.message_json, '$.usage.input_tokens')) AS input_tokens,
+				SUM(json_extract(si.message_json, '$.usage.output_tokens')) AS output_tokens,
+				SUM(json_extract(si.message_json, '$.cost')) AS cost
+			FROM tree JOIN session_items si ON si.session_id = tree.id AND si.item_type = 'message'
+			GROUP BY tree.root_id
+		 )
+		 SELECT s.id, s.title, s.created_at, COALESCE(u.models, ''),
+			COALESCE(u.input_tokens, 0), COALESCE(u.output_tokens, 0), COALESCE(u.cost, 0)
+		 FROM sessions s LEFT JOIN usage u ON u.root_id = s.id
+		 WHERE s.parent_id IS NULL OR s.parent_id = ''
+		 ORDER BY s.created_at DESC, s.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []UsageRow
+	for rows.Next() {
+		var row UsageRow
+		var createdAtStr, models string
+		if err := rows.Scan(&row.SessionID, &row.Title, &createdAtStr, &models, &row.InputTokens, &row.OutputTokens, &row.Cost); err != nil {
+			return nil, err
+		}
+		row.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+		if err != nil {
+			return nil, err
+		}
+		if models != "" {
+			row.Models = strings.Split(models, ",")
+			slices.Sort(row.Models)
+		}
+		usage = append(usage, row)
+	}
+	return usage, rows.Err()
+}
+
+// FindSessionsUsingTool returns the root sessions in which the named tool
+// was called with arguments containing argSubstring. Tool calls are read
+// from the message JSON with json_each, and sub-sessions are attributed to
+// their root session like in UsageRows. The arguments are matched after
+// loading them, since they may be encrypted.
+func (s *SQLiteSessionStore) FindSessionsUsingTool(ctx context.Context, toolName, argSubstring string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`WITH RECURSIVE tree(root_id, id) AS (
+			SELECT id, id FROM sessions WHERE parent_id IS NULL OR parent_id = ''
+			UNION ALL
+			SELECT tree.root_id, s.id FROM sessions s JOIN tree ON s.parent_id = tree.id
+		 )
+		 SELECT tree.root_id, COALESCE(json_extract(tc.value, '$.function.arguments'), '')
+		 FROM tree
+		 JOIN sessions s ON s.id = tree.root_id
+		 JOIN session_items si ON si.session_id = tree.id AND si.item_type = 'message'
+		 JOIN json_each(si.message_json, '$.tool_calls') tc
+		 WHERE json_extract(tc.value, '$.function.name') = ?
+		 ORDER BY s.created_at DESC, s.id`, toolName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id, arguments string
+		if err := rows.Scan(&id, &arguments); err != nil {
+			return nil, err
+		}
+		if slices.Contains(ids, id) {
+			continue
+		}
+		if arguments, err = s.decrypt(arguments); err != nil {
+			return nil, fmt.Errorf("decrypting tool call arguments of session %s: %w", id, err)
+		}
+		if strings.Contains(arguments, argSubstring) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
 // UpdateSessionTokens updates only token/cost fields.
-func (s *SQLiteSessionStore) UpdateSessionTokens(ctx context.Context, sessionID string, inputTokens, outputTokens int64, cost float64) error {
+func (s *SQLiteSessionStore) UpdateSessionTokens(ctx context.Context, sessionID string, inputTokens, outputTokens int64, cost, lifetimeCost float64) error {
 	if sessionID == "" {
 		return ErrEmptyID
 	}
 	_, err := s.db.ExecContext(ctx,
-		"UPDATE sessions SET input_tokens = ?, output_tokens = ?, cost = ? WHERE id = ?",
-		inputTokens, outputTokens, cost, sessionID)
+		"UPDATE sessions SET input_tokens = ?, output_tokens = ?, cost = ?, lifetime_cost = ? WHERE id = ?",
+		inputTokens, outputTokens, cost, lifetimeCost, sessionID)
 	return err
 }
 
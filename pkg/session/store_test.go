@@ -3,6 +3,7 @@ package session
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/docker/cagent/pkg/agent"
 	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/tools"
 )
 
 func TestStoreAgentName(t *testing.T) {
@@ -164,6 +166,48 @@ func TestGetSessions(t *testing.T) {
 	}
 }
 
+func TestSessionOrderingIsDeterministic(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "ordering.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	sameSecond := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			for _, id := range []string{"c", "a", "d", "b"} {
+				require.NoError(t, store.AddSession(ctx, &Session{ID: id, CreatedAt: sameSecond}))
+			}
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "z", CreatedAt: sameSecond.Add(-time.Hour)}))
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "newest", CreatedAt: sameSecond.Add(time.Hour)}))
+
+			expected := []string{"newest", "a", "b", "c", "d", "z"}
+
+			sessions, err := store.GetSessions(ctx)
+			require.NoError(t, err)
+			var ids []string
+			for _, sess := range sessions {
+				ids = append(ids, sess.ID)
+			}
+			assert.Equal(t, expected, ids)
+
+			summaries, err := store.GetSessionSummaries(ctx)
+			require.NoError(t, err)
+			ids = nil
+			for _, summary := range summaries {
+				ids = append(ids, summary.ID)
+			}
+			assert.Equal(t, expected, ids)
+		})
+	}
+}
+
 func TestGetSessionSummaries(t *testing.T) {
 	tempDB := filepath.Join(t.TempDir(), "test_get_session_summaries.db")
 
@@ -455,6 +499,55 @@ func TestUpdateSession_LazyCreation_InMemory(t *testing.T) {
 	assert.Len(t, retrieved.Messages, 2)
 }
 
+func TestLazyStore_DefersEmptySessions(t *testing.T) {
+	tempDB := filepath.Join(t.TempDir(), "test_lazy_store.db")
+
+	sqliteStore, err := NewSQLiteSessionStore(tempDB)
+	require.NoError(t, err)
+	defer sqliteStore.(*SQLiteSessionStore).Close()
+
+	store := NewLazyStore(sqliteStore)
+
+	// An empty session is kept pending, not written.
+	abandoned := &Session{ID: "abandoned", CreatedAt: time.Now()}
+	require.NoError(t, store.UpdateSession(t.Context(), abandoned))
+	_, err = sqliteStore.GetSession(t.Context(), "abandoned")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Deleting a pending session forgets it.
+	require.NoError(t, store.DeleteSession(t.Context(), "abandoned"))
+
+	// Forgetting a pending session drops it without writing it.
+	require.NoError(t, store.UpdateSession(t.Context(), abandoned))
+	store.Forget("abandoned")
+	assert.Empty(t, store.pending)
+	_, err = store.AddMessage(t.Context(), "abandoned", UserMessage("Hello"))
+	require.Error(t, err)
+
+	// Adding the first message flushes the pending session.
+	sess := &Session{ID: "used", Title: "Used", CreatedAt: time.Now()}
+	require.NoError(t, store.UpdateSession(t.Context(), sess))
+	_, err = store.AddMessage(t.Context(), "used", UserMessage("Hello"))
+	require.NoError(t, err)
+
+	retrieved, err := sqliteStore.GetSession(t.Context(), "used")
+	require.NoError(t, err)
+	assert.Equal(t, "Used", retrieved.Title)
+	assert.Len(t, retrieved.Messages, 1)
+
+	// A session that already has a real message is written right away.
+	withMessage := New(WithUserMessage("Hi"))
+	require.NoError(t, store.UpdateSession(t.Context(), withMessage))
+	_, err = sqliteStore.GetSession(t.Context(), withMessage.ID)
+	require.NoError(t, err)
+
+	// Implicit messages alone don't count as a real conversation.
+	implicit := New(WithImplicitUserMessage("run"))
+	require.NoError(t, store.UpdateSession(t.Context(), implicit))
+	_, err = sqliteStore.GetSession(t.Context(), implicit.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
 func TestStorePermissions(t *testing.T) {
 	tempDB := filepath.Join(t.TempDir(), "test_permissions.db")
 
@@ -1286,3 +1379,945 @@ func TestResolveSessionID_InMemory(t *testing.T) {
 		assert.Equal(t, "some-uuid", id)
 	})
 }
+
+func TestGetItemsByType(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "items_by_type.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "typed", CreatedAt: time.Now()}))
+
+			_, err := store.AddMessage(ctx, "typed", UserMessage("Hello"))
+			require.NoError(t, err)
+			require.NoError(t, store.AddSubSession(ctx, "typed", &Session{
+				ID:        "typed-sub",
+				CreatedAt: time.Now(),
+				Messages:  []Item{NewMessageItem(UserMessage("Sub task"))},
+			}))
+			require.NoError(t, store.AddSummary(ctx, "typed", "A summary"))
+			_, err = store.AddMessage(ctx, "typed", UserMessage("Bye"))
+			require.NoError(t, err)
+
+			messages, err := store.GetItemsByType(ctx, "typed", ItemTypeMessage)
+			require.NoError(t, err)
+			require.Len(t, messages, 2)
+			assert.Equal(t, "Hello", messages[0].Message.Message.Content)
+			assert.Equal(t, "Bye", messages[1].Message.Message.Content)
+
+			mixed, err := store.GetItemsByType(ctx, "typed", ItemTypeSummary, ItemTypeSubSession)
+			require.NoError(t, err)
+			require.Len(t, mixed, 2)
+			assert.Equal(t, "typed-sub", mixed[0].SubSession.ID)
+			assert.Equal(t, "A summary", mixed[1].Summary)
+
+			all, err := store.GetItemsByType(ctx, "typed")
+			require.NoError(t, err)
+			assert.Len(t, all, 4)
+
+			_, err = store.GetItemsByType(ctx, "missing", ItemTypeMessage)
+			require.ErrorIs(t, err, ErrNotFound)
+
+			_, err = store.GetItemsByType(ctx, "", ItemTypeMessage)
+			require.ErrorIs(t, err, ErrEmptyID)
+		})
+	}
+}
+
+func TestGetSummaries(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "summaries.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "compacted", CreatedAt: time.Now()}))
+
+			summaries, err := store.GetSummaries(ctx, "compacted")
+			require.NoError(t, err)
+			assert.Empty(t, summaries)
+
+			_, err = store.AddMessage(ctx, "compacted", UserMessage("Hello"))
+			require.NoError(t, err)
+			require.NoError(t, store.AddSummary(ctx, "compacted", "First summary"))
+			_, err = store.AddMessage(ctx, "compacted", UserMessage("Again"))
+			require.NoError(t, err)
+			require.NoError(t, store.AddSummary(ctx, "compacted", "Second summary"))
+
+			want := []SummaryItem{
+				{Position: 1, Text: "First summary"},
+				{Position: 3, Text: "Second summary"},
+			}
+			summaries, err = store.GetSummaries(ctx, "compacted")
+			require.NoError(t, err)
+			assert.Equal(t, want, summaries)
+
+			loaded, err := store.GetSession(ctx, "compacted")
+			require.NoError(t, err)
+			assert.Equal(t, want, loaded.Summaries())
+
+			_, err = store.GetSummaries(ctx, "missing")
+			require.ErrorIs(t, err, ErrNotFound)
+
+			_, err = store.GetSummaries(ctx, "")
+			require.ErrorIs(t, err, ErrEmptyID)
+		})
+	}
+}
+
+func TestUpdateItemAndDeleteItemsAfter(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "rewrite.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "rewrite", CreatedAt: time.Now()}))
+
+			_, err := store.AddMessage(ctx, "rewrite", UserMessage("Helo"))
+			require.NoError(t, err)
+			_, err = store.AddMessage(ctx, "rewrite", &Message{AgentName: "root", Message: chat.Message{Role: chat.MessageRoleAssistant, Content: "Hi"}})
+			require.NoError(t, err)
+			require.NoError(t, store.AddSubSession(ctx, "rewrite", &Session{
+				ID:        "rewrite-sub",
+				CreatedAt: time.Now(),
+				Messages:  []Item{NewMessageItem(UserMessage("Sub task"))},
+			}))
+
+			require.NoError(t, store.UpdateItem(ctx, "rewrite", 0, NewMessageItem(UserMessage("Hello"))))
+			require.NoError(t, store.DeleteItemsAfter(ctx, "rewrite", 0))
+
+			sess, err := store.GetSession(ctx, "rewrite")
+			require.NoError(t, err)
+			require.Len(t, sess.Messages, 1)
+			assert.Equal(t, "Hello", sess.Messages[0].Message.Message.Content)
+
+			_, err = store.GetSession(ctx, "rewrite-sub")
+			require.ErrorIs(t, err, ErrNotFound, "sub-sessions after the position are deleted")
+
+			// New items continue after the kept ones
+			_, err = store.AddMessage(ctx, "rewrite", &Message{AgentName: "root", Message: chat.Message{Role: chat.MessageRoleAssistant, Content: "Hello!"}})
+			require.NoError(t, err)
+			sess, err = store.GetSession(ctx, "rewrite")
+			require.NoError(t, err)
+			require.Len(t, sess.Messages, 2)
+			assert.Equal(t, "Hello!", sess.Messages[1].Message.Message.Content)
+
+			require.ErrorIs(t, store.UpdateItem(ctx, "rewrite", 5, NewMessageItem(UserMessage("x"))), ErrItemNotFound)
+		})
+	}
+}
+
+func TestRewriteItem(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "rewrite_item.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			sess := New(WithUserMessage("Helo"))
+			sess.AddMessage(&Message{AgentName: "root", Message: chat.Message{Role: chat.MessageRoleAssistant, Content: "Hi"}})
+			require.NoError(t, store.AddSession(ctx, sess))
+
+			require.ErrorIs(t, store.RewriteItem(ctx, sess.ID, 5, NewMessageItem(UserMessage("x"))), ErrItemNotFound)
+			stored, err := store.GetSession(ctx, sess.ID)
+			require.NoError(t, err)
+			require.Len(t, stored.Messages, 2, "nothing is deleted when the item can't be replaced")
+
+			edited := UserMessage("Hello")
+			require.NoError(t, store.RewriteItem(ctx, sess.ID, 0, NewMessageItem(edited)))
+
+			stored, err = store.GetSession(ctx, sess.ID)
+			require.NoError(t, err)
+			require.Len(t, stored.Messages, 1)
+			assert.Equal(t, "Hello", stored.Messages[0].Message.Message.Content)
+			assert.Equal(t, stored.Messages[0].Message.ID, edited.ID)
+		})
+	}
+}
+
+func TestUpdateItems(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "update_items.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "redact", CreatedAt: time.Now()}))
+			for _, content := range []string{"my password is hunter2", "noted", "hunter2 again"} {
+				_, err := store.AddMessage(ctx, "redact", UserMessage(content))
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, store.UpdateItems(ctx, "redact", map[int]Item{
+				0: NewMessageItem(UserMessage("my password is [REDACTED]")),
+				2: NewMessageItem(UserMessage("[REDACTED] again")),
+			}))
+
+			// Nothing is replaced if one of the positions doesn't exist.
+			require.ErrorIs(t, store.UpdateItems(ctx, "redact", map[int]Item{
+				1: NewMessageItem(UserMessage("changed")),
+				7: NewMessageItem(UserMessage("missing")),
+			}), ErrItemNotFound)
+
+			sess, err := store.GetSession(ctx, "redact")
+			require.NoError(t, err)
+			var contents []string
+			for _, item := range sess.Messages {
+				contents = append(contents, item.Message.Message.Content)
+			}
+			assert.Equal(t, []string{"my password is [REDACTED]", "noted", "[REDACTED] again"}, contents)
+		})
+	}
+}
+
+func TestModelUsageStats(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "model_stats.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	assistant := func(model string, in, out int64, cost float64) *Message {
+		return &Message{AgentName: "root", Message: chat.Message{
+			Role:  chat.MessageRoleAssistant,
+			Model: model,
+			Usage: &chat.Usage{InputTokens: in, OutputTokens: out},
+			Cost:  cost,
+		}}
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s1", CreatedAt: time.Now()}))
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s2", CreatedAt: time.Now()}))
+
+			for _, m := range []struct {
+				session string
+				msg     *Message
+			}{
+				{"s1", UserMessage("Hi")},
+				{"s1", assistant("openai/gpt-4o", 10, 5, 0.5)},
+				{"s1", assistant("anthropic/claude-sonnet-4-5", 20, 10, 1)},
+				{"s2", assistant("openai/gpt-4o", 30, 15, 1.5)},
+			} {
+				_, err := store.AddMessage(ctx, m.session, m.msg)
+				require.NoError(t, err)
+			}
+			require.NoError(t, store.AddSubSession(ctx, "s2", &Session{
+				ID:        "s2-sub",
+				CreatedAt: time.Now(),
+				Messages:  []Item{NewMessageItem(assistant("anthropic/claude-sonnet-4-5", 1, 1, 0.25))},
+			}))
+
+			stats, err := store.ModelUsageStats(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []ModelStat{
+				{Model: "anthropic/claude-sonnet-4-5", Messages: 2, InputTokens: 21, OutputTokens: 11, Cost: 1.25},
+				{Model: "openai/gpt-4o", Messages: 2, InputTokens: 40, OutputTokens: 20, Cost: 2},
+			}, stats)
+		})
+	}
+}
+
+func TestSQLiteSessionStoreDB(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "db.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.AddSession(t.Context(), &Session{ID: "s1", Title: "hello", CreatedAt: time.Now()}))
+
+	var title string
+	err = store.(*SQLiteSessionStore).DB().QueryRowContext(t.Context(), "SELECT title FROM sessions WHERE id = ?", "s1").Scan(&title)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", title)
+}
+
+func TestUsageRows(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "usage_rows.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	assistant := func(model string, in, out int64, cost float64) *Message {
+		return &Message{AgentName: "root", Message: chat.Message{
+			Role:  chat.MessageRoleAssistant,
+			Model: model,
+			Usage: &chat.Usage{InputTokens: in, OutputTokens: out},
+			Cost:  cost,
+		}}
+	}
+
+	older := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	newer := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s1", Title: "first", CreatedAt: older}))
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s2", Title: "second", CreatedAt: newer}))
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s3", Title: "empty", CreatedAt: older.Add(-time.Hour)}))
+
+			for _, m := range []struct {
+				session string
+				msg     *Message
+			}{
+				{"s1", UserMessage("Hi")},
+				{"s1", assistant("openai/gpt-4o", 10, 5, 0.5)},
+				{"s1", assistant("openai/gpt-4o", 20, 10, 1)},
+				{"s2", assistant("openai/gpt-4o", 30, 15, 1.5)},
+			} {
+				_, err := store.AddMessage(ctx, m.session, m.msg)
+				require.NoError(t, err)
+			}
+			require.NoError(t, store.AddSubSession(ctx, "s2", &Session{
+				ID:        "s2-sub",
+				CreatedAt: newer,
+				Messages:  []Item{NewMessageItem(assistant("anthropic/claude-sonnet-4-5", 1, 1, 0.25))},
+			}))
+
+			rows, err := store.UsageRows(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []UsageRow{
+				{SessionID: "s2", Title: "second", CreatedAt: newer, Models: []string{"anthropic/claude-sonnet-4-5", "openai/gpt-4o"}, InputTokens: 31, OutputTokens: 16, Cost: 1.75},
+				{SessionID: "s1", Title: "first", CreatedAt: older, Models: []string{"openai/gpt-4o"}, InputTokens: 30, OutputTokens: 15, Cost: 1.5},
+				{SessionID: "s3", Title: "empty", CreatedAt: older.Add(-time.Hour)},
+			}, rows)
+		})
+	}
+}
+
+func TestFindSessionsUsingTool(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "find_tool.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+	encryptedStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "find_tool_encrypted.db"), WithEncryption([]byte("0123456789abcdef")))
+	require.NoError(t, err)
+	defer encryptedStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":           sqliteStore,
+		"sqlite-encrypted": encryptedStore,
+		"in-memory":        NewInMemorySessionStore(),
+	}
+
+	call := func(name, arguments string) *Message {
+		return &Message{AgentName: "root", Message: chat.Message{
+			Role:      chat.MessageRoleAssistant,
+			ToolCalls: []tools.ToolCall{{ID: "call", Function: tools.FunctionCall{Name: name, Arguments: arguments}}},
+		}}
+	}
+
+	older := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	newer := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s1", CreatedAt: older}))
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s2", CreatedAt: newer}))
+			require.NoError(t, store.AddSession(ctx, &Session{ID: "s3", CreatedAt: newer}))
+
+			for _, m := range []struct {
+				session string
+				msg     *Message
+			}{
+				{"s1", call("shell", `{"cmd":"rm -rf build"}`)},
+				{"s1", call("shell", `{"cmd":"rm -rf dist"}`)},
+				{"s3", call("shell", `{"cmd":"ls"}`)},
+				{"s3", call("read_file", `{"path":"rm.txt"}`)},
+			} {
+				_, err := store.AddMessage(ctx, m.session, m.msg)
+				require.NoError(t, err)
+			}
+			require.NoError(t, store.AddSubSession(ctx, "s2", &Session{
+				ID:        "s2-sub",
+				CreatedAt: newer,
+				Messages:  []Item{NewMessageItem(call("shell", `{"cmd":"rm notes.md"}`))},
+			}))
+
+			ids, err := store.FindSessionsUsingTool(ctx, "shell", "rm")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"s2", "s1"}, ids)
+
+			ids, err = store.FindSessionsUsingTool(ctx, "shell", "")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"s2", "s3", "s1"}, ids)
+
+			ids, err = store.FindSessionsUsingTool(ctx, "write_file", "")
+			require.NoError(t, err)
+			assert.Empty(t, ids)
+		})
+	}
+}
+
+func TestResetUsagePersistsLifetimeCost(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "reset_usage.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+
+			sess := &Session{ID: "s1", CreatedAt: time.Now(), InputTokens: 100, OutputTokens: 20}
+			sess.AddCost(0.5)
+			sess.AddCost(0.25)
+			require.NoError(t, store.AddSession(ctx, sess))
+
+			sess.ResetUsage()
+			assert.Zero(t, sess.InputTokens)
+			assert.Zero(t, sess.OutputTokens)
+			assert.Zero(t, sess.Cost)
+			assert.InDelta(t, 0.75, sess.LifetimeCost, 1e-9)
+			require.NoError(t, store.UpdateSession(ctx, sess))
+
+			sess.AddCost(0.1)
+			require.NoError(t, store.UpdateSessionTokens(ctx, sess.ID, 30, 5, sess.Cost, sess.LifetimeCost))
+
+			loaded, err := store.GetSession(ctx, sess.ID)
+			require.NoError(t, err)
+			assert.Equal(t, int64(30), loaded.InputTokens)
+			assert.Equal(t, int64(5), loaded.OutputTokens)
+			assert.InDelta(t, 0.1, loaded.Cost, 1e-9)
+			assert.InDelta(t, 0.85, loaded.LifetimeCost, 1e-9)
+		})
+	}
+}
+
+func TestGetSessionsByIDs(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "by_ids.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+
+			parent := New(WithTitle("Parent"), WithUserMessage("Hi"))
+			require.NoError(t, store.AddSession(ctx, parent))
+			child := New(WithTitle("Child"), WithParentID(parent.ID), WithUserMessage("Do it"))
+			require.NoError(t, store.AddSubSession(ctx, parent.ID, child))
+			other := New(WithTitle("Other"))
+			require.NoError(t, store.AddSession(ctx, other))
+
+			sessions, err := store.GetSessionsByIDs(ctx, []string{parent.ID, child.ID, "missing"})
+			require.NoError(t, err)
+			require.Len(t, sessions, 2)
+			assert.Equal(t, "Parent", sessions[parent.ID].Title)
+			assert.Equal(t, "Child", sessions[child.ID].Title)
+			assert.Len(t, sessions[child.ID].Messages, 1)
+			assert.NotContains(t, sessions, "missing")
+
+			empty, err := store.GetSessionsByIDs(ctx, nil)
+			require.NoError(t, err)
+			assert.Empty(t, empty)
+		})
+	}
+}
+
+func TestGetSessionsGroupedByWorkingDir(t *testing.T) {
+	sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "grouped.db"))
+	require.NoError(t, err)
+	defer sqliteStore.Close()
+
+	stores := map[string]Store{
+		"sqlite":    sqliteStore,
+		"in-memory": NewInMemorySessionStore(),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+
+			now := time.Now()
+			older := New(WithTitle("Older"), WithWorkingDir("/src/app"))
+			older.CreatedAt = now.Add(-time.Hour)
+			newer := New(WithTitle("Newer"), WithWorkingDir("/src/app"))
+			newer.CreatedAt = now
+			other := New(WithTitle("Other"), WithWorkingDir("/src/lib"))
+			none := New(WithTitle("None"))
+			for _, sess := range []*Session{older, newer, other, none} {
+				require.NoError(t, store.AddSession(ctx, sess))
+			}
+
+			groups, err := store.GetSessionsGroupedByWorkingDir(ctx)
+			require.NoError(t, err)
+			require.Len(t, groups, 3)
+
+			require.Len(t, groups["/src/app"], 2)
+			assert.Equal(t, "Newer", groups["/src/app"][0].Title)
+			assert.Equal(t, "Older", groups["/src/app"][1].Title)
+			require.Len(t, groups["/src/lib"], 1)
+			assert.Equal(t, "/src/lib", groups["/src/lib"][0].WorkingDir)
+			require.Len(t, groups[NoWorkingDir], 1)
+			assert.Equal(t, "None", groups[NoWorkingDir][0].Title)
+		})
+	}
+}
+
+// orphanSubSession adds a parent with a sub-session, which itself has a
+// sub-session, and deletes the parent without cascading, as an old crash would.
+func orphanSubSession(t *testing.T, store Store) (orphan, grandChild *Session) {
+	t.Helper()
+	ctx := t.Context()
+
+	parent := New(WithTitle("Parent"))
+	require.NoError(t, store.AddSession(ctx, parent))
+	orphan = New(WithTitle("Orphan"), WithUserMessage("Do it"))
+	require.NoError(t, store.AddSubSession(ctx, parent.ID, orphan))
+	grandChild = New(WithTitle("Grandchild"), WithUserMessage("Look it up"))
+	require.NoError(t, store.AddSubSession(ctx, orphan.ID, grandChild))
+
+	if sqliteStore, ok := store.(*SQLiteSessionStore); ok {
+		conn, err := sqliteStore.db.Conn(ctx)
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+		require.NoError(t, err)
+		_, err = conn.ExecContext(ctx, "DELETE FROM sessions WHERE id = ?", parent.ID)
+		require.NoError(t, err)
+		_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+		require.NoError(t, err)
+	} else {
+		require.NoError(t, store.DeleteSession(ctx, parent.ID))
+	}
+
+	return orphan, grandChild
+}
+
+func TestRepairOrphans(t *testing.T) {
+	for _, promote := range []bool{true, false} {
+		sqliteStore, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "orphans.db"))
+		require.NoError(t, err)
+		defer sqliteStore.Close()
+
+		stores := map[string]Store{
+			"sqlite":    sqliteStore,
+			"in-memory": NewInMemorySessionStore(),
+		}
+
+		for name, store := range stores {
+			t.Run(fmt.Sprintf("%s/promote=%t", name, promote), func(t *testing.T) {
+				ctx := t.Context()
+
+				orphan, grandChild := orphanSubSession(t, store)
+
+				orphans, err := store.FindOrphanedSessions(ctx)
+				require.NoError(t, err)
+				assert.Equal(t, []string{orphan.ID}, orphans)
+
+				repaired, err := store.RepairOrphans(ctx, promote)
+				require.NoError(t, err)
+				assert.Equal(t, 1, repaired)
+
+				orphans, err = store.FindOrphanedSessions(ctx)
+				require.NoError(t, err)
+				assert.Empty(t, orphans)
+
+				summaries, err := store.GetSessionSummaries(ctx)
+				require.NoError(t, err)
+
+				_, err = store.GetSession(ctx, grandChild.ID)
+				if promote {
+					require.Len(t, summaries, 1)
+					assert.Equal(t, orphan.ID, summaries[0].ID)
+					require.NoError(t, err)
+				} else {
+					assert.Empty(t, summaries)
+					require.ErrorIs(t, err, ErrNotFound)
+				}
+			})
+		}
+	}
+}
+
+func TestDuplicateItemPositionsLoadInInsertionOrder(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "duplicates.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := t.Context()
+	sqliteStore := store.(*SQLiteSessionStore)
+
+	sess := New(WithUserMessage("first"))
+	require.NoError(t, store.AddSession(ctx, sess))
+
+	// Simulate a buggy writer that reuses the position of the first item.
+	for _, content := range []string{"second", "third"} {
+		msgJSON, err := json.Marshal(chat.Message{Role: chat.MessageRoleUser, Content: content})
+		require.NoError(t, err)
+		_, err = sqliteStore.db.ExecContext(ctx,
+			`INSERT INTO session_items (session_id, position, item_type, message_json) VALUES (?, 0, 'message', ?)`,
+			sess.ID, string(msgJSON))
+		require.NoError(t, err)
+	}
+
+	loaded, err := store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+
+	var contents []string
+	for _, item := range loaded.Messages {
+		contents = append(contents, item.Message.Message.Content)
+	}
+	assert.Equal(t, []string{"first", "second", "third"}, contents)
+}
+
+func TestSessionCommands_SQLite(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "commands.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	session := &Session{
+		ID:        "commands-session",
+		CreatedAt: time.Now(),
+		Commands:  map[string]string{"ls": "list files"},
+	}
+	require.NoError(t, store.AddSession(t.Context(), session))
+
+	retrieved, err := store.GetSession(t.Context(), session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ls": "list files"}, retrieved.Commands)
+
+	session.Commands["df"] = "check disk space"
+	require.NoError(t, store.UpdateSession(t.Context(), session))
+
+	retrieved, err = store.GetSession(t.Context(), session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ls": "list files", "df": "check disk space"}, retrieved.Commands)
+}
+
+func TestSessionTeamRef_SQLite(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "team_ref.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	session := New(WithTeamRef("agent.yaml@sha256:abc"))
+	require.NoError(t, store.AddSession(t.Context(), session))
+
+	retrieved, err := store.GetSession(t.Context(), session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "agent.yaml@sha256:abc", retrieved.TeamRef)
+
+	session.TeamRef = "agent.yaml@sha256:def"
+	require.NoError(t, store.UpdateSession(t.Context(), session))
+
+	sessions, err := store.GetSessions(t.Context())
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "agent.yaml@sha256:def", sessions[0].TeamRef)
+}
+
+func TestDeleteSessionCascades(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "cascade.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	ctx := t.Context()
+	db := store.(*SQLiteSessionStore).db
+
+	parent := New(WithTitle("Parent"), WithUserMessage("Start"))
+	require.NoError(t, store.AddSession(ctx, parent))
+	child := New(WithTitle("Child"), WithUserMessage("Do it"))
+	require.NoError(t, store.AddSubSession(ctx, parent.ID, child))
+	grandChild := New(WithTitle("Grandchild"), WithUserMessage("Look it up"))
+	require.NoError(t, store.AddSubSession(ctx, child.ID, grandChild))
+
+	other := New(WithTitle("Other"), WithUserMessage("Unrelated"))
+	require.NoError(t, store.AddSession(ctx, other))
+
+	count := func(query string) int {
+		t.Helper()
+		var n int
+		require.NoError(t, db.QueryRowContext(ctx, query).Scan(&n))
+		return n
+	}
+	require.Equal(t, 4, count("SELECT COUNT(*) FROM sessions"))
+	require.Positive(t, count("SELECT COUNT(*) FROM session_items WHERE session_id != '"+other.ID+"'"))
+
+	require.NoError(t, store.DeleteSession(ctx, parent.ID))
+
+	assert.Equal(t, 0, count("SELECT COUNT(*) FROM sessions WHERE id != '"+other.ID+"'"))
+	assert.Equal(t, 0, count("SELECT COUNT(*) FROM session_items WHERE session_id != '"+other.ID+"'"))
+	assert.Equal(t, 1, count("SELECT COUNT(*) FROM sessions"))
+	assert.Equal(t, 1, count("SELECT COUNT(*) FROM session_items"))
+}
+
+func TestNewSQLiteSessionStore_SchemaTooNew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "newer.db")
+
+	store, err := NewSQLiteSessionStore(path)
+	require.NoError(t, err)
+	_, err = store.(*SQLiteSessionStore).db.ExecContext(t.Context(),
+		"INSERT INTO migrations (id, name, description, applied_at) VALUES (?, ?, ?, ?)",
+		latestMigrationID()+1, "999_from_the_future", "", time.Now().Format(time.RFC3339))
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	_, err = NewSQLiteSessionStore(path)
+	require.ErrorIs(t, err, ErrSchemaTooNew)
+
+	// The database is left in place for the newer version.
+	assert.FileExists(t, path)
+	assert.NoFileExists(t, path+".bak")
+}
+
+func TestTimestampsKeepSubSecondPrecision(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "timestamps.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	ctx := t.Context()
+
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	first := New()
+	first.CreatedAt = createdAt
+	second := New()
+	second.CreatedAt = createdAt.Add(time.Millisecond)
+	require.NoError(t, store.AddSession(ctx, first))
+	require.NoError(t, store.AddSession(ctx, second))
+
+	retrieved, err := store.GetSession(ctx, first.ID)
+	require.NoError(t, err)
+	assert.True(t, createdAt.Equal(retrieved.CreatedAt), "got %s", retrieved.CreatedAt)
+
+	// Sessions created within the same second are listed newest first.
+	sessions, err := store.GetSessions(ctx)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, second.ID, sessions[0].ID)
+
+	// Message timestamps use the same layout.
+	_, err = time.Parse(TimestampFormat, UserMessage("hello").Message.CreatedAt)
+	require.NoError(t, err)
+}
+
+func TestMessageRawOutput_SQLite(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "raw_output.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	ctx := t.Context()
+
+	toolMessage := func(content, raw string) *Message {
+		return &Message{
+			AgentName: "root",
+			Message:   chat.Message{Role: chat.MessageRoleTool, ToolCallID: "call_1", Content: content},
+			RawOutput: raw,
+		}
+	}
+
+	sess := New()
+	sess.AddMessage(toolMessage("[redacted]", "secret=42"))
+	require.NoError(t, store.AddSession(ctx, sess))
+
+	id, err := store.AddMessage(ctx, sess.ID, toolMessage("first lines...", "all the lines"))
+	require.NoError(t, err)
+	_, err = store.AddMessage(ctx, sess.ID, toolMessage("short", ""))
+	require.NoError(t, err)
+
+	retrieved, err := store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, retrieved.Messages, 3)
+	assert.Equal(t, "secret=42", retrieved.Messages[0].Message.RawOutput)
+	assert.Equal(t, "[redacted]", retrieved.Messages[0].Message.Message.Content)
+	assert.Equal(t, "all the lines", retrieved.Messages[1].Message.RawOutput)
+	assert.Empty(t, retrieved.Messages[2].Message.RawOutput)
+
+	require.NoError(t, store.UpdateMessage(ctx, id, toolMessage("first lines...", "all the lines, updated")))
+	retrieved, err = store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "all the lines, updated", retrieved.Messages[1].Message.RawOutput)
+
+	// The raw output is never sent to the model.
+	for _, msg := range retrieved.GetMessages(agent.New("root", "")) {
+		assert.NotContains(t, msg.Content, "all the lines")
+	}
+}
+
+func TestMessageAttachments_SQLite(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "attachments.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	ctx := t.Context()
+
+	withAttachments := func(content string, attachments ...Attachment) *Message {
+		msg := UserMessage(content)
+		msg.Attachments = attachments
+		return msg
+	}
+	paste := Attachment{Name: "paste-1", MimeType: "text/plain", Content: "pasted text"}
+	pdf := Attachment{Name: "report.pdf", MimeType: "application/pdf", Path: "/tmp/report.pdf"}
+	code := Attachment{Name: "main.go", MimeType: "text/x-go", Path: "/src/main.go"}
+
+	sess := New()
+	sess.AddMessage(withAttachments("first", paste, pdf))
+	require.NoError(t, store.AddSession(ctx, sess))
+
+	id, err := store.AddMessage(ctx, sess.ID, withAttachments("second", code))
+	require.NoError(t, err)
+	_, err = store.AddMessage(ctx, sess.ID, UserMessage("third"))
+	require.NoError(t, err)
+
+	retrieved, err := store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, retrieved.Messages, 3)
+	assert.Equal(t, []Attachment{paste, pdf}, retrieved.Messages[0].Message.Attachments)
+	assert.Equal(t, []Attachment{code}, retrieved.Messages[1].Message.Attachments)
+	assert.Empty(t, retrieved.Messages[2].Message.Attachments)
+
+	// Updating a message replaces its attachments.
+	require.NoError(t, store.UpdateMessage(ctx, id, withAttachments("second", pdf)))
+	retrieved, err = store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []Attachment{pdf}, retrieved.Messages[1].Message.Attachments)
+
+	// So does rewriting the item, and dropping items drops their attachments.
+	require.NoError(t, store.UpdateItem(ctx, sess.ID, 0, NewMessageItem(withAttachments("first, edited", code))))
+	require.NoError(t, store.DeleteItemsAfter(ctx, sess.ID, 0))
+	retrieved, err = store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, retrieved.Messages, 1)
+	assert.Equal(t, []Attachment{code}, retrieved.Messages[0].Message.Attachments)
+
+	var count int
+	require.NoError(t, store.(*SQLiteSessionStore).DB().QueryRowContext(ctx, "SELECT COUNT(*) FROM attachments").Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestUpdateItemsInPlace_SQLite(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "update_items.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	ctx := t.Context()
+
+	sub := New(WithUserMessage("sub task"))
+	sess := New(WithUserMessage("first"))
+	sess.AddSubSession(sub)
+	require.NoError(t, store.AddSession(ctx, sess))
+
+	stored, err := store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+	id := stored.Messages[0].Message.ID
+
+	// Messages keep their row ID, which is copied to the replacing message.
+	edited := UserMessage("first, edited")
+	require.NoError(t, store.UpdateItem(ctx, sess.ID, 0, NewMessageItem(edited)))
+	assert.Equal(t, id, edited.ID)
+	require.NoError(t, store.UpdateMessage(ctx, id, UserMessage("first, edited twice")))
+
+	// Rewriting an item with an already stored sub-session doesn't insert it again.
+	require.NoError(t, store.UpdateItem(ctx, sess.ID, 1, Item{SubSession: sub}))
+
+	// Replacing a sub-session deletes it.
+	require.NoError(t, store.UpdateItem(ctx, sess.ID, 1, Item{Summary: "summary"}))
+	_, err = store.GetSession(ctx, sub.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	stored, err = store.GetSession(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, stored.Messages, 2)
+	assert.Equal(t, "first, edited twice", stored.Messages[0].Message.Message.Content)
+	assert.Equal(t, "summary", stored.Messages[1].Summary)
+
+	require.ErrorIs(t, store.UpdateItem(ctx, sess.ID, 5, Item{Summary: "nope"}), ErrItemNotFound)
+}
+
+func TestToolDefinitionsOrder_SQLite(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "tool_definitions.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	ctx := t.Context()
+
+	definitions := []tools.Tool{{Name: "shell"}, {Name: "read_file"}, {Name: "write_file"}, {Name: "fetch"}}
+	msg := &Message{AgentName: "root", Message: chat.Message{
+		Role:            chat.MessageRoleAssistant,
+		Content:         "Let me look",
+		ToolDefinitions: definitions,
+	}}
+
+	sess := New(WithUserMessage("Hi"))
+	require.NoError(t, store.AddSession(ctx, sess))
+	_, err = store.AddMessage(ctx, sess.ID, msg)
+	require.NoError(t, err)
+
+	// Tool definitions are stored in the message JSON, so every reload
+	// returns them in the order they were stored.
+	for range 3 {
+		retrieved, err := store.GetSession(ctx, sess.ID)
+		require.NoError(t, err)
+		require.Len(t, retrieved.Messages, 2)
+
+		var names []string
+		for _, def := range retrieved.Messages[1].Message.Message.ToolDefinitions {
+			names = append(names, def.Name)
+		}
+		assert.Equal(t, []string{"shell", "read_file", "write_file", "fetch"}, names)
+	}
+}
+
+func TestSessionCurrentAgent_SQLite(t *testing.T) {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "current_agent.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	session := New()
+	require.NoError(t, store.AddSession(t.Context(), session))
+
+	retrieved, err := store.GetSession(t.Context(), session.ID)
+	require.NoError(t, err)
+	assert.Empty(t, retrieved.CurrentAgent)
+
+	session.CurrentAgent = "reviewer"
+	require.NoError(t, store.UpdateSession(t.Context(), session))
+
+	retrieved, err = store.GetSession(t.Context(), session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "reviewer", retrieved.CurrentAgent)
+}
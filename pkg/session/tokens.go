@@ -0,0 +1,77 @@
+package session
+
+import (
+	"sync/atomic"
+
+	"github.com/docker/cagent/pkg/chat"
+)
+
+// TokenEstimator returns an approximate number of tokens for a piece of text.
+type TokenEstimator func(text string) int
+
+// DefaultTokenEstimator counts a token for every four bytes of text. It's
+// crude but needs no tokenizer and is close enough for budget meters.
+func DefaultTokenEstimator(text string) int {
+	return len(text) / 4
+}
+
+var tokenEstimator atomic.Pointer[TokenEstimator]
+
+func init() {
+	estimator := TokenEstimator(DefaultTokenEstimator)
+	tokenEstimator.Store(&estimator)
+}
+
+// SetTokenEstimator replaces the TokenEstimator used by
+// Session.EstimateTokens, for example with a real tokenizer, and returns a
+// function that restores the previous one. A nil estimator restores
+// DefaultTokenEstimator.
+func SetTokenEstimator(e TokenEstimator) (restore func()) {
+	if e == nil {
+		e = DefaultTokenEstimator
+	}
+	previous := tokenEstimator.Swap(&e)
+	return func() {
+		tokenEstimator.Store(previous)
+	}
+}
+
+// EstimateTokens returns an approximation of the number of tokens the
+// conversation takes in the model's context, without calling the model: the
+// last summary and the messages after it. It's meant to be shown before the
+// provider reports the actual usage.
+func (s *Session) EstimateTokens() int {
+	estimate := *tokenEstimator.Load()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	start, tokens := 0, 0
+	for i := len(s.Messages) - 1; i >= 0; i-- {
+		if s.Messages[i].Summary != "" {
+			start = i + 1
+			tokens += estimate(s.Messages[i].Summary)
+			break
+		}
+	}
+
+	for _, item := range s.Messages[start:] {
+		if item.IsMessage() {
+			tokens += estimateMessageTokens(estimate, &item.Message.Message)
+		}
+	}
+	return tokens
+}
+
+func estimateMessageTokens(estimate TokenEstimator, msg *chat.Message) int {
+	tokens := estimate(msg.Content) + estimate(msg.ReasoningContent)
+	for _, part := range msg.MultiContent {
+		if part.Type == chat.MessagePartTypeText {
+			tokens += estimate(part.Text)
+		}
+	}
+	for _, call := range msg.ToolCalls {
+		tokens += estimate(call.Function.Name) + estimate(call.Function.Arguments)
+	}
+	return tokens
+}
@@ -0,0 +1,42 @@
+package session
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/docker/cagent/pkg/agent"
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	sess := New(WithUserMessage(strings.Repeat("a", 40)))
+	sess.AddMessage(NewAgentMessage(agent.New("root", ""), &chat.Message{
+		Role:    chat.MessageRoleAssistant,
+		Content: strings.Repeat("b", 20),
+		ToolCalls: []tools.ToolCall{{
+			Function: tools.FunctionCall{Name: "read_file", Arguments: `{"path":"main.go"}`},
+		}},
+	}))
+
+	// 10 tokens for the user message, 5 for the answer, 2 for the tool name and 4 for its arguments.
+	assert.Equal(t, 21, sess.EstimateTokens())
+
+	t.Run("starts at the last summary", func(t *testing.T) {
+		sess.Messages = append(sess.Messages, Item{Summary: strings.Repeat("c", 12)})
+		sess.AddMessage(UserMessage(strings.Repeat("d", 8)))
+
+		assert.Equal(t, 5, sess.EstimateTokens())
+	})
+
+	t.Run("pluggable estimator", func(t *testing.T) {
+		restore := SetTokenEstimator(func(text string) int { return len(strings.Fields(text)) })
+		defer restore()
+
+		assert.Equal(t, 2, sess.EstimateTokens())
+	})
+
+	assert.Equal(t, 5, sess.EstimateTokens())
+}
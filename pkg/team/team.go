@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 
 	"github.com/docker/cagent/pkg/agent"
@@ -119,6 +120,57 @@ func (t *Team) Agent(name string) (*agent.Agent, error) {
 	return nil, fmt.Errorf("agent not found: %s (available agents: %s)", name, strings.Join(t.AgentNames(), ", "))
 }
 
+// Validate checks that the team is consistent and returns every problem it
+// finds: agents without a model, sub-agents and handoffs that aren't part of
+// the team, transfer targets that aren't sub-agents and toolsets that failed
+// to load. Toolsets aren't started.
+func (t *Team) Validate(_ context.Context) []error {
+	if t.Size() == 0 {
+		return []error{errors.New("no agents loaded; ensure your agent configuration defines at least one agent")}
+	}
+
+	var errs []error
+
+	members := make(map[*agent.Agent]bool, len(t.agents))
+	names := make(map[string]bool, len(t.agents))
+	for _, a := range t.agents {
+		members[a] = true
+		if names[a.Name()] {
+			errs = append(errs, fmt.Errorf("agent '%s' is defined more than once", a.Name()))
+		}
+		names[a.Name()] = true
+	}
+
+	for _, a := range t.agents {
+		if len(a.ConfiguredModels()) == 0 {
+			errs = append(errs, fmt.Errorf("agent '%s' has no model", a.Name()))
+		}
+
+		for _, sub := range a.SubAgents() {
+			if !members[sub] {
+				errs = append(errs, fmt.Errorf("agent '%s' references sub-agent '%s' which is not part of the team", a.Name(), sub.Name()))
+			}
+		}
+		for _, handoff := range a.Handoffs() {
+			if !members[handoff] {
+				errs = append(errs, fmt.Errorf("agent '%s' references handoff agent '%s' which is not part of the team", a.Name(), handoff.Name()))
+			}
+		}
+
+		for _, target := range a.AllowedTransferTargets() {
+			if !slices.ContainsFunc(a.SubAgents(), func(sub *agent.Agent) bool { return sub.Name() == target }) {
+				errs = append(errs, fmt.Errorf("agent '%s' allows transfers to '%s' which is not one of its sub-agents", a.Name(), target))
+			}
+		}
+
+		for _, warning := range a.Warnings() {
+			errs = append(errs, fmt.Errorf("agent '%s': %s", a.Name(), warning))
+		}
+	}
+
+	return errs
+}
+
 func (t *Team) Size() int {
 	return len(t.agents)
 }
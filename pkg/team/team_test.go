@@ -0,0 +1,78 @@
+package team
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/docker/cagent/pkg/agent"
+	"github.com/docker/cagent/pkg/chat"
+	"github.com/docker/cagent/pkg/model/provider/base"
+	"github.com/docker/cagent/pkg/tools"
+)
+
+type mockProvider struct{}
+
+func (m *mockProvider) ID() string { return "test/mock-model" }
+func (m *mockProvider) CreateChatCompletionStream(_ context.Context, _ []chat.Message, _ []tools.Tool) (chat.MessageStream, error) {
+	return nil, nil
+}
+func (m *mockProvider) BaseConfig() base.Config { return base.Config{} }
+
+func errorStrings(errs []error) []string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return messages
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	model := agent.WithModel(&mockProvider{})
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+
+		librarian := agent.New("librarian", "", model)
+		reviewer := agent.New("reviewer", "", model)
+		root := agent.New("root", "", model, agent.WithSubAgents(librarian), agent.WithHandoffs(reviewer), agent.WithAllowedTransferTargets("librarian"))
+
+		assert.Empty(t, New(WithAgents(root, librarian, reviewer)).Validate(t.Context()))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Len(t, New().Validate(t.Context()), 1)
+	})
+
+	t.Run("reports every problem", func(t *testing.T) {
+		t.Parallel()
+
+		outsider := agent.New("outsider", "", model)
+		librarian := agent.New("librarian", "", model)
+		root := agent.New("root", "", model,
+			agent.WithSubAgents(librarian, outsider),
+			agent.WithHandoffs(outsider),
+			agent.WithAllowedTransferTargets("librarian", "archivist"),
+			agent.WithLoadTimeWarnings([]string{"toolset mcp failed: command not found"}),
+		)
+		noModel := agent.New("librarian", "")
+
+		errs := New(WithAgents(root, librarian, noModel)).Validate(t.Context())
+		assert.Equal(t, []string{
+			"agent 'librarian' is defined more than once",
+			"agent 'root' references sub-agent 'outsider' which is not part of the team",
+			"agent 'root' references handoff agent 'outsider' which is not part of the team",
+			"agent 'root' allows transfers to 'archivist' which is not one of its sub-agents",
+			"agent 'root': toolset mcp failed: command not found",
+			"agent 'librarian' has no model",
+		}, errorStrings(errs))
+
+		// Validating doesn't consume the warnings.
+		assert.Len(t, root.DrainWarnings(), 1)
+	})
+}
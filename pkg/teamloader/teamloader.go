@@ -47,6 +47,9 @@ type loadOptions struct {
 	modelOverrides  []string
 	promptFiles     []string
 	toolsetRegistry *ToolsetRegistry
+	embeddingModel  provider.EmbeddingProvider
+	toolLogger      *slog.Logger
+	toolRedactor    tools.Redactor
 }
 
 type Opt func(*loadOptions) error
@@ -75,6 +78,30 @@ func WithToolsetRegistry(registry *ToolsetRegistry) Opt {
 	}
 }
 
+// WithEmbeddingModel makes the embedding strategies of the RAG sources use the
+// given model, to index documents and to embed queries, instead of the
+// embedding_model they are configured with. Any provider.EmbeddingProvider
+// works, a client for a local embedding server for example; if it also
+// implements provider.BatchEmbeddingProvider, documents are embedded in
+// batches.
+func WithEmbeddingModel(model provider.EmbeddingProvider) Opt {
+	return func(opts *loadOptions) error {
+		opts.embeddingModel = model
+		return nil
+	}
+}
+
+// WithToolLogger logs every tool call of the agents, along with its
+// arguments, to logger, for auditing what the agents actually ran. If redact
+// isn't nil, the arguments go through it first. See tools.WithLogger.
+func WithToolLogger(logger *slog.Logger, redact tools.Redactor) Opt {
+	return func(opts *loadOptions) error {
+		opts.toolLogger = logger
+		opts.toolRedactor = redact
+		return nil
+	}
+}
+
 // LoadResult contains the result of loading an agent team, including
 // the team and configuration needed for runtime model switching.
 type LoadResult struct {
@@ -140,6 +167,8 @@ func LoadWithConfig(ctx context.Context, agentSource config.Source, runConfig *c
 		ModelsGateway: runConfig.ModelsGateway,
 		Env:           env,
 		Models:        cfg.Models,
+
+		EmbeddingModel: loadOpts.embeddingModel,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create RAG managers: %w", err)
@@ -233,6 +262,10 @@ func LoadWithConfig(ctx context.Context, agentSource config.Source, runConfig *c
 			}
 		}
 
+		for i, ts := range agentTools {
+			agentTools[i] = tools.WithLogger(ts, loadOpts.toolLogger, loadOpts.toolRedactor)
+		}
+
 		opts = append(opts, agent.WithToolSets(agentTools...))
 
 		ag := agent.New(agentConfig.Name, agentConfig.Instruction, opts...)
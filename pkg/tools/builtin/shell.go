@@ -149,7 +149,7 @@ func (h *shellHandler) RunShell(ctx context.Context, params RunShellArgs) (*tool
 	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cwd := h.resolveWorkDir(params.Cwd)
+	cwd := h.resolveWorkDir(ctx, params.Cwd)
 
 	slog.Debug("Executing native shell command", "command", params.Cmd, "cwd", cwd)
 
@@ -191,13 +191,13 @@ func (h *shellHandler) runNativeCommand(timeoutCtx, ctx context.Context, command
 	return tools.ResultSuccess(limitOutput(output))
 }
 
-func (h *shellHandler) RunShellBackground(_ context.Context, params RunShellBackgroundArgs) (*tools.ToolCallResult, error) {
+func (h *shellHandler) RunShellBackground(ctx context.Context, params RunShellBackgroundArgs) (*tools.ToolCallResult, error) {
 	counter := h.jobCounter.Add(1)
 	jobID := fmt.Sprintf("job_%d_%d", time.Now().Unix(), counter)
 
 	cmd := exec.Command(h.shell, append(h.shellArgsPrefix, params.Cmd)...)
 	cmd.Env = h.env
-	cmd.Dir = h.resolveWorkDir(params.Cwd)
+	cmd.Dir = h.resolveWorkDir(ctx, params.Cwd)
 	cmd.SysProcAttr = platformSpecificSysProcAttr()
 
 	outputBuf := &bytes.Buffer{}
@@ -374,13 +374,16 @@ func detectWindowsShell() (shell string, argsPrefix []string) {
 	return cmp.Or(os.Getenv("ComSpec"), "cmd.exe"), []string{"/C"}
 }
 
-// resolveWorkDir returns the effective working directory.
-func (h *shellHandler) resolveWorkDir(cwd string) string {
+// resolveWorkDir returns the effective working directory. Relative paths are
+// resolved against the working directory of the session the command runs for,
+// if any, or against the tool's configured working directory.
+func (h *shellHandler) resolveWorkDir(ctx context.Context, cwd string) string {
+	workingDir := cmp.Or(tools.WorkingDirFromContext(ctx), h.workingDir)
 	if cwd == "" || cwd == "." {
-		return h.workingDir
+		return workingDir
 	}
 	if !filepath.IsAbs(cwd) {
-		return filepath.Clean(filepath.Join(h.workingDir, cwd))
+		return filepath.Clean(filepath.Join(workingDir, cwd))
 	}
 	return cwd
 }
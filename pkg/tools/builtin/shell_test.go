@@ -156,7 +156,7 @@ func TestResolveWorkDir(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			assert.Equal(t, tt.expected, h.resolveWorkDir(tt.cwd))
+			assert.Equal(t, tt.expected, h.resolveWorkDir(t.Context(), tt.cwd))
 		})
 	}
 }
@@ -177,3 +177,20 @@ func TestShellTool_RelativeCwdResolvesAgainstWorkingDir(t *testing.T) {
 	assert.Contains(t, result.Output, subdir,
 		"relative cwd must resolve against the configured workingDir, not the process cwd")
 }
+
+func TestShellTool_SessionWorkingDirFromContext(t *testing.T) {
+	workingDir := t.TempDir()
+	sessionDir := t.TempDir()
+	require.NoError(t, os.Mkdir(sessionDir+"/subdir", 0o755))
+
+	tool := NewShellTool(nil, &config.RuntimeConfig{Config: config.Config{WorkingDir: workingDir}})
+	ctx := tools.WithWorkingDir(t.Context(), sessionDir)
+
+	result, err := tool.handler.RunShell(ctx, RunShellArgs{Cmd: "pwd"})
+	require.NoError(t, err)
+	assert.Contains(t, result.Output, sessionDir)
+
+	result, err = tool.handler.RunShell(ctx, RunShellArgs{Cmd: "pwd", Cwd: "subdir"})
+	require.NoError(t, err)
+	assert.Contains(t, result.Output, sessionDir+"/subdir")
+}
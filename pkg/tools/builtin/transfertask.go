@@ -16,6 +16,7 @@ type TransferTaskArgs struct {
 	Agent          string `json:"agent" jsonschema:"The name of the agent to transfer the task to."`
 	Task           string `json:"task" jsonschema:"A clear and concise description of the task the member should achieve."`
 	ExpectedOutput string `json:"expected_output" jsonschema:"The expected output from the member (optional)."`
+	WorkingDir     string `json:"working_dir,omitempty" jsonschema:"The directory the member should work in, relative to the current working directory (default: the current working directory)."`
 }
 
 func NewTransferTaskTool() *TransferTaskTool {
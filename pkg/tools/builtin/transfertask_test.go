@@ -53,6 +53,10 @@ func TestTaskTool_Tools(t *testing.T) {
 		"task": {
 			"description": "A clear and concise description of the task the member should achieve.",
 			"type": "string"
+		},
+		"working_dir": {
+			"description": "The directory the member should work in, relative to the current working directory (default: the current working directory).",
+			"type": "string"
 		}
 	},
 	"additionalProperties": false,
@@ -25,6 +25,13 @@ type OAuthCapable interface {
 	SetManagedOAuth(managed bool)
 }
 
+// OAuthStatusReporter is implemented by toolsets that can report their OAuth
+// state: whether the server requires a login, and whether a valid token is
+// currently available.
+type OAuthStatusReporter interface {
+	OAuthStatus() (needsAuth, authenticated bool)
+}
+
 // GetInstructions returns instructions if the toolset implements Instructable.
 // Returns empty string if the toolset doesn't provide instructions.
 func GetInstructions(ts ToolSet) string {
@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Redactor rewrites the arguments of a call to the named tool before they're
+// logged, to hide secrets for example.
+type Redactor func(toolName, arguments string) string
+
+// WithLogger wraps a toolset so that every call of its tools is logged at
+// info level: the tool's name and arguments before it runs, then whether it
+// failed and how long it took. This gives an audit trail of what an agent
+// actually ran, shell commands included. If redact isn't nil, arguments go
+// through it before they're logged. A nil logger returns inner as is.
+func WithLogger(inner ToolSet, logger *slog.Logger, redact Redactor) ToolSet {
+	if logger == nil {
+		return inner
+	}
+
+	return &loggingTools{
+		ToolSet: inner,
+		logger:  logger,
+		redact:  redact,
+	}
+}
+
+type loggingTools struct {
+	ToolSet
+	logger *slog.Logger
+	redact Redactor
+}
+
+// Verify interface compliance
+var (
+	_ Describer    = (*loggingTools)(nil)
+	_ Instructable = (*loggingTools)(nil)
+	_ Unwrapper    = (*loggingTools)(nil)
+)
+
+// Describe implements Describer by delegating to the inner toolset.
+func (l *loggingTools) Describe() string {
+	return DescribeToolSet(l.ToolSet)
+}
+
+// Unwrap implements Unwrapper.
+func (l *loggingTools) Unwrap() ToolSet {
+	return l.ToolSet
+}
+
+// Instructions implements Instructable by delegating to the inner toolset.
+func (l *loggingTools) Instructions() string {
+	return GetInstructions(l.ToolSet)
+}
+
+func (l *loggingTools) Tools(ctx context.Context) ([]Tool, error) {
+	allTools, err := l.ToolSet.Tools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, tool := range allTools {
+		if tool.Handler == nil {
+			continue
+		}
+
+		handler := tool.Handler
+		allTools[i].Handler = func(ctx context.Context, toolCall ToolCall) (*ToolCallResult, error) {
+			arguments := toolCall.Function.Arguments
+			if l.redact != nil {
+				arguments = l.redact(toolCall.Function.Name, arguments)
+			}
+			l.logger.InfoContext(ctx, "Tool call", "tool", toolCall.Function.Name, "call_id", toolCall.ID, "arguments", arguments)
+
+			start := time.Now()
+			res, err := handler(ctx, toolCall)
+
+			attrs := []any{"tool", toolCall.Function.Name, "call_id", toolCall.ID, "duration", time.Since(start)}
+			switch {
+			case err != nil:
+				attrs = append(attrs, "error", err)
+			case res != nil:
+				attrs = append(attrs, "is_error", res.IsError)
+			}
+			l.logger.InfoContext(ctx, "Tool call finished", attrs...)
+
+			return res, err
+		}
+	}
+
+	return allTools, nil
+}
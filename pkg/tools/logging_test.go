@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type shellToolSet struct{}
+
+func (shellToolSet) Tools(context.Context) ([]Tool, error) {
+	return []Tool{{
+		Name: "shell",
+		Handler: func(context.Context, ToolCall) (*ToolCallResult, error) {
+			return ResultSuccess("ok"), nil
+		},
+	}}, nil
+}
+
+func (shellToolSet) Instructions() string { return "Use the shell." }
+
+func TestWithLogger(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	redact := func(_, arguments string) string {
+		return strings.ReplaceAll(arguments, "hunter2", "[REDACTED]")
+	}
+
+	ts := WithLogger(shellToolSet{}, logger, redact)
+	assert.Equal(t, "Use the shell.", GetInstructions(ts))
+	_, ok := As[shellToolSet](ts)
+	assert.True(t, ok)
+
+	allTools, err := ts.Tools(t.Context())
+	require.NoError(t, err)
+	require.Len(t, allTools, 1)
+
+	res, err := allTools[0].Handler(t.Context(), ToolCall{
+		ID:       "call_1",
+		Function: FunctionCall{Name: "shell", Arguments: `{"cmd":"login --password hunter2"}`},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", res.Output)
+
+	logs := buf.String()
+	assert.Contains(t, logs, `level=INFO msg="Tool call" tool=shell call_id=call_1`)
+	assert.Contains(t, logs, `[REDACTED]`)
+	assert.NotContains(t, logs, "hunter2")
+	assert.Contains(t, logs, `msg="Tool call finished" tool=shell call_id=call_1`)
+	assert.Contains(t, logs, "is_error=false")
+}
+
+func TestWithLoggerWithoutLogger(t *testing.T) {
+	t.Parallel()
+
+	inner := shellToolSet{}
+	assert.Equal(t, ToolSet(inner), WithLogger(inner, nil, nil))
+}
@@ -541,6 +541,15 @@ func (ts *Toolset) SetManagedOAuth(managed bool) {
 	ts.mcpClient.SetManagedOAuth(managed)
 }
 
+// OAuthStatus reports the OAuth state of the underlying client. Clients that
+// don't use OAuth (e.g. stdio) never need authentication.
+func (ts *Toolset) OAuthStatus() (needsAuth, authenticated bool) {
+	if r, ok := ts.mcpClient.(tools.OAuthStatusReporter); ok {
+		return r.OAuthStatus()
+	}
+	return false, false
+}
+
 func (ts *Toolset) SetToolsChangedHandler(handler func()) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
@@ -192,6 +192,7 @@ func (t *oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	if resp.StatusCode == http.StatusUnauthorized {
 		wwwAuth := resp.Header.Get("WWW-Authenticate")
 		if wwwAuth != "" {
+			t.client.authRequired.Store(true)
 			resp.Body.Close()
 
 			authServer := req.URL.Scheme + "://" + req.URL.Host
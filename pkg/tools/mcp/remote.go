@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 
 	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
 
@@ -18,6 +19,7 @@ type remoteMCPClient struct {
 	headers       map[string]string
 	tokenStore    OAuthTokenStore
 	managed       bool
+	authRequired  atomic.Bool // set once the server answered with an OAuth challenge
 }
 
 func newRemoteClient(url, transportType string, headers map[string]string, tokenStore OAuthTokenStore) *remoteMCPClient {
@@ -93,6 +95,14 @@ func (c *remoteMCPClient) SetManagedOAuth(managed bool) {
 	c.mu.Unlock()
 }
 
+// OAuthStatus reports whether the server asked for OAuth and whether a
+// non-expired token is stored for it.
+func (c *remoteMCPClient) OAuthStatus() (needsAuth, authenticated bool) {
+	token, err := c.tokenStore.GetToken(c.url)
+	authenticated = err == nil && token != nil && !token.IsExpired()
+	return c.authRequired.Load(), authenticated
+}
+
 // createHTTPClient creates an HTTP client with custom headers and OAuth support.
 // Header values may contain ${headers.NAME} placeholders that are resolved
 // at request time from upstream headers stored in the request context.
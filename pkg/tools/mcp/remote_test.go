@@ -180,3 +180,28 @@ func TestRemoteClientEmptyHeaders(t *testing.T) {
 		t.Fatal("Server did not receive request within timeout")
 	}
 }
+
+func TestRemoteClientOAuthStatus(t *testing.T) {
+	t.Parallel()
+
+	tokenStore := NewInMemoryTokenStore()
+	client := newRemoteClient("http://example.invalid/mcp", "streamable", nil, tokenStore)
+
+	needsAuth, authenticated := client.OAuthStatus()
+	assert.False(t, needsAuth)
+	assert.False(t, authenticated)
+
+	client.authRequired.Store(true)
+	needsAuth, authenticated = client.OAuthStatus()
+	assert.True(t, needsAuth)
+	assert.False(t, authenticated)
+
+	require.NoError(t, tokenStore.StoreToken("http://example.invalid/mcp", &OAuthToken{AccessToken: "token"}))
+	needsAuth, authenticated = client.OAuthStatus()
+	assert.True(t, needsAuth)
+	assert.True(t, authenticated)
+
+	require.NoError(t, tokenStore.StoreToken("http://example.invalid/mcp", &OAuthToken{AccessToken: "token", ExpiresAt: time.Now().Add(-time.Minute)}))
+	_, authenticated = client.OAuthStatus()
+	assert.False(t, authenticated)
+}
@@ -68,6 +68,10 @@ type ToolCallResult struct {
 	// tool whose definition includes an OutputSchema. When non-nil it is the
 	// JSON-decoded structured result from the server.
 	StructuredContent any `json:"structuredContent,omitempty"`
+	// RawOutput optionally holds the full result when Output was truncated
+	// or redacted for the model. It's persisted with the tool message for
+	// audit but never sent to the model.
+	RawOutput string `json:"rawOutput,omitempty"`
 }
 
 func ResultError(output string) *ToolCallResult {
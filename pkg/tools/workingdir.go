@@ -0,0 +1,18 @@
+package tools
+
+import "context"
+
+type workingDirKey struct{}
+
+// WithWorkingDir returns a new context carrying the working directory of the
+// session a tool call is made for.
+func WithWorkingDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, workingDirKey{}, dir)
+}
+
+// WorkingDirFromContext returns the session working directory carried by the
+// context, or "" if there is none.
+func WorkingDirFromContext(ctx context.Context) string {
+	dir, _ := ctx.Value(workingDirKey{}).(string)
+	return dir
+}
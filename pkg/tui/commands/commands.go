@@ -57,6 +57,16 @@ func builtInSessionCommands() []Item {
 				return core.CmdHandler(messages.CompactSessionMsg{AdditionalPrompt: arg})
 			},
 		},
+		{
+			ID:           "session.cancel_compaction",
+			Label:        "Cancel Compaction",
+			SlashCommand: "/cancel-compact",
+			Description:  "Cancel the summary being generated and keep the full conversation",
+			Category:     "Session",
+			Execute: func(string) tea.Cmd {
+				return core.CmdHandler(messages.CancelCompactionMsg{})
+			},
+		},
 		{
 			ID:           "session.clipboard",
 			Label:        "Copy",
@@ -67,6 +77,16 @@ func builtInSessionCommands() []Item {
 				return core.CmdHandler(messages.CopySessionToClipboardMsg{})
 			},
 		},
+		{
+			ID:           "session.clipboard_with_system",
+			Label:        "Copy With System Prompt",
+			SlashCommand: "/copy-full",
+			Description:  "Copy the current conversation, including the system prompt, to the clipboard",
+			Category:     "Session",
+			Execute: func(string) tea.Cmd {
+				return core.CmdHandler(messages.CopySessionToClipboardMsg{IncludeSystem: true})
+			},
+		},
 		{
 			ID:           "session.copy_last_response",
 			Label:        "Copy Last Response",
@@ -225,6 +245,16 @@ func builtInSessionCommands() []Item {
 
 func builtInSettingsCommands() []Item {
 	return []Item{
+		{
+			ID:           "settings.newline",
+			Label:        "Newline Key",
+			SlashCommand: "/newline",
+			Description:  "Toggle using ctrl+j instead of shift+enter for newlines",
+			Category:     "Settings",
+			Execute: func(string) tea.Cmd {
+				return core.CmdHandler(messages.ToggleLegacyNewlineMsg{})
+			},
+		},
 		{
 			ID:           "settings.split-diff",
 			Label:        "Split Diff",
@@ -6,6 +6,7 @@ import (
 	"charm.land/lipgloss/v2"
 	"github.com/mattn/go-runewidth"
 
+	"github.com/docker/cagent/pkg/sanitize"
 	"github.com/docker/cagent/pkg/tui/styles"
 )
 
@@ -100,13 +101,13 @@ func (b *attachmentBanner) buildRegions(pills []string, separator string) {
 	}
 
 	pos := 0
-	sepWidth := runewidth.StringWidth(stripANSI(separator))
+	sepWidth := runewidth.StringWidth(sanitize.StripANSI(separator))
 
 	for i, pill := range pills {
 		if i > 0 {
 			pos += sepWidth
 		}
-		width := runewidth.StringWidth(stripANSI(pill))
+		width := runewidth.StringWidth(sanitize.StripANSI(pill))
 		b.regions = append(b.regions, bannerRegion{
 			start: pos,
 			end:   pos + width,
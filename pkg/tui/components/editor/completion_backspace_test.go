@@ -21,7 +21,7 @@ type mockCompletion struct {
 func (m *mockCompletion) Trigger() string                 { return m.trigger }
 func (m *mockCompletion) Items() []completion.Item        { return m.items }
 func (m *mockCompletion) AutoSubmit() bool                { return false }
-func (m *mockCompletion) RequiresEmptyEditor() bool       { return true }
+func (m *mockCompletion) RequiresWordStart() bool         { return true }
 func (m *mockCompletion) MatchMode() completion.MatchMode { return completion.MatchFuzzy }
 
 var _ completions.Completion = (*mockCompletion)(nil)
@@ -0,0 +1,94 @@
+package editor
+
+import (
+	"testing"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/cagent/pkg/tui/components/completion"
+	"github.com/docker/cagent/pkg/tui/components/editor/completions"
+)
+
+func TestSlashCompletionTriggersAtWordStart(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		value   string
+		trigger bool
+	}{
+		{name: "empty editor", value: "", trigger: true},
+		{name: "after a space", value: "run this ", trigger: true},
+		{name: "after a newline", value: "first line\n", trigger: true},
+		{name: "inside a word", value: "path", trigger: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			e := newTestEditor(tt.value, "")
+			e.currentCompletion = nil
+
+			_, _ = e.Update(tea.KeyPressMsg{Code: '/', Text: "/"})
+
+			assert.Equal(t, tt.value+"/", e.textarea.Value())
+			if tt.trigger {
+				require.NotNil(t, e.currentCompletion)
+				assert.Equal(t, "/", e.currentCompletion.Trigger())
+			} else {
+				assert.Nil(t, e.currentCompletion)
+			}
+		})
+	}
+}
+
+func TestSlashCompletionAfterTextInsertsCommand(t *testing.T) {
+	t.Parallel()
+
+	e := newTestEditor("please run /com", "com")
+	e.currentCompletion = &autoSubmitCompletion{mockCompletion: e.currentCompletion.(*mockCompletion)}
+
+	_, _ = e.Update(completion.SelectedMsg{Value: "/compact"})
+
+	// The command is inserted in place instead of replacing the whole message.
+	assert.Equal(t, "please run /compact ", e.textarea.Value())
+}
+
+func TestSlashCompletionAtStartSubmitsCommand(t *testing.T) {
+	t.Parallel()
+
+	e := newTestEditor("/com", "com")
+	e.currentCompletion = &autoSubmitCompletion{mockCompletion: e.currentCompletion.(*mockCompletion)}
+
+	_, cmd := e.Update(completion.SelectedMsg{Value: "/compact"})
+
+	require.NotNil(t, cmd)
+	assert.Empty(t, e.textarea.Value())
+}
+
+func TestExtraCompletionsAreOffered(t *testing.T) {
+	t.Parallel()
+
+	tickets := &mockCompletion{
+		trigger: "#",
+		items:   []completion.Item{{Label: "PROJ-42", Value: "PROJ-42"}},
+	}
+
+	e := newTestEditor("", "")
+	e.currentCompletion = nil
+	e.completions = completions.Completions(nil, tickets)
+
+	_, _ = e.Update(tea.KeyPressMsg{Code: '#', Text: "#"})
+
+	require.NotNil(t, e.currentCompletion)
+	assert.Same(t, tickets, e.currentCompletion)
+}
+
+type autoSubmitCompletion struct {
+	*mockCompletion
+}
+
+func (c *autoSubmitCompletion) AutoSubmit() bool { return true }
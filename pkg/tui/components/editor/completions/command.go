@@ -22,7 +22,7 @@ func (c *commandCompletion) AutoSubmit() bool {
 	return true // Commands auto-submit: selecting inserts command text and sends it
 }
 
-func (c *commandCompletion) RequiresEmptyEditor() bool {
+func (c *commandCompletion) RequiresWordStart() bool {
 	return true
 }
 
@@ -7,11 +7,26 @@ import (
 	"github.com/docker/cagent/pkg/tui/components/completion"
 )
 
+// Completion is a source of completion items for the editor. A completion
+// opens when its trigger is typed and offers its items in a popup; the
+// selected item's Value is inserted in place of the trigger and the typed
+// query. Embedders can implement it to add their own sources and pass them
+// to editor.New.
 type Completion interface {
+	// Trigger returns the text that opens the completion, e.g. "/" or "@".
+	// Only the first completion registered for a trigger is used.
 	Trigger() string
+	// Items returns the items to offer. It is called every time the
+	// completion opens, so it should be cheap; implement AsyncLoader for
+	// sources that are slow to load.
 	Items() []completion.Item
+	// AutoSubmit reports whether selecting an item sends the message right
+	// away when the trigger started the message.
 	AutoSubmit() bool
-	RequiresEmptyEditor() bool
+	// RequiresWordStart reports whether the trigger only opens the completion
+	// when typed at the start of a word: at the beginning of a line or after
+	// whitespace.
+	RequiresWordStart() bool
 	// MatchMode returns how items should be filtered (fuzzy or prefix)
 	MatchMode() completion.MatchMode
 }
@@ -28,9 +43,10 @@ type AsyncLoader interface {
 	LoadItemsAsync(ctx context.Context) <-chan []completion.Item
 }
 
-func Completions(a *app.App) []Completion {
-	return []Completion{
+// Completions returns the built-in completions followed by any extra ones.
+func Completions(a *app.App, extra ...Completion) []Completion {
+	return append([]Completion{
 		NewCommandCompletion(a),
 		NewFileCompletion(),
-	}
+	}, extra...)
 }
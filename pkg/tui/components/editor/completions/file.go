@@ -29,7 +29,7 @@ func (c *fileCompletion) AutoSubmit() bool {
 	return false
 }
 
-func (c *fileCompletion) RequiresEmptyEditor() bool {
+func (c *fileCompletion) RequiresWordStart() bool {
 	return false
 }
 
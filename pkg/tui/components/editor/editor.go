@@ -6,9 +6,9 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
+	"unicode"
 
 	"charm.land/bubbles/v2/key"
 	"charm.land/bubbles/v2/textarea"
@@ -23,18 +23,16 @@ import (
 	"github.com/docker/cagent/pkg/app"
 	"github.com/docker/cagent/pkg/history"
 	"github.com/docker/cagent/pkg/paths"
+	"github.com/docker/cagent/pkg/sanitize"
 	"github.com/docker/cagent/pkg/tui/components/completion"
 	"github.com/docker/cagent/pkg/tui/components/editor/completions"
 	"github.com/docker/cagent/pkg/tui/core"
 	"github.com/docker/cagent/pkg/tui/core/layout"
 	"github.com/docker/cagent/pkg/tui/messages"
 	"github.com/docker/cagent/pkg/tui/styles"
+	"github.com/docker/cagent/pkg/userconfig"
 )
 
-// ansiRegexp matches ANSI escape sequences so they can be removed when
-// computing layout measurements.
-var ansiRegexp = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
-
 const (
 	// maxInlinePasteLines is the maximum number of lines for inline paste.
 	// Pastes exceeding this are buffered to a temp file attachment.
@@ -88,6 +86,9 @@ type Editor interface {
 	EnterHistorySearch() (layout.Model, tea.Cmd)
 	// SendContent triggers sending the current editor content
 	SendContent() tea.Cmd
+	// SetLegacyNewline forces ctrl+j as the only newline key, regardless of
+	// the keyboard enhancements reported by the terminal
+	SetLegacyNewline(enabled bool)
 }
 
 // fileLoadResultMsg is sent when async file loading completes.
@@ -128,6 +129,9 @@ type editor struct {
 	userTyped bool
 	// keyboardEnhancementsSupported tracks whether the terminal supports keyboard enhancements
 	keyboardEnhancementsSupported bool
+	// legacyNewline forces the ctrl+j newline binding even when the terminal
+	// reports keyboard enhancements
+	legacyNewline bool
 	// pendingFileRef tracks the current @word being typed (for manual file ref detection).
 	// Only set when cursor is in a word starting with @, cleared when cursor leaves.
 	pendingFileRef string
@@ -157,8 +161,9 @@ type editor struct {
 	searchInput textinput.Model
 }
 
-// New creates a new editor component
-func New(a *app.App, hist *history.History) Editor {
+// New creates a new editor component. Extra completions are offered after
+// the built-in slash command and file completions.
+func New(a *app.App, hist *history.History, extraCompletions ...completions.Completion) Editor {
 	ta := textarea.New()
 	ta.SetStyles(styles.InputStyle)
 	ta.Placeholder = "Type your message here…"
@@ -185,8 +190,9 @@ func New(a *app.App, hist *history.History) Editor {
 		textarea:                      ta,
 		searchInput:                   si,
 		hist:                          hist,
-		completions:                   completions.Completions(a),
+		completions:                   completions.Completions(a, extraCompletions...),
 		keyboardEnhancementsSupported: false,
+		legacyNewline:                 userconfig.Get().LegacyNewlineKey,
 		banner:                        newAttachmentBanner(),
 	}
 
@@ -200,16 +206,10 @@ func (e *editor) Init() tea.Cmd {
 	return textarea.Blink
 }
 
-// stripANSI removes ANSI escape sequences from the provided string so width
-// calculations can be performed on plain text.
-func stripANSI(s string) string {
-	return ansiRegexp.ReplaceAllString(s, "")
-}
-
 // lineHasContent reports whether the rendered line has user input after the
 // prompt has been stripped.
 func lineHasContent(line, prompt string) bool {
-	plain := stripANSI(line)
+	plain := sanitize.StripANSI(line)
 	if prompt != "" && strings.HasPrefix(plain, prompt) {
 		plain = strings.TrimPrefix(plain, prompt)
 	}
@@ -220,7 +220,7 @@ func lineHasContent(line, prompt string) bool {
 // extractLineText extracts the user input text from a rendered view line,
 // stripping ANSI codes and the prompt prefix.
 func extractLineText(line, prompt string) string {
-	plain := stripANSI(line)
+	plain := sanitize.StripANSI(line)
 	if prompt != "" && strings.HasPrefix(plain, prompt) {
 		plain = strings.TrimPrefix(plain, prompt)
 	}
@@ -276,7 +276,7 @@ func (e *editor) computeWrappedLines(text string, startOffset int) []string {
 func (e *editor) applySuggestionOverlay(view string) string {
 	lines := strings.Split(view, "\n")
 	value := e.textarea.Value()
-	promptWidth := runewidth.StringWidth(stripANSI(e.textarea.Prompt))
+	promptWidth := runewidth.StringWidth(sanitize.StripANSI(e.textarea.Prompt))
 
 	// Use LineInfo to get the actual cursor position within soft-wrapped lines
 	lineInfo := e.textarea.LineInfo()
@@ -579,10 +579,11 @@ func (e *editor) resetAndSend(content string) tea.Cmd {
 }
 
 // configureNewlineKeybinding sets up the appropriate newline keybinding
-// based on terminal keyboard enhancement support.
+// based on terminal keyboard enhancement support, unless the legacy binding
+// is forced.
 func (e *editor) configureNewlineKeybinding() {
 	// Configure textarea's InsertNewline binding based on terminal capabilities
-	if e.keyboardEnhancementsSupported {
+	if e.keyboardEnhancementsSupported && !e.legacyNewline {
 		// Modern terminals:
 		e.textarea.KeyMap.InsertNewline.SetKeys("shift+enter", "ctrl+j")
 		e.textarea.KeyMap.InsertNewline.SetEnabled(true)
@@ -654,7 +655,7 @@ func (e *editor) Update(msg tea.Msg) (layout.Model, tea.Cmd) {
 			e.clearSuggestion()
 			return e, msg.Execute()
 		}
-		if e.currentCompletion.AutoSubmit() {
+		if e.currentCompletion.AutoSubmit() && e.completionStartsMessage() {
 			// For auto-submit completions (like commands), use the selected
 			// command value (e.g., "/exit") instead of what the user typed
 			// (e.g., "/e"). Append any extra text after the trigger word
@@ -667,7 +668,8 @@ func (e *editor) Update(msg tea.Msg) (layout.Model, tea.Cmd) {
 			cmd := e.resetAndSend(msg.Value + extraText)
 			return e, cmd
 		}
-		// For non-auto-submit completions (like file paths), replace the completion word
+		// For non-auto-submit completions (like file paths), and commands typed
+		// after existing text, replace the completion word
 		currentValue := e.textarea.Value()
 		if lastIdx := strings.LastIndex(currentValue, e.completionWord); lastIdx >= 0 {
 			newValue := currentValue[:lastIdx-1] + msg.Value + " " + currentValue[lastIdx+len(e.completionWord):]
@@ -811,10 +813,11 @@ func (e *editor) Update(msg tea.Msg) (layout.Model, tea.Cmd) {
 		default:
 			for _, completion := range e.completions {
 				if msg.String() == completion.Trigger() {
-					if completion.RequiresEmptyEditor() && e.textarea.Value() != "" {
+					if completion.RequiresWordStart() && !e.atWordStart() {
 						continue
 					}
 					cmds = append(cmds, e.startCompletion(completion))
+					break
 				}
 			}
 		}
@@ -982,6 +985,41 @@ func (e *editor) handleGraphemeBackspace() (layout.Model, tea.Cmd) {
 	return e, tea.Batch(textarea.Blink, e.updateCompletionQuery())
 }
 
+// atWordStart reports whether the cursor is at the start of a word: at the
+// beginning of a line or right after whitespace.
+func (e *editor) atWordStart() bool {
+	lines := strings.Split(e.textarea.Value(), "\n")
+	row := e.textarea.Line()
+	if row < 0 || row >= len(lines) {
+		return true
+	}
+
+	lineInfo := e.textarea.LineInfo()
+	colPos := lineInfo.CharOffset + lineInfo.StartColumn
+	if colPos == 0 {
+		return true
+	}
+
+	// Column positions are display widths; find the rune just before the cursor.
+	var prev rune
+	width := 0
+	for _, r := range lines[row] {
+		if width >= colPos {
+			break
+		}
+		width += runewidth.RuneWidth(r)
+		prev = r
+	}
+	return unicode.IsSpace(prev)
+}
+
+// completionStartsMessage reports whether the word being completed is the
+// first thing in the editor, which is where commands can be submitted from.
+func (e *editor) completionStartsMessage() bool {
+	triggerWord := e.currentCompletion.Trigger() + e.completionWord
+	return strings.HasPrefix(strings.TrimLeftFunc(e.textarea.Value(), unicode.IsSpace), triggerWord)
+}
+
 // updateCompletionQuery sends the appropriate completion message based on current editor state.
 // It returns a command that either updates the completion query or closes the completion popup.
 func (e *editor) updateCompletionQuery() tea.Cmd {
@@ -1432,6 +1470,12 @@ func (e *editor) tickRecordingDots() tea.Cmd {
 	})
 }
 
+// SetLegacyNewline forces ctrl+j as the only newline key when enabled.
+func (e *editor) SetLegacyNewline(enabled bool) {
+	e.legacyNewline = enabled
+	e.configureNewlineKeybinding()
+}
+
 // IsRecording returns true if the editor is in recording mode
 func (e *editor) IsRecording() bool {
 	return e.recording
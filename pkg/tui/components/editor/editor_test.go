@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"charm.land/bubbles/v2/textarea"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -338,3 +339,17 @@ func TestDeleteLastGraphemeCluster(t *testing.T) {
 		})
 	}
 }
+
+func TestLegacyNewlineKeybinding(t *testing.T) {
+	t.Parallel()
+
+	e := &editor{textarea: textarea.New(), keyboardEnhancementsSupported: true}
+	e.configureNewlineKeybinding()
+	assert.Equal(t, []string{"shift+enter", "ctrl+j"}, e.textarea.KeyMap.InsertNewline.Keys())
+
+	e.SetLegacyNewline(true)
+	assert.Equal(t, []string{"ctrl+j"}, e.textarea.KeyMap.InsertNewline.Keys())
+
+	e.SetLegacyNewline(false)
+	assert.Equal(t, []string{"shift+enter", "ctrl+j"}, e.textarea.KeyMap.InsertNewline.Keys())
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/docker/cagent/pkg/app"
 	"github.com/docker/cagent/pkg/history"
+	"github.com/docker/cagent/pkg/sanitize"
 )
 
 func TestApplySuggestionOverlay(t *testing.T) {
@@ -215,7 +216,7 @@ func TestApplySuggestionOverlayWithVariousLineCount(t *testing.T) {
 				"result should have at least %d lines", tt.expectedLine+1)
 
 			// Get the line where we expect the suggestion
-			targetLine := stripANSI(lines[tt.expectedLine])
+			targetLine := sanitize.StripANSI(lines[tt.expectedLine])
 
 			// The suggestion should appear on this line (first char has cursor style, rest is ghost)
 			// Check that the suggestion text appears on the target line
@@ -297,7 +298,7 @@ func TestApplySuggestionOverlayWithMultiLineSuggestion(t *testing.T) {
 				require.Greater(t, len(lines), tt.expectedLine)
 
 				firstSuggestionPart := strings.Split(tt.suggestion, "\n")[0]
-				targetLine := stripANSI(lines[tt.expectedLine])
+				targetLine := sanitize.StripANSI(lines[tt.expectedLine])
 				assert.Contains(t, targetLine, firstSuggestionPart,
 					"first part of suggestion %q should appear on line %d, got %q",
 					firstSuggestionPart, tt.expectedLine, targetLine)
@@ -485,9 +486,9 @@ func TestMultiLineSuggestionWithSmallEditor(t *testing.T) {
 	require.GreaterOrEqual(t, len(resultLines), 3, "result should have at least 3 lines for multi-line suggestion")
 
 	// Check that each suggestion line is present
-	assert.Contains(t, stripANSI(resultLines[0]), "Anything", "first line should contain merged text")
-	assert.Contains(t, stripANSI(resultLines[1]), "line2", "second line should contain line2")
-	assert.Contains(t, stripANSI(resultLines[2]), "line3", "third line should contain line3")
+	assert.Contains(t, sanitize.StripANSI(resultLines[0]), "Anything", "first line should contain merged text")
+	assert.Contains(t, sanitize.StripANSI(resultLines[1]), "line2", "second line should contain line2")
+	assert.Contains(t, sanitize.StripANSI(resultLines[2]), "line3", "third line should contain line3")
 }
 
 // TestLongSuggestionWrapping verifies that long suggestions (without newlines)
@@ -518,7 +519,7 @@ func TestLongSuggestionWrapping(t *testing.T) {
 	require.GreaterOrEqual(t, len(resultLines), 3, "long suggestion should wrap to at least 3 lines")
 
 	// First line should have "L" + start of suggestion
-	line0 := stripANSI(resultLines[0])
+	line0 := sanitize.StripANSI(resultLines[0])
 	assert.True(t, strings.HasPrefix(line0, "L"), "first line should start with L")
 	assert.Contains(t, line0, "ook", "first line should contain start of suggestion")
 }
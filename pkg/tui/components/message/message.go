@@ -1,6 +1,7 @@
 package message
 
 import (
+	"cmp"
 	"fmt"
 	"regexp"
 	"strings"
@@ -94,7 +95,7 @@ func (mv *messageModel) Render(width int) string {
 		}
 
 		if msg.SessionPosition == nil {
-			return messageStyle.Width(width).Render(msg.Content)
+			return messageStyle.Width(width).Render(withImageLabels(msg.Content, msg.Images))
 		}
 
 		// For editable messages, place the pencil icon in the top padding row
@@ -103,6 +104,7 @@ func (mv *messageModel) Render(width int) string {
 		if content == "" {
 			content = msg.Content
 		}
+		content = withImageLabels(content, msg.Images)
 
 		// Create the edit icon for the top row
 		editIcon := styles.MutedStyle.Render(types.UserMessageEditLabel)
@@ -270,3 +272,32 @@ func preserveIndentation(line string) string {
 	}
 	return strings.Repeat("\u00A0", leadingSpaces) + line[leadingSpaces:]
 }
+
+// withImageLabels appends a label for each image attached to a message.
+// Images aren't drawn inline: graphics escape sequences don't survive the
+// cell-based rendering of the chat.
+func withImageLabels(content string, images []string) string {
+	if len(images) == 0 {
+		return content
+	}
+
+	var b strings.Builder
+	b.WriteString(content)
+	for _, url := range images {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(styles.MutedStyle.Render(imageLabel(url)))
+	}
+	return b.String()
+}
+
+// imageLabel describes an image by its URL. Data URLs are summarized by their
+// media type rather than printed in full.
+func imageLabel(url string) string {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		mediaType, _, _ := strings.Cut(rest, ";")
+		return "[image: " + cmp.Or(mediaType, "inline data") + "]"
+	}
+	return "[image: " + url + "]"
+}
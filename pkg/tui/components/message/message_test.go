@@ -213,3 +213,18 @@ func TestWelcomeMessagePreservesLineBreaks(t *testing.T) {
 	plainRendered := stripANSI(rendered)
 	assert.Contains(t, plainRendered, "indented")
 }
+
+func TestUserMessageShowsImageLabels(t *testing.T) {
+	t.Parallel()
+
+	msg := types.User("Look at these")
+	msg.Images = []string{"https://example.com/cat.png", "data:image/jpeg;base64,/9j/4AAQSkZJRg=="}
+	mv := New(msg, nil)
+	mv.SetSize(80, 0)
+
+	rendered := stripANSI(mv.View())
+	assert.Contains(t, rendered, "Look at these")
+	assert.Contains(t, rendered, "[image: https://example.com/cat.png]")
+	assert.Contains(t, rendered, "[image: image/jpeg]")
+	assert.NotContains(t, rendered, "base64")
+}
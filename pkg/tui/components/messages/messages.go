@@ -46,7 +46,7 @@ type Model interface {
 
 	AddUserMessage(content string) tea.Cmd
 	AddLoadingMessage(description string) tea.Cmd
-	ReplaceLoadingWithUser(content string, sessionPos int) tea.Cmd
+	ReplaceLoadingWithUser(content string, images []string, sessionPos int) tea.Cmd
 	AddErrorMessage(content string) tea.Cmd
 	AddAssistantMessage() tea.Cmd
 	AddCancelledMessage() tea.Cmd
@@ -452,6 +452,21 @@ func (m *model) handleKeyPress(msg tea.KeyPressMsg) (layout.Model, tea.Cmd) {
 			}
 		}
 		return m, nil
+	case "E":
+		if m.focused && m.selectedMessageIndex >= 0 {
+			msg := m.messages[m.selectedMessageIndex]
+			if msg.Type == types.MessageTypeUser && msg.SessionPosition != nil {
+				return m, func() tea.Msg {
+					return messages.EditUserMessageMsg{
+						MsgIndex:        m.selectedMessageIndex,
+						SessionPosition: *msg.SessionPosition,
+						OriginalContent: msg.Content,
+						InPlace:         true,
+					}
+				}
+			}
+		}
+		return m, nil
 	case "pgup":
 		m.scrollPageUp()
 		return m, nil
@@ -464,6 +479,12 @@ func (m *model) handleKeyPress(msg tea.KeyPressMsg) (layout.Model, tea.Cmd) {
 	case "end":
 		m.scrollToBottom()
 		return m, nil
+	case "[":
+		m.jumpToPreviousToolCall()
+		return m, nil
+	case "]":
+		m.jumpToNextToolCall()
+		return m, nil
 	}
 	return m, nil
 }
@@ -639,13 +660,17 @@ func (m *model) Bindings() []key.Binding {
 		key.NewBinding(key.WithKeys("up"), key.WithHelp("↑", "select prev")),
 		key.NewBinding(key.WithKeys("down"), key.WithHelp("↓", "select next")),
 		key.NewBinding(key.WithKeys("c"), key.WithHelp("c", "copy message")),
+		key.NewBinding(key.WithKeys("[", "]"), key.WithHelp("[/]", "prev/next tool call")),
 	}
 
 	// Only show edit binding when a user message with session position is selected
 	if m.selectedMessageIndex >= 0 && m.selectedMessageIndex < len(m.messages) {
 		msg := m.messages[m.selectedMessageIndex]
 		if msg.Type == types.MessageTypeUser && msg.SessionPosition != nil {
-			bindings = append(bindings, key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "edit message")))
+			bindings = append(bindings,
+				key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "edit message")),
+				key.NewBinding(key.WithKeys("E"), key.WithHelp("E", "rewrite message")),
+			)
 		}
 	}
 
@@ -736,6 +761,67 @@ func (m *model) scrollByWheel(delta int) {
 	}
 }
 
+// jumpToNextToolCall scrolls so that the first tool call below the top of the
+// viewport becomes the first visible line.
+func (m *model) jumpToNextToolCall() {
+	for _, line := range m.toolCallStartLines() {
+		if line > m.scrollOffset {
+			m.setScrollOffset(line)
+			m.bottomSlack = 0
+			m.userHasScrolled = !m.isAtBottom()
+			return
+		}
+	}
+}
+
+// jumpToPreviousToolCall scrolls so that the last tool call above the top of
+// the viewport becomes the first visible line.
+func (m *model) jumpToPreviousToolCall() {
+	lines := m.toolCallStartLines()
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i] < m.scrollOffset {
+			m.userHasScrolled = true
+			m.bottomSlack = 0
+			m.setScrollOffset(lines[i])
+			return
+		}
+	}
+}
+
+// toolCallStartLines returns the first rendered line of every item that shows
+// tool calls, either standalone or grouped in a reasoning block.
+func (m *model) toolCallStartLines() []int {
+	m.ensureAllItemsRendered()
+
+	var lines []int
+	line := 0
+	for i, view := range m.views {
+		if m.isToolCallItem(i) {
+			lines = append(lines, line)
+		}
+		line += m.renderItem(i, view).height
+		if m.needsSeparator(i) {
+			line++
+		}
+	}
+	return lines
+}
+
+func (m *model) isToolCallItem(index int) bool {
+	if index < 0 || index >= len(m.messages) {
+		return false
+	}
+	switch m.messages[index].Type {
+	case types.MessageTypeToolCall:
+		return true
+	case types.MessageTypeAssistantReasoningBlock:
+		block, ok := m.views[index].(*reasoningblock.Model)
+		return ok && block.ToolCount() > 0
+	default:
+		return false
+	}
+}
+
 func (m *model) setScrollOffset(offset int) {
 	maxOffset := max(0, m.totalScrollableHeight()-m.height)
 	m.scrollOffset = max(0, min(offset, maxOffset))
@@ -1082,7 +1168,7 @@ func (m *model) AddLoadingMessage(description string) tea.Cmd {
 	return m.addMessage(types.Loading(description))
 }
 
-func (m *model) ReplaceLoadingWithUser(content string, sessionPos int) tea.Cmd {
+func (m *model) ReplaceLoadingWithUser(content string, images []string, sessionPos int) tea.Cmd {
 	for i := len(m.messages) - 1; i >= 0; i-- {
 		if m.messages[i].Type == types.MessageTypeLoading {
 			m.messages = append(m.messages[:i], m.messages[i+1:]...)
@@ -1094,6 +1180,7 @@ func (m *model) ReplaceLoadingWithUser(content string, sessionPos int) tea.Cmd {
 		}
 	}
 	msg := types.User(content)
+	msg.Images = images
 	if sessionPos >= 0 {
 		pos := sessionPos
 		msg.SessionPosition = &pos
@@ -1193,11 +1280,12 @@ func (m *model) LoadFromSession(sess *session.Session) tea.Cmd {
 	}
 
 	// addStandaloneToolCall adds a tool call as a standalone message (not in a reasoning block)
-	addStandaloneToolCall := func(agentName string, tc tools.ToolCall, toolDef tools.Tool, toolResults map[string]string) {
+	addStandaloneToolCall := func(agentName string, tc tools.ToolCall, toolDef tools.Tool, toolResults map[string]*chat.Message) {
 		toolMsg := types.ToolCallMessage(agentName, tc, toolDef, types.ToolStatusCompleted)
 		// Apply tool result if available
 		if result, ok := toolResults[tc.ID]; ok {
-			toolMsg.Content = strings.ReplaceAll(result, "\t", "    ")
+			toolMsg.Content = strings.ReplaceAll(result.Content, "\t", "    ")
+			toolMsg.ToolStatus = toolResultStatus(result)
 		}
 		view := m.createToolCallView(toolMsg)
 		appendSessionMessage(toolMsg, view)
@@ -1215,14 +1303,14 @@ func (m *model) LoadFromSession(sess *session.Session) tea.Cmd {
 	var cmds []tea.Cmd
 
 	// First pass: collect tool results by ToolCallID
-	toolResults := make(map[string]string)
+	toolResults := make(map[string]*chat.Message)
 	for _, item := range sess.Messages {
 		if !item.IsMessage() {
 			continue
 		}
 		smsg := item.Message
 		if smsg.Message.Role == chat.MessageRoleTool && smsg.Message.ToolCallID != "" {
-			toolResults[smsg.Message.ToolCallID] = smsg.Message.Content
+			toolResults[smsg.Message.ToolCallID] = &smsg.Message
 		}
 	}
 
@@ -1239,6 +1327,7 @@ func (m *model) LoadFromSession(sess *session.Session) tea.Cmd {
 		switch smsg.Message.Role {
 		case chat.MessageRoleUser:
 			msg := types.User(smsg.Message.Content)
+			msg.Images = types.ImageURLs(smsg.Message.MultiContent)
 			msgPos := pos
 			msg.SessionPosition = &msgPos
 			appendSessionMessage(msg, m.createMessageView(msg))
@@ -1280,7 +1369,7 @@ func (m *model) LoadFromSession(sess *session.Session) tea.Cmd {
 						toolMsg := types.ToolCallMessage(smsg.AgentName, tc, toolDef, types.ToolStatusCompleted)
 						reasoningBlock.AddToolCall(toolMsg)
 						if result, ok := toolResults[tc.ID]; ok {
-							reasoningBlock.UpdateToolResult(tc.ID, result, types.ToolStatusCompleted, nil)
+							reasoningBlock.UpdateToolResult(tc.ID, result.Content, toolResultStatus(result), nil)
 						}
 						continue
 					}
@@ -1301,6 +1390,14 @@ func (m *model) LoadFromSession(sess *session.Session) tea.Cmd {
 	return tea.Batch(cmds...)
 }
 
+// toolResultStatus returns the status of a tool call given its stored result.
+func toolResultStatus(result *chat.Message) types.ToolStatus {
+	if result.IsError {
+		return types.ToolStatusError
+	}
+	return types.ToolStatusCompleted
+}
+
 func (m *model) AddOrUpdateToolCall(agentName string, toolCall tools.ToolCall, toolDef tools.Tool, status types.ToolStatus) tea.Cmd {
 	// First check if this tool call exists in an active reasoning block
 	if block, blockIdx := m.getActiveReasoningBlock(agentName); block != nil {
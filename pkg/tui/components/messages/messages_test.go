@@ -454,6 +454,44 @@ func TestLoadFromSessionStandaloneToolCallsWithResults(t *testing.T) {
 	assert.Equal(t, types.ToolStatusCompleted, m.messages[0].ToolStatus)
 }
 
+func TestLoadFromSessionFailedToolCall(t *testing.T) {
+	t.Parallel()
+
+	sessionState := &service.SessionState{}
+	m := NewScrollableView(80, 24, sessionState).(*model)
+	m.SetSize(80, 24)
+
+	sess := &session.Session{
+		ID: "test-session",
+		Messages: []session.Item{
+			session.NewMessageItem(&session.Message{
+				AgentName: "root",
+				Message: chat.Message{
+					Role: chat.MessageRoleAssistant,
+					ToolCalls: []tools.ToolCall{
+						{ID: "call-1", Function: tools.FunctionCall{Name: "test_tool", Arguments: `{}`}},
+					},
+				},
+			}),
+			session.NewMessageItem(&session.Message{
+				AgentName: "root",
+				Message: chat.Message{
+					Role:       chat.MessageRoleTool,
+					ToolCallID: "call-1",
+					Content:    "permission denied",
+					IsError:    true,
+				},
+			}),
+		},
+	}
+
+	m.LoadFromSession(sess)
+
+	require.Len(t, m.messages, 1)
+	assert.Equal(t, "permission denied", m.messages[0].Content)
+	assert.Equal(t, types.ToolStatusError, m.messages[0].ToolStatus)
+}
+
 func TestLoadFromSessionToolCallsDuringReasoningNoContent(t *testing.T) {
 	t.Parallel()
 
@@ -1140,3 +1178,52 @@ func TestBindingsExcludesEditKeyWhenAssistantMessageSelected(t *testing.T) {
 	}
 	assert.False(t, foundE, "Bindings should NOT include 'e' key when assistant message is selected")
 }
+
+func TestJumpBetweenToolCalls(t *testing.T) {
+	t.Parallel()
+
+	sessionState := &service.SessionState{}
+	m := NewScrollableView(80, 5, sessionState).(*model)
+	m.SetSize(80, 5)
+
+	addAssistant := func() {
+		msg := types.Agent(types.MessageTypeAssistant, "root", strings.Repeat("line\n\n", 10))
+		m.messages = append(m.messages, msg)
+		m.views = append(m.views, m.createMessageView(msg))
+	}
+	addToolCall := func(id string) {
+		msg := types.ToolCallMessage("root", tools.ToolCall{
+			ID:       id,
+			Function: tools.FunctionCall{Name: "some_tool", Arguments: `{}`},
+		}, tools.Tool{Name: "some_tool"}, types.ToolStatusCompleted)
+		m.messages = append(m.messages, msg)
+		m.views = append(m.views, m.createToolCallView(msg))
+	}
+
+	addAssistant()
+	addToolCall("call-1")
+	addAssistant()
+	addToolCall("call-2")
+	addAssistant()
+	m.renderDirty = true
+
+	lines := m.toolCallStartLines()
+	require.Len(t, lines, 2)
+
+	next := tea.KeyPressMsg{Code: ']', Text: "]"}
+	prev := tea.KeyPressMsg{Code: '[', Text: "["}
+
+	m.Update(next)
+	assert.Equal(t, lines[0], m.scrollOffset)
+	assert.True(t, m.userHasScrolled)
+
+	m.Update(next)
+	assert.Equal(t, lines[1], m.scrollOffset)
+
+	m.Update(prev)
+	assert.Equal(t, lines[0], m.scrollOffset)
+
+	// Nothing before the first tool call.
+	m.Update(prev)
+	assert.Equal(t, lines[0], m.scrollOffset)
+}
@@ -98,6 +98,30 @@ func (m *appModel) handleBranchFromEdit(msg messages.BranchFromEditMsg) (tea.Mod
 	)
 }
 
+func (m *appModel) handleRewriteFromEdit(msg messages.RewriteFromEditMsg) (tea.Model, tea.Cmd) {
+	ctx := context.Background()
+
+	if err := m.application.RewriteUserMessage(ctx, msg.SessionPosition, msg.Content, msg.Attachments); err != nil {
+		return m, notification.ErrorCmd(fmt.Sprintf("Failed to rewrite message: %v", err))
+	}
+
+	// Preserve sidebar settings across the rebuild
+	sidebarSettings := m.chatPage.GetSidebarSettings()
+
+	// Rebuild all per-session components so the dropped messages disappear.
+	m.initSessionComponents(m.supervisor.ActiveID(), m.application, m.application.Session())
+	m.chatPage.SetSidebarSettings(sidebarSettings)
+
+	m.reapplyKeyboardEnhancements()
+
+	return m, tea.Sequence(
+		m.chatPage.Init(),
+		m.resizeAll(),
+		m.editor.Focus(),
+		core.CmdHandler(messages.RerunMsg{}),
+	)
+}
+
 func (m *appModel) handleToggleSessionStar(sessionID string) (tea.Model, tea.Cmd) {
 	store := m.application.SessionStore()
 	if store == nil {
@@ -174,8 +198,20 @@ func (m *appModel) handleCompactSession(additionalPrompt string) (tea.Model, tea
 	return m, m.chatPage.CompactSession(additionalPrompt)
 }
 
-func (m *appModel) handleCopySessionToClipboard() (tea.Model, tea.Cmd) {
-	transcript := m.application.PlainTextTranscript()
+func (m *appModel) handleCancelCompaction() (tea.Model, tea.Cmd) {
+	if !m.application.CancelCompaction() {
+		return m, notification.WarningCmd("No compaction in progress.")
+	}
+	return m, nil
+}
+
+func (m *appModel) handleCopySessionToClipboard(includeSystem bool) (tea.Model, tea.Cmd) {
+	var transcript string
+	if includeSystem {
+		transcript = m.application.PlainTextTranscriptWithSystem()
+	} else {
+		transcript = m.application.PlainTextTranscript()
+	}
 	if transcript == "" {
 		return m, notification.SuccessCmd("Conversation is empty; nothing copied.")
 	}
@@ -331,6 +367,35 @@ func (m *appModel) handleToggleSplitDiff() (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+func (m *appModel) handleToggleLegacyNewline() (tea.Model, tea.Cmd) {
+	m.legacyNewline = !m.legacyNewline
+	enabled := m.legacyNewline
+	for _, ed := range m.editors {
+		ed.SetLegacyNewline(enabled)
+	}
+
+	// Persist to global userconfig
+	go func() {
+		cfg, err := userconfig.Load()
+		if err != nil {
+			slog.Warn("Failed to load userconfig for newline key toggle", "error", err)
+			return
+		}
+		if cfg.Settings == nil {
+			cfg.Settings = &userconfig.Settings{}
+		}
+		cfg.Settings.LegacyNewlineKey = enabled
+		if err := cfg.Save(); err != nil {
+			slog.Warn("Failed to persist newline key setting to userconfig", "error", err)
+		}
+	}()
+
+	if enabled {
+		return m, notification.InfoCmd("Newlines are inserted with ctrl+j")
+	}
+	return m, notification.InfoCmd("Newlines are inserted with shift+enter or ctrl+j when the terminal supports it")
+}
+
 // --- Dialogs ---
 
 func (m *appModel) handleShowCostDialog() (tea.Model, tea.Cmd) {
@@ -5,6 +5,7 @@ type EditUserMessageMsg struct {
 	MsgIndex        int    // TUI message index (directly usable, no re-computation needed)
 	SessionPosition int    // Session position for branching
 	OriginalContent string // Original message content
+	InPlace         bool   // Rewrite the message in the current session instead of branching
 }
 
 // BranchFromEditMsg requests branching from a session position with new content.
@@ -15,6 +16,17 @@ type BranchFromEditMsg struct {
 	Attachments      []Attachment
 }
 
+// RewriteFromEditMsg requests replacing the user message at a session position
+// with new content, dropping everything after it, and running the session again.
+type RewriteFromEditMsg struct {
+	SessionPosition int
+	Content         string
+	Attachments     []Attachment
+}
+
+// RerunMsg requests running the current session again without a new user message.
+type RerunMsg struct{}
+
 // InvalidateStatusBarMsg signals that the statusbar cache should be invalidated.
 // This is emitted when bindings change (e.g., entering/exiting inline edit mode).
 type InvalidateStatusBarMsg struct{}
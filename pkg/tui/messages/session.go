@@ -38,8 +38,12 @@ type (
 	// CompactSessionMsg generates a summary and compacts session history.
 	CompactSessionMsg struct{ AdditionalPrompt string }
 
-	// CopySessionToClipboardMsg copies the entire conversation to clipboard.
-	CopySessionToClipboardMsg struct{}
+	// CancelCompactionMsg cancels the in-flight compaction, keeping the full history.
+	CancelCompactionMsg struct{}
+
+	// CopySessionToClipboardMsg copies the entire conversation to clipboard,
+	// with the system prompt and system messages when IncludeSystem is set.
+	CopySessionToClipboardMsg struct{ IncludeSystem bool }
 
 	// CopyLastResponseToClipboardMsg copies the last assistant response to clipboard.
 	CopyLastResponseToClipboardMsg struct{}
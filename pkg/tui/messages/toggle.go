@@ -17,6 +17,9 @@ type (
 	// ToggleHideToolResultsMsg toggles hiding of tool results.
 	ToggleHideToolResultsMsg struct{}
 
+	// ToggleLegacyNewlineMsg toggles the legacy ctrl+j newline key binding.
+	ToggleLegacyNewlineMsg struct{}
+
 	// ToggleSidebarMsg toggles sidebar visibility.
 	// The top-level model also handles this to persist the collapsed state.
 	ToggleSidebarMsg struct{}
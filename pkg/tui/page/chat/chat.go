@@ -154,6 +154,7 @@ type chatPage struct {
 
 	// Editing state for branching sessions
 	editing          bool
+	editInPlace      bool // Rewrite the current session instead of branching
 	branchAtPosition int
 	editAttachments  []msgtypes.Attachment // Preserved attachments from original message
 
@@ -385,6 +386,10 @@ func (p *chatPage) Update(msg tea.Msg) (layout.Model, tea.Cmd) {
 	case messages.InlineEditCancelledMsg:
 		return p.handleInlineEditCancelled(msg)
 
+	case msgtypes.RerunMsg:
+		cmd := p.processRerun()
+		return p, cmd
+
 	case msgtypes.SendMsg:
 		slog.Debug(msg.Content)
 		return p.handleSendMsg(msg)
@@ -660,6 +665,7 @@ func (p *chatPage) handleEditUserMessage(msg msgtypes.EditUserMessageMsg) (layou
 	}
 
 	p.editing = true
+	p.editInPlace = msg.InPlace
 	p.branchAtPosition = msg.SessionPosition
 
 	// Extract any attachments from the original session message
@@ -680,6 +686,8 @@ func (p *chatPage) handleInlineEditCommitted(msg messages.InlineEditCommittedMsg
 	}
 
 	p.editing = false
+	inPlace := p.editInPlace
+	p.editInPlace = false
 	branchPosition := p.branchAtPosition
 	p.branchAtPosition = 0
 	attachments := p.editAttachments
@@ -693,6 +701,14 @@ func (p *chatPage) handleInlineEditCommitted(msg messages.InlineEditCommittedMsg
 	p.messageQueue = nil
 	p.syncQueueToSidebar()
 
+	if inPlace {
+		return p, tea.Batch(cancelCmd, core.CmdHandler(msgtypes.RewriteFromEditMsg{
+			SessionPosition: branchPosition,
+			Content:         msg.Content,
+			Attachments:     attachments,
+		}))
+	}
+
 	parentID := ""
 	if sess := p.app.Session(); sess != nil {
 		parentID = sess.ID
@@ -711,6 +727,7 @@ func (p *chatPage) handleInlineEditCommitted(msg messages.InlineEditCommittedMsg
 // handleInlineEditCancelled handles cancellation of an inline edit.
 func (p *chatPage) handleInlineEditCancelled(msg messages.InlineEditCancelledMsg) (layout.Model, tea.Cmd) {
 	p.editing = false
+	p.editInPlace = false
 	p.branchAtPosition = 0
 	p.editAttachments = nil
 
@@ -724,8 +741,8 @@ func (p *chatPage) handleInlineEditCancelled(msg messages.InlineEditCancelledMsg
 }
 
 // extractAttachmentsFromSession extracts attachments from a session message at the given position.
-// Attachments are stored as text parts in MultiContent with format "Contents of <filename>: <dataURL>".
-// TODO(krisetto): meh we can store and retrieve attachments better in the session itself
+// Attachments recorded on the message are used when present. Older messages only have them as text
+// parts in MultiContent with format "Contents of <filename>: <dataURL>".
 func (p *chatPage) extractAttachmentsFromSession(position int) []msgtypes.Attachment {
 	sess := p.app.Session()
 	if sess == nil || position < 0 || position >= len(sess.Messages) {
@@ -737,6 +754,18 @@ func (p *chatPage) extractAttachmentsFromSession(position int) []msgtypes.Attach
 		return nil
 	}
 
+	if stored := item.Message.Attachments; len(stored) > 0 {
+		attachments := make([]msgtypes.Attachment, 0, len(stored))
+		for _, att := range stored {
+			attachments = append(attachments, msgtypes.Attachment{
+				Name:     att.Name,
+				FilePath: att.Path,
+				Content:  att.Content,
+			})
+		}
+		return attachments
+	}
+
 	msg := item.Message.Message
 	if len(msg.MultiContent) <= 1 {
 		// No attachments - only the main text content or nothing
@@ -873,6 +902,24 @@ func (p *chatPage) processMessage(msg msgtypes.SendMsg) tea.Cmd {
 	return tea.Batch(p.messages.ScrollToBottom(), spinnerCmd, loadingCmd)
 }
 
+// processRerun runs the current session again, e.g. after one of its user
+// messages was rewritten.
+func (p *chatPage) processRerun() tea.Cmd {
+	if p.msgCancel != nil {
+		p.msgCancel()
+	}
+
+	p.streamDepth = 0
+
+	var ctx context.Context
+	ctx, p.msgCancel = context.WithCancel(context.Background())
+
+	spinnerCmd := p.setWorking(true)
+	p.app.Rerun(ctx, p.msgCancel)
+
+	return tea.Batch(p.messages.ScrollToBottom(), spinnerCmd)
+}
+
 // CompactSession generates a summary and compacts the session history
 func (p *chatPage) CompactSession(additionalPrompt string) tea.Cmd {
 	// Cancel any active stream without showing cancellation message
@@ -29,6 +29,7 @@ import (
 //   - AgentChoiceEvent         → Append text to message
 //   - AgentChoiceReasoningEvent → Append reasoning block
 //   - UserMessageEvent         → Replace loading with user message
+//   - SummaryDeltaEvent        → Append text to the session summary
 //
 // Tool Events:
 //   - PartialToolCallEvent      → Show tool call in progress
@@ -43,6 +44,10 @@ import (
 //   - MaxIterationsReachedEvent → Show max iterations dialog
 //   - ElicitationRequestEvent   → Show elicitation/OAuth dialog
 
+// summarySender is the sender shown for the session summary streamed while the
+// session is compacted, which keeps it apart from the agents' messages.
+const summarySender = "summary"
+
 // handleRuntimeEvent processes runtime events and returns the appropriate command.
 // Returns (handled, cmd) where handled indicates if the event was processed.
 //
@@ -72,7 +77,7 @@ func (p *chatPage) handleRuntimeEvent(msg tea.Msg) (bool, tea.Cmd) {
 
 	// ===== Content Events =====
 	case *runtime.UserMessageEvent:
-		return true, p.messages.ReplaceLoadingWithUser(msg.Message, msg.SessionPosition)
+		return true, p.messages.ReplaceLoadingWithUser(msg.Message, types.ImageURLs(msg.MultiContent), msg.SessionPosition)
 
 	case *runtime.AgentChoiceEvent:
 		return true, p.handleAgentChoice(msg)
@@ -122,6 +127,10 @@ func (p *chatPage) handleRuntimeEvent(msg tea.Msg) (bool, tea.Cmd) {
 	case *runtime.SessionTitleEvent:
 		return true, p.forwardToSidebar(msg)
 
+	case *runtime.SummaryDeltaEvent:
+		p.setPendingResponse(false)
+		return true, p.messages.AppendToLastMessage(summarySender, msg.Delta)
+
 	case *runtime.SessionCompactionEvent:
 		if msg.Status == "completed" {
 			return true, tea.Batch(
@@ -131,6 +140,13 @@ func (p *chatPage) handleRuntimeEvent(msg tea.Msg) (bool, tea.Cmd) {
 				p.messages.ScrollToBottom(),
 			)
 		}
+		if msg.Status == "cancelled" {
+			return true, tea.Batch(
+				p.setWorking(false),
+				p.setPendingResponse(false),
+				notification.InfoCmd("Compaction cancelled, the full conversation is kept."),
+			)
+		}
 		return true, nil
 
 	// ===== RAG Indexing Events (forwarded to sidebar) =====
@@ -65,6 +65,10 @@ type appModel struct {
 	supervisor *supervisor.Supervisor
 	tabBar     *tabbar.TabBar
 	tuiStore   *tuistate.Store
+	maxTabs    int // Maximum number of open tabs, zero for no limit
+
+	// legacyNewline forces ctrl+j as the newline key of every editor
+	legacyNewline bool
 
 	// Per-session chat pages (kept alive for streaming continuity)
 	chatPages     map[string]chat.Page
@@ -151,8 +155,8 @@ func New(ctx context.Context, spawner SessionSpawner, initialApp *app.App, initi
 	sv := supervisor.New(spawner)
 
 	// Initialize tab bar with configurable title length from user settings
-	tabTitleMaxLen := userconfig.Get().GetTabTitleMaxLength()
-	tb := tabbar.New(tabTitleMaxLen)
+	settings := userconfig.Get()
+	tb := tabbar.New(settings.GetTabTitleMaxLength())
 
 	// Initialize tab store
 	var ts *tuistate.Store
@@ -177,6 +181,8 @@ func New(ctx context.Context, spawner SessionSpawner, initialApp *app.App, initi
 		supervisor:              sv,
 		tabBar:                  tb,
 		tuiStore:                ts,
+		maxTabs:                 settings.GetMaxTabs(),
+		legacyNewline:           settings.LegacyNewlineKey,
 		chatPages:               map[string]chat.Page{sessID: initialChatPage},
 		sessionStates:           map[string]*service.SessionState{sessID: initialSessionState},
 		editors:                 map[string]editor.Editor{sessID: initialEditor},
@@ -346,6 +352,10 @@ func (m *appModel) restoreTabs(
 			restoredFirst = true
 			runtimeID = initialTabID
 		} else {
+			if m.tabLimitReached() {
+				slog.Info("Not restoring more tabs, the maximum number of tabs is open", "max_tabs", m.maxTabs)
+				break
+			}
 			a, newSess, spawnCleanup, err := spawner(ctx, saved.WorkingDir)
 			if err != nil {
 				slog.Warn("Failed to restore tab", "working_dir", saved.WorkingDir, "error", err)
@@ -708,6 +718,9 @@ func (m *appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case messages.BranchFromEditMsg:
 		return m.handleBranchFromEdit(msg)
 
+	case messages.RewriteFromEditMsg:
+		return m.handleRewriteFromEdit(msg)
+
 	// --- Session commands (slash commands, command palette) ---
 
 	case messages.ToggleYoloMsg:
@@ -725,6 +738,9 @@ func (m *appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case messages.ToggleSplitDiffMsg:
 		return m.handleToggleSplitDiff()
 
+	case messages.ToggleLegacyNewlineMsg:
+		return m.handleToggleLegacyNewline()
+
 	case messages.ClearQueueMsg:
 		updated, cmd := m.chatPage.Update(msg)
 		m.chatPage = updated.(chat.Page)
@@ -733,8 +749,11 @@ func (m *appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case messages.CompactSessionMsg:
 		return m.handleCompactSession(msg.AdditionalPrompt)
 
+	case messages.CancelCompactionMsg:
+		return m.handleCancelCompaction()
+
 	case messages.CopySessionToClipboardMsg:
-		return m.handleCopySessionToClipboard()
+		return m.handleCopySessionToClipboard(msg.IncludeSystem)
 
 	case messages.CopyLastResponseToClipboardMsg:
 		return m.handleCopyLastResponseToClipboard()
@@ -1006,6 +1025,10 @@ func (m *appModel) handleLoadSession(sessionID string) (tea.Model, tea.Cmd) {
 
 	slog.Debug("Loading session into new tab", "session_id", sessionID)
 
+	if cmd := m.tabLimitCmd(); cmd != nil {
+		return m, cmd
+	}
+
 	// Spawn a new tab.
 	newSessionID, err := m.supervisor.SpawnSession(ctx, workingDir)
 	if err != nil {
@@ -1085,8 +1108,26 @@ func (m *appModel) replaceActiveSession(ctx context.Context, sess *session.Sessi
 	return m, cmd
 }
 
+// tabLimitReached reports whether the maximum number of tabs is open.
+func (m *appModel) tabLimitReached() bool {
+	return m.maxTabs > 0 && m.supervisor.Count() >= m.maxTabs
+}
+
+// tabLimitCmd returns a notification refusing to open a new tab when the
+// maximum number of tabs is open, or nil when a tab can be opened.
+func (m *appModel) tabLimitCmd() tea.Cmd {
+	if !m.tabLimitReached() {
+		return nil
+	}
+	return notification.WarningCmd(fmt.Sprintf("Can't open more than %d tabs, close one first", m.maxTabs))
+}
+
 // handleSpawnSession spawns a new session.
 func (m *appModel) handleSpawnSession(workingDir string) (tea.Model, tea.Cmd) {
+	if cmd := m.tabLimitCmd(); cmd != nil {
+		return m, cmd
+	}
+
 	// If no working dir specified, open the picker
 	if workingDir == "" {
 		return m.openWorkingDirPicker()
@@ -3,6 +3,7 @@ package types
 import (
 	"strings"
 
+	"github.com/docker/cagent/pkg/chat"
 	"github.com/docker/cagent/pkg/tools"
 )
 
@@ -48,6 +49,19 @@ type Message struct {
 	// SessionPosition is the index of this message in session.Messages (when known).
 	// Used for operations like branching on edits.
 	SessionPosition *int
+	// Images holds the URLs of the images attached to a user message.
+	Images []string
+}
+
+// ImageURLs returns the URLs of the image parts of a message.
+func ImageURLs(parts []chat.MessagePart) []string {
+	var urls []string
+	for _, part := range parts {
+		if part.Type == chat.MessagePartTypeImageURL && part.ImageURL != nil && part.ImageURL.URL != "" {
+			urls = append(urls, part.ImageURL.URL)
+		}
+	}
+	return urls
 }
 
 func Agent(typ MessageType, agentName, content string) *Message {
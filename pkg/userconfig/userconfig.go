@@ -55,6 +55,13 @@ type Settings struct {
 	// RestoreTabs restores previously open tabs when launching the TUI.
 	// Defaults to false when not set (user must explicitly opt-in).
 	RestoreTabs *bool `yaml:"restore_tabs,omitempty"`
+	// MaxTabs is the maximum number of tabs open at once in the TUI. Each tab
+	// keeps its whole session in memory. Zero, the default, means no limit.
+	MaxTabs int `yaml:"max_tabs,omitempty"`
+	// LegacyNewlineKey makes ctrl+j the only key inserting a newline in the
+	// editor, for terminals that report keyboard enhancements but don't
+	// deliver shift+enter.
+	LegacyNewlineKey bool `yaml:"legacy_newline_key,omitempty"`
 }
 
 // DefaultTabTitleMaxLength is the default maximum tab title length when not configured.
@@ -68,6 +75,14 @@ func (s *Settings) GetTabTitleMaxLength() int {
 	return s.TabTitleMaxLength
 }
 
+// GetMaxTabs returns the configured maximum number of tabs, or zero for no limit.
+func (s *Settings) GetMaxTabs() int {
+	if s == nil || s.MaxTabs < 0 {
+		return 0
+	}
+	return s.MaxTabs
+}
+
 // GetSplitDiffView returns whether split diff view is enabled, defaulting to true.
 func (s *Settings) GetSplitDiffView() bool {
 	if s == nil || s.SplitDiffView == nil {
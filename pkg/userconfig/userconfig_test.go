@@ -838,3 +838,25 @@ func TestSettings_RestoreTabs(t *testing.T) {
 		})
 	}
 }
+
+func TestSettings_GetMaxTabs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		settings *Settings
+		expected int
+	}{
+		{"nil settings", nil, 0},
+		{"not set", &Settings{}, 0},
+		{"negative", &Settings{MaxTabs: -1}, 0},
+		{"set", &Settings{MaxTabs: 5}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.expected, tt.settings.GetMaxTabs())
+		})
+	}
+}